@@ -0,0 +1,8 @@
+package api
+
+import _ "embed"
+
+// GraphQL schema of the API (embedded so binaries don't depend on the working directory)
+//
+//go:embed schema.graphql
+var Schema string
@@ -2,86 +2,137 @@ package main
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"log"
 	"os"
+	"time"
 
+	"github.com/mcwiet/go-test/api"
 	"github.com/mcwiet/go-test/pkg/authorization"
 	"github.com/mcwiet/go-test/pkg/controller"
 	"github.com/mcwiet/go-test/pkg/data"
 	"github.com/mcwiet/go-test/pkg/encoding"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
 	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/mcwiet/go-test/pkg/tracing"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-xray-sdk-go/strategy/ctxmissing"
+	"github.com/aws/aws-xray-sdk-go/xray"
 )
 
 var (
-	petController  controller.PetController
-	userController controller.UserController
+	registry controller.ResolverRegistry
+	recorder metrics.Recorder
 )
 
+// Time left to return a response after downstream calls are stopped, so the Lambda isn't killed mid-flight
+const deadlineMargin = 500 * time.Millisecond
+
 func init() {
 	session := session.Must(session.NewSession())
 	ddbClient := dynamodb.New(session)
 	cognitoClient := cognitoidentityprovider.New(session)
+	s3Client := s3.New(session)
+
+	// Tracing (a call made outside of an invocation is logged rather than panicking)
+	xray.Configure(xray.Config{ContextMissingStrategy: ctxmissing.NewDefaultLogErrorStrategy()})
+	xray.AWS(ddbClient.Client)
+	xray.AWS(cognitoClient.Client)
+	// S3 isn't instrumented: most of its requests are presigned rather than sent, which would leave X-Ray subsegments
+	// open (listing photos is still traced as a service step)
+
 	cursorEncoder := encoding.NewCursorEncoder()
 
+	// Metrics (written to stdout in the Embedded Metric Format)
+	recorder = metrics.NewRecorder(os.Stdout, metrics.Namespace, metrics.Dimensions{"Environment": os.Getenv("ENV_NAME")})
+
 	// Authorization
-	petAuth := authorization.NewPetAuthorizer()
+	policyEngine := authorization.NewPolicyEngine()
+	petAuth := authorization.NewPetAuthorizer(&policyEngine)
+	visibility := authorization.NewFieldVisibility(&policyEngine)
+	auditAuth := authorization.NewAuditAuthorizer(&policyEngine)
 
 	// Data
 	primaryTableName := os.Getenv("DDB_PRIMARY_TABLE_NAME")
 	petDao := data.NewPetDao(ddbClient, primaryTableName)
+	transferDao := data.NewPetTransferDao(ddbClient, primaryTableName)
+	auditDao := data.NewAuditDao(ddbClient, primaryTableName)
 	userPoolId := os.Getenv("USER_POOL_ID")
 	userDao := data.NewUserDao(cognitoClient, userPoolId)
+	photoBucketName := os.Getenv("PHOTO_BUCKET_NAME")
+	photoDao := data.NewPhotoDao(s3Client, photoBucketName)
 
 	// Service
-	petService := service.NewPetService(&petDao, &userDao, &petAuth, &cursorEncoder)
+	petService := service.NewPetService(&petDao, &photoDao, &userDao, &petAuth, &cursorEncoder)
 	userService := service.NewUserService(&userDao, &cursorEncoder)
+	photoService := service.NewPhotoService(&petDao, &photoDao, &petAuth)
+	transferService := service.NewPetTransferService(&petDao, &transferDao, &userDao, &petAuth)
+	auditService := service.NewAuditService(&auditDao, &auditAuth, &cursorEncoder)
 
 	// Controller
-	petController = controller.NewPetController(&petService)
-	userController = controller.NewUserController(&userService)
+	petController := controller.NewPetController(&petService, &visibility)
+	userController := controller.NewUserController(&userService, &visibility)
+	photoController := controller.NewPhotoController(&photoService)
+	transferController := controller.NewPetTransferController(&transferService, &visibility)
+	auditController := controller.NewAuditController(&auditService)
+
+	// Resolvers
+	registry = controller.NewResolverRegistry()
+	petController.RegisterResolvers(&registry)
+	userController.RegisterResolvers(&registry)
+	photoController.RegisterResolvers(&registry)
+	transferController.RegisterResolvers(&registry)
+	auditController.RegisterResolvers(&registry)
+	// Every mutation is recorded in the audit log
+	registry.SetAuditor(&auditService)
+	if err := registry.Validate(api.Schema); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	ctx, cancel := withDeadlineMargin(ctx)
+	defer cancel()
+	ctx = withRequestLogger(ctx)
+	ctx = metrics.NewContext(ctx, recorder)
+	ctx = tracing.NewContext(ctx, tracing.NewXRayTracer())
+
+	if IsBatch(payload) {
+		requests := NewBatchRequests(payload)
+		responses := registry.HandleBatch(ctx, requests)
+		return NewBatchResults(responses), nil
+	}
+
+	request := NewRequest(payload)
+	response := registry.Handle(ctx, request)
+
+	return NewResult(response), nil
 }
 
-func handle(ctx context.Context, req interface{}) (interface{}, error) {
-	request := NewRequest(req)
-	log.Println(request.ParentTypeName + " " + request.FieldName)
-
-	var response controller.Response
-	switch request.ParentTypeName {
-	case "Query":
-		switch request.FieldName {
-		case "pet":
-			response = petController.HandleGet(request)
-		case "pets":
-			response = petController.HandleList(request)
-		case "user":
-			response = userController.HandleGet(request)
-		case "users":
-			response = userController.HandleList(request)
-		default:
-			response = controller.Response{Error: errors.New("query not recognized")}
-		}
-	case "Mutation":
-		switch request.FieldName {
-		case "createPet":
-			response = petController.HandleCreate(request)
-		case "deletePet":
-			response = petController.HandleDelete(request)
-		case "updatePetOwner":
-			response = petController.HandleUpdateOwner(request)
-		default:
-			response = controller.Response{Error: errors.New("mutation not recognized")}
-		}
-	default:
-		response = controller.Response{Error: errors.New("request type not recognized")}
+// Stops downstream calls shortly before the Lambda deadline (the timeout set on the function)
+func withDeadlineMargin(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
 	}
+	return context.WithDeadline(ctx, deadline.Add(-deadlineMargin))
+}
 
-	return response.Data, response.Error
+// Tags every line logged during the invocation with the AWS request ID
+func withRequestLogger(ctx context.Context) context.Context {
+	requestId := ""
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		requestId = lambdaContext.AwsRequestID
+	}
+	logger := logging.NewLogger(os.Stdout).With(logging.Fields{"requestId": requestId})
+	return logging.NewContext(ctx, logger)
 }
 
 func main() {
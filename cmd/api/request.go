@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/mcwiet/go-test/pkg/controller"
@@ -9,6 +10,7 @@ import (
 
 type AppSyncRequest struct {
 	Arguments map[string]interface{} `json:"arguments"`
+	Source    map[string]interface{} `json:"source"`
 	Info      struct {
 		FieldName      string `json:"fieldName"`
 		ParentTypeName string `json:"parentTypeName"`
@@ -28,6 +30,7 @@ func NewRequest(req interface{}) controller.Request {
 	groups := convertToSet(appsync.Identity.Claims.Groups)
 	return controller.Request{
 		Arguments:      appsync.Arguments,
+		Source:         appsync.Source,
 		FieldName:      appsync.Info.FieldName,
 		ParentTypeName: appsync.Info.ParentTypeName,
 		Identity: model.Identity{
@@ -38,6 +41,24 @@ func NewRequest(req interface{}) controller.Request {
 	}
 }
 
+// Takes the payload of a batch invocation (a list of AppSync requests) and converts each item into a standardized request
+func NewBatchRequests(payload json.RawMessage) []controller.Request {
+	var items []json.RawMessage
+	json.Unmarshal(payload, &items)
+
+	requests := []controller.Request{}
+	for _, item := range items {
+		requests = append(requests, NewRequest(item))
+	}
+	return requests
+}
+
+// Checks whether a payload is a batch invocation (AppSync sends a list of requests when batching is enabled)
+func IsBatch(payload json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(payload)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
 func newAppSyncRequest(req interface{}) AppSyncRequest {
 	var appsync AppSyncRequest
 	reqBytes, _ := json.Marshal(req)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/controller"
+)
+
+// Result of a request; AppSync turns errorMessage / errorType / errorInfo into a GraphQL error
+type Result struct {
+	Data         interface{}            `json:"data"`
+	ErrorMessage string                 `json:"errorMessage,omitempty"`
+	ErrorType    string                 `json:"errorType,omitempty"`
+	ErrorInfo    map[string]interface{} `json:"errorInfo,omitempty"`
+}
+
+// Converts a controller response into a result; the error type is the app error code so clients can branch on it
+func NewResult(response controller.Response) Result {
+	if response.Error == nil {
+		return Result{Data: response.Data}
+	}
+	return Result{
+		ErrorMessage: response.Error.Error(),
+		ErrorType:    string(apperror.CodeOf(response.Error)),
+		ErrorInfo:    apperror.InfoOf(response.Error),
+	}
+}
+
+// Converts controller responses into batch results (index aligned with the responses)
+func NewBatchResults(responses []controller.Response) []Result {
+	results := []Result{}
+	for _, response := range responses {
+		results = append(results, NewResult(response))
+	}
+	return results
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/api"
+	"github.com/mcwiet/go-test/pkg/controller"
 	"github.com/mcwiet/go-test/pkg/infra"
 )
 
@@ -18,6 +20,22 @@ func main() {
 
 	stackNamePrefix := "go-" + env
 
+	// Resolvers (handlers aren't invoked while synthesizing, so the controllers don't need services)
+	registry := controller.NewResolverRegistry()
+	petController := controller.NewPetController(nil, nil)
+	petController.RegisterResolvers(&registry)
+	userController := controller.NewUserController(nil, nil)
+	userController.RegisterResolvers(&registry)
+	photoController := controller.NewPhotoController(nil)
+	photoController.RegisterResolvers(&registry)
+	transferController := controller.NewPetTransferController(nil, nil)
+	transferController.RegisterResolvers(&registry)
+	auditController := controller.NewAuditController(nil)
+	auditController.RegisterResolvers(&registry)
+	if err := registry.Validate(api.Schema); err != nil {
+		panic(err)
+	}
+
 	// Auth
 	authStackName := stackNamePrefix + "-auth"
 	authStack := infra.NewAuthStack(app, authStackName, &infra.AuthStackProps{
@@ -35,7 +53,8 @@ func main() {
 			StackName: &apiStackName,
 			Env:       newCdkEnvironment(),
 		},
-		EnvName: env,
+		EnvName:   env,
+		Resolvers: registry.Resolvers(),
 	})
 
 	// Define dependencies (from parameters)
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/model"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// Resolves fields which have a registered handler
+type Resolvers interface {
+	Handle(context.Context, controller.Request) controller.Response
+	HandleBatch(context.Context, []controller.Request) []controller.Response
+	IsRegistered(typeName string, fieldName string) bool
+}
+
+// Object containing information needed to execute GraphQL operations
+type Executor struct {
+	schema    *ast.Schema
+	resolvers Resolvers
+}
+
+// Standard GraphQL request body
+type GraphQlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Standard GraphQL response body (errors are shaped like AppSync errors)
+type GraphQlResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQlError `json:"errors,omitempty"`
+}
+
+type GraphQlError struct {
+	Message   string                 `json:"message"`
+	ErrorType string                 `json:"errorType,omitempty"`
+	ErrorInfo map[string]interface{} `json:"errorInfo,omitempty"`
+	Path      []interface{}          `json:"path,omitempty"`
+}
+
+// Creates an executor which sends every root field, and every nested field with a handler, to the resolvers
+func NewExecutor(schema *ast.Schema, resolvers Resolvers) Executor {
+	return Executor{
+		schema:    schema,
+		resolvers: resolvers,
+	}
+}
+
+// Executes a GraphQL request on behalf of an identity
+func (e *Executor) Execute(ctx context.Context, identity model.Identity, req GraphQlRequest) GraphQlResponse {
+	doc, errs := gqlparser.LoadQuery(e.schema, req.Query)
+	if errs != nil {
+		return GraphQlResponse{Errors: convertGqlErrors(errs)}
+	}
+
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return GraphQlResponse{Errors: []GraphQlError{{Message: "operation not found", ErrorType: "BadRequestException"}}}
+	}
+
+	vars, err := validator.VariableValues(e.schema, op, req.Variables)
+	if err != nil {
+		return GraphQlResponse{Errors: convertGqlErrors(gqlerror.List{err.(*gqlerror.Error)})}
+	}
+
+	var root *ast.Definition
+	switch op.Operation {
+	case ast.Query:
+		root = e.schema.Query
+	case ast.Mutation:
+		root = e.schema.Mutation
+	default:
+		return GraphQlResponse{Errors: []GraphQlError{{Message: "only queries and mutations are supported", ErrorType: "BadRequestException"}}}
+	}
+
+	execution := execution{
+		ctx:      ctx,
+		executor: e,
+		identity: identity,
+		vars:     vars,
+	}
+	data, ok := execution.resolveRoot(root, op.SelectionSet)
+	if !ok {
+		return GraphQlResponse{Data: nil, Errors: execution.errors}
+	}
+	execution.resolvePending()
+
+	return GraphQlResponse{Data: data, Errors: execution.errors}
+}
+
+// State of a single operation being executed
+type execution struct {
+	ctx      context.Context
+	executor *Executor
+	identity model.Identity
+	vars     map[string]interface{}
+	errors   []GraphQlError
+	pending  []pendingField
+}
+
+// Nested field waiting to be resolved by its handler
+type pendingField struct {
+	parent     *object
+	definition *ast.Definition
+	field      *ast.Field
+	source     map[string]interface{}
+	path       []interface{}
+}
+
+// Resolves every root field through the resolve function
+func (x *execution) resolveRoot(root *ast.Definition, selectionSet ast.SelectionSet) (interface{}, bool) {
+	result := newObject()
+	for _, field := range x.collectFields(root, selectionSet) {
+		path := []interface{}{field.Alias}
+		if field.Name == "__typename" {
+			result.set(field.Alias, root.Name)
+			continue
+		}
+
+		response := x.executor.resolvers.Handle(x.ctx, x.newRequest(root, field, nil))
+		if response.Error != nil {
+			x.addResolverError(response.Error, path)
+			if field.Definition.Type.NonNull {
+				return nil, false
+			}
+			result.set(field.Alias, nil)
+			continue
+		}
+
+		value, ok := x.completeValue(field.Definition.Type, field.SelectionSet, normalize(response.Data), path)
+		if !ok {
+			return nil, false
+		}
+		result.set(field.Alias, value)
+	}
+	return result, true
+}
+
+// Resolves nested fields in rounds, like AppSync batching, so every edge of the same field goes out in one batch
+//
+// Nested fields are filled in after their parent object is built, so an error on a non-null nested field leaves
+// null in place rather than propagating to the parent
+func (x *execution) resolvePending() {
+	for len(x.pending) > 0 {
+		round := x.pending
+		x.pending = nil
+
+		requests := []controller.Request{}
+		for _, pending := range round {
+			requests = append(requests, x.newRequest(pending.definition, pending.field, pending.source))
+		}
+		responses := x.executor.resolvers.HandleBatch(x.ctx, requests)
+
+		for i, pending := range round {
+			if responses[i].Error != nil {
+				x.addResolverError(responses[i].Error, pending.path)
+				continue
+			}
+			value, ok := x.completeValue(pending.field.Definition.Type, pending.field.SelectionSet, normalize(responses[i].Data), pending.path)
+			if ok {
+				pending.parent.set(pending.field.Alias, value)
+			}
+		}
+	}
+}
+
+func (x *execution) newRequest(definition *ast.Definition, field *ast.Field, source map[string]interface{}) controller.Request {
+	return controller.Request{
+		Arguments:      normalize(field.ArgumentMap(x.vars)).(map[string]interface{}),
+		FieldName:      field.Name,
+		ParentTypeName: definition.Name,
+		Identity:       x.identity,
+		Source:         source,
+	}
+}
+
+// Shapes a resolved value to match the selection set; returns false if a null must propagate to the parent
+func (x *execution) completeValue(fieldType *ast.Type, selectionSet ast.SelectionSet, value interface{}, path []interface{}) (interface{}, bool) {
+	if value == nil {
+		if fieldType.NonNull {
+			x.addError("cannot return null for non-nullable type "+fieldType.String(), path)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if fieldType.Elem != nil {
+		items, isList := value.([]interface{})
+		if !isList {
+			x.addError("expected a list for type "+fieldType.String(), path)
+			return nullable(fieldType)
+		}
+		completed := make([]interface{}, len(items))
+		for i, item := range items {
+			value, ok := x.completeValue(fieldType.Elem, selectionSet, item, appendPath(path, i))
+			if !ok {
+				return nullable(fieldType)
+			}
+			completed[i] = value
+		}
+		return completed, true
+	}
+
+	definition := x.executor.schema.Types[fieldType.NamedType]
+	if definition.Kind != ast.Object {
+		return value, true
+	}
+
+	source, isObject := value.(map[string]interface{})
+	if !isObject {
+		x.addError("expected an object for type "+fieldType.String(), path)
+		return nullable(fieldType)
+	}
+	result := newObject()
+	for _, field := range x.collectFields(definition, selectionSet) {
+		if field.Name == "__typename" {
+			result.set(field.Alias, definition.Name)
+			continue
+		}
+		if x.executor.resolvers.IsRegistered(definition.Name, field.Name) {
+			result.set(field.Alias, nil)
+			x.pending = append(x.pending, pendingField{
+				parent:     result,
+				definition: definition,
+				field:      field,
+				source:     source,
+				path:       appendPath(path, field.Alias),
+			})
+			continue
+		}
+		value, ok := x.completeValue(field.Definition.Type, field.SelectionSet, source[field.Name], appendPath(path, field.Alias))
+		if !ok {
+			return nullable(fieldType)
+		}
+		result.set(field.Alias, value)
+	}
+	return result, true
+}
+
+// Flattens fragments and applies @skip / @include to get the fields selected on a type
+func (x *execution) collectFields(definition *ast.Definition, selectionSet ast.SelectionSet) []*ast.Field {
+	fields := []*ast.Field{}
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if x.shouldInclude(selection.Directives) {
+				fields = append(fields, selection)
+			}
+		case *ast.InlineFragment:
+			if x.shouldInclude(selection.Directives) && (selection.TypeCondition == "" || selection.TypeCondition == definition.Name) {
+				fields = append(fields, x.collectFields(definition, selection.SelectionSet)...)
+			}
+		case *ast.FragmentSpread:
+			if x.shouldInclude(selection.Directives) && selection.Definition.TypeCondition == definition.Name {
+				fields = append(fields, x.collectFields(definition, selection.Definition.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+func (x *execution) shouldInclude(directives ast.DirectiveList) bool {
+	if skip := directives.ForName("skip"); skip != nil && skip.ArgumentMap(x.vars)["if"] == true {
+		return false
+	}
+	if include := directives.ForName("include"); include != nil && include.ArgumentMap(x.vars)["if"] == false {
+		return false
+	}
+	return true
+}
+
+func (x *execution) addError(message string, path []interface{}) {
+	x.errors = append(x.errors, GraphQlError{Message: message, Path: path})
+}
+
+// Adds an error returned by a resolver, typed the same way as the API Lambda types it
+func (x *execution) addResolverError(err error, path []interface{}) {
+	x.errors = append(x.errors, GraphQlError{
+		Message:   err.Error(),
+		ErrorType: string(apperror.CodeOf(err)),
+		ErrorInfo: apperror.InfoOf(err),
+		Path:      path,
+	})
+}
+
+// Result of a null value for a type; non-null types propagate the null to their parent
+func nullable(fieldType *ast.Type) (interface{}, bool) {
+	return nil, !fieldType.NonNull
+}
+
+// Copies a path before appending to it so sibling fields don't share backing arrays
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), element)
+}
+
+// Round trip a value through JSON so it has the same shape as AppSync arguments / Lambda results
+func normalize(value interface{}) interface{} {
+	var normalized interface{}
+	valueBytes, _ := json.Marshal(value)
+	json.Unmarshal(valueBytes, &normalized)
+	return normalized
+}
+
+func convertGqlErrors(errs gqlerror.List) []GraphQlError {
+	converted := []GraphQlError{}
+	for _, err := range errs {
+		converted = append(converted, GraphQlError{
+			Message:   err.Message,
+			ErrorType: "GraphQLError",
+		})
+	}
+	return converted
+}
+
+// JSON object which keeps fields in the order they were selected
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *object {
+	return &object{values: map[string]interface{}{}}
+}
+
+func (o *object) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		keyBytes, _ := json.Marshal(key)
+		valueBytes, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(keyBytes)
+		buffer.WriteByte(':')
+		buffer.Write(valueBytes)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/mcwiet/go-test/api"
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/data/memory"
+	"github.com/mcwiet/go-test/pkg/encoding"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var (
+	registry      controller.ResolverRegistry
+	localUserDao  *memory.UserDao  // only set when using in-memory data
+	localPhotoDao *memory.PhotoDao // only set when using in-memory data
+)
+
+// Path photos are served from when using in-memory data
+const photosPath = "/photos/"
+
+// Wires up the controllers using either in-memory ('memory') or AWS-backed ('aws') data access objects; in-memory photos
+// are served by this server at baseUrl
+func setup(dataSource string, baseUrl string) error {
+	cursorEncoder := encoding.NewCursorEncoder()
+
+	// Authorization
+	policyEngine := authorization.NewPolicyEngine()
+	petAuth := authorization.NewPetAuthorizer(&policyEngine)
+	visibility := authorization.NewFieldVisibility(&policyEngine)
+	auditAuth := authorization.NewAuditAuthorizer(&policyEngine)
+
+	// Data
+	var petDao service.PetDao
+	var userDao service.UserDao
+	var photoDao service.PhotoDao
+	var transferDao service.PetTransferDao
+	var auditDao service.AuditDao
+	switch dataSource {
+	case "memory":
+		memoryPetDao := memory.NewPetDao()
+		memoryUserDao := memory.NewUserDao()
+		memoryPhotoDao := memory.NewPhotoDao(baseUrl + photosPath)
+		memoryTransferDao := memory.NewPetTransferDao()
+		memoryAuditDao := memory.NewAuditDao()
+		petDao, userDao, localUserDao = &memoryPetDao, &memoryUserDao, &memoryUserDao
+		photoDao, localPhotoDao = &memoryPhotoDao, &memoryPhotoDao
+		transferDao, auditDao = &memoryTransferDao, &memoryAuditDao
+	case "aws":
+		session := session.Must(session.NewSession())
+		primaryTableName := os.Getenv("DDB_PRIMARY_TABLE_NAME")
+		ddbClient := dynamodb.New(session)
+		ddbPetDao := data.NewPetDao(ddbClient, primaryTableName)
+		ddbTransferDao := data.NewPetTransferDao(ddbClient, primaryTableName)
+		ddbAuditDao := data.NewAuditDao(ddbClient, primaryTableName)
+		userPoolId := os.Getenv("USER_POOL_ID")
+		cognitoUserDao := data.NewUserDao(cognitoidentityprovider.New(session), userPoolId)
+		photoBucketName := os.Getenv("PHOTO_BUCKET_NAME")
+		s3PhotoDao := data.NewPhotoDao(s3.New(session), photoBucketName)
+		petDao, userDao, photoDao, transferDao = &ddbPetDao, &cognitoUserDao, &s3PhotoDao, &ddbTransferDao
+		auditDao = &ddbAuditDao
+	default:
+		return errors.New("data source must be 'memory' or 'aws'")
+	}
+
+	// Service
+	petService := service.NewPetService(petDao, photoDao, userDao, &petAuth, &cursorEncoder)
+	userService := service.NewUserService(userDao, &cursorEncoder)
+	photoService := service.NewPhotoService(petDao, photoDao, &petAuth)
+	transferService := service.NewPetTransferService(petDao, transferDao, userDao, &petAuth)
+	auditService := service.NewAuditService(auditDao, &auditAuth, &cursorEncoder)
+
+	// Controller
+	petController := controller.NewPetController(&petService, &visibility)
+	userController := controller.NewUserController(&userService, &visibility)
+	photoController := controller.NewPhotoController(&photoService)
+	transferController := controller.NewPetTransferController(&transferService, &visibility)
+	auditController := controller.NewAuditController(&auditService)
+
+	// Resolvers
+	registry = controller.NewResolverRegistry()
+	petController.RegisterResolvers(&registry)
+	userController.RegisterResolvers(&registry)
+	photoController.RegisterResolvers(&registry)
+	transferController.RegisterResolvers(&registry)
+	auditController.RegisterResolvers(&registry)
+	registry.SetAuditor(&auditService)
+
+	return registry.Validate(api.Schema)
+}
+
+// Makes sure callers exist in the in-memory user pool (an ID token implies a Cognito user exists)
+func registerCaller(identity model.Identity) {
+	if localUserDao != nil {
+		localUserDao.Put(model.User{Username: identity.Username, Email: identity.Email})
+	}
+}
+
+// Gets the URL the server can be reached at on this machine from the address it listens on (e.g. 'http://[::1]:8080'),
+// using localhost when it listens on every interface
+func baseUrlOf(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address the GraphQL server listens on")
+	dataSource := flag.String("data", "memory", "where data is stored: 'memory' (offline) or 'aws' (DynamoDB and Cognito)")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	baseUrl := baseUrlOf(listener.Addr())
+
+	if err := setup(*dataSource, baseUrl); err != nil {
+		log.Fatal(err)
+	}
+
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: api.Schema})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	executor := NewExecutor(schema, &registry)
+	http.Handle("/graphql", NewServer(executor, registerCaller))
+	if localPhotoDao != nil {
+		http.Handle(photosPath, http.StripPrefix(photosPath, NewPhotoServer(localPhotoDao)))
+	}
+
+	log.Println("Serving GraphQL API (" + *dataSource + " data) at " + baseUrl + "/graphql")
+	log.Fatal(http.Serve(listener, nil))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mcwiet/go-test/pkg/data/memory"
+)
+
+// Largest photo the server accepts
+const maxPhotoBytes = 10 << 20
+
+// HTTP handler standing in for the S3 bucket when using in-memory data; the photo key is the request path, and photos
+// must be uploaded as an image with their length given up front (as S3 checks the signed content type and length)
+type PhotoServer struct {
+	photoDao *memory.PhotoDao
+}
+
+// Creates a server which stores photos in the given data store
+func NewPhotoServer(photoDao *memory.PhotoDao) PhotoServer {
+	return PhotoServer{
+		photoDao: photoDao,
+	}
+}
+
+func (s PhotoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Allow browser-based clients to upload and show photos
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, OPTIONS")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		content, exists := s.photoDao.Get(r.URL.Path)
+		if !exists {
+			http.Error(w, "photo not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(content))
+		w.Write(content)
+	case http.MethodPut:
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "image/") || r.ContentLength < 1 || r.ContentLength > maxPhotoBytes {
+			http.Error(w, "photo must be an image of at most 10 MB with a content length", http.StatusBadRequest)
+			return
+		}
+		content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPhotoBytes))
+		if err != nil {
+			http.Error(w, "could not read photo", http.StatusBadRequest)
+			return
+		}
+		s.photoDao.Put(r.URL.Path, content)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
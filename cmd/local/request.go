@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mcwiet/go-test/pkg/authentication"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Builds the identity of the caller from the Authorization header (Cognito ID token, optionally prefixed with 'Bearer')
+func NewIdentity(authorization string) (model.Identity, error) {
+	idToken := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	token, err := authentication.ParseIdToken(idToken)
+	if err != nil {
+		return model.Identity{}, err
+	}
+
+	return model.Identity{
+		Username: token.Username,
+		Email:    token.Email,
+		Groups:   convertToSet(token.Groups),
+	}, nil
+}
+
+func convertToSet(arr []string) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range arr {
+		set[item] = true
+	}
+	return set
+}
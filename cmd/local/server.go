@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// HTTP handler serving the GraphQL API
+type Server struct {
+	executor  Executor
+	onRequest func(model.Identity) // called with the caller of every authorized request
+}
+
+// Creates a server which executes requests with the given executor
+func NewServer(executor Executor, onRequest func(model.Identity)) Server {
+	return Server{
+		executor:  executor,
+		onRequest: onRequest,
+	}
+}
+
+func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Allow browser-based clients (e.g. a frontend dev server) to call the API
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "BadRequestException")
+		return
+	}
+
+	// Mirror AppSync's user pool authorization; the token is parsed but not verified
+	identity, err := NewIdentity(r.Header.Get("Authorization"))
+	if err != nil || identity.Username == "" {
+		writeError(w, http.StatusUnauthorized, "valid authorization header is required", "UnauthorizedException")
+		return
+	}
+
+	s.onRequest(identity)
+
+	var request GraphQlRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "could not parse request body", "BadRequestException")
+		return
+	}
+
+	// Like the Lambda, tag every line logged while handling the request with a request ID
+	logger := logging.FromContext(r.Context()).With(logging.Fields{"requestId": uuid.NewString()})
+	ctx := logging.NewContext(r.Context(), logger)
+
+	writeJson(w, http.StatusOK, s.executor.Execute(ctx, identity, request))
+}
+
+func writeError(w http.ResponseWriter, status int, message string, errorType string) {
+	writeJson(w, status, GraphQlResponse{Errors: []GraphQlError{{Message: message, ErrorType: errorType}}})
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -5,19 +5,33 @@ go 1.17
 require (
 	github.com/aws/aws-cdk-go/awscdk/v2 v2.13.0
 	github.com/aws/aws-lambda-go v1.28.0
+	github.com/aws/aws-xray-sdk-go v1.6.0
 	github.com/aws/constructs-go/constructs/v10 v10.0.67
 	github.com/aws/jsii-runtime-go v1.54.0
 	github.com/google/uuid v1.3.0
 	github.com/openlyinc/pointy v1.1.2
+	github.com/vektah/gqlparser/v2 v2.5.1
 )
 
 require (
+	github.com/agnivade/levenshtein v1.0.1 // indirect
+	github.com/andybalholm/brotli v1.0.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/klauspost/compress v1.11.8 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/matryer/is v1.4.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.24.0 // indirect
+	golang.org/x/net v0.0.0-20211216030914-fe4d6282115f // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
+	golang.org/x/text v0.3.6 // indirect
+	google.golang.org/genproto v0.0.0-20210114201628-6edceaf6022f // indirect
+	google.golang.org/grpc v1.35.0 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
@@ -0,0 +1,91 @@
+// Package apperror contains typed errors which clients can tell apart (not found, forbidden, validation, conflict, internal)
+package apperror
+
+import (
+	"errors"
+)
+
+// Code which identifies the kind of error; sent to clients as the AppSync error type
+type Code string
+
+const (
+	CodeNotFound   Code = "NOT_FOUND"
+	CodeForbidden  Code = "FORBIDDEN"
+	CodeValidation Code = "VALIDATION_FAILED"
+	CodeConflict   Code = "CONFLICT"
+	CodeInternal   Code = "INTERNAL"
+)
+
+// Error with a code, a message which is safe to show to clients and (optionally) the error which caused it
+type Error struct {
+	Code    Code
+	Message string
+	Info    map[string]interface{} // extra details for clients (sent as the AppSync error info)
+	Cause   error                  // underlying error; never shown to clients
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Adds a detail for clients to the error
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Info == nil {
+		e.Info = map[string]interface{}{}
+	}
+	e.Info[key] = value
+	return e
+}
+
+// Creates an error for something which does not exist
+func NewNotFound(message string, cause error) *Error {
+	return &Error{Code: CodeNotFound, Message: message, Cause: cause}
+}
+
+// Creates an error for a caller who is not allowed to do something
+func NewForbidden(message string, cause error) *Error {
+	return &Error{Code: CodeForbidden, Message: message, Cause: cause}
+}
+
+// Creates an error for input which is not valid
+func NewValidation(message string, cause error) *Error {
+	return &Error{Code: CodeValidation, Message: message, Cause: cause}
+}
+
+// Creates an error for a change which conflicts with the current state of the data
+func NewConflict(message string, cause error) *Error {
+	return &Error{Code: CodeConflict, Message: message, Cause: cause}
+}
+
+// Creates an error for a failure the caller can't do anything about (e.g. a data store being unavailable)
+func NewInternal(message string, cause error) *Error {
+	return &Error{Code: CodeInternal, Message: message, Cause: cause}
+}
+
+// Gets the code of an error; errors which aren't app errors are internal
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// Gets the details of an error meant for clients (nil if there are none)
+func InfoOf(err error) map[string]interface{} {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Info
+	}
+	return nil
+}
+
+// Checks whether an error (or any error it wraps) has the given code
+func Is(err error, code Code) bool {
+	var appErr *Error
+	return errors.As(err, &appErr) && appErr.Code == code
+}
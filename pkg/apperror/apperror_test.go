@@ -0,0 +1,74 @@
+package apperror_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeOf(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name         string
+		err          error
+		expectedCode apperror.Code
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:         "app error",
+			err:          apperror.NewNotFound("pet not found", nil),
+			expectedCode: apperror.CodeNotFound,
+		},
+		{
+			name:         "wrapped app error",
+			err:          fmt.Errorf("context: %w", apperror.NewConflict("conflict", nil)),
+			expectedCode: apperror.CodeConflict,
+		},
+		{
+			name:         "plain error",
+			err:          errors.New("plain"),
+			expectedCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		code := apperror.CodeOf(test.err)
+
+		// Verify
+		assert.Equal(t, test.expectedCode, code, test.name)
+	}
+}
+
+func TestErrorWrapsCause(t *testing.T) {
+	// Setup
+	cause := errors.New("connection reset")
+
+	// Execute
+	err := apperror.NewInternal("error retrieving pet", cause)
+
+	// Verify
+	assert.Equal(t, "error retrieving pet", err.Error(), "message does not leak the cause")
+	assert.True(t, errors.Is(err, cause))
+	assert.True(t, apperror.Is(err, apperror.CodeInternal))
+	assert.False(t, apperror.Is(err, apperror.CodeNotFound))
+}
+
+func TestInfoOf(t *testing.T) {
+	// Setup
+	err := apperror.NewValidation("owner is not a valid user", nil).With("field", "owner")
+
+	// Execute
+	info := apperror.InfoOf(err)
+	plainInfo := apperror.InfoOf(errors.New("plain"))
+
+	// Verify
+	assert.Equal(t, map[string]interface{}{"field": "owner"}, info)
+	assert.Nil(t, plainInfo)
+}
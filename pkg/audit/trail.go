@@ -0,0 +1,56 @@
+// Package audit collects what happens while a mutation is handled (e.g. the authorization decisions made along the way)
+// so it can be recorded in the audit log once the mutation is done
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+type contextKey struct{}
+
+// Authorization decisions made while handling a request; safe for concurrent use, and a nil trail drops decisions
+type Trail struct {
+	mutex     sync.Mutex
+	decisions []model.AuthorizationDecision
+}
+
+// Creates an empty trail
+func NewTrail() *Trail {
+	return &Trail{
+		decisions: []model.AuthorizationDecision{},
+	}
+}
+
+// Adds a decision to the trail
+func (t *Trail) AddDecision(decision model.AuthorizationDecision) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.decisions = append(t.decisions, decision)
+}
+
+// Gets the decisions added so far, in the order they were made
+func (t *Trail) Decisions() []model.AuthorizationDecision {
+	if t == nil {
+		return []model.AuthorizationDecision{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]model.AuthorizationDecision{}, t.decisions...)
+}
+
+// Creates a context which carries the trail
+func NewContext(ctx context.Context, trail *Trail) context.Context {
+	return context.WithValue(ctx, contextKey{}, trail)
+}
+
+// Gets the trail carried by the context (or nil, which drops decisions, if there isn't one)
+func FromContext(ctx context.Context) *Trail {
+	trail, _ := ctx.Value(contextKey{}).(*Trail)
+	return trail
+}
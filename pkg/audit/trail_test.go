@@ -0,0 +1,51 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/audit"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleDecision1 = model.AuthorizationDecision{Action: "pet:update", Allowed: true, Reason: "allowed"}
+	SampleDecision2 = model.AuthorizationDecision{Action: "pet:updateOwner", Allowed: false, Reason: "denied"}
+)
+
+func TestTrail(t *testing.T) {
+	// Setup
+	trail := audit.NewTrail()
+	ctx := audit.NewContext(context.Background(), trail)
+
+	// Execute
+	audit.FromContext(ctx).AddDecision(SampleDecision1)
+	audit.FromContext(ctx).AddDecision(SampleDecision2)
+
+	// Verify
+	assert.Equal(t, []model.AuthorizationDecision{SampleDecision1, SampleDecision2}, trail.Decisions())
+}
+
+func TestTrailDecisionsAreCopied(t *testing.T) {
+	// Setup
+	trail := audit.NewTrail()
+	trail.AddDecision(SampleDecision1)
+
+	// Execute
+	decisions := trail.Decisions()
+	decisions[0] = SampleDecision2
+
+	// Verify
+	assert.Equal(t, []model.AuthorizationDecision{SampleDecision1}, trail.Decisions())
+}
+
+func TestFromContextWithoutTrail(t *testing.T) {
+	// Execute
+	trail := audit.FromContext(context.Background())
+	trail.AddDecision(SampleDecision1)
+
+	// Verify
+	assert.Nil(t, trail)
+	assert.Equal(t, []model.AuthorizationDecision{}, trail.Decisions(), "decisions are dropped without a trail")
+}
@@ -65,6 +65,11 @@ func (a *CognitoAuthenticator) Login(email string, password string) (UserToken,
 	return buildUserToken(accessToken, idToken, refreshToken)
 }
 
+// Turn an ID token string into a token object (does not verify token!)
+func ParseIdToken(idToken string) (UserToken, error) {
+	return buildUserToken("", idToken, "")
+}
+
 // Turn a token string into a token object (does not verify token!)
 func buildUserToken(accessToken string, idToken string, refreshToken string) (UserToken, error) {
 	idClaims, err := getClaims(idToken)
@@ -79,12 +84,14 @@ func buildUserToken(accessToken string, idToken string, refreshToken string) (Us
 		}
 	}
 
+	username, _ := idClaims["cognito:username"].(string)
+	email, _ := idClaims["email"].(string)
 	token := UserToken{
 		AccessTokenString:  accessToken,
 		IdTokenString:      idToken,
 		RefreshTokenString: refreshToken,
-		Username:           idClaims["cognito:username"].(string),
-		Email:              idClaims["email"].(string),
+		Username:           username,
+		Email:              email,
 		Groups:             groups,
 	}
 
@@ -86,3 +86,47 @@ func TestLogin(t *testing.T) {
 		}
 	}
 }
+
+func TestParseIdToken(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name          string
+		idToken       string
+		expectedToken authentication.UserToken
+		expectErr     bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:    "valid token",
+			idToken: SampleIdTokenString,
+			expectedToken: authentication.UserToken{
+				IdTokenString: SampleIdTokenString,
+				Username:      SampleUsername,
+				Email:         SampleEmail,
+				Groups:        SampleGroups,
+			},
+			expectErr: false,
+		},
+		{
+			name:      "malformed token",
+			idToken:   "not a token",
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		token, err := authentication.ParseIdToken(test.idToken)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedToken, token, test.name)
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package authorization
+
+import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/audit"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Name of the action of reading the audit log in the policies
+const actionListAuditEvents = "audit:list"
+
+// Object authorizing reads of the audit log with the policy engine
+type AuditAuthorizer struct {
+	engine *PolicyEngine
+}
+
+// Creates an audit authorizer deciding with the policy engine
+func NewAuditAuthorizer(engine *PolicyEngine) AuditAuthorizer {
+	return AuditAuthorizer{
+		engine: engine,
+	}
+}
+
+// Checks whether an identity may list audit events; returns a forbidden error (explaining why) if not
+//
+// The decision is added to the context's audit trail
+func (a *AuditAuthorizer) AuthorizeList(ctx context.Context, identity model.Identity) error {
+	decision := a.engine.Evaluate(identity, actionListAuditEvents, Resource{})
+	audit.FromContext(ctx).AddDecision(decision.For(actionListAuditEvents))
+
+	if decision.Allowed {
+		return nil
+	}
+	return apperror.NewForbidden("not authorized to list audit events", nil).With("reason", decision.Explanation)
+}
@@ -0,0 +1,46 @@
+package authorization_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeListAuditEvents(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name          string
+		identity      model.Identity
+		expectAllowed bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{name: "admin", identity: withRole(authorization.RoleAdmin), expectAllowed: true},
+		{name: "vet", identity: withRole(authorization.RoleVet), expectAllowed: false},
+		{name: "shelter staff", identity: withRole(authorization.RoleShelterStaff), expectAllowed: false},
+		{name: "moderator", identity: withRole(authorization.RoleModerator), expectAllowed: false},
+		{name: "user", identity: model.Identity{Username: SampleUsername}, expectAllowed: false},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine := authorization.NewPolicyEngine()
+		authorizer := authorization.NewAuditAuthorizer(&engine)
+
+		// Execute
+		err := authorizer.AuthorizeList(context.Background(), test.identity)
+
+		// Verify
+		if test.expectAllowed {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeForbidden, apperror.CodeOf(err), test.name)
+		}
+	}
+}
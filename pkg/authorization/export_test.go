@@ -2,4 +2,5 @@ package authorization_test
 
 const (
 	SampleUsername = "Test User"
+	SampleCoOwner  = "Test Co-Owner"
 )
@@ -1,29 +1,88 @@
 package authorization
 
 import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/audit"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/mcwiet/go-test/pkg/service"
 )
 
-type PetAuthorizer struct{}
+// Name of each pet action in the policies, and the message callers get when it is forbidden
+var petActions = map[service.PetAction]struct {
+	name             string
+	forbiddenMessage string
+}{
+	service.PetActionUpdate:            {"pet:update", "not authorized to update this pet"},
+	service.PetActionUpdatePrivacy:     {"pet:updatePrivacy", "not authorized to make this pet private or public"},
+	service.PetActionUploadPhoto:       {"pet:uploadPhoto", "not authorized to upload photos of this pet"},
+	service.PetActionTransfer:          {"pet:transfer", "not authorized to transfer this pet"},
+	service.PetActionAcceptTransfer:    {"pet:acceptTransfer", "only the recipient can accept this transfer"},
+	service.PetActionDeclineTransfer:   {"pet:declineTransfer", "only the recipient can decline this transfer"},
+	service.PetActionAddOwner:          {"pet:addOwner", "not authorized to add owners to this pet"},
+	service.PetActionRemoveOwner:       {"pet:removeOwner", "not authorized to remove owners from this pet"},
+	service.PetActionRemoveLastOwner:   {"pet:removeLastOwner", "not authorized to leave this pet without owners"},
+	service.PetActionRestore:           {"pet:restore", "not authorized to restore this pet"},
+	service.PetActionPurge:             {"pet:purge", "not authorized to purge this pet"},
+	service.PetActionListDeleted:       {"pet:listDeleted", "not authorized to list deleted pets"},
+	service.PetActionCreate:            {"pet:create", "not authorized to create a pet with these owners"},
+	service.PetActionRead:              {"pet:read", "not authorized to read this pet"},
+	service.PetActionDelete:            {"pet:delete", "not authorized to delete this pet"},
+	service.PetActionReadPrivateOwners: {actionReadPrivatePetOwners, "not authorized to see who owns this private pet"},
+}
+
+// Object authorizing pet actions with the policy engine
+type PetAuthorizer struct {
+	engine *PolicyEngine
+}
+
+// Creates a pet authorizer deciding with the policy engine
+func NewPetAuthorizer(engine *PolicyEngine) PetAuthorizer {
+	return PetAuthorizer{
+		engine: engine,
+	}
+}
+
+// Checks whether an identity may perform an action on a pet; returns a forbidden error (explaining why) if not
+//
+// The decision is added to the context's audit trail
+func (a *PetAuthorizer) Authorize(ctx context.Context, identity model.Identity, pet model.Pet, action service.PetAction) error {
+	return a.record(ctx, action, a.Decide(identity, pet, action))
+}
+
+// Checks whether an identity may perform an action on a pending transfer of a pet, with the transfer (and so its
+// recipient) as the resource; returns a forbidden error (explaining why) if not
+//
+// The decision is added to the context's audit trail
+func (a *PetAuthorizer) AuthorizeTransfer(ctx context.Context, identity model.Identity, transfer model.PetTransfer, action service.PetAction) error {
+	return a.record(ctx, action, a.decide(identity, action, Resource{Recipient: transfer.Recipient}))
+}
 
-func NewPetAuthorizer() PetAuthorizer {
-	return PetAuthorizer{}
+// Decides whether an identity may perform an action on a pet; actions without a policy name are always denied
+func (a *PetAuthorizer) Decide(identity model.Identity, pet model.Pet, action service.PetAction) Decision {
+	return a.decide(identity, action, Resource{Owners: pet.Owners})
 }
 
-func (a *PetAuthorizer) IsAuthorized(identity model.Identity, pet model.Pet, action service.PetAction) bool {
-	if identity.Groups[RoleAdmin.String()] {
-		return true
+// Adds a decision on an action to the context's audit trail; returns a forbidden error (explaining why) if it was denied
+func (a *PetAuthorizer) record(ctx context.Context, action service.PetAction, decision Decision) error {
+	name, message := "unknown", "not authorized to perform this action on this pet"
+	if petAction, known := petActions[action]; known {
+		name, message = petAction.name, petAction.forbiddenMessage
 	}
+	audit.FromContext(ctx).AddDecision(decision.For(name))
 
-	switch action {
-	case service.PetActionUpdateOwner:
-		return canUpdatePetOwner(identity, pet)
-	default:
-		return false
+	if decision.Allowed {
+		return nil
 	}
+	return apperror.NewForbidden(message, nil).With("reason", decision.Explanation)
 }
 
-func canUpdatePetOwner(identity model.Identity, pet model.Pet) bool {
-	return identity.Username == pet.Owner
+// Decides whether an identity may perform an action on a resource; actions without a policy name are always denied
+func (a *PetAuthorizer) decide(identity model.Identity, action service.PetAction, resource Resource) Decision {
+	petAction, known := petActions[action]
+	if !known {
+		return Decision{Explanation: "denied; unknown pet action"}
+	}
+	return a.engine.Evaluate(identity, petAction.name, resource)
 }
@@ -1,9 +1,12 @@
 package authorization_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/audit"
 	"github.com/mcwiet/go-test/pkg/authorization"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/mcwiet/go-test/pkg/service"
@@ -12,14 +15,14 @@ import (
 
 var (
 	SamplePet = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "Levi",
-		Age:   1,
-		Owner: SampleUsername,
+		Id:     uuid.NewString(),
+		Name:   "Levi",
+		Age:    1,
+		Owners: []string{SampleCoOwner, SampleUsername},
 	}
 )
 
-func TestIsAuthorized(t *testing.T) {
+func TestAuthorize(t *testing.T) {
 	type Test struct {
 		name           string
 		identity       model.Identity
@@ -30,37 +33,452 @@ func TestIsAuthorized(t *testing.T) {
 
 	tests := []Test{
 		{
-			name: "update pet owner - not authorized",
+			name: "update pet privacy - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdatePrivacy,
+			expectedResult: true,
+		},
+		{
+			name: "update pet privacy - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdatePrivacy,
+			expectedResult: true,
+		},
+		{
+			name: "update pet privacy - vet",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleVet.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdatePrivacy,
+			expectedResult: false,
+		},
+		{
+			name: "update pet privacy - shelter staff",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleShelterStaff.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdatePrivacy,
+			expectedResult: false,
+		},
+		{
+			name: "update pet - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdate,
+			expectedResult: false,
+		},
+		{
+			name: "update pet - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdate,
+			expectedResult: true,
+		},
+		{
+			name: "upload pet photo - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUploadPhoto,
+			expectedResult: false,
+		},
+		{
+			name: "upload pet photo - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUploadPhoto,
+			expectedResult: true,
+		},
+		{
+			name: "upload pet photo - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUploadPhoto,
+			expectedResult: true,
+		},
+		{
+			name: "transfer pet - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionTransfer,
+			expectedResult: false,
+		},
+		{
+			name: "transfer pet - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionTransfer,
+			expectedResult: true,
+		},
+		{
+			name: "transfer pet - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionTransfer,
+			expectedResult: true,
+		},
+		{
+			name: "update pet - user is a co-owner",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdate,
+			expectedResult: true,
+		},
+		{
+			name: "add pet owner - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionAddOwner,
+			expectedResult: false,
+		},
+		{
+			name: "add pet owner - user is owner",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionAddOwner,
+			expectedResult: true,
+		},
+		{
+			name: "remove pet owner - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRemoveOwner,
+			expectedResult: false,
+		},
+		{
+			name: "remove pet owner - user is owner",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRemoveOwner,
+			expectedResult: true,
+		},
+		{
+			name: "remove last pet owner - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRemoveLastOwner,
+			expectedResult: true,
+		},
+		{
+			name: "remove last pet owner - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRemoveLastOwner,
+			expectedResult: false,
+		},
+		{
+			name: "restore pet - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRestore,
+			expectedResult: false,
+		},
+		{
+			name: "restore pet - user is owner",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRestore,
+			expectedResult: true,
+		},
+		{
+			name: "purge pet - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionPurge,
+			expectedResult: false,
+		},
+		{
+			name: "purge pet - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionPurge,
+			expectedResult: true,
+		},
+		{
+			name: "list deleted pets - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			action:         service.PetActionListDeleted,
+			expectedResult: true,
+		},
+		{
+			name: "list deleted pets - user",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			action:         service.PetActionListDeleted,
+			expectedResult: false,
+		},
+		{
+			name: "create pet - not among the owners",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionCreate,
+			expectedResult: false,
+		},
+		{
+			name: "create pet - user is the only owner",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            model.Pet{Owners: []string{SampleCoOwner}},
+			action:         service.PetActionCreate,
+			expectedResult: true,
+		},
+		{
+			name: "create pet - user is one of several owners",
+			identity: model.Identity{
+				Username: SampleCoOwner,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionCreate,
+			expectedResult: false,
+		},
+		{
+			name: "create pet with several owners - admin",
 			identity: model.Identity{
 				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
 			},
 			pet:            SamplePet,
-			action:         service.PetActionUpdateOwner,
+			action:         service.PetActionCreate,
+			expectedResult: true,
+		},
+		{
+			name: "create pet without owners - user",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            model.Pet{Owners: []string{}},
+			action:         service.PetActionCreate,
 			expectedResult: false,
 		},
 		{
-			name: "update pet owner - admin",
+			name: "create pet without owners - admin",
 			identity: model.Identity{
 				Username: "unexpected",
 				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
 			},
+			pet:            model.Pet{Owners: []string{}},
+			action:         service.PetActionCreate,
+			expectedResult: true,
+		},
+		{
+			name: "read pet - any user",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionRead,
+			expectedResult: true,
+		},
+		{
+			name: "delete pet - not authorized",
+			identity: model.Identity{
+				Username: "unexpected",
+			},
+			pet:            SamplePet,
+			action:         service.PetActionDelete,
+			expectedResult: false,
+		},
+		{
+			name: "delete pet - user is owner",
+			identity: model.Identity{
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionDelete,
+			expectedResult: true,
+		},
+		{
+			name: "delete pet - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionDelete,
+			expectedResult: true,
+		},
+		{
+			name: "update pet - vet",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleVet.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdate,
+			expectedResult: true,
+		},
+		{
+			name: "upload photo - vet",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleVet.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUploadPhoto,
+			expectedResult: true,
+		},
+		{
+			name: "delete pet - vet",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleVet.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionDelete,
+			expectedResult: false,
+		},
+		{
+			name: "create pet for others - shelter staff",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleShelterStaff.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionCreate,
+			expectedResult: true,
+		},
+		{
+			name: "transfer pet - shelter staff",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleShelterStaff.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionTransfer,
+			expectedResult: true,
+		},
+		{
+			name: "update pet - shelter staff",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleShelterStaff.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUpdate,
+			expectedResult: false,
+		},
+		{
+			name: "remove last owner - shelter staff",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleShelterStaff.String(): true},
+			},
 			pet:            SamplePet,
-			action:         service.PetActionUpdateOwner,
+			action:         service.PetActionRemoveLastOwner,
+			expectedResult: false,
+		},
+		{
+			name: "delete pet - moderator",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleModerator.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionDelete,
 			expectedResult: true,
 		},
 		{
-			name: "update pet owner - user is owner",
+			name: "restore pet - moderator",
 			identity: model.Identity{
-				Username: SamplePet.Owner,
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleModerator.String(): true},
 			},
 			pet:            SamplePet,
-			action:         service.PetActionUpdateOwner,
+			action:         service.PetActionRestore,
 			expectedResult: true,
 		},
+		{
+			name: "list deleted pets - moderator",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleModerator.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionListDeleted,
+			expectedResult: true,
+		},
+		{
+			name: "purge pet - moderator",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleModerator.String(): true},
+			},
+			pet:            SamplePet,
+			action:         service.PetActionPurge,
+			expectedResult: false,
+		},
 		{
 			name: "undefined action",
 			identity: model.Identity{
-				Username: SamplePet.Owner,
+				Username: SampleUsername,
+			},
+			pet:            SamplePet,
+			action:         service.PetActionUndefined,
+			expectedResult: false,
+		},
+		{
+			name: "undefined action - admin",
+			identity: model.Identity{
+				Username: "unexpected",
+				Groups:   map[string]bool{authorization.RoleAdmin.String(): true},
 			},
 			pet:            SamplePet,
 			action:         service.PetActionUndefined,
@@ -69,10 +487,116 @@ func TestIsAuthorized(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		authorizer := authorization.NewPetAuthorizer()
+		engine := authorization.NewPolicyEngine()
+		authorizer := authorization.NewPetAuthorizer(&engine)
+
+		err := authorizer.Authorize(context.Background(), test.identity, test.pet, test.action)
+
+		if test.expectedResult {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeForbidden, apperror.CodeOf(err), test.name)
+			var appErr *apperror.Error
+			if assert.ErrorAs(t, err, &appErr, test.name) {
+				assert.NotEmpty(t, appErr.Info["reason"], test.name+": should explain the decision")
+			}
+		}
+	}
+}
+
+func TestAuthorizeTransfer(t *testing.T) {
+	type Test struct {
+		name           string
+		identity       model.Identity
+		action         service.PetAction
+		expectedResult bool
+	}
+
+	// Sent by the pet's owners, so only the recipient (or an admin) may answer it
+	transfer := model.PetTransfer{PetId: SamplePet.Id, Sender: SampleUsername, Recipient: "recipient"}
+	tests := []Test{
+		{
+			name:           "accept pet transfer - recipient",
+			identity:       model.Identity{Username: "recipient"},
+			action:         service.PetActionAcceptTransfer,
+			expectedResult: true,
+		},
+		{
+			name:           "accept pet transfer - sender",
+			identity:       model.Identity{Username: SampleUsername},
+			action:         service.PetActionAcceptTransfer,
+			expectedResult: false,
+		},
+		{
+			name:           "accept pet transfer - not the recipient",
+			identity:       model.Identity{Username: "unexpected"},
+			action:         service.PetActionAcceptTransfer,
+			expectedResult: false,
+		},
+		{
+			name:           "accept pet transfer - admin",
+			identity:       model.Identity{Username: "unexpected", Groups: map[string]bool{authorization.RoleAdmin.String(): true}},
+			action:         service.PetActionAcceptTransfer,
+			expectedResult: true,
+		},
+		{
+			name:           "decline pet transfer - recipient",
+			identity:       model.Identity{Username: "recipient"},
+			action:         service.PetActionDeclineTransfer,
+			expectedResult: true,
+		},
+		{
+			name:           "decline pet transfer - shelter staff",
+			identity:       model.Identity{Username: "unexpected", Groups: map[string]bool{authorization.RoleShelterStaff.String(): true}},
+			action:         service.PetActionDeclineTransfer,
+			expectedResult: false,
+		},
+		{
+			name:           "transfer pet - recipient",
+			identity:       model.Identity{Username: "recipient"},
+			action:         service.PetActionTransfer,
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range tests {
+		engine := authorization.NewPolicyEngine()
+		authorizer := authorization.NewPetAuthorizer(&engine)
+		trail := audit.NewTrail()
+		ctx := audit.NewContext(context.Background(), trail)
+
+		err := authorizer.AuthorizeTransfer(ctx, test.identity, transfer, test.action)
+
+		if test.expectedResult {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeForbidden, apperror.CodeOf(err), test.name)
+		}
+		if assert.Equal(t, 1, len(trail.Decisions()), test.name) {
+			assert.Equal(t, test.expectedResult, trail.Decisions()[0].Allowed, test.name+": should record the decision")
+		}
+	}
+}
+
+func TestAuthorizeRecordsDecision(t *testing.T) {
+	// Setup
+	engine := authorization.NewPolicyEngine()
+	authorizer := authorization.NewPetAuthorizer(&engine)
+	trail := audit.NewTrail()
+	ctx := audit.NewContext(context.Background(), trail)
 
-		authorized := authorizer.IsAuthorized(test.identity, test.pet, test.action)
+	// Execute
+	_ = authorizer.Authorize(ctx, model.Identity{Username: SampleUsername}, SamplePet, service.PetActionUpdate)
+	_ = authorizer.Authorize(ctx, model.Identity{Username: "unexpected"}, SamplePet, service.PetActionDelete)
+	_ = authorizer.Authorize(ctx, model.Identity{Username: SampleUsername}, SamplePet, service.PetActionUndefined)
 
-		assert.Equal(t, test.expectedResult, authorized, test.name)
+	// Verify
+	decisions := trail.Decisions()
+	if assert.Equal(t, 3, len(decisions)) {
+		assert.Equal(t, model.AuthorizationDecision{Action: "pet:update", Allowed: true, Reason: "allowed by policy 'owners' (Owners (every co-owner included) manage their pets)"}, decisions[0])
+		assert.Equal(t, "pet:delete", decisions[1].Action)
+		assert.False(t, decisions[1].Allowed)
+		assert.Contains(t, decisions[1].Reason, "policy 'owners' requires that the caller owns the resource")
+		assert.Equal(t, model.AuthorizationDecision{Action: "unknown", Allowed: false, Reason: "denied; unknown pet action"}, decisions[2])
 	}
 }
@@ -0,0 +1,221 @@
+package authorization
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Policies the API is authorized with (embedded so binaries don't depend on the working directory)
+//
+//go:embed policies.json
+var policies []byte
+
+// Matches every action in a policy
+const anyAction = "*"
+
+// Document listing the policies; callers may only do what some policy allows
+type PolicyDocument struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Allows callers with any of the roles (or any caller, if no roles are given) to perform the actions on resources which
+// meet every condition
+type Policy struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Actions     []string    `json:"actions"` // e.g. 'pet:update', or '*' for every action
+	Roles       []string    `json:"roles"`
+	Conditions  []Condition `json:"conditions"`
+}
+
+// Condition on the caller's relationship to a resource
+type Condition string
+
+const (
+	ConditionIsOwner     Condition = "isOwner"     // the caller is one of the resource's owners
+	ConditionIsSoleOwner Condition = "isSoleOwner" // the caller is the resource's only owner
+	ConditionIsRecipient Condition = "isRecipient" // the caller is who the resource (e.g. a transfer) is offered to
+)
+
+// How each condition is checked, and described in explanations
+var conditions = map[Condition]struct {
+	holds       func(identity model.Identity, resource Resource) bool
+	description string
+}{
+	ConditionIsOwner: {
+		holds:       func(identity model.Identity, resource Resource) bool { return resource.hasOwner(identity.Username) },
+		description: "the caller owns the resource",
+	},
+	ConditionIsSoleOwner: {
+		holds: func(identity model.Identity, resource Resource) bool {
+			return len(resource.Owners) == 1 && resource.hasOwner(identity.Username)
+		},
+		description: "the caller is the resource's only owner",
+	},
+	ConditionIsRecipient: {
+		holds: func(identity model.Identity, resource Resource) bool {
+			return identity.Username != "" && resource.Recipient == identity.Username
+		},
+		description: "the caller is the resource's recipient",
+	},
+}
+
+// Attributes of the resource an action is performed on, which conditions are checked against
+type Resource struct {
+	Owners    []string
+	Recipient string // only set on resources offered to someone, like transfers
+}
+
+func (r Resource) hasOwner(username string) bool {
+	for _, owner := range r.Owners {
+		if username != "" && owner == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome of evaluating the policies for an action, with an explanation of why it was (or wasn't) allowed
+type Decision struct {
+	Allowed     bool
+	Policy      string // name of the policy which allowed the action, if any
+	Explanation string
+}
+
+// Gets the decision as it is recorded in the audit log, for the action it was made on
+func (d Decision) For(action string) model.AuthorizationDecision {
+	return model.AuthorizationDecision{
+		Action:  action,
+		Allowed: d.Allowed,
+		Reason:  d.Explanation,
+	}
+}
+
+// Object deciding what callers may do using a set of policies
+type PolicyEngine struct {
+	policies []Policy
+}
+
+// Creates a policy engine using the embedded policies; panics if they aren't valid, which the tests guard against
+func NewPolicyEngine() PolicyEngine {
+	engine, err := NewPolicyEngineFromJson(policies)
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}
+
+// Creates a policy engine from a JSON policy document; returns an error if any policy isn't valid
+func NewPolicyEngineFromJson(document []byte) (PolicyEngine, error) {
+	var doc PolicyDocument
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return PolicyEngine{}, errors.New("could not parse policies: " + err.Error())
+	}
+	if err := validatePolicies(doc.Policies); err != nil {
+		return PolicyEngine{}, err
+	}
+
+	return PolicyEngine{policies: doc.Policies}, nil
+}
+
+// Decides whether a caller may perform an action on a resource; the first policy covering the action whose roles and
+// conditions are met allows it, and actions no policy allows are denied
+func (e *PolicyEngine) Evaluate(identity model.Identity, action string, resource Resource) Decision {
+	unmet := []string{}
+	for _, policy := range e.policies {
+		if !policy.covers(action) {
+			continue
+		}
+		if reason := policy.unmetRequirement(identity, resource); reason != "" {
+			unmet = append(unmet, fmt.Sprintf("policy '%s' requires %s", policy.Name, reason))
+			continue
+		}
+		return Decision{
+			Allowed:     true,
+			Policy:      policy.Name,
+			Explanation: fmt.Sprintf("allowed by policy '%s' (%s)", policy.Name, policy.Description),
+		}
+	}
+
+	if len(unmet) == 0 {
+		return Decision{Explanation: fmt.Sprintf("denied; no policy covers '%s'", action)}
+	}
+	return Decision{Explanation: "denied; " + strings.Join(unmet, ", ")}
+}
+
+// Whether the policy applies to the action
+func (p Policy) covers(action string) bool {
+	for _, covered := range p.Actions {
+		if covered == anyAction || covered == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Describes the first of the policy's roles or conditions the caller doesn't meet (or returns "" if all are met)
+func (p Policy) unmetRequirement(identity model.Identity, resource Resource) string {
+	if len(p.Roles) > 0 && !hasAnyRole(identity, p.Roles) {
+		return "role " + strings.Join(p.Roles, " or ")
+	}
+	for _, condition := range p.Conditions {
+		if !conditions[condition].holds(identity, resource) {
+			return "that " + conditions[condition].description
+		}
+	}
+	return ""
+}
+
+func hasAnyRole(identity model.Identity, roles []string) bool {
+	for _, role := range RolesOf(identity) {
+		for _, name := range roles {
+			if role.String() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks every policy is named (uniquely), covers some actions and only uses known roles and conditions
+func validatePolicies(policies []Policy) error {
+	problems := []string{}
+	names := map[string]bool{}
+	for i, policy := range policies {
+		name := policy.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			problems = append(problems, "policy "+name+" has no name")
+		} else if names[name] {
+			problems = append(problems, "policy '"+name+"' is defined more than once")
+		}
+		names[name] = true
+
+		if len(policy.Actions) == 0 {
+			problems = append(problems, "policy '"+name+"' has no actions")
+		}
+		for _, role := range policy.Roles {
+			if ParseRole(role) == RoleUndefined {
+				problems = append(problems, "policy '"+name+"' has unknown role '"+role+"'")
+			}
+		}
+		for _, condition := range policy.Conditions {
+			if _, known := conditions[condition]; !known {
+				problems = append(problems, "policy '"+name+"' has unknown condition '"+string(condition)+"'")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("policies are not valid: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package authorization_test
+
+import (
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const SamplePolicies = `{
+	"policies": [
+		{"name": "admins", "description": "Admins may do anything", "actions": ["*"], "roles": ["admin"]},
+		{"name": "owners", "description": "Owners feed their pets", "actions": ["pet:feed"], "conditions": ["isOwner"]},
+		{"name": "soleOwners", "description": "Sole owners rename their pets", "actions": ["pet:rename"], "conditions": ["isSoleOwner"]},
+		{"name": "recipients", "description": "Recipients accept what they are offered", "actions": ["pet:accept"], "conditions": ["isRecipient"]}
+	]
+}`
+
+func TestNewPolicyEngine(t *testing.T) {
+	// Execute
+	engine := authorization.NewPolicyEngine()
+
+	// Verify
+	decision := engine.Evaluate(model.Identity{}, "pet:update", authorization.Resource{})
+	assert.False(t, decision.Allowed, "embedded policies should load and deny anonymous callers")
+}
+
+func TestNewPolicyEngineFromJson(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name              string
+		document          string
+		expectErr         bool
+		expectedErrDetail string
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:     "valid policies",
+			document: SamplePolicies,
+		},
+		{
+			name:              "not JSON",
+			document:          "policies:",
+			expectErr:         true,
+			expectedErrDetail: "could not parse policies",
+		},
+		{
+			name:              "unknown field",
+			document:          `{"policies": [{"name": "a", "actions": ["*"], "effect": "deny"}]}`,
+			expectErr:         true,
+			expectedErrDetail: "unknown field",
+		},
+		{
+			name:              "missing name",
+			document:          `{"policies": [{"actions": ["*"]}]}`,
+			expectErr:         true,
+			expectedErrDetail: "policy #0 has no name",
+		},
+		{
+			name:              "duplicate name",
+			document:          `{"policies": [{"name": "a", "actions": ["*"]}, {"name": "a", "actions": ["*"]}]}`,
+			expectErr:         true,
+			expectedErrDetail: "policy 'a' is defined more than once",
+		},
+		{
+			name:              "no actions",
+			document:          `{"policies": [{"name": "a"}]}`,
+			expectErr:         true,
+			expectedErrDetail: "policy 'a' has no actions",
+		},
+		{
+			name:              "unknown role",
+			document:          `{"policies": [{"name": "a", "actions": ["*"], "roles": ["superuser"]}]}`,
+			expectErr:         true,
+			expectedErrDetail: "policy 'a' has unknown role 'superuser'",
+		},
+		{
+			name:              "unknown condition",
+			document:          `{"policies": [{"name": "a", "actions": ["*"], "conditions": ["isFriend"]}]}`,
+			expectErr:         true,
+			expectedErrDetail: "policy 'a' has unknown condition 'isFriend'",
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		_, err := authorization.NewPolicyEngineFromJson([]byte(test.document))
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+		} else if assert.NotNil(t, err, test.name) {
+			assert.Contains(t, err.Error(), test.expectedErrDetail, test.name)
+		}
+	}
+}
+
+func TestPolicyEngineEvaluate(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                string
+		identity            model.Identity
+		action              string
+		resource            authorization.Resource
+		expectedAllowed     bool
+		expectedPolicy      string
+		expectedExplanation string
+	}
+
+	admin := model.Identity{Username: "admin", Groups: map[string]bool{authorization.RoleAdmin.String(): true}}
+	owner := model.Identity{Username: SampleUsername}
+	stranger := model.Identity{Username: "stranger"}
+	soleOwned := authorization.Resource{Owners: []string{SampleUsername}}
+	shared := authorization.Resource{Owners: []string{SampleCoOwner, SampleUsername}}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:                "role allows every action",
+			identity:            admin,
+			action:              "pet:anything",
+			expectedAllowed:     true,
+			expectedPolicy:      "admins",
+			expectedExplanation: "allowed by policy 'admins' (Admins may do anything)",
+		},
+		{
+			name:                "no policy covers the action",
+			identity:            owner,
+			action:              "pet:anything",
+			resource:            soleOwned,
+			expectedAllowed:     false,
+			expectedExplanation: "denied; policy 'admins' requires role admin",
+		},
+		{
+			name:            "owner",
+			identity:        owner,
+			action:          "pet:feed",
+			resource:        soleOwned,
+			expectedAllowed: true,
+			expectedPolicy:  "owners",
+		},
+		{
+			name:            "one of several owners",
+			identity:        owner,
+			action:          "pet:feed",
+			resource:        shared,
+			expectedAllowed: true,
+			expectedPolicy:  "owners",
+		},
+		{
+			name:                "caller who isn't an owner",
+			identity:            stranger,
+			action:              "pet:feed",
+			resource:            shared,
+			expectedAllowed:     false,
+			expectedExplanation: "denied; policy 'admins' requires role admin, policy 'owners' requires that the caller owns the resource",
+		},
+		{
+			name:            "sole owner",
+			identity:        owner,
+			action:          "pet:rename",
+			resource:        soleOwned,
+			expectedAllowed: true,
+			expectedPolicy:  "soleOwners",
+		},
+		{
+			name:                "one of several owners isn't the sole owner",
+			identity:            owner,
+			action:              "pet:rename",
+			resource:            shared,
+			expectedAllowed:     false,
+			expectedExplanation: "denied; policy 'admins' requires role admin, policy 'soleOwners' requires that the caller is the resource's only owner",
+		},
+		{
+			name:            "recipient",
+			identity:        owner,
+			action:          "pet:accept",
+			resource:        authorization.Resource{Recipient: SampleUsername},
+			expectedAllowed: true,
+			expectedPolicy:  "recipients",
+		},
+		{
+			name:                "owner isn't the recipient",
+			identity:            owner,
+			action:              "pet:accept",
+			resource:            authorization.Resource{Owners: []string{SampleUsername}, Recipient: SampleCoOwner},
+			expectedAllowed:     false,
+			expectedExplanation: "denied; policy 'admins' requires role admin, policy 'recipients' requires that the caller is the resource's recipient",
+		},
+		{
+			name:            "anonymous caller isn't the recipient",
+			identity:        model.Identity{},
+			action:          "pet:accept",
+			resource:        authorization.Resource{},
+			expectedAllowed: false,
+		},
+		{
+			name:            "anonymous caller isn't an owner",
+			identity:        model.Identity{},
+			action:          "pet:feed",
+			resource:        authorization.Resource{Owners: []string{""}},
+			expectedAllowed: false,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine, err := authorization.NewPolicyEngineFromJson([]byte(SamplePolicies))
+		assert.Nil(t, err, test.name)
+
+		// Execute
+		decision := engine.Evaluate(test.identity, test.action, test.resource)
+
+		// Verify
+		assert.Equal(t, test.expectedAllowed, decision.Allowed, test.name)
+		assert.Equal(t, test.expectedPolicy, decision.Policy, test.name)
+		assert.NotEmpty(t, decision.Explanation, test.name)
+		if test.expectedExplanation != "" {
+			assert.Equal(t, test.expectedExplanation, decision.Explanation, test.name)
+		}
+	}
+}
@@ -1,16 +1,67 @@
 package authorization
 
+import "github.com/mcwiet/go-test/pkg/model"
+
+// Role a caller has by being in the Cognito group of the same name
 type Role int
 
 const (
 	RoleUndefined Role = iota
 	RoleAdmin
+	RoleVet
+	RoleShelterStaff
+	RoleModerator
 )
 
+// Every role a caller may have; the auth stack creates a user pool group for each
+var Roles = []Role{RoleAdmin, RoleVet, RoleShelterStaff, RoleModerator}
+
 func (r Role) String() string {
 	switch r {
 	case RoleAdmin:
 		return "admin"
+	case RoleVet:
+		return "vet"
+	case RoleShelterStaff:
+		return "shelterStaff"
+	case RoleModerator:
+		return "moderator"
 	}
 	return "unknown"
 }
+
+// Describes who has the role
+func (r Role) Description() string {
+	switch r {
+	case RoleAdmin:
+		return "Application administrators"
+	case RoleVet:
+		return "Vets looking after pets"
+	case RoleShelterStaff:
+		return "Shelter staff taking in and rehoming pets"
+	case RoleModerator:
+		return "Moderators taking down and reviewing pets"
+	}
+	return ""
+}
+
+// Gets the role with the name (RoleUndefined if there isn't one)
+func ParseRole(name string) Role {
+	for _, role := range Roles {
+		if role.String() == name {
+			return role
+		}
+	}
+	return RoleUndefined
+}
+
+// Gets the roles of an identity from its groups (in the order of Roles); groups which aren't roles are ignored
+func RolesOf(identity model.Identity) []Role {
+	roles := []Role{}
+	for _, role := range Roles {
+		if identity.Groups[role.String()] {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
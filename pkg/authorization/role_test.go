@@ -0,0 +1,96 @@
+package authorization_test
+
+import (
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name         string
+		roleName     string
+		expectedRole authorization.Role
+	}
+
+	// Define tests
+	tests := []Test{
+		{name: "admin", roleName: "admin", expectedRole: authorization.RoleAdmin},
+		{name: "vet", roleName: "vet", expectedRole: authorization.RoleVet},
+		{name: "shelter staff", roleName: "shelterStaff", expectedRole: authorization.RoleShelterStaff},
+		{name: "moderator", roleName: "moderator", expectedRole: authorization.RoleModerator},
+		{name: "wrong case", roleName: "Admin", expectedRole: authorization.RoleUndefined},
+		{name: "unknown", roleName: "unknown", expectedRole: authorization.RoleUndefined},
+		{name: "empty", roleName: "", expectedRole: authorization.RoleUndefined},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		role := authorization.ParseRole(test.roleName)
+
+		// Verify
+		assert.Equal(t, test.expectedRole, role, test.name)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	for _, role := range authorization.Roles {
+		assert.Equal(t, role, authorization.ParseRole(role.String()), "every role should parse from its name")
+		assert.NotEmpty(t, role.Description(), role.String()+" should be described")
+	}
+}
+
+func TestRolesOf(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name          string
+		identity      model.Identity
+		expectedRoles []authorization.Role
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:          "no groups",
+			identity:      model.Identity{Username: SampleUsername},
+			expectedRoles: []authorization.Role{},
+		},
+		{
+			name: "one role",
+			identity: model.Identity{
+				Username: SampleUsername,
+				Groups:   map[string]bool{"vet": true},
+			},
+			expectedRoles: []authorization.Role{authorization.RoleVet},
+		},
+		{
+			name: "several roles in role order",
+			identity: model.Identity{
+				Username: SampleUsername,
+				Groups:   map[string]bool{"moderator": true, "shelterStaff": true, "admin": true},
+			},
+			expectedRoles: []authorization.Role{authorization.RoleAdmin, authorization.RoleShelterStaff, authorization.RoleModerator},
+		},
+		{
+			name: "groups which aren't roles are ignored",
+			identity: model.Identity{
+				Username: SampleUsername,
+				Groups:   map[string]bool{"group": true, "vet": true, "moderator": false},
+			},
+			expectedRoles: []authorization.Role{authorization.RoleVet},
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		roles := authorization.RolesOf(test.identity)
+
+		// Verify
+		assert.Equal(t, test.expectedRoles, roles, test.name)
+	}
+}
@@ -0,0 +1,42 @@
+package authorization
+
+import (
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Actions in the policies which let callers see fields that are otherwise hidden
+const (
+	actionReadUserEmail        = "user:readEmail"
+	actionReadPrivatePetOwners = "pet:readPrivateOwners"
+)
+
+// Object hiding the fields of users and pets which the policies don't let callers see
+type FieldVisibility struct {
+	engine *PolicyEngine
+}
+
+// Creates a field visibility object deciding with the policy engine
+func NewFieldVisibility(engine *PolicyEngine) FieldVisibility {
+	return FieldVisibility{
+		engine: engine,
+	}
+}
+
+// Gets the user as the caller may see them; the email is redacted unless the caller is the user (who owns their own
+// details) or an admin
+func (v *FieldVisibility) User(identity model.Identity, user model.User) model.User {
+	if !v.engine.Evaluate(identity, actionReadUserEmail, Resource{Owners: []string{user.Username}}).Allowed {
+		user.Email = ""
+	}
+	return user
+}
+
+// Gets the pet as the caller may see it; the owners of private pets are hidden (along with who last changed the pet,
+// which is usually one of them) unless the caller is an owner or an admin
+func (v *FieldVisibility) Pet(identity model.Identity, pet model.Pet) model.Pet {
+	if pet.Private && !v.engine.Evaluate(identity, actionReadPrivatePetOwners, Resource{Owners: pet.Owners}).Allowed {
+		pet.Owners = []string{}
+		pet.ChangedBy = ""
+	}
+	return pet
+}
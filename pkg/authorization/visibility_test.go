@@ -0,0 +1,108 @@
+package authorization_test
+
+import (
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleUser = model.User{
+		Username: SampleUsername,
+		Email:    "test@email.com",
+		Name:     "Test User",
+	}
+	SamplePrivatePet = model.Pet{
+		Id:        "private",
+		Name:      "Levi",
+		Owners:    []string{SampleCoOwner, SampleUsername},
+		Private:   true,
+		ChangedBy: SampleUsername,
+	}
+)
+
+// Identity of a caller with the role (and no other)
+func withRole(role authorization.Role) model.Identity {
+	return model.Identity{Username: "unexpected", Groups: map[string]bool{role.String(): true}}
+}
+
+func TestFieldVisibilityUser(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name          string
+		identity      model.Identity
+		expectedEmail string
+	}
+
+	// Define tests
+	tests := []Test{
+		{name: "user themselves", identity: model.Identity{Username: SampleUsername}, expectedEmail: SampleUser.Email},
+		{name: "admin", identity: withRole(authorization.RoleAdmin), expectedEmail: SampleUser.Email},
+		{name: "vet", identity: withRole(authorization.RoleVet), expectedEmail: ""},
+		{name: "shelter staff", identity: withRole(authorization.RoleShelterStaff), expectedEmail: ""},
+		{name: "moderator", identity: withRole(authorization.RoleModerator), expectedEmail: ""},
+		{name: "another user", identity: model.Identity{Username: SampleCoOwner}, expectedEmail: ""},
+		{name: "anonymous caller", identity: model.Identity{}, expectedEmail: ""},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine := authorization.NewPolicyEngine()
+		visibility := authorization.NewFieldVisibility(&engine)
+
+		// Execute
+		user := visibility.User(test.identity, SampleUser)
+
+		// Verify
+		assert.Equal(t, test.expectedEmail, user.Email, test.name)
+		assert.Equal(t, SampleUser.Username, user.Username, test.name)
+		assert.Equal(t, SampleUser.Name, user.Name, test.name)
+	}
+}
+
+func TestFieldVisibilityPet(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name         string
+		identity     model.Identity
+		pet          model.Pet
+		expectHidden bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{name: "private pet - owner", identity: model.Identity{Username: SampleUsername}, pet: SamplePrivatePet, expectHidden: false},
+		{name: "private pet - co-owner", identity: model.Identity{Username: SampleCoOwner}, pet: SamplePrivatePet, expectHidden: false},
+		{name: "private pet - admin", identity: withRole(authorization.RoleAdmin), pet: SamplePrivatePet, expectHidden: false},
+		{name: "private pet - vet", identity: withRole(authorization.RoleVet), pet: SamplePrivatePet, expectHidden: true},
+		{name: "private pet - shelter staff", identity: withRole(authorization.RoleShelterStaff), pet: SamplePrivatePet, expectHidden: true},
+		{name: "private pet - moderator", identity: withRole(authorization.RoleModerator), pet: SamplePrivatePet, expectHidden: true},
+		{name: "private pet - another user", identity: model.Identity{Username: "unexpected"}, pet: SamplePrivatePet, expectHidden: true},
+		{name: "private pet - anonymous caller", identity: model.Identity{}, pet: SamplePrivatePet, expectHidden: true},
+		{name: "public pet - another user", identity: model.Identity{Username: "unexpected"}, pet: SamplePet, expectHidden: false},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine := authorization.NewPolicyEngine()
+		visibility := authorization.NewFieldVisibility(&engine)
+
+		// Execute
+		pet := visibility.Pet(test.identity, test.pet)
+
+		// Verify
+		if test.expectHidden {
+			assert.Equal(t, []string{}, pet.Owners, test.name)
+			assert.Empty(t, pet.ChangedBy, test.name)
+		} else {
+			assert.Equal(t, test.pet.Owners, pet.Owners, test.name)
+			assert.Equal(t, test.pet.ChangedBy, pet.ChangedBy, test.name)
+		}
+		assert.Equal(t, test.pet.Name, pet.Name, test.name)
+		assert.Equal(t, test.pet.Private, pet.Private, test.name)
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+type AuditService interface {
+	List(ctx context.Context, requestor model.Identity, filter model.AuditEventsFilter, first int, after string) (model.AuditEventConnection, error)
+}
+
+// Object containing data needed for the Audit controller
+type AuditController struct {
+	auditService AuditService
+}
+
+// Creates a new audit controller object
+func NewAuditController(service AuditService) AuditController {
+	return AuditController{
+		auditService: service,
+	}
+}
+
+// Registers the fields resolved by the audit controller
+func (c *AuditController) RegisterResolvers(registry *ResolverRegistry) {
+	registry.Register("Query", "auditEvents", c.HandleList)
+}
+
+// Handles request for listing audit events
+func (c *AuditController) HandleList(ctx context.Context, request Request) Response {
+	var input model.AuditEventsInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	connection, err := c.auditService.List(ctx, request.Identity, input.Filter, input.First, input.After)
+
+	if err == nil {
+		return Response{Data: connection}
+	} else {
+		return Response{Error: err}
+	}
+}
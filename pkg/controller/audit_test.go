@@ -0,0 +1,95 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleAuditEvent = model.AuditEvent{
+		Id:        "20220101T000000.000000000Z-1",
+		Time:      "2022-01-01T00:00:00Z",
+		Username:  "user1",
+		Groups:    []string{},
+		Field:     "Mutation.createPet",
+		Arguments: `{"input":{"name":"Pet 1"}}`,
+		Decisions: []model.AuthorizationDecision{{Action: "pet:create", Allowed: true, Reason: "allowed"}},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleAuditEventConnection = model.AuditEventConnection{
+		Edges:    []model.AuditEventEdge{{Node: SampleAuditEvent, Cursor: "cursor"}},
+		PageInfo: model.PageInfo{EndCursor: "cursor"},
+	}
+)
+
+func TestAuditHandleList(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name             string
+		auditService     FakeAuditService
+		request          controller.Request
+		expectedResponse controller.Response
+		expectedFilter   model.AuditEventsFilter
+		expectErr        bool
+	}{
+		{
+			name:         "valid request",
+			auditService: FakeAuditService{list: SampleAuditEventConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"first":  1,
+					"filter": map[string]interface{}{"username": "user1", "from": "2022-01-01T00:00:00Z"},
+				}},
+			},
+			expectedResponse: controller.Response{Data: SampleAuditEventConnection},
+			expectedFilter:   model.AuditEventsFilter{Username: "user1", From: "2022-01-01T00:00:00Z"},
+			expectErr:        false,
+		},
+		{
+			name:         "valid request without filter",
+			auditService: FakeAuditService{list: SampleAuditEventConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{"first": 1}},
+			},
+			expectedResponse: controller.Response{Data: SampleAuditEventConnection},
+			expectErr:        false,
+		},
+		{
+			name:         "service list error",
+			auditService: FakeAuditService{listErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{"first": 1}},
+			},
+			expectErr: true,
+		},
+		{
+			name:         "filter of the wrong type",
+			auditService: FakeAuditService{list: SampleAuditEventConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{"first": 1, "filter": "user1"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewAuditController(&test.auditService)
+
+		// Execute
+		response := controller.HandleList(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+			assert.Equal(t, test.expectedFilter, test.auditService.listFilter, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
@@ -1,45 +1,223 @@
 package controller_test
 
-import "github.com/mcwiet/go-test/pkg/model"
+import (
+	"context"
+	"errors"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
 
 type FakePetService struct {
-	createPet      model.Pet
-	createErr      error
-	deleteErr      error
-	getByIdUser    model.Pet
-	getByIdErr     error
-	listConnection model.PetConnection
-	listErr        error
-	updateOwnerPet model.Pet
-	updateOwnerErr error
-}
-
-func (s *FakePetService) Create(name string, age int, owner string) (model.Pet, error) {
+	createPet             model.Pet
+	createErr             error
+	createInput           model.CreatePetInput
+	deleteErr             error
+	getAsOfPet            model.Pet
+	getAsOfErr            error
+	getByIdUser           model.Pet
+	getByIdErr            error
+	historyConnection     model.PetConnection
+	historyErr            error
+	listConnection        model.PetConnection
+	listErr               error
+	listByOwnerConnection model.PetConnection
+	listByOwnerErr        error
+	listByOwnerOwner      string
+	listDeleted           model.PetConnection
+	listDeletedErr        error
+	purgeErr              error
+	removeOwnerPet        model.Pet
+	removeOwnerErr        error
+	restorePet            model.Pet
+	restoreErr            error
+	updatePet             model.Pet
+	updatePatch           model.PetPatch
+	updateExpectedVersion *int
+	updateErr             error
+}
+
+func (s *FakePetService) Create(ctx context.Context, requestor model.Identity, input model.CreatePetInput) (model.Pet, error) {
+	s.createInput = input
 	return s.createPet, s.createErr
 }
-func (s *FakePetService) Delete(id string) error {
+func (s *FakePetService) Delete(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) error {
 	return s.deleteErr
 }
-func (s *FakePetService) GetById(id string) (model.Pet, error) {
+func (s *FakePetService) GetAsOf(ctx context.Context, requestor model.Identity, id string, asOf string) (model.Pet, error) {
+	return s.getAsOfPet, s.getAsOfErr
+}
+func (s *FakePetService) GetById(ctx context.Context, requestor model.Identity, id string) (model.Pet, error) {
 	return s.getByIdUser, s.getByIdErr
 }
-func (s *FakePetService) List(first int, after string) (model.PetConnection, error) {
+func (s *FakePetService) History(ctx context.Context, requestor model.Identity, id string, first int, after string) (model.PetConnection, error) {
+	return s.historyConnection, s.historyErr
+}
+func (s *FakePetService) List(ctx context.Context, requestor model.Identity, first int, after string) (model.PetConnection, error) {
 	return s.listConnection, s.listErr
 }
-func (s *FakePetService) UpdateOwner(requestor model.Identity, id string, owner string) (model.Pet, error) {
-	return s.updateOwnerPet, s.updateOwnerErr
+func (s *FakePetService) ListByOwner(ctx context.Context, requestor model.Identity, owner string, first int, after string) (model.PetConnection, error) {
+	s.listByOwnerOwner = owner
+	return s.listByOwnerConnection, s.listByOwnerErr
+}
+func (s *FakePetService) ListDeleted(ctx context.Context, requestor model.Identity, first int, after string) (model.PetConnection, error) {
+	return s.listDeleted, s.listDeletedErr
+}
+func (s *FakePetService) Purge(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) error {
+	return s.purgeErr
+}
+func (s *FakePetService) RemoveOwner(ctx context.Context, requestor model.Identity, id string, owner string, expectedVersion *int) (model.Pet, error) {
+	return s.removeOwnerPet, s.removeOwnerErr
+}
+func (s *FakePetService) Restore(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) (model.Pet, error) {
+	return s.restorePet, s.restoreErr
+}
+func (s *FakePetService) Update(ctx context.Context, requestor model.Identity, id string, patch model.PetPatch, expectedVersion *int) (model.Pet, error) {
+	s.updatePatch = patch
+	s.updateExpectedVersion = expectedVersion
+	return s.updatePet, s.updateErr
 }
 
 type FakeUserService struct {
 	getByUsernameUser model.User
 	getByUsernameErr  error
+	getByUsernamesMap map[string]model.User
 	listConnection    model.UserConnection
 	listErr           error
 }
 
-func (s *FakeUserService) GetByUsername(username string) (model.User, error) {
+func (s *FakeUserService) GetByUsername(ctx context.Context, username string) (model.User, error) {
 	return s.getByUsernameUser, s.getByUsernameErr
 }
-func (s *FakeUserService) List(first int, after string) (model.UserConnection, error) {
+func (s *FakeUserService) GetByUsernames(ctx context.Context, usernames []string) ([]model.User, []error) {
+	users := make([]model.User, len(usernames))
+	errs := make([]error, len(usernames))
+	for i, username := range usernames {
+		user, found := s.getByUsernamesMap[username]
+		if found {
+			users[i] = user
+		} else {
+			errs[i] = errors.New("user not found")
+		}
+	}
+	return users, errs
+}
+func (s *FakeUserService) List(ctx context.Context, first int, after string) (model.UserConnection, error) {
 	return s.listConnection, s.listErr
 }
+
+type FakePhotoService struct {
+	listByPetMap         map[string][]model.PetPhoto
+	listByPetsCalls      int
+	requestUpload        model.PetPhotoUpload
+	requestUploadErr     error
+	requestContentType   string
+	requestContentLength int
+}
+
+func (s *FakePhotoService) ListByPets(ctx context.Context, petIds []string) ([][]model.PetPhoto, []error) {
+	s.listByPetsCalls++
+	photos := make([][]model.PetPhoto, len(petIds))
+	errs := make([]error, len(petIds))
+	for i, petId := range petIds {
+		found := false
+		photos[i], found = s.listByPetMap[petId]
+		if !found {
+			errs[i] = errors.New("could not list photos")
+		}
+	}
+	return photos, errs
+}
+func (s *FakePhotoService) RequestUpload(ctx context.Context, requestor model.Identity, petId string, contentType string, contentLength int) (model.PetPhotoUpload, error) {
+	s.requestContentType, s.requestContentLength = contentType, contentLength
+	return s.requestUpload, s.requestUploadErr
+}
+
+type FakePetTransferService struct {
+	acceptPet        model.Pet
+	acceptErr        error
+	addOwnerPet      model.Pet
+	addOwnerErr      error
+	addOwner         string
+	cancelErr        error
+	declineErr       error
+	listPending      []model.PetTransfer
+	listPendingErr   error
+	requestTransfer  model.PetTransfer
+	requestErr       error
+	requestRecipient string
+	updateOwnerPet   model.Pet
+	updateOwnerErr   error
+	updateOwner      string
+}
+
+func (s *FakePetTransferService) Accept(ctx context.Context, requestor model.Identity, petId string) (model.Pet, error) {
+	return s.acceptPet, s.acceptErr
+}
+func (s *FakePetTransferService) Cancel(ctx context.Context, requestor model.Identity, petId string) error {
+	return s.cancelErr
+}
+func (s *FakePetTransferService) Decline(ctx context.Context, requestor model.Identity, petId string) error {
+	return s.declineErr
+}
+func (s *FakePetTransferService) ListPending(ctx context.Context, requestor model.Identity) ([]model.PetTransfer, error) {
+	return s.listPending, s.listPendingErr
+}
+func (s *FakePetTransferService) Request(ctx context.Context, requestor model.Identity, petId string, recipient string) (model.PetTransfer, error) {
+	s.requestRecipient = recipient
+	return s.requestTransfer, s.requestErr
+}
+func (s *FakePetTransferService) RequestAddOwner(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (model.Pet, error) {
+	s.addOwner = owner
+	return s.addOwnerPet, s.addOwnerErr
+}
+func (s *FakePetTransferService) RequestOwnerUpdate(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (model.Pet, error) {
+	s.updateOwner = owner
+	return s.updateOwnerPet, s.updateOwnerErr
+}
+
+// Shows every field, unless hidden is set, in which case every email and the owners of every private pet are hidden
+type FakeFieldVisibility struct {
+	hidden bool
+}
+
+func (v *FakeFieldVisibility) User(identity model.Identity, user model.User) model.User {
+	if v.hidden {
+		user.Email = ""
+	}
+	return user
+}
+func (v *FakeFieldVisibility) Pet(identity model.Identity, pet model.Pet) model.Pet {
+	if v.hidden && pet.Private {
+		pet.Owners = []string{}
+	}
+	return pet
+}
+
+type FakeAuditService struct {
+	list       model.AuditEventConnection
+	listErr    error
+	listFilter model.AuditEventsFilter
+}
+
+func (s *FakeAuditService) List(ctx context.Context, requestor model.Identity, filter model.AuditEventsFilter, first int, after string) (model.AuditEventConnection, error) {
+	s.listFilter = filter
+	return s.list, s.listErr
+}
+
+// Remembers every mutation it records; fails to record them if recordErr is set
+type FakeAuditor struct {
+	recorded  []FakeAuditRecord
+	recordErr error
+}
+
+type FakeAuditRecord struct {
+	field       string
+	arguments   map[string]interface{}
+	decisions   []model.AuthorizationDecision
+	mutationErr error
+}
+
+func (a *FakeAuditor) Record(ctx context.Context, requestor model.Identity, field string, arguments map[string]interface{}, decisions []model.AuthorizationDecision, mutationErr error) error {
+	a.recorded = append(a.recorded, FakeAuditRecord{field: field, arguments: arguments, decisions: decisions, mutationErr: mutationErr})
+	return a.recordErr
+}
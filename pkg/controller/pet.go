@@ -1,53 +1,83 @@
 package controller
 
 import (
-	"encoding/json"
+	"context"
 
 	"github.com/mcwiet/go-test/pkg/model"
 )
 
 type PetService interface {
-	Create(name string, age int, owner string) (model.Pet, error)
-	Delete(id string) error
-	GetById(id string) (model.Pet, error)
-	List(first int, after string) (model.PetConnection, error)
-	UpdateOwner(requestor model.Identity, id string, owner string) (model.Pet, error)
+	Create(ctx context.Context, requestor model.Identity, input model.CreatePetInput) (model.Pet, error)
+	Delete(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) error
+	GetAsOf(ctx context.Context, requestor model.Identity, id string, asOf string) (model.Pet, error)
+	GetById(ctx context.Context, requestor model.Identity, id string) (model.Pet, error)
+	History(ctx context.Context, requestor model.Identity, id string, first int, after string) (model.PetConnection, error)
+	List(ctx context.Context, requestor model.Identity, first int, after string) (model.PetConnection, error)
+	ListByOwner(ctx context.Context, requestor model.Identity, owner string, first int, after string) (model.PetConnection, error)
+	ListDeleted(ctx context.Context, requestor model.Identity, first int, after string) (model.PetConnection, error)
+	Purge(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) error
+	RemoveOwner(ctx context.Context, requestor model.Identity, id string, owner string, expectedVersion *int) (model.Pet, error)
+	Restore(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) (model.Pet, error)
+	Update(ctx context.Context, requestor model.Identity, id string, patch model.PetPatch, expectedVersion *int) (model.Pet, error)
 }
 
 // Object containing data needed for the Pet controller
 type PetController struct {
 	petService PetService
+	visibility FieldVisibility
 }
 
 // Creates a new pet controller object
-func NewPetController(service PetService) PetController {
+func NewPetController(service PetService, visibility FieldVisibility) PetController {
 	return PetController{
 		petService: service,
+		visibility: visibility,
 	}
 }
 
+// Registers the fields resolved by the pet controller
+func (c *PetController) RegisterResolvers(registry *ResolverRegistry) {
+	registry.Register("Query", "pet", c.HandleGet)
+	registry.Register("Query", "pets", c.HandleList)
+	registry.Register("Query", "deletedPets", c.HandleListDeleted)
+	registry.Register("Query", "myPets", c.HandleListMine)
+	registry.Register("Query", "petHistory", c.HandleHistory)
+	registry.Register("Mutation", "createPet", c.HandleCreate)
+	registry.Register("Mutation", "deletePet", c.HandleDelete)
+	registry.Register("Mutation", "removePetOwner", c.HandleRemoveOwner)
+	registry.Register("Mutation", "restorePet", c.HandleRestore)
+	registry.Register("Mutation", "updatePet", c.HandleUpdate)
+}
+
 // Handles request for creating a pet
-func (c *PetController) HandleCreate(request Request) Response {
+func (c *PetController) HandleCreate(ctx context.Context, request Request) Response {
 	var input model.CreatePetInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	pet, err := c.petService.Create(input.Name, input.Age, input.Owner)
+	pet, err := c.petService.Create(ctx, request.Identity, input)
 
 	if err == nil {
-		return Response{Data: model.CreatePetPayload{Pet: pet}}
+		return Response{Data: model.CreatePetPayload{Pet: c.visibility.Pet(request.Identity, pet)}}
 	} else {
 		return Response{Error: err}
 	}
 }
 
-// Handles request for deleting a pet
-func (c *PetController) HandleDelete(request Request) Response {
+// Handles request for deleting a pet; the pet can be restored unless it is purged
+func (c *PetController) HandleDelete(ctx context.Context, request Request) Response {
 	var input model.DeletePetInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	err := c.petService.Delete(input.Id)
+	var err error
+	if input.Purge {
+		err = c.petService.Purge(ctx, request.Identity, input.Id, input.ExpectedVersion)
+	} else {
+		err = c.petService.Delete(ctx, request.Identity, input.Id, input.ExpectedVersion)
+	}
 
 	if err == nil {
 		//lint:ignore S1016 Input and payload happen to look similar
@@ -57,46 +87,150 @@ func (c *PetController) HandleDelete(request Request) Response {
 	}
 }
 
-// Handles request for getting a specific pet
-func (c *PetController) HandleGet(request Request) Response {
+// Handles request for getting a specific pet, either as it is now or as it was at a given time
+func (c *PetController) HandleGet(ctx context.Context, request Request) Response {
 	var input model.PetInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	pet, err := c.petService.GetById(input.Id)
+	var pet model.Pet
+	var err error
+	if input.AsOf != "" {
+		pet, err = c.petService.GetAsOf(ctx, request.Identity, input.Id, input.AsOf)
+	} else {
+		pet, err = c.petService.GetById(ctx, request.Identity, input.Id)
+	}
 
 	if err == nil {
-		return Response{Data: pet}
+		return Response{Data: c.visibility.Pet(request.Identity, pet)}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for listing the versions of a pet
+func (c *PetController) HandleHistory(ctx context.Context, request Request) Response {
+	var input model.PetHistoryInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	connection, err := c.petService.History(ctx, request.Identity, input.Id, input.First, input.After)
+
+	if err == nil {
+		return Response{Data: visiblePets(c.visibility, request.Identity, connection)}
 	} else {
 		return Response{Error: err}
 	}
 }
 
 // Handles request for listing pets
-func (c *PetController) HandleList(request Request) Response {
+func (c *PetController) HandleList(ctx context.Context, request Request) Response {
 	var input model.PetsInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	connection, err := c.petService.List(input.First, input.After)
+	var connection model.PetConnection
+	var err error
+	if input.Owner != "" {
+		connection, err = c.petService.ListByOwner(ctx, request.Identity, input.Owner, input.First, input.After)
+	} else {
+		connection, err = c.petService.List(ctx, request.Identity, input.First, input.After)
+	}
 
 	if err == nil {
-		return Response{Data: connection}
+		return Response{Data: visiblePets(c.visibility, request.Identity, connection)}
 	} else {
 		return Response{Error: err}
 	}
 }
 
-// Handles request for updating a pet
-func (c *PetController) HandleUpdateOwner(request Request) Response {
-	var input model.UpdatePetOwnerInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+// Handles request for listing deleted pets
+func (c *PetController) HandleListDeleted(ctx context.Context, request Request) Response {
+	var input model.DeletedPetsInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	connection, err := c.petService.ListDeleted(ctx, request.Identity, input.First, input.After)
+
+	if err == nil {
+		return Response{Data: visiblePets(c.visibility, request.Identity, connection)}
+	} else {
+		return Response{Error: err}
+	}
+}
 
-	updatedPet, err := c.petService.UpdateOwner(request.Identity, input.Id, input.Owner)
+// Handles request for listing the pets the caller owns
+func (c *PetController) HandleListMine(ctx context.Context, request Request) Response {
+	var input model.MyPetsInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	connection, err := c.petService.ListByOwner(ctx, request.Identity, request.Identity.Username, input.First, input.After)
+
+	if err == nil {
+		return Response{Data: visiblePets(c.visibility, request.Identity, connection)}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for removing an owner from a pet
+func (c *PetController) HandleRemoveOwner(ctx context.Context, request Request) Response {
+	var input model.RemovePetOwnerInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	updatedPet, err := c.petService.RemoveOwner(ctx, request.Identity, input.Id, input.Owner, input.ExpectedVersion)
+
+	if err == nil {
+		return Response{Data: model.RemovePetOwnerPayload{Pet: c.visibility.Pet(request.Identity, updatedPet)}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for restoring a deleted pet
+func (c *PetController) HandleRestore(ctx context.Context, request Request) Response {
+	var input model.RestorePetInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	pet, err := c.petService.Restore(ctx, request.Identity, input.Id, input.ExpectedVersion)
+
+	if err == nil {
+		return Response{Data: model.RestorePetPayload{Pet: c.visibility.Pet(request.Identity, pet)}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for updating a pet; fields left out of the input are left unchanged
+func (c *PetController) HandleUpdate(ctx context.Context, request Request) Response {
+	var input model.UpdatePetInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	patch := model.PetPatch{
+		Name:      input.Name,
+		Species:   input.Species,
+		Breed:     input.Breed,
+		BirthDate: input.BirthDate,
+		Age:       input.Age,
+		Owners:    input.Owners,
+		Private:   input.Private,
+	}
+	updatedPet, err := c.petService.Update(ctx, request.Identity, input.Id, patch, input.ExpectedVersion)
 
 	if err == nil {
-		return Response{Data: model.UpdatePetOwnerPayload{Pet: updatedPet}}
+		return Response{Data: model.UpdatePetPayload{Pet: c.visibility.Pet(request.Identity, updatedPet)}}
 	} else {
 		return Response{Error: err}
 	}
@@ -1,20 +1,31 @@
 package controller_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/controller"
 	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/validation"
+	"github.com/openlyinc/pointy"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	SamplePet = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "Levi",
-		Age:   1,
-		Owner: "User",
+		Id:     uuid.NewString(),
+		Name:   "Levi",
+		Age:    1,
+		Owners: []string{"User"},
+	}
+	SamplePrivatePet = model.Pet{
+		Id:      uuid.NewString(),
+		Name:    "Mika",
+		Age:     2,
+		Owners:  []string{"User"},
+		Private: true,
 	}
 	SamplePetConnection = model.PetConnection{
 		TotalCount: 1,
@@ -27,6 +38,7 @@ var (
 type PetTest struct {
 	name             string
 	petService       FakePetService
+	visibility       FakeFieldVisibility
 	request          controller.Request
 	expectedResponse controller.Response
 	expectErr        bool
@@ -42,9 +54,9 @@ func TestPetHandleCreate(t *testing.T) {
 			},
 			request: controller.Request{
 				Arguments: map[string]interface{}{"input": map[string]interface{}{
-					"name":  SamplePet.Name,
-					"age":   float64(SamplePet.Age),
-					"owner": SamplePet.Owner,
+					"name":   SamplePet.Name,
+					"age":    float64(SamplePet.Age),
+					"owners": []interface{}{"User"},
 				}},
 			},
 			expectedResponse: controller.Response{
@@ -77,22 +89,45 @@ func TestPetHandleCreate(t *testing.T) {
 			},
 			request: controller.Request{
 				Arguments: map[string]interface{}{"input": map[string]interface{}{
-					"name":  SamplePet.Name,
-					"age":   float64(SamplePet.Age),
-					"owner": SamplePet.Owner,
+					"name":   SamplePet.Name,
+					"age":    float64(SamplePet.Age),
+					"owners": []interface{}{"User"},
 				}},
 			},
 			expectErr: true,
 		},
+		{
+			name: "argument of the wrong type",
+			petService: FakePetService{
+				createPet: SamplePet,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"name": SamplePet.Name,
+					"age":  "one",
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "input which isn't an object",
+			petService: FakePetService{
+				createPet: SamplePet,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": "pet"},
+			},
+			expectErr: true,
+		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewPetController(&test.petService)
+		controller := controller.NewPetController(&test.petService, &test.visibility)
 
 		// Execute
-		response := controller.HandleCreate(test.request)
+		response := controller.HandleCreate(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -103,6 +138,29 @@ func TestPetHandleCreate(t *testing.T) {
 	}
 }
 
+func TestPetHandleCreatePassesInput(t *testing.T) {
+	// Setup
+	petService := FakePetService{createPet: SamplePet}
+	request := controller.Request{
+		Arguments: map[string]interface{}{"input": map[string]interface{}{
+			"name":      SamplePet.Name,
+			"species":   "DOG",
+			"breed":     "Beagle",
+			"birthDate": "2020-01-02",
+			"owners":    []interface{}{"User 1", "User 2"},
+			"private":   true,
+		}},
+	}
+	controller := controller.NewPetController(&petService, &FakeFieldVisibility{})
+
+	// Execute
+	response := controller.HandleCreate(context.Background(), request)
+
+	// Verify
+	assert.Nil(t, response.Error)
+	assert.Equal(t, model.CreatePetInput{Name: SamplePet.Name, Species: model.SpeciesDog, Breed: "Beagle", BirthDate: "2020-01-02", Owners: []string{"User 1", "User 2"}, Private: true}, petService.createInput)
+}
+
 func TestPetHandleDelete(t *testing.T) {
 	// Define tests
 	tests := []PetTest{
@@ -133,15 +191,46 @@ func TestPetHandleDelete(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "valid purge",
+			petService: FakePetService{
+				deleteErr: assert.AnError,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"purge": true,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.DeletePetPayload{
+					Id: SamplePet.Id,
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "service purge error",
+			petService: FakePetService{
+				purgeErr: assert.AnError,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"purge": true,
+				}},
+			},
+			expectErr: true,
+		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewPetController(&test.petService)
+		controller := controller.NewPetController(&test.petService, &test.visibility)
 
 		// Execute
-		response := controller.HandleDelete(test.request)
+		response := controller.HandleDelete(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -170,6 +259,22 @@ func TestPetHandleGet(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "get private pet with its owners hidden",
+			petService: FakePetService{
+				getByIdUser: SamplePrivatePet,
+			},
+			visibility: FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id": SamplePrivatePet.Id,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.Pet{Id: SamplePrivatePet.Id, Name: "Mika", Age: 2, Owners: []string{}, Private: true},
+			},
+			expectErr: false,
+		},
 		{
 			name: "service get error",
 			petService: FakePetService{
@@ -182,15 +287,46 @@ func TestPetHandleGet(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "valid get as of",
+			petService: FakePetService{
+				getByIdErr: assert.AnError,
+				getAsOfPet: SamplePet,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":   SamplePet.Id,
+					"asOf": "2022-01-01T00:00:00Z",
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: SamplePet,
+			},
+			expectErr: false,
+		},
+		{
+			name: "service get as of error",
+			petService: FakePetService{
+				getByIdUser: SamplePet,
+				getAsOfErr:  assert.AnError,
+			},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":   SamplePet.Id,
+					"asOf": "2022-01-01T00:00:00Z",
+				}},
+			},
+			expectErr: true,
+		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewPetController(&test.petService)
+		controller := controller.NewPetController(&test.petService, &test.visibility)
 
 		// Execute
-		response := controller.HandleGet(test.request)
+		response := controller.HandleGet(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -204,6 +340,29 @@ func TestPetHandleGet(t *testing.T) {
 func TestPetHandleList(t *testing.T) {
 	// Define tests
 	tests := []PetTest{
+		{
+			name: "list with the owners of private pets hidden",
+			petService: FakePetService{
+				listConnection: model.PetConnection{
+					TotalCount: 2,
+					Edges:      []model.PetEdge{{Node: SamplePet, Cursor: "1"}, {Node: SamplePrivatePet, Cursor: "2"}},
+				},
+			},
+			visibility: FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{},
+			},
+			expectedResponse: controller.Response{
+				Data: model.PetConnection{
+					TotalCount: 2,
+					Edges: []model.PetEdge{
+						{Node: SamplePet, Cursor: "1"},
+						{Node: model.Pet{Id: SamplePrivatePet.Id, Name: "Mika", Age: 2, Owners: []string{}, Private: true}, Cursor: "2"},
+					},
+				},
+			},
+			expectErr: false,
+		},
 		{
 			name: "list without input",
 			petService: FakePetService{
@@ -231,6 +390,20 @@ func TestPetHandleList(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name:       "list by owner",
+			petService: FakePetService{listByOwnerConnection: SamplePetConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"first": float64(10),
+					"owner": "owner",
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: SamplePetConnection,
+			},
+			expectErr: false,
+		},
 		{
 			name:       "service list error",
 			petService: FakePetService{listErr: assert.AnError},
@@ -244,10 +417,10 @@ func TestPetHandleList(t *testing.T) {
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewPetController(&test.petService)
+		controller := controller.NewPetController(&test.petService, &test.visibility)
 
 		// Execute
-		response := controller.HandleList(test.request)
+		response := controller.HandleList(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -258,40 +431,214 @@ func TestPetHandleList(t *testing.T) {
 	}
 }
 
-func TestPetHandleUpdateOwner(t *testing.T) {
+func TestPetHandleListMine(t *testing.T) {
 	// Define tests
 	tests := []PetTest{
 		{
-			name: "valid update owner",
-			petService: FakePetService{
-				updateOwnerPet: SamplePet,
+			name:       "list caller's pets",
+			petService: FakePetService{listByOwnerConnection: SamplePetConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"first": float64(10),
+					"after": "some cursor value",
+				}},
+				Identity: model.Identity{Username: "owner"},
 			},
+			expectedResponse: controller.Response{
+				Data: SamplePetConnection,
+			},
+			expectErr: false,
+		},
+		{
+			name:       "service list error",
+			petService: FakePetService{listByOwnerErr: assert.AnError},
 			request: controller.Request{
-				Arguments: map[string]interface{}{
+				Arguments: map[string]interface{}{},
+				Identity:  model.Identity{Username: "owner"},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetController(&test.petService, &test.visibility)
+
+		// Execute
+		response := controller.HandleListMine(context.Background(), test.request)
+
+		// Verify
+		assert.Equal(t, test.request.Identity.Username, test.petService.listByOwnerOwner, test.name)
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetHandleHistory(t *testing.T) {
+	// Define tests
+	tests := []PetTest{
+		{
+			name:       "list pet history",
+			petService: FakePetService{historyConnection: SamplePetConnection},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
 					"id":    SamplePet.Id,
-					"owner": SamplePet.Owner,
-				},
+					"first": float64(10),
+					"after": "some cursor value",
+				}},
 			},
 			expectedResponse: controller.Response{
-				Data: model.UpdatePetOwnerPayload{
-					Pet: SamplePet,
-				},
+				Data: SamplePetConnection,
+			},
+			expectErr: false,
+		},
+		{
+			name:       "service history error",
+			petService: FakePetService{historyErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id": SamplePet.Id,
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetController(&test.petService, &test.visibility)
+
+		// Execute
+		response := controller.HandleHistory(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetHandleRestore(t *testing.T) {
+	// Define tests
+	tests := []PetTest{
+		{
+			name:       "valid restore",
+			petService: FakePetService{restorePet: SamplePet},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":              SamplePet.Id,
+					"expectedVersion": float64(2),
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.RestorePetPayload{Pet: SamplePet},
 			},
 			expectErr: false,
 		},
 		{
-			name:       "service update owner error",
-			petService: FakePetService{updateOwnerErr: assert.AnError},
+			name:       "service restore error",
+			petService: FakePetService{restoreErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id": SamplePet.Id,
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetController(&test.petService, &test.visibility)
+
+		// Execute
+		response := controller.HandleRestore(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetHandleListDeleted(t *testing.T) {
+	// Define tests
+	tests := []PetTest{
+		{
+			name:       "list deleted pets",
+			petService: FakePetService{listDeleted: SamplePetConnection},
 			request: controller.Request{
-				Arguments: map[string]interface{}{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"first": float64(10),
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: SamplePetConnection,
+			},
+			expectErr: false,
+		},
+		{
+			name:       "service list deleted error",
+			petService: FakePetService{listDeletedErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetController(&test.petService, &test.visibility)
+
+		// Execute
+		response := controller.HandleListDeleted(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetHandleRemoveOwner(t *testing.T) {
+	// Define tests
+	tests := []PetTest{
+		{
+			name:       "valid remove owner",
+			petService: FakePetService{removeOwnerPet: SamplePet},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
 					"id":    SamplePet.Id,
-					"owner": SamplePet.Owner,
-				},
+					"owner": "User 2",
+				}},
 			},
 			expectedResponse: controller.Response{
-				Data: model.UpdatePetOwnerPayload{
-					Pet: SamplePet,
-				},
+				Data: model.RemovePetOwnerPayload{Pet: SamplePet},
+			},
+			expectErr: false,
+		},
+		{
+			name:       "service remove owner error",
+			petService: FakePetService{removeOwnerErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"owner": "User 2",
+				}},
 			},
 			expectErr: true,
 		},
@@ -300,10 +647,10 @@ func TestPetHandleUpdateOwner(t *testing.T) {
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewPetController(&test.petService)
+		controller := controller.NewPetController(&test.petService, &test.visibility)
 
 		// Execute
-		response := controller.HandleUpdateOwner(test.request)
+		response := controller.HandleRemoveOwner(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -313,3 +660,97 @@ func TestPetHandleUpdateOwner(t *testing.T) {
 		}
 	}
 }
+
+func TestPetHandleUpdate(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                    string
+		petService              FakePetService
+		input                   map[string]interface{}
+		expectedPatch           model.PetPatch
+		expectedExpectedVersion *int
+		expectErr               bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:          "update name",
+			petService:    FakePetService{updatePet: SamplePet},
+			input:         map[string]interface{}{"id": SamplePet.Id, "name": SamplePet.Name},
+			expectedPatch: model.PetPatch{Name: &SamplePet.Name},
+			expectErr:     false,
+		},
+		{
+			name:          "update every field",
+			petService:    FakePetService{updatePet: SamplePet},
+			input:         map[string]interface{}{"id": SamplePet.Id, "name": SamplePet.Name, "age": SamplePet.Age, "owners": []interface{}{}},
+			expectedPatch: model.PetPatch{Name: &SamplePet.Name, Age: &SamplePet.Age, Owners: &[]string{}},
+			expectErr:     false,
+		},
+		{
+			name:          "update species, breed and birth date",
+			petService:    FakePetService{updatePet: SamplePet},
+			input:         map[string]interface{}{"id": SamplePet.Id, "species": "CAT", "breed": "Siamese", "birthDate": "2020-01-02"},
+			expectedPatch: model.PetPatch{Species: (*model.Species)(pointy.String("CAT")), Breed: pointy.String("Siamese"), BirthDate: pointy.String("2020-01-02")},
+			expectErr:     false,
+		},
+		{
+			name:          "make private",
+			petService:    FakePetService{updatePet: SamplePet},
+			input:         map[string]interface{}{"id": SamplePet.Id, "private": true},
+			expectedPatch: model.PetPatch{Private: pointy.Bool(true)},
+			expectErr:     false,
+		},
+		{
+			name:                    "update with expected version",
+			petService:              FakePetService{updatePet: SamplePet},
+			input:                   map[string]interface{}{"id": SamplePet.Id, "age": SamplePet.Age, "expectedVersion": 4},
+			expectedPatch:           model.PetPatch{Age: &SamplePet.Age},
+			expectedExpectedVersion: pointy.Int(4),
+			expectErr:               false,
+		},
+		{
+			name:          "service update error",
+			petService:    FakePetService{updateErr: assert.AnError},
+			input:         map[string]interface{}{"id": SamplePet.Id, "age": SamplePet.Age},
+			expectedPatch: model.PetPatch{Age: &SamplePet.Age},
+			expectErr:     true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		request := controller.Request{Arguments: map[string]interface{}{"input": test.input}}
+		expectedResponse := controller.Response{Data: model.UpdatePetPayload{Pet: SamplePet}}
+		controller := controller.NewPetController(&test.petService, &FakeFieldVisibility{})
+
+		// Execute
+		response := controller.HandleUpdate(context.Background(), request)
+
+		// Verify
+		assert.Equal(t, test.expectedPatch, test.petService.updatePatch, test.name)
+		assert.Equal(t, test.expectedExpectedVersion, test.petService.updateExpectedVersion, test.name)
+		if !test.expectErr {
+			assert.Equal(t, expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetHandleCreateReportsArgumentPath(t *testing.T) {
+	// Setup
+	request := controller.Request{
+		Arguments: map[string]interface{}{"input": map[string]interface{}{"age": "one"}},
+	}
+	controller := controller.NewPetController(&FakePetService{}, &FakeFieldVisibility{})
+
+	// Execute
+	response := controller.HandleCreate(context.Background(), request)
+
+	// Verify
+	assert.Equal(t, apperror.CodeValidation, apperror.CodeOf(response.Error))
+	assert.Equal(t, []validation.Violation{{Path: "input.age", Message: "cannot be a string"}}, apperror.InfoOf(response.Error)["violations"])
+}
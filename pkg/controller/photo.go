@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+type PhotoService interface {
+	ListByPets(ctx context.Context, petIds []string) ([][]model.PetPhoto, []error)
+	RequestUpload(ctx context.Context, requestor model.Identity, petId string, contentType string, contentLength int) (model.PetPhotoUpload, error)
+}
+
+// Object containing data needed for the Photo controller
+type PhotoController struct {
+	photoService PhotoService
+}
+
+// Creates a new photo controller object
+func NewPhotoController(service PhotoService) PhotoController {
+	return PhotoController{
+		photoService: service,
+	}
+}
+
+// Registers the fields resolved by the photo controller
+func (c *PhotoController) RegisterResolvers(registry *ResolverRegistry) {
+	registry.Register("Mutation", "requestPetPhotoUpload", c.HandleRequestUpload)
+	registry.RegisterBatch("Pet", "photos", c.HandleBatchListPetPhotos, 100)
+}
+
+// Handles a batch of requests for the photos of a pet (the pet is the source of each request); the photos of every pet
+// in the batch are listed at once
+func (c *PhotoController) HandleBatchListPetPhotos(ctx context.Context, requests []Request) []Response {
+	responses := make([]Response, len(requests))
+	petIds := make([]string, len(requests))
+	for i, request := range requests {
+		petIds[i], _ = request.Source["id"].(string)
+	}
+
+	photos, errs := c.photoService.ListByPets(ctx, petIds)
+	for i := range requests {
+		if errs[i] == nil {
+			responses[i] = Response{Data: photos[i]}
+		} else {
+			responses[i] = Response{Error: errs[i]}
+		}
+	}
+
+	return responses
+}
+
+// Handles request for a URL to upload a photo of a pet to
+func (c *PhotoController) HandleRequestUpload(ctx context.Context, request Request) Response {
+	var input model.RequestPetPhotoUploadInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	upload, err := c.photoService.RequestUpload(ctx, request.Identity, input.PetId, input.ContentType, input.ContentLength)
+
+	if err == nil {
+		return Response{Data: model.RequestPetPhotoUploadPayload{PhotoUpload: upload}}
+	} else {
+		return Response{Error: err}
+	}
+}
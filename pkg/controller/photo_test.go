@@ -0,0 +1,95 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SamplePhoto       = model.PetPhoto{Key: "pets/1/photos/a", Url: "https://bucket/pets/1/photos/a"}
+	SamplePhotoUpload = model.PetPhotoUpload{Key: "pets/1/photos/b", UploadUrl: "https://bucket/pets/1/photos/b", ExpiresAt: "2022-01-01T00:15:00Z"}
+)
+
+func TestPhotoHandleRequestUpload(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name             string
+		photoService     FakePhotoService
+		request          controller.Request
+		expectedResponse controller.Response
+		expectErr        bool
+	}{
+		{
+			name:         "valid request",
+			photoService: FakePhotoService{requestUpload: SamplePhotoUpload},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{"petId": "1", "contentType": "image/png", "contentLength": float64(1024)}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.RequestPetPhotoUploadPayload{PhotoUpload: SamplePhotoUpload},
+			},
+			expectErr: false,
+		},
+		{
+			name:         "service request upload error",
+			photoService: FakePhotoService{requestUploadErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{"petId": "1"}},
+			},
+			expectErr: true,
+		},
+		{
+			name:         "input which isn't an object",
+			photoService: FakePhotoService{requestUpload: SamplePhotoUpload},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": "1"},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPhotoController(&test.photoService)
+
+		// Execute
+		response := controller.HandleRequestUpload(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+			assert.Equal(t, "image/png", test.photoService.requestContentType, test.name)
+			assert.Equal(t, 1024, test.photoService.requestContentLength, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPhotoHandleBatchListPetPhotos(t *testing.T) {
+	// Setup
+	photoService := FakePhotoService{
+		listByPetMap: map[string][]model.PetPhoto{"1": {SamplePhoto}, "2": {}},
+	}
+	requests := []controller.Request{
+		{Source: map[string]interface{}{"id": "1"}},
+		{Source: map[string]interface{}{"id": "2"}},
+		{Source: map[string]interface{}{"id": "3"}},
+	}
+	controller := controller.NewPhotoController(&photoService)
+
+	// Execute
+	responses := controller.HandleBatchListPetPhotos(context.Background(), requests)
+
+	// Verify
+	assert.Equal(t, 3, len(responses), "responses aligned with requests")
+	assert.Equal(t, []model.PetPhoto{SamplePhoto}, responses[0].Data, "pet with photos")
+	assert.Equal(t, []model.PetPhoto{}, responses[1].Data, "pet without photos")
+	assert.NotNil(t, responses[2].Error, "service list error")
+	assert.Equal(t, 1, photoService.listByPetsCalls, "every pet is listed at once")
+}
@@ -1,7 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/validation"
 )
 
 // Standard request format
@@ -10,4 +15,22 @@ type Request struct {
 	FieldName      string
 	ParentTypeName string
 	Identity       model.Identity
+	Source         map[string]interface{} // parent object (only set for fields which aren't on Query / Mutation)
+}
+
+// Decodes the 'input' argument of a request; values of the wrong type are reported as validation errors
+func decodeInput(request Request, input interface{}) error {
+	inputBytes, _ := json.Marshal(request.Arguments["input"])
+	err := json.Unmarshal(inputBytes, input)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		v := validation.NewValidator("input")
+		v.Add(typeErr.Field, "cannot be a "+typeErr.Value)
+		return v.Err()
+	} else if err != nil {
+		return apperror.NewValidation("input must be an object", err)
+	}
+
+	return nil
 }
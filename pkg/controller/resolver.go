@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/audit"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Function which handles the request for a single field
+type Handler func(context.Context, Request) Response
+
+// Function which handles many requests for the same field at once; responses are index aligned with the requests
+type BatchHandler func(context.Context, []Request) []Response
+
+// Schema field along with the handler which resolves it
+type Resolver struct {
+	TypeName     string
+	FieldName    string
+	Handler      Handler
+	BatchHandler BatchHandler // only set for batch resolvers
+	MaxBatchSize int          // max number of requests AppSync sends per invocation (0 disables batching)
+}
+
+// Records mutations in the audit log
+type Auditor interface {
+	Record(ctx context.Context, requestor model.Identity, field string, arguments map[string]interface{}, decisions []model.AuthorizationDecision, mutationErr error) error
+}
+
+// Collection of resolvers which routes requests to the handler registered for the requested field
+type ResolverRegistry struct {
+	resolvers []Resolver
+	auditor   Auditor // nil if mutations aren't audited
+}
+
+// Creates an empty resolver registry
+func NewResolverRegistry() ResolverRegistry {
+	return ResolverRegistry{
+		resolvers: []Resolver{},
+	}
+}
+
+// Registers the handler for a field
+func (r *ResolverRegistry) Register(typeName string, fieldName string, handler Handler) {
+	r.resolvers = append(r.resolvers, Resolver{
+		TypeName:  typeName,
+		FieldName: fieldName,
+		Handler:   handler,
+	})
+}
+
+// Registers the batch handler for a field; AppSync sends up to maxBatchSize requests per invocation
+func (r *ResolverRegistry) RegisterBatch(typeName string, fieldName string, handler BatchHandler, maxBatchSize int) {
+	r.resolvers = append(r.resolvers, Resolver{
+		TypeName:  typeName,
+		FieldName: fieldName,
+		Handler: func(ctx context.Context, request Request) Response {
+			return handler(ctx, []Request{request})[0]
+		},
+		BatchHandler: handler,
+		MaxBatchSize: maxBatchSize,
+	})
+}
+
+// Sets the auditor every mutation handled from now on is recorded with (along with the authorization decisions made
+// while handling it)
+func (r *ResolverRegistry) SetAuditor(auditor Auditor) {
+	r.auditor = auditor
+}
+
+// Gets all resolvers in the order they were registered
+func (r *ResolverRegistry) Resolvers() []Resolver {
+	return append([]Resolver{}, r.resolvers...)
+}
+
+// Checks whether a handler is registered for a field
+func (r *ResolverRegistry) IsRegistered(typeName string, fieldName string) bool {
+	_, found := r.find(typeName, fieldName)
+	return found
+}
+
+// Handles a request using the handler registered for the requested field
+func (r *ResolverRegistry) Handle(ctx context.Context, request Request) Response {
+	ctx, logger, recorder := withRequestContext(ctx, request)
+	ctx, span := tracing.Start(ctx, request.ParentTypeName+"."+request.FieldName)
+	start := time.Now()
+
+	var trail *audit.Trail
+	if r.auditor != nil && request.ParentTypeName == "Mutation" {
+		trail = audit.NewTrail()
+		ctx = audit.NewContext(ctx, trail)
+	}
+
+	var response Response
+	resolver, found := r.find(request.ParentTypeName, request.FieldName)
+	if !found {
+		response = newNotRecognizedResponse(request)
+	} else {
+		response = resolver.Handler(ctx, request)
+	}
+
+	// The mutation has already happened, so failing to record it is logged rather than returned
+	if trail != nil {
+		field := request.ParentTypeName + "." + request.FieldName
+		err := r.auditor.Record(ctx, request.Identity, field, request.Arguments, trail.Decisions(), response.Error)
+		if err != nil {
+			logger.Error("could not record audit event", err, nil)
+		}
+	}
+
+	reportResponses(logger, recorder, span, start, []Response{response})
+	return response
+}
+
+// Handles a batch of requests; requests for batch resolvers are passed to the batch handler together
+func (r *ResolverRegistry) HandleBatch(ctx context.Context, requests []Request) []Response {
+	responses := make([]Response, len(requests))
+
+	// Group the requests by field, remembering where each came from
+	groups := map[string][]int{}
+	order := []string{}
+	for i, request := range requests {
+		name := request.ParentTypeName + "." + request.FieldName
+		if _, exists := groups[name]; !exists {
+			order = append(order, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+
+	for _, name := range order {
+		indexes := groups[name]
+		first := requests[indexes[0]]
+		ctx, logger, recorder := withRequestContext(ctx, first)
+		logger = logger.With(logging.Fields{"batchSize": len(indexes)})
+		ctx, span := tracing.Start(ctx, name)
+		start := time.Now()
+
+		resolver, found := r.find(first.ParentTypeName, first.FieldName)
+		switch {
+		case !found:
+			for _, i := range indexes {
+				responses[i] = newNotRecognizedResponse(requests[i])
+			}
+		case resolver.BatchHandler != nil:
+			group := []Request{}
+			for _, i := range indexes {
+				group = append(group, requests[i])
+			}
+			for j, response := range resolver.BatchHandler(ctx, group) {
+				responses[indexes[j]] = response
+			}
+		default:
+			for _, i := range indexes {
+				responses[i] = resolver.Handler(ctx, requests[i])
+			}
+		}
+
+		group := []Response{}
+		for _, i := range indexes {
+			group = append(group, responses[i])
+		}
+		reportResponses(logger, recorder, span, start, group)
+	}
+
+	return responses
+}
+
+// Checks every Query and Mutation field in the schema has exactly one handler and every handler belongs to a schema field
+func (r *ResolverRegistry) Validate(schemaSource string) error {
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: schemaSource})
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	problems := []string{}
+	for _, resolver := range r.resolvers {
+		name := resolver.TypeName + "." + resolver.FieldName
+		counts[name]++
+		if counts[name] == 2 {
+			problems = append(problems, name+" has more than one handler")
+		}
+		definition := schema.Types[resolver.TypeName]
+		if definition == nil || definition.Fields.ForName(resolver.FieldName) == nil {
+			problems = append(problems, name+" is not in the schema")
+		}
+	}
+
+	for _, root := range []*ast.Definition{schema.Query, schema.Mutation} {
+		if root == nil {
+			continue
+		}
+		for _, field := range root.Fields {
+			name := root.Name + "." + field.Name
+			if !strings.HasPrefix(field.Name, "__") && counts[name] == 0 {
+				problems = append(problems, name+" has no handler")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("resolvers do not match schema: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func (r *ResolverRegistry) find(typeName string, fieldName string) (Resolver, bool) {
+	for _, resolver := range r.resolvers {
+		if resolver.TypeName == typeName && resolver.FieldName == fieldName {
+			return resolver, true
+		}
+	}
+	return Resolver{}, false
+}
+
+// Adds the resolver and caller to the context's logger and the field to its metrics recorder, so everything logged
+// or recorded while handling the request carries them
+func withRequestContext(ctx context.Context, request Request) (context.Context, logging.Logger, metrics.Recorder) {
+	field := request.ParentTypeName + "." + request.FieldName
+	logger := logging.FromContext(ctx).With(logging.Fields{
+		"resolver": field,
+		"username": request.Identity.Username,
+	})
+	recorder := metrics.FromContext(ctx).With(metrics.Dimensions{"Field": field})
+	ctx = logging.NewContext(ctx, logger)
+	ctx = metrics.NewContext(ctx, recorder)
+	return ctx, logger, recorder
+}
+
+// Logs the outcome of a request (or a summary of a batch of requests, along with each failure), records its metrics
+// and ends its span (with the first error, if any)
+func reportResponses(logger logging.Logger, recorder metrics.Recorder, span tracing.Span, start time.Time, responses []Response) {
+	failed := 0
+	var firstErr error
+	for _, response := range responses {
+		if response.Error != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = response.Error
+			}
+		}
+	}
+	span.End(firstErr)
+	recorder.RecordRequests(len(responses), failed, start)
+
+	duration := logging.Fields{"durationMs": logging.Since(start)}
+	if len(responses) == 1 {
+		if responses[0].Error != nil {
+			logger.Error("request failed", responses[0].Error, duration)
+		} else {
+			logger.Info("request handled", duration)
+		}
+		return
+	}
+
+	for _, response := range responses {
+		if response.Error != nil {
+			logger.Error("batch item failed", response.Error, nil)
+		}
+	}
+	duration["errorCount"] = failed
+	logger.Info("batch handled", duration)
+}
+
+func newNotRecognizedResponse(request Request) Response {
+	return Response{Error: errors.New(request.ParentTypeName + "." + request.FieldName + " not recognized")}
+}
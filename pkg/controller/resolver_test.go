@@ -0,0 +1,377 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mcwiet/go-test/api"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/audit"
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	SampleSchema = `
+		schema { query: Query, mutation: Mutation }
+		type Query { a: String, b: String }
+		type Mutation { c: String }
+	`
+)
+
+func newStaticHandler(data string) controller.Handler {
+	return func(context.Context, controller.Request) controller.Response {
+		return controller.Response{Data: data}
+	}
+}
+
+func TestResolverHandle(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name             string
+		request          controller.Request
+		expectedResponse controller.Response
+		expectErr        bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:             "registered query",
+			request:          controller.Request{ParentTypeName: "Query", FieldName: "a"},
+			expectedResponse: controller.Response{Data: "a"},
+		},
+		{
+			name:             "registered mutation",
+			request:          controller.Request{ParentTypeName: "Mutation", FieldName: "c"},
+			expectedResponse: controller.Response{Data: "c"},
+		},
+		{
+			name:      "unregistered field",
+			request:   controller.Request{ParentTypeName: "Query", FieldName: "c"},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		registry := controller.NewResolverRegistry()
+		registry.Register("Query", "a", newStaticHandler("a"))
+		registry.Register("Mutation", "c", newStaticHandler("c"))
+
+		// Execute
+		response := registry.Handle(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestResolverValidate(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name      string
+		register  func(*controller.ResolverRegistry)
+		schema    string
+		expectErr bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "every field has one handler",
+			register: func(r *controller.ResolverRegistry) {
+				r.Register("Query", "a", newStaticHandler("a"))
+				r.Register("Query", "b", newStaticHandler("b"))
+				r.Register("Mutation", "c", newStaticHandler("c"))
+			},
+			schema:    SampleSchema,
+			expectErr: false,
+		},
+		{
+			name: "field without handler",
+			register: func(r *controller.ResolverRegistry) {
+				r.Register("Query", "a", newStaticHandler("a"))
+				r.Register("Mutation", "c", newStaticHandler("c"))
+			},
+			schema:    SampleSchema,
+			expectErr: true,
+		},
+		{
+			name: "field with two handlers",
+			register: func(r *controller.ResolverRegistry) {
+				r.Register("Query", "a", newStaticHandler("a"))
+				r.Register("Query", "a", newStaticHandler("a"))
+				r.Register("Query", "b", newStaticHandler("b"))
+				r.Register("Mutation", "c", newStaticHandler("c"))
+			},
+			schema:    SampleSchema,
+			expectErr: true,
+		},
+		{
+			name: "handler for field not in schema",
+			register: func(r *controller.ResolverRegistry) {
+				r.Register("Query", "a", newStaticHandler("a"))
+				r.Register("Query", "b", newStaticHandler("b"))
+				r.Register("Mutation", "c", newStaticHandler("c"))
+				r.Register("Mutation", "d", newStaticHandler("d"))
+			},
+			schema:    SampleSchema,
+			expectErr: true,
+		},
+		{
+			name:      "invalid schema",
+			register:  func(r *controller.ResolverRegistry) {},
+			schema:    "type Query {",
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		registry := controller.NewResolverRegistry()
+		test.register(&registry)
+
+		// Execute
+		err := registry.Validate(test.schema)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+	}
+}
+
+func TestApiResolversMatchSchema(t *testing.T) {
+	// Setup
+	registry := controller.NewResolverRegistry()
+	petController := controller.NewPetController(&FakePetService{}, &FakeFieldVisibility{})
+	petController.RegisterResolvers(&registry)
+	userController := controller.NewUserController(&FakeUserService{}, &FakeFieldVisibility{})
+	userController.RegisterResolvers(&registry)
+	photoController := controller.NewPhotoController(&FakePhotoService{})
+	photoController.RegisterResolvers(&registry)
+	transferController := controller.NewPetTransferController(&FakePetTransferService{}, &FakeFieldVisibility{})
+	transferController.RegisterResolvers(&registry)
+	auditController := controller.NewAuditController(&FakeAuditService{})
+	auditController.RegisterResolvers(&registry)
+
+	// Execute
+	err := registry.Validate(api.Schema)
+
+	// Verify
+	assert.Nil(t, err)
+}
+
+func TestResolverHandleBatch(t *testing.T) {
+	// Setup
+	batchCalls := 0
+	registry := controller.NewResolverRegistry()
+	registry.Register("Query", "a", newStaticHandler("a"))
+	registry.RegisterBatch("Type", "b", func(_ context.Context, requests []controller.Request) []controller.Response {
+		batchCalls++
+		responses := []controller.Response{}
+		for _, request := range requests {
+			if request.Source["id"] == "bad" {
+				responses = append(responses, controller.Response{Error: assert.AnError})
+			} else {
+				responses = append(responses, controller.Response{Data: request.Source["id"]})
+			}
+		}
+		return responses
+	}, 10)
+	requests := []controller.Request{
+		{ParentTypeName: "Type", FieldName: "b", Source: map[string]interface{}{"id": "1"}},
+		{ParentTypeName: "Query", FieldName: "a"},
+		{ParentTypeName: "Type", FieldName: "b", Source: map[string]interface{}{"id": "bad"}},
+		{ParentTypeName: "Query", FieldName: "unknown"},
+		{ParentTypeName: "Type", FieldName: "b", Source: map[string]interface{}{"id": "3"}},
+	}
+
+	// Execute
+	responses := registry.HandleBatch(context.Background(), requests)
+
+	// Verify
+	assert.Equal(t, 1, batchCalls, "batch handler called once for all of its requests")
+	assert.Equal(t, 5, len(responses), "responses aligned with requests")
+	assert.Equal(t, controller.Response{Data: "1"}, responses[0])
+	assert.Equal(t, controller.Response{Data: "a"}, responses[1])
+	assert.Equal(t, assert.AnError, responses[2].Error)
+	assert.NotNil(t, responses[3].Error, "unknown field")
+	assert.Equal(t, controller.Response{Data: "3"}, responses[4])
+}
+
+func TestResolverRegisterBatch(t *testing.T) {
+	// Setup
+	registry := controller.NewResolverRegistry()
+	registry.RegisterBatch("Type", "b", func(_ context.Context, requests []controller.Request) []controller.Response {
+		return []controller.Response{{Data: len(requests)}}
+	}, 25)
+
+	// Execute
+	response := registry.Handle(context.Background(), controller.Request{ParentTypeName: "Type", FieldName: "b"})
+	resolvers := registry.Resolvers()
+
+	// Verify
+	assert.Equal(t, controller.Response{Data: 1}, response, "single request is handled as a batch of one")
+	assert.Equal(t, 25, resolvers[0].MaxBatchSize)
+}
+
+func TestResolverIsRegistered(t *testing.T) {
+	// Setup
+	registry := controller.NewResolverRegistry()
+	registry.Register("Query", "a", newStaticHandler("a"))
+
+	// Execute / Verify
+	assert.True(t, registry.IsRegistered("Query", "a"))
+	assert.False(t, registry.IsRegistered("Query", "b"))
+}
+
+func TestResolverHandleLogsRequest(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.NewLogger(&buffer).With(logging.Fields{"requestId": "request-1"}))
+	registry := controller.NewResolverRegistry()
+	registry.Register("Query", "a", func(ctx context.Context, request controller.Request) controller.Response {
+		logging.FromContext(ctx).Info("from handler", nil)
+		return controller.Response{Error: apperror.NewNotFound("not found", nil)}
+	})
+
+	// Execute
+	registry.Handle(ctx, controller.Request{
+		ParentTypeName: "Query",
+		FieldName:      "a",
+		Identity:       model.Identity{Username: "user"},
+	})
+
+	// Verify
+	lines := []map[string]interface{}{}
+	decoder := json.NewDecoder(&buffer)
+	for decoder.More() {
+		line := map[string]interface{}{}
+		decoder.Decode(&line)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, 2, len(lines))
+	for _, line := range lines {
+		assert.Equal(t, "request-1", line["requestId"], "lines are tied to the invocation")
+		assert.Equal(t, "Query.a", line["resolver"])
+		assert.Equal(t, "user", line["username"])
+	}
+	assert.Equal(t, "from handler", lines[0]["message"])
+	assert.Equal(t, "NOT_FOUND", lines[1]["errorClass"])
+	assert.NotNil(t, lines[1]["durationMs"])
+}
+
+func TestResolverRecordsMetrics(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	ctx := metrics.NewContext(context.Background(), metrics.NewRecorder(&capture, metrics.Namespace, metrics.Dimensions{"Environment": "test"}))
+	registry := controller.NewResolverRegistry()
+	registry.Register("Query", "a", newStaticHandler("a"))
+	registry.RegisterBatch("Type", "b", func(_ context.Context, requests []controller.Request) []controller.Response {
+		return []controller.Response{{Data: "1"}, {Error: assert.AnError}}
+	}, 10)
+
+	// Execute
+	registry.Handle(ctx, controller.Request{ParentTypeName: "Query", FieldName: "a"})
+	registry.HandleBatch(ctx, []controller.Request{
+		{ParentTypeName: "Type", FieldName: "b"},
+		{ParentTypeName: "Type", FieldName: "b"},
+	})
+
+	// Verify
+	records := capture.Find("Requests")
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, metrics.Dimensions{"Environment": "test", "Field": "Query.a"}, records[0].Dimensions)
+	assert.Equal(t, float64(1), records[0].Values["Requests"])
+	assert.Equal(t, float64(0), records[0].Values["Errors"])
+	assert.Equal(t, metrics.Dimensions{"Environment": "test", "Field": "Type.b"}, records[1].Dimensions)
+	assert.Equal(t, float64(2), records[1].Values["Requests"], "batch is recorded once")
+	assert.Equal(t, float64(1), records[1].Values["Errors"])
+}
+
+func TestResolverHandleTraces(t *testing.T) {
+	// Setup
+	var capture tracing.Capture
+	ctx := tracing.NewContext(context.Background(), &capture)
+	registry := controller.NewResolverRegistry()
+	registry.Register("Query", "a", func(ctx context.Context, _ controller.Request) controller.Response {
+		_, span := tracing.Start(ctx, "Inner")
+		span.End(nil)
+		return controller.Response{Error: assert.AnError}
+	})
+
+	// Execute
+	registry.Handle(ctx, controller.Request{ParentTypeName: "Query", FieldName: "a"})
+	registry.HandleBatch(ctx, []controller.Request{
+		{ParentTypeName: "Query", FieldName: "a"},
+		{ParentTypeName: "Query", FieldName: "a"},
+	})
+
+	// Verify
+	assert.Equal(t, []string{"Query.a", "Query.a > Inner", "Query.a", "Query.a > Inner", "Query.a > Inner"}, capture.Paths())
+	assert.Equal(t, assert.AnError, capture.Roots()[0].Err)
+}
+
+func TestResolverHandleAuditsMutations(t *testing.T) {
+	// Setup
+	decision := model.AuthorizationDecision{Action: "pet:update", Allowed: false, Reason: "denied"}
+	auditor := FakeAuditor{}
+	registry := controller.NewResolverRegistry()
+	registry.SetAuditor(&auditor)
+	registry.Register("Query", "a", func(ctx context.Context, _ controller.Request) controller.Response {
+		audit.FromContext(ctx).AddDecision(decision)
+		return controller.Response{Data: "a"}
+	})
+	registry.Register("Mutation", "c", func(ctx context.Context, _ controller.Request) controller.Response {
+		audit.FromContext(ctx).AddDecision(decision)
+		return controller.Response{Error: assert.AnError}
+	})
+	arguments := map[string]interface{}{"input": map[string]interface{}{"id": "1"}}
+
+	// Execute
+	queryResponse := registry.Handle(context.Background(), controller.Request{ParentTypeName: "Query", FieldName: "a"})
+	mutationResponse := registry.Handle(context.Background(), controller.Request{ParentTypeName: "Mutation", FieldName: "c", Arguments: arguments})
+
+	// Verify
+	assert.Equal(t, "a", queryResponse.Data)
+	assert.Equal(t, assert.AnError, mutationResponse.Error)
+	assert.Equal(t, []FakeAuditRecord{{
+		field:       "Mutation.c",
+		arguments:   arguments,
+		decisions:   []model.AuthorizationDecision{decision},
+		mutationErr: assert.AnError,
+	}}, auditor.recorded, "only mutations are recorded")
+}
+
+func TestResolverHandleAuditFailureKeepsResponse(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.NewLogger(&buffer))
+	auditor := FakeAuditor{recordErr: assert.AnError}
+	registry := controller.NewResolverRegistry()
+	registry.SetAuditor(&auditor)
+	registry.Register("Mutation", "c", newStaticHandler("c"))
+
+	// Execute
+	response := registry.Handle(ctx, controller.Request{ParentTypeName: "Mutation", FieldName: "c"})
+
+	// Verify
+	assert.Equal(t, controller.Response{Data: "c"}, response, "the mutation already happened")
+	assert.Contains(t, buffer.String(), "could not record audit event")
+}
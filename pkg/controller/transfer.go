@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+type PetTransferService interface {
+	Accept(ctx context.Context, requestor model.Identity, petId string) (model.Pet, error)
+	Cancel(ctx context.Context, requestor model.Identity, petId string) error
+	Decline(ctx context.Context, requestor model.Identity, petId string) error
+	ListPending(ctx context.Context, requestor model.Identity) ([]model.PetTransfer, error)
+	Request(ctx context.Context, requestor model.Identity, petId string, recipient string) (model.PetTransfer, error)
+	RequestAddOwner(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (model.Pet, error)
+	RequestOwnerUpdate(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (model.Pet, error)
+}
+
+// Object containing data needed for the Pet Transfer controller
+type PetTransferController struct {
+	transferService PetTransferService
+	visibility      FieldVisibility
+}
+
+// Creates a new pet transfer controller object
+func NewPetTransferController(service PetTransferService, visibility FieldVisibility) PetTransferController {
+	return PetTransferController{
+		transferService: service,
+		visibility:      visibility,
+	}
+}
+
+// Registers the fields resolved by the pet transfer controller
+func (c *PetTransferController) RegisterResolvers(registry *ResolverRegistry) {
+	registry.Register("Query", "pendingTransfers", c.HandleListPending)
+	registry.Register("Mutation", "acceptPetTransfer", c.HandleAccept)
+	registry.Register("Mutation", "addPetOwner", c.HandleAddOwner)
+	registry.Register("Mutation", "cancelPetTransfer", c.HandleCancel)
+	registry.Register("Mutation", "declinePetTransfer", c.HandleDecline)
+	registry.Register("Mutation", "requestPetTransfer", c.HandleRequest)
+	registry.Register("Mutation", "updatePetOwner", c.HandleUpdateOwner)
+}
+
+// Handles request for accepting a pending transfer
+func (c *PetTransferController) HandleAccept(ctx context.Context, request Request) Response {
+	var input model.PetTransferInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	pet, err := c.transferService.Accept(ctx, request.Identity, input.PetId)
+
+	if err == nil {
+		return Response{Data: model.AcceptPetTransferPayload{Pet: c.visibility.Pet(request.Identity, pet)}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for adding an owner to a pet, which now invites them to join the owners through a transfer
+func (c *PetTransferController) HandleAddOwner(ctx context.Context, request Request) Response {
+	var input model.AddPetOwnerInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	pet, err := c.transferService.RequestAddOwner(ctx, request.Identity, input.Id, input.Owner, input.ExpectedVersion)
+
+	if err == nil {
+		return Response{Data: model.AddPetOwnerPayload{Pet: c.visibility.Pet(request.Identity, pet)}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for canceling a pending transfer
+func (c *PetTransferController) HandleCancel(ctx context.Context, request Request) Response {
+	var input model.PetTransferInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	err := c.transferService.Cancel(ctx, request.Identity, input.PetId)
+
+	if err == nil {
+		return Response{Data: model.CancelPetTransferPayload{PetId: input.PetId}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for declining a pending transfer
+func (c *PetTransferController) HandleDecline(ctx context.Context, request Request) Response {
+	var input model.PetTransferInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	err := c.transferService.Decline(ctx, request.Identity, input.PetId)
+
+	if err == nil {
+		return Response{Data: model.DeclinePetTransferPayload{PetId: input.PetId}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for listing the pending transfers of the requestor
+func (c *PetTransferController) HandleListPending(ctx context.Context, request Request) Response {
+	transfers, err := c.transferService.ListPending(ctx, request.Identity)
+
+	if err == nil {
+		return Response{Data: transfers}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for transferring a pet to another user
+func (c *PetTransferController) HandleRequest(ctx context.Context, request Request) Response {
+	var input model.RequestPetTransferInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	transfer, err := c.transferService.Request(ctx, request.Identity, input.PetId, input.Recipient)
+
+	if err == nil {
+		return Response{Data: model.RequestPetTransferPayload{Transfer: transfer}}
+	} else {
+		return Response{Error: err}
+	}
+}
+
+// Handles request for the deprecated owner update, which now requests a transfer to the new owner
+func (c *PetTransferController) HandleUpdateOwner(ctx context.Context, request Request) Response {
+	var input model.UpdatePetOwnerInput
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
+
+	pet, err := c.transferService.RequestOwnerUpdate(ctx, request.Identity, input.Id, input.Owner, input.ExpectedVersion)
+
+	if err == nil {
+		return Response{Data: model.UpdatePetOwnerPayload{Pet: c.visibility.Pet(request.Identity, pet)}}
+	} else {
+		return Response{Error: err}
+	}
+}
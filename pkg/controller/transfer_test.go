@@ -0,0 +1,421 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/controller"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleTransfer        = model.PetTransfer{PetId: "1", Sender: "User 1", Recipient: "User 2", RequestedAt: "2022-01-01T00:00:00Z"}
+	SampleTransferRequest = controller.Request{
+		Arguments: map[string]interface{}{"input": map[string]interface{}{"petId": SampleTransfer.PetId}},
+	}
+)
+
+// Define test struct
+type PetTransferTest struct {
+	name             string
+	transferService  FakePetTransferService
+	visibility       FakeFieldVisibility
+	request          controller.Request
+	expectedResponse controller.Response
+	expectErr        bool
+}
+
+func TestPetTransferHandleRequest(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid request",
+			transferService: FakePetTransferService{requestTransfer: SampleTransfer},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"petId":     SampleTransfer.PetId,
+					"recipient": SampleTransfer.Recipient,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.RequestPetTransferPayload{Transfer: SampleTransfer},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service request error",
+			transferService: FakePetTransferService{requestErr: assert.AnError},
+			request:         SampleTransferRequest,
+			expectErr:       true,
+		},
+		{
+			name:            "input which isn't an object",
+			transferService: FakePetTransferService{requestTransfer: SampleTransfer},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": "1"},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleRequest(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+			assert.Equal(t, SampleTransfer.Recipient, test.transferService.requestRecipient, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleAccept(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid request",
+			transferService: FakePetTransferService{acceptPet: SamplePet},
+			request:         SampleTransferRequest,
+			expectedResponse: controller.Response{
+				Data: model.AcceptPetTransferPayload{Pet: SamplePet},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "accepted private pet with its owners hidden",
+			transferService: FakePetTransferService{acceptPet: SamplePrivatePet},
+			visibility:      FakeFieldVisibility{hidden: true},
+			request:         SampleTransferRequest,
+			expectedResponse: controller.Response{
+				Data: model.AcceptPetTransferPayload{Pet: model.Pet{Id: SamplePrivatePet.Id, Name: "Mika", Age: 2, Owners: []string{}, Private: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service accept error",
+			transferService: FakePetTransferService{acceptErr: assert.AnError},
+			request:         SampleTransferRequest,
+			expectErr:       true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleAccept(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleAddOwner(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid add owner",
+			transferService: FakePetTransferService{addOwnerPet: SamplePet},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.AddPetOwnerPayload{Pet: SamplePet},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "private pet with its owners hidden",
+			transferService: FakePetTransferService{addOwnerPet: SamplePrivatePet},
+			visibility:      FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePrivatePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.AddPetOwnerPayload{Pet: model.Pet{Id: SamplePrivatePet.Id, Name: "Mika", Age: 2, Owners: []string{}, Private: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service add owner error",
+			transferService: FakePetTransferService{addOwnerErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleAddOwner(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+			assert.Equal(t, SampleTransfer.Recipient, test.transferService.addOwner, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleDecline(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid request",
+			transferService: FakePetTransferService{},
+			request:         SampleTransferRequest,
+			expectedResponse: controller.Response{
+				Data: model.DeclinePetTransferPayload{PetId: SampleTransfer.PetId},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service decline error",
+			transferService: FakePetTransferService{declineErr: assert.AnError},
+			request:         SampleTransferRequest,
+			expectErr:       true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleDecline(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleCancel(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid request",
+			transferService: FakePetTransferService{},
+			request:         SampleTransferRequest,
+			expectedResponse: controller.Response{
+				Data: model.CancelPetTransferPayload{PetId: SampleTransfer.PetId},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service cancel error",
+			transferService: FakePetTransferService{cancelErr: assert.AnError},
+			request:         SampleTransferRequest,
+			expectErr:       true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleCancel(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleListPending(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid request",
+			transferService: FakePetTransferService{listPending: []model.PetTransfer{SampleTransfer}},
+			request:         controller.Request{},
+			expectedResponse: controller.Response{
+				Data: []model.PetTransfer{SampleTransfer},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service list error",
+			transferService: FakePetTransferService{listPendingErr: assert.AnError},
+			request:         controller.Request{},
+			expectErr:       true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleListPending(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferHandleUpdateOwner(t *testing.T) {
+	// Define tests
+	tests := []PetTransferTest{
+		{
+			name:            "valid update owner",
+			transferService: FakePetTransferService{updateOwnerPet: SamplePet},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.UpdatePetOwnerPayload{Pet: SamplePet},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "private pet with its owners hidden",
+			transferService: FakePetTransferService{updateOwnerPet: SamplePrivatePet},
+			visibility:      FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePrivatePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.UpdatePetOwnerPayload{Pet: model.Pet{Id: SamplePrivatePet.Id, Name: "Mika", Age: 2, Owners: []string{}, Private: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name:            "service update owner error",
+			transferService: FakePetTransferService{updateOwnerErr: assert.AnError},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"id":    SamplePet.Id,
+					"owner": SampleTransfer.Recipient,
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		controller := controller.NewPetTransferController(&test.transferService, &test.visibility)
+
+		// Execute
+		response := controller.HandleUpdateOwner(context.Background(), test.request)
+
+		// Verify
+		if !test.expectErr {
+			assert.Equal(t, test.expectedResponse, response, test.name)
+			assert.Equal(t, SampleTransfer.Recipient, test.transferService.updateOwner, test.name)
+		} else {
+			assert.NotNil(t, response.Error, test.name)
+		}
+	}
+}
+
+func TestPetTransferVisibility(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name           string
+		identity       model.Identity
+		expectedOwners []string
+	}
+
+	// Define tests
+	pet := SamplePrivatePet
+	pet.ChangedBy = "User"
+	tests := []Test{
+		{
+			name:           "shelter staff who don't own the pet",
+			identity:       model.Identity{Username: "Shelter Staff", Groups: map[string]bool{authorization.RoleShelterStaff.String(): true}},
+			expectedOwners: []string{},
+		},
+		{
+			name:           "owner",
+			identity:       model.Identity{Username: "User"},
+			expectedOwners: pet.Owners,
+		},
+		{
+			name:           "admin",
+			identity:       model.Identity{Username: "Admin", Groups: map[string]bool{authorization.RoleAdmin.String(): true}},
+			expectedOwners: pet.Owners,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine := authorization.NewPolicyEngine()
+		visibility := authorization.NewFieldVisibility(&engine)
+		transferService := FakePetTransferService{updateOwnerPet: pet, acceptPet: pet}
+		request := controller.Request{
+			Identity: test.identity,
+			Arguments: map[string]interface{}{"input": map[string]interface{}{
+				"id":    pet.Id,
+				"petId": pet.Id,
+				"owner": SampleTransfer.Recipient,
+			}},
+		}
+		controller := controller.NewPetTransferController(&transferService, &visibility)
+
+		// Execute
+		updateResponse := controller.HandleUpdateOwner(context.Background(), request)
+		acceptResponse := controller.HandleAccept(context.Background(), request)
+
+		// Verify
+		updated := updateResponse.Data.(model.UpdatePetOwnerPayload).Pet
+		assert.Equal(t, test.expectedOwners, updated.Owners, test.name)
+		assert.Equal(t, len(test.expectedOwners) > 0, updated.ChangedBy != "", test.name)
+		accepted := acceptResponse.Data.(model.AcceptPetTransferPayload).Pet
+		assert.Equal(t, test.expectedOwners, accepted.Owners, test.name)
+	}
+}
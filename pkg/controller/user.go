@@ -1,56 +1,129 @@
 package controller
 
 import (
-	"encoding/json"
-	"log"
+	"context"
 
 	"github.com/mcwiet/go-test/pkg/model"
 )
 
 type UserService interface {
-	GetByUsername(username string) (model.User, error)
-	List(first int, after string) (model.UserConnection, error)
+	GetByUsername(ctx context.Context, username string) (model.User, error)
+	GetByUsernames(ctx context.Context, usernames []string) ([]model.User, []error)
+	List(ctx context.Context, first int, after string) (model.UserConnection, error)
 }
 
 // Object containing data needed for the User controller
 type UserController struct {
 	userService UserService
+	visibility  FieldVisibility
 }
 
 // Creates a new user controller object
-func NewUserController(service UserService) UserController {
+func NewUserController(service UserService, visibility FieldVisibility) UserController {
 	return UserController{
 		userService: service,
+		visibility:  visibility,
 	}
 }
 
+// Registers the fields resolved by the user controller
+func (c *UserController) RegisterResolvers(registry *ResolverRegistry) {
+	registry.Register("Query", "user", c.HandleGet)
+	registry.Register("Query", "users", c.HandleList)
+	registry.RegisterBatch("Pet", "ownerUser", c.HandleBatchGetPetOwner, 100)
+	registry.RegisterBatch("Pet", "ownerUsers", c.HandleBatchGetPetOwners, 100)
+}
+
 // Handles request for getting a specific user
-func (c *UserController) HandleGet(request Request) Response {
+func (c *UserController) HandleGet(ctx context.Context, request Request) Response {
 	var input model.UserInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	user, err := c.userService.GetByUsername(input.Username)
+	user, err := c.userService.GetByUsername(ctx, input.Username)
 
 	if err == nil {
-		return Response{Data: user}
+		return Response{Data: c.visibility.User(request.Identity, user)}
 	} else {
 		return Response{Error: err}
 	}
 }
 
+// Handles a batch of requests for the deprecated single owner of a pet, i.e. the user who is its first owner (the pet is
+// the source of each request)
+func (c *UserController) HandleBatchGetPetOwner(ctx context.Context, requests []Request) []Response {
+	responses := make([]Response, len(requests))
+
+	// Only look up pets which have an owner; the rest resolve to null
+	usernames := []string{}
+	indexes := []int{}
+	for i, request := range requests {
+		if owner, _ := request.Source["owner"].(string); owner != "" {
+			usernames = append(usernames, owner)
+			indexes = append(indexes, i)
+		}
+	}
+
+	users, errs := c.userService.GetByUsernames(ctx, usernames)
+	for j, i := range indexes {
+		if errs[j] == nil {
+			responses[i] = Response{Data: c.visibility.User(requests[i].Identity, users[j])}
+		} else {
+			responses[i] = Response{Error: errs[j]}
+		}
+	}
+
+	return responses
+}
+
+// Handles a batch of requests for the users who own a pet (the pet is the source of each request); every owner of
+// every pet in the batch is looked up at once
+func (c *UserController) HandleBatchGetPetOwners(ctx context.Context, requests []Request) []Response {
+	responses := make([]Response, len(requests))
+
+	// The owners of pet i are usernames[starts[i]:starts[i+1]]
+	usernames := []string{}
+	starts := make([]int, len(requests)+1)
+	for i, request := range requests {
+		owners, _ := request.Source["owners"].([]interface{})
+		for _, owner := range owners {
+			if username, _ := owner.(string); username != "" {
+				usernames = append(usernames, username)
+			}
+		}
+		starts[i+1] = len(usernames)
+	}
+
+	users, errs := c.userService.GetByUsernames(ctx, usernames)
+	for i := range requests {
+		owners := []model.User{}
+		for j := starts[i]; j < starts[i+1]; j++ {
+			if errs[j] != nil {
+				responses[i] = Response{Error: errs[j]}
+				break
+			}
+			owners = append(owners, c.visibility.User(requests[i].Identity, users[j]))
+		}
+		if responses[i].Error == nil {
+			responses[i] = Response{Data: owners}
+		}
+	}
+
+	return responses
+}
+
 // Handles request for listing users
-func (c *UserController) HandleList(request Request) Response {
+func (c *UserController) HandleList(ctx context.Context, request Request) Response {
 	var input model.UsersInput
-	inputBytes, _ := json.Marshal(request.Arguments["input"])
-	json.Unmarshal(inputBytes, &input)
-
-	connection, err := c.userService.List(input.First, input.After)
+	if err := decodeInput(request, &input); err != nil {
+		return Response{Error: err}
+	}
 
-	log.Println(connection)
+	connection, err := c.userService.List(ctx, input.First, input.After)
 
 	if err == nil {
-		return Response{Data: connection}
+		return Response{Data: visibleUsers(c.visibility, request.Identity, connection)}
 	} else {
 		return Response{Error: err}
 	}
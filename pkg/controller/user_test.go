@@ -1,6 +1,7 @@
 package controller_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/mcwiet/go-test/pkg/controller"
@@ -29,6 +30,7 @@ var (
 type UserTest struct {
 	name             string
 	userService      FakeUserService
+	visibility       FakeFieldVisibility
 	request          controller.Request
 	expectedResponse controller.Response
 	expectErr        bool
@@ -50,6 +52,21 @@ func TestUserHandleGet(t *testing.T) {
 				Data: SampleUser,
 			},
 		},
+		{
+			name: "get with the email hidden",
+			userService: FakeUserService{
+				getByUsernameUser: SampleUser,
+			},
+			visibility: FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"username": SampleUser.Username,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.User{Username: SampleUser.Username, Name: SampleUser.Name},
+			},
+		},
 		{
 			name: "service get by username error",
 			userService: FakeUserService{
@@ -66,10 +83,10 @@ func TestUserHandleGet(t *testing.T) {
 
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewUserController(&test.userService)
+		controller := controller.NewUserController(&test.userService, &test.visibility)
 
 		// Execute
-		response := controller.HandleGet(test.request)
+		response := controller.HandleGet(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -97,6 +114,25 @@ func TestUserHandleList(t *testing.T) {
 				Data: SampleUserConnection,
 			},
 		},
+		{
+			name: "list with emails hidden",
+			userService: FakeUserService{
+				listConnection: SampleUserConnection,
+			},
+			visibility: FakeFieldVisibility{hidden: true},
+			request: controller.Request{
+				Arguments: map[string]interface{}{"input": map[string]interface{}{
+					"first": 10,
+				}},
+			},
+			expectedResponse: controller.Response{
+				Data: model.UserConnection{
+					TotalCount: 1,
+					Edges:      []model.UserEdge{{Node: model.User{Username: SampleUser.Username, Name: SampleUser.Name}}},
+					PageInfo:   SampleUserConnection.PageInfo,
+				},
+			},
+		},
 		{
 			name: "service list error",
 			userService: FakeUserService{
@@ -113,10 +149,10 @@ func TestUserHandleList(t *testing.T) {
 
 	for _, test := range tests {
 		// Setup
-		controller := controller.NewUserController(&test.userService)
+		controller := controller.NewUserController(&test.userService, &test.visibility)
 
 		// Execute
-		response := controller.HandleList(test.request)
+		response := controller.HandleList(context.Background(), test.request)
 
 		// Verify
 		if !test.expectErr {
@@ -126,3 +162,68 @@ func TestUserHandleList(t *testing.T) {
 		}
 	}
 }
+
+func TestUserHandleBatchGetPetOwner(t *testing.T) {
+	// Setup
+	userService := FakeUserService{
+		getByUsernamesMap: map[string]model.User{SampleUser.Username: SampleUser},
+	}
+	requests := []controller.Request{
+		{Source: map[string]interface{}{"id": "1", "owner": SampleUser.Username}},
+		{Source: map[string]interface{}{"id": "2", "owner": nil}},
+		{Source: map[string]interface{}{"id": "3", "owner": "unknown"}},
+	}
+	controller := controller.NewUserController(&userService, &FakeFieldVisibility{hidden: true})
+
+	// Execute
+	responses := controller.HandleBatchGetPetOwner(context.Background(), requests)
+
+	// Verify
+	assert.Equal(t, 3, len(responses), "responses aligned with requests")
+	assert.Equal(t, model.User{Username: SampleUser.Username, Name: SampleUser.Name}, responses[0].Data, "pet with an owner")
+	assert.Nil(t, responses[1].Data, "pet without owners")
+	assert.Nil(t, responses[1].Error, "pet without owners")
+	assert.NotNil(t, responses[2].Error, "owner not found")
+}
+
+func TestUserHandleBatchGetPetOwners(t *testing.T) {
+	// Setup
+	coOwner := model.User{Username: "user-2", Name: "User 2"}
+	userService := FakeUserService{
+		getByUsernamesMap: map[string]model.User{SampleUser.Username: SampleUser, coOwner.Username: coOwner},
+	}
+	requests := []controller.Request{
+		{Source: map[string]interface{}{"id": "1", "owners": []interface{}{SampleUser.Username}}},
+		{Source: map[string]interface{}{"id": "2", "owners": []interface{}{}}},
+		{Source: map[string]interface{}{"id": "3", "owners": []interface{}{SampleUser.Username, "unknown"}}},
+		{Source: map[string]interface{}{"id": "4", "owners": []interface{}{SampleUser.Username, coOwner.Username}}},
+	}
+	controller := controller.NewUserController(&userService, &FakeFieldVisibility{})
+
+	// Execute
+	responses := controller.HandleBatchGetPetOwners(context.Background(), requests)
+
+	// Verify
+	assert.Equal(t, 4, len(responses), "responses aligned with requests")
+	assert.Equal(t, []model.User{SampleUser}, responses[0].Data, "pet with an owner")
+	assert.Equal(t, []model.User{}, responses[1].Data, "pet without owners")
+	assert.NotNil(t, responses[2].Error, "owner not found")
+	assert.Equal(t, []model.User{SampleUser, coOwner}, responses[3].Data, "pet with co-owners")
+}
+
+func TestUserHandleBatchGetPetOwnersHidesEmails(t *testing.T) {
+	// Setup
+	userService := FakeUserService{
+		getByUsernamesMap: map[string]model.User{SampleUser.Username: SampleUser},
+	}
+	requests := []controller.Request{
+		{Source: map[string]interface{}{"id": "1", "owners": []interface{}{SampleUser.Username}}},
+	}
+	controller := controller.NewUserController(&userService, &FakeFieldVisibility{hidden: true})
+
+	// Execute
+	responses := controller.HandleBatchGetPetOwners(context.Background(), requests)
+
+	// Verify
+	assert.Equal(t, []model.User{{Username: SampleUser.Username, Name: SampleUser.Name}}, responses[0].Data)
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Hides the fields of users and pets which a caller isn't allowed to see
+type FieldVisibility interface {
+	User(identity model.Identity, user model.User) model.User
+	Pet(identity model.Identity, pet model.Pet) model.Pet
+}
+
+// Gets the page of pets as the caller may see them (the edges are copied, since the service may share them)
+func visiblePets(visibility FieldVisibility, identity model.Identity, connection model.PetConnection) model.PetConnection {
+	if connection.Edges == nil {
+		return connection
+	}
+	edges := make([]model.PetEdge, len(connection.Edges))
+	for i, edge := range connection.Edges {
+		edges[i] = model.PetEdge{Node: visibility.Pet(identity, edge.Node), Cursor: edge.Cursor}
+	}
+	connection.Edges = edges
+	return connection
+}
+
+// Gets the page of users as the caller may see them
+func visibleUsers(visibility FieldVisibility, identity model.Identity, connection model.UserConnection) model.UserConnection {
+	if connection.Edges == nil {
+		return connection
+	}
+	edges := make([]model.UserEdge, len(connection.Edges))
+	for i, edge := range connection.Edges {
+		edges[i] = model.UserEdge{Node: visibility.User(identity, edge.Node)}
+	}
+	connection.Edges = edges
+	return connection
+}
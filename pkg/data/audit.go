@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+const (
+	// Audit events are sorted under the day they happened too, e.g. 'auditEvent#2022-01-31', so they don't all land in
+	// one partition of the sort key index either
+	auditEventSortPrefix = "auditEvent#"
+	// Every audit event holds the AuditLog shard of the (UTC) day it happened, e.g. 'audit#2022-01-31', which auditIndex
+	// is keyed on (with the event ID, which starts with the time of the event, as the sort key) so a day's events can be
+	// read in the order they happened without every event landing in one partition
+	auditLogShardPrefix = "audit#"
+	auditLogShardLayout = "2006-01-02"
+	auditIndex          = "audit-gsi"
+	// Sorts after every character an event ID can have after its time, so a bound on the time takes in every event then
+	auditIdTimeBoundSuffix = "~"
+)
+
+// Object containing information needed to access the audit log; events share the primary table with pets, and are
+// only ever inserted (the table's TTL removes them)
+type AuditDao struct {
+	client    DynamoDbClient
+	tableName string
+}
+
+// Creates an audit log data store access object
+func NewAuditDao(client DynamoDbClient, tableName string) AuditDao {
+	return AuditDao{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Inserts an audit event, which expires some time after it happened; fails with a conflict if an event with the same
+// ID already exists, so events are never overwritten
+func (a *AuditDao) Insert(ctx context.Context, event model.AuditEvent) error {
+	start := time.Now()
+	_, err := a.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           &a.tableName,
+		Item:                convertAuditEventToItem(event, time.Now().Add(model.AuditEventRetention)),
+		ConditionExpression: jsii.String("attribute_not_exists(Id)"),
+	})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.PutItem", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb put item failed", err, logging.Fields{"auditEventId": event.Id})
+		var conditionError *dynamodb.ConditionalCheckFailedException
+		if errors.As(err, &conditionError) {
+			return apperror.NewConflict("audit event already exists", err)
+		}
+		return apperror.NewInternal("error adding audit event", err)
+	}
+
+	return nil
+}
+
+// Query for a set of audit events matching the filter (first n events after the exclusive start ID, which must be an
+// event ID), newest first; events older than the retention period have expired and aren't included
+//
+// Each day's events are in their own shard of the audit index, so the days in the filter's time range (at most the
+// longest window before its end) are read newest first until the page is full
+func (a *AuditDao) Query(ctx context.Context, filter model.AuditEventsFilter, count int, exclusiveStartId string) ([]model.AuditEvent, bool, error) {
+	newest, oldest := auditQueryDays(filter, time.Now())
+	var exclusiveStartKey DynamoItem
+	if exclusiveStartId != "" {
+		startTime, err := model.AuditEventIdTime(exclusiveStartId)
+		if err != nil {
+			return []model.AuditEvent{}, false, apperror.NewInternal("error retrieving audit events; start ID isn't an event ID", err)
+		}
+		startDay := auditDay(startTime)
+		if startDay.Before(newest) {
+			newest = startDay
+		}
+		if startDay.Equal(newest) {
+			exclusiveStartKey = auditEventKey(exclusiveStartId, startDay)
+			exclusiveStartKey["AuditLog"] = &dynamodb.AttributeValue{S: jsii.String(auditLogShard(startDay))}
+		}
+	}
+
+	events := []model.AuditEvent{}
+	for day := newest; !day.Before(oldest); day = day.AddDate(0, 0, -1) {
+		for {
+			queryInput := buildAuditQueryInput(a.tableName, auditLogShard(day), filter, count-len(events), exclusiveStartKey)
+
+			start := time.Now()
+			ret, err := a.client.QueryWithContext(ctx, &queryInput)
+			metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+			if err != nil {
+				logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"auditLog": auditLogShard(day)})
+				return []model.AuditEvent{}, false, apperror.NewInternal("error retrieving audit events", err)
+			}
+
+			// Nothing is returned when no events are asked for, but whether there are any is still reported
+			if count == 0 && (len(ret.Items) > 0 || len(ret.LastEvaluatedKey) != 0) {
+				return events, true, nil
+			}
+
+			for _, item := range ret.Items {
+				events = append(events, convertItemToAuditEvent(item))
+			}
+
+			// The filter is applied after a page is read, so keep reading until the page is full or every event has been
+			// seen; a full page may still report a next page (in this day or an older one) which turns out to hold no
+			// matching events
+			exclusiveStartKey = ret.LastEvaluatedKey
+			if count > 0 && len(events) >= count {
+				return events, len(exclusiveStartKey) != 0 || day.After(oldest), nil
+			}
+			if len(exclusiveStartKey) == 0 {
+				break
+			}
+		}
+	}
+
+	return events, false, nil
+}
+
+// Gets the newest and oldest days to read events from: the days of the filter's (optional) times, bounded by today, the
+// oldest day whose events may not have expired and the longest window a query may read
+func auditQueryDays(filter model.AuditEventsFilter, now time.Time) (time.Time, time.Time) {
+	newest, oldest := auditDay(now), auditDay(now.Add(-model.AuditEventRetention))
+	if to, err := time.Parse(time.RFC3339, filter.To); err == nil && auditDay(to).Before(newest) {
+		newest = auditDay(to)
+	}
+	if from, err := time.Parse(time.RFC3339, filter.From); err == nil && auditDay(from).After(oldest) {
+		oldest = auditDay(from)
+	}
+	if windowStart := auditDay(newest.Add(-model.AuditEventsMaxWindow)); windowStart.After(oldest) {
+		oldest = windowStart
+	}
+	return newest, oldest
+}
+
+// Gets the start of the (UTC) day of a time
+func auditDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Gets the audit index shard holding the events of a day
+func auditLogShard(day time.Time) string {
+	return auditLogShardPrefix + day.Format(auditLogShardLayout)
+}
+
+// Build input to query a shard of the audit index for events matching the filter; its times were checked by the service
+func buildAuditQueryInput(tableName string, shard string, filter model.AuditEventsFilter, count int, exclusiveStartKey DynamoItem) dynamodb.QueryInput {
+	limit := int64(count)
+	if count < 1 {
+		limit = 1 // Dynamo minimum limit is 1
+	}
+
+	keyCondition := "AuditLog = :log"
+	values := DynamoItem{":log": {S: jsii.String(shard)}}
+	from, to := auditIdTimeBound(filter.From, ""), auditIdTimeBound(filter.To, auditIdTimeBoundSuffix)
+	switch {
+	case from != nil && to != nil:
+		keyCondition += " AND Id BETWEEN :from AND :to"
+		values[":from"], values[":to"] = from, to
+	case from != nil:
+		keyCondition += " AND Id >= :from"
+		values[":from"] = from
+	case to != nil:
+		keyCondition += " AND Id <= :to"
+		values[":to"] = to
+	}
+
+	conditions := []string{}
+	names := map[string]*string{}
+	for attribute, value := range map[string]string{"Username": filter.Username, "Field": filter.Field, "Outcome": filter.Outcome} {
+		if value == "" {
+			continue
+		}
+		placeholder := strings.ToLower(attribute)
+		conditions = append(conditions, "#"+placeholder+" = :"+placeholder)
+		names["#"+placeholder] = jsii.String(attribute)
+		values[":"+placeholder] = &dynamodb.AttributeValue{S: jsii.String(value)}
+	}
+
+	queryInput := dynamodb.QueryInput{
+		TableName:                 &tableName,
+		IndexName:                 jsii.String(auditIndex),
+		KeyConditionExpression:    &keyCondition,
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          jsii.Bool(false), // newest first
+		ExclusiveStartKey:         exclusiveStartKey,
+		Limit:                     &limit,
+	}
+	if len(conditions) > 0 {
+		// Sorted so the expression doesn't depend on map order
+		sort.Strings(conditions)
+		queryInput.FilterExpression = jsii.String(strings.Join(conditions, " AND "))
+		queryInput.ExpressionAttributeNames = names
+	}
+	return queryInput
+}
+
+// Gets the bound on event IDs for an (optional) RFC 3339 time; nil if there is no time
+func auditIdTimeBound(value string, suffix string) *dynamodb.AttributeValue {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if value == "" || err != nil {
+		return nil
+	}
+	return &dynamodb.AttributeValue{S: jsii.String(parsed.UTC().Format(model.AuditEventIdTimeLayout) + suffix)}
+}
+
+// Gets the key of an audit event which happened on the day
+func auditEventKey(id string, day time.Time) DynamoItem {
+	return DynamoItem{
+		"Id":   {S: jsii.String(id)},
+		"Sort": {S: jsii.String(auditEventSortPrefix + day.Format(auditLogShardLayout))},
+	}
+}
+
+// Convert a DynamoDB item to an audit event
+func convertItemToAuditEvent(item DynamoItem) model.AuditEvent {
+	event := model.AuditEvent{
+		Id:        *item["Id"].S,
+		Time:      *item["Time"].S,
+		Username:  *item["Username"].S,
+		Groups:    []string{},
+		Field:     *item["Field"].S,
+		Arguments: *item["Arguments"].S,
+		Decisions: []model.AuthorizationDecision{},
+		Outcome:   *item["Outcome"].S,
+	}
+	if item["Groups"] != nil {
+		event.Groups = aws.StringValueSlice(item["Groups"].SS)
+		sort.Strings(event.Groups)
+	}
+	if item["Decisions"] != nil {
+		for _, decision := range item["Decisions"].L {
+			event.Decisions = append(event.Decisions, model.AuthorizationDecision{
+				Action:  *decision.M["Action"].S,
+				Allowed: *decision.M["Allowed"].BOOL,
+				Reason:  *decision.M["Reason"].S,
+			})
+		}
+	}
+	if item["Error"] != nil {
+		event.Error = *item["Error"].S
+	}
+	return event
+}
+
+// Convert an audit event to a DynamoDB item, which the table's TTL removes some time after it expires; the groups are
+// left out when there are none (DynamoDB doesn't store empty sets), and an event whose ID has no time (which the
+// service never creates) is sorted and sharded by when it is stored
+func convertAuditEventToItem(event model.AuditEvent, expiresAt time.Time) DynamoItem {
+	eventTime, err := model.AuditEventIdTime(event.Id)
+	if err != nil {
+		eventTime = time.Now()
+	}
+	day := auditDay(eventTime)
+	item := auditEventKey(event.Id, day)
+	item["AuditLog"] = &dynamodb.AttributeValue{S: jsii.String(auditLogShard(day))}
+	item["Time"] = &dynamodb.AttributeValue{S: jsii.String(event.Time)}
+	item["Username"] = &dynamodb.AttributeValue{S: jsii.String(event.Username)}
+	item["Field"] = &dynamodb.AttributeValue{S: jsii.String(event.Field)}
+	item["Arguments"] = &dynamodb.AttributeValue{S: jsii.String(event.Arguments)}
+	item["Outcome"] = &dynamodb.AttributeValue{S: jsii.String(event.Outcome)}
+	item["ExpiresAt"] = &dynamodb.AttributeValue{N: jsii.String(strconv.FormatInt(expiresAt.Unix(), 10))}
+	if len(event.Groups) > 0 {
+		item["Groups"] = &dynamodb.AttributeValue{SS: aws.StringSlice(event.Groups)}
+	}
+	decisions := []*dynamodb.AttributeValue{}
+	for _, decision := range event.Decisions {
+		decisions = append(decisions, &dynamodb.AttributeValue{M: DynamoItem{
+			"Action":  {S: jsii.String(decision.Action)},
+			"Allowed": {BOOL: jsii.Bool(decision.Allowed)},
+			"Reason":  {S: jsii.String(decision.Reason)},
+		}})
+	}
+	item["Decisions"] = &dynamodb.AttributeValue{L: decisions}
+	if event.Error != "" {
+		item["Error"] = &dynamodb.AttributeValue{S: jsii.String(event.Error)}
+	}
+	return item
+}
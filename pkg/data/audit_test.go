@@ -0,0 +1,304 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// The sample audit events happened at the start of yesterday and today (UTC), so they haven't expired
+	SampleAuditToday     = time.Now().UTC().Truncate(24 * time.Hour)
+	SampleAuditYesterday = SampleAuditToday.AddDate(0, 0, -1)
+	SampleAuditEvent     = model.AuditEvent{
+		Id:        SampleAuditYesterday.Format(model.AuditEventIdTimeLayout) + "-1",
+		Time:      SampleAuditYesterday.Format(time.RFC3339),
+		Username:  "User 1",
+		Groups:    []string{"admin", "vet"},
+		Field:     "Mutation.updatePet",
+		Arguments: `{"input":{"id":"1"}}`,
+		Decisions: []model.AuthorizationDecision{{Action: "pet:update", Allowed: false, Reason: "denied"}},
+		Outcome:   "FORBIDDEN",
+		Error:     "not authorized",
+	}
+	SampleAuditEventItem = data.DynamoItem{
+		"Id":        {S: jsii.String(SampleAuditEvent.Id)},
+		"Sort":      {S: jsii.String("auditEvent#" + SampleAuditYesterday.Format("2006-01-02"))},
+		"AuditLog":  {S: jsii.String("audit#" + SampleAuditYesterday.Format("2006-01-02"))},
+		"Time":      {S: jsii.String(SampleAuditEvent.Time)},
+		"Username":  {S: jsii.String(SampleAuditEvent.Username)},
+		"Groups":    {SS: *jsii.Strings("vet", "admin")}, // sets have no order
+		"Field":     {S: jsii.String(SampleAuditEvent.Field)},
+		"Arguments": {S: jsii.String(SampleAuditEvent.Arguments)},
+		"Decisions": {L: []*dynamodb.AttributeValue{{M: data.DynamoItem{
+			"Action":  {S: jsii.String("pet:update")},
+			"Allowed": {BOOL: jsii.Bool(false)},
+			"Reason":  {S: jsii.String("denied")},
+		}}}},
+		"Outcome":   {S: jsii.String(SampleAuditEvent.Outcome)},
+		"Error":     {S: jsii.String(SampleAuditEvent.Error)},
+		"ExpiresAt": {N: jsii.String("1672531200")},
+	}
+	SampleAuditEvent2 = model.AuditEvent{
+		Id:        SampleAuditToday.Format(model.AuditEventIdTimeLayout) + "-2",
+		Time:      SampleAuditToday.Format(time.RFC3339),
+		Username:  "User 2",
+		Groups:    []string{},
+		Field:     "Mutation.createPet",
+		Arguments: `{}`,
+		Decisions: []model.AuthorizationDecision{},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleAuditEvent2Item = data.DynamoItem{
+		"Id":        {S: jsii.String(SampleAuditEvent2.Id)},
+		"Sort":      {S: jsii.String("auditEvent#" + SampleAuditToday.Format("2006-01-02"))},
+		"AuditLog":  {S: jsii.String("audit#" + SampleAuditToday.Format("2006-01-02"))},
+		"Time":      {S: jsii.String(SampleAuditEvent2.Time)},
+		"Username":  {S: jsii.String(SampleAuditEvent2.Username)},
+		"Field":     {S: jsii.String(SampleAuditEvent2.Field)},
+		"Arguments": {S: jsii.String(SampleAuditEvent2.Arguments)},
+		"Decisions": {L: []*dynamodb.AttributeValue{}},
+		"Outcome":   {S: jsii.String(SampleAuditEvent2.Outcome)},
+		"ExpiresAt": {N: jsii.String("1672531200")},
+	}
+)
+
+func TestAuditInsert(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name            string
+		event           model.AuditEvent
+		client          FakeDynamoDbClient
+		expectedItem    data.DynamoItem
+		expectedErrCode apperror.Code
+	}{
+		{
+			name:         "valid insert",
+			event:        SampleAuditEvent,
+			client:       FakeDynamoDbClient{putItemOutput: &dynamodb.PutItemOutput{}},
+			expectedItem: SampleAuditEventItem,
+		},
+		{
+			name:         "valid insert without groups",
+			event:        SampleAuditEvent2,
+			client:       FakeDynamoDbClient{putItemOutput: &dynamodb.PutItemOutput{}},
+			expectedItem: SampleAuditEvent2Item,
+		},
+		{
+			name:            "event already exists",
+			event:           SampleAuditEvent,
+			client:          FakeDynamoDbClient{putItemErr: &dynamodb.ConditionalCheckFailedException{}},
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "dynamodb put error",
+			event:           SampleAuditEvent,
+			client:          FakeDynamoDbClient{putItemErr: assert.AnError},
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewAuditDao(&test.client, SampleTableName)
+
+		// Execute
+		err := dao.Insert(context.Background(), test.event)
+
+		// Verify
+		if test.expectedErrCode == "" {
+			assert.Nil(t, err, test.name)
+			item := test.client.putItemInput.Item
+			assert.Equal(t, "attribute_not_exists(Id)", *test.client.putItemInput.ConditionExpression, test.name)
+			assert.Equal(t, *test.expectedItem["Sort"].S, *item["Sort"].S, test.name)
+			assert.Equal(t, *test.expectedItem["AuditLog"].S, *item["AuditLog"].S, test.name)
+			assert.NotNil(t, item["ExpiresAt"].N, test.name)
+			assert.Equal(t, len(test.event.Groups) > 0, item["Groups"] != nil, test.name)
+			assert.Equal(t, test.event.Error != "", item["Error"] != nil, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	today, yesterday := "audit#"+SampleAuditToday.Format("2006-01-02"), "audit#"+SampleAuditYesterday.Format("2006-01-02")
+	twoDaysAgo := "audit#" + SampleAuditYesterday.AddDate(0, 0, -1).Format("2006-01-02")
+
+	// Define tests
+	tests := []struct {
+		name                   string
+		filter                 model.AuditEventsFilter
+		count                  int
+		exclusiveStartId       string
+		client                 FakeDynamoDbClient
+		expectedEvents         []model.AuditEvent
+		expectedHasNextPage    bool
+		expectedShards         []string // the first shards queried, in order
+		expectedQueries        int      // if set, how many queries are made
+		expectedKeyCondition   string
+		expectedFilter         string
+		expectedExclusiveStart bool
+		expectErr              bool
+	}{
+		{
+			name:  "events found across days",
+			count: 2,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleAuditEvent2Item}},
+				{Items: []data.DynamoItem{SampleAuditEventItem}},
+			}},
+			expectedEvents:       []model.AuditEvent{SampleAuditEvent2, SampleAuditEvent},
+			expectedHasNextPage:  true,
+			expectedShards:       []string{today, yesterday},
+			expectedQueries:      2,
+			expectedKeyCondition: "AuditLog = :log",
+		},
+		{
+			name:  "more events in the day",
+			count: 1,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleAuditEvent2Item}, LastEvaluatedKey: SampleAuditEvent2Item},
+			}},
+			expectedEvents:       []model.AuditEvent{SampleAuditEvent2},
+			expectedHasNextPage:  true,
+			expectedShards:       []string{today},
+			expectedQueries:      1,
+			expectedKeyCondition: "AuditLog = :log",
+		},
+		{
+			name:  "no events requested",
+			count: 0,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{},
+				{Items: []data.DynamoItem{SampleAuditEventItem}},
+			}},
+			expectedEvents:       []model.AuditEvent{},
+			expectedHasNextPage:  true,
+			expectedShards:       []string{today, yesterday},
+			expectedQueries:      2,
+			expectedKeyCondition: "AuditLog = :log",
+		},
+		{
+			name:                 "no events in the days filtered",
+			filter:               model.AuditEventsFilter{From: SampleAuditYesterday.Format(time.RFC3339), To: SampleAuditToday.Format(time.RFC3339)},
+			count:                10,
+			client:               FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{}},
+			expectedEvents:       []model.AuditEvent{},
+			expectedShards:       []string{today, yesterday},
+			expectedQueries:      2,
+			expectedKeyCondition: "AuditLog = :log AND Id BETWEEN :from AND :to",
+		},
+		{
+			name:             "after start",
+			count:            10,
+			exclusiveStartId: SampleAuditEvent2.Id,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{},
+				{Items: []data.DynamoItem{SampleAuditEventItem}},
+			}},
+			expectedEvents:         []model.AuditEvent{SampleAuditEvent},
+			expectedShards:         []string{today, yesterday, twoDaysAgo},
+			expectedKeyCondition:   "AuditLog = :log",
+			expectedExclusiveStart: true,
+		},
+		{
+			name:             "filtered before start",
+			filter:           model.AuditEventsFilter{Username: "User 1", Outcome: "FORBIDDEN", From: SampleAuditYesterday.Format(time.RFC3339), To: SampleAuditYesterday.Add(12 * time.Hour).Format(time.RFC3339)},
+			count:            10,
+			exclusiveStartId: SampleAuditEvent2.Id,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleAuditEventItem}},
+			}},
+			expectedEvents:       []model.AuditEvent{SampleAuditEvent},
+			expectedShards:       []string{yesterday},
+			expectedQueries:      1,
+			expectedKeyCondition: "AuditLog = :log AND Id BETWEEN :from AND :to",
+			expectedFilter:       "#outcome = :outcome AND #username = :username",
+		},
+		{
+			name:   "filtered from",
+			filter: model.AuditEventsFilter{Field: "Mutation.createPet", From: SampleAuditToday.Format(time.RFC3339)},
+			count:  10,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleAuditEvent2Item}},
+			}},
+			expectedEvents:       []model.AuditEvent{SampleAuditEvent2},
+			expectedShards:       []string{today},
+			expectedQueries:      1,
+			expectedKeyCondition: "AuditLog = :log AND Id >= :from",
+			expectedFilter:       "#field = :field",
+		},
+		{
+			name:   "filtered to",
+			filter: model.AuditEventsFilter{To: SampleAuditYesterday.Format(time.RFC3339)},
+			count:  10,
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleAuditEventItem}},
+			}},
+			expectedEvents:       []model.AuditEvent{SampleAuditEvent},
+			expectedShards:       []string{yesterday, twoDaysAgo},
+			expectedQueries:      32,
+			expectedKeyCondition: "AuditLog = :log AND Id <= :to",
+		},
+		{
+			name:             "start isn't an event ID",
+			count:            10,
+			exclusiveStartId: "1",
+			client:           FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{}},
+			expectErr:        true,
+		},
+		{
+			name:      "dynamodb query error",
+			count:     10,
+			client:    FakeDynamoDbClient{queryErr: assert.AnError},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewAuditDao(&test.client, SampleTableName)
+
+		// Execute
+		events, hasNextPage, err := dao.Query(context.Background(), test.filter, test.count, test.exclusiveStartId)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedEvents, events, test.name)
+			assert.Equal(t, test.expectedHasNextPage, hasNextPage, test.name)
+			if test.expectedQueries != 0 {
+				assert.Equal(t, test.expectedQueries, len(test.client.queryInputs), test.name)
+			}
+			for i, shard := range test.expectedShards {
+				assert.Equal(t, shard, *test.client.queryInputs[i].ExpressionAttributeValues[":log"].S, test.name)
+			}
+			input := test.client.queryInputs[0]
+			assert.Equal(t, "audit-gsi", *input.IndexName, test.name)
+			assert.False(t, *input.ScanIndexForward, test.name)
+			assert.Equal(t, test.expectedKeyCondition, *input.KeyConditionExpression, test.name)
+			if test.expectedFilter == "" {
+				assert.Nil(t, input.FilterExpression, test.name)
+			} else {
+				assert.Equal(t, test.expectedFilter, *input.FilterExpression, test.name)
+			}
+			assert.Equal(t, test.expectedExclusiveStart, input.ExclusiveStartKey != nil, test.name)
+			if test.expectedExclusiveStart {
+				assert.Equal(t, today, *input.ExclusiveStartKey["AuditLog"].S, test.name)
+				assert.Equal(t, "auditEvent#"+SampleAuditToday.Format("2006-01-02"), *input.ExclusiveStartKey["Sort"].S, test.name)
+			}
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package data_test
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/data/datatest"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+)
+
+// Runs the pet DAO conformance tests against DynamoDB Local (e.g. 'docker run -p 8000:8000 amazon/dynamodb-local')
+func TestPetDaoConformance(t *testing.T) {
+	client := newDynamoDbLocalClient(t)
+
+	datatest.TestPetDao(t, func() service.PetDao {
+		dao := data.NewPetDao(client, createPrimaryTable(t, client))
+		return &dao
+	})
+}
+
+// Runs the pet transfer DAO conformance tests against DynamoDB Local
+func TestPetTransferDaoConformance(t *testing.T) {
+	client := newDynamoDbLocalClient(t)
+
+	datatest.TestPetTransferDao(t, func() (service.PetTransferDao, service.PetDao) {
+		tableName := createPrimaryTable(t, client)
+		dao, petDao := data.NewPetTransferDao(client, tableName), data.NewPetDao(client, tableName)
+		return &dao, &petDao
+	})
+}
+
+// Runs the audit DAO conformance tests against DynamoDB Local
+func TestAuditDaoConformance(t *testing.T) {
+	client := newDynamoDbLocalClient(t)
+
+	datatest.TestAuditDao(t, func() (service.AuditDao, service.PetDao) {
+		tableName := createPrimaryTable(t, client)
+		dao, petDao := data.NewAuditDao(client, tableName), data.NewPetDao(client, tableName)
+		return &dao, &petDao
+	})
+}
+
+// Creates a client for DynamoDB Local; the test is skipped unless DYNAMODB_ENDPOINT is set
+func newDynamoDbLocalClient(t *testing.T) *dynamodb.DynamoDB {
+	endpoint, exists := os.LookupEnv("DYNAMODB_ENDPOINT")
+	if !exists {
+		t.Skip("DYNAMODB_ENDPOINT is not set; skipping DynamoDB conformance tests")
+	}
+	return dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    &endpoint,
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("local", "local", ""),
+	})))
+}
+
+func TestUserDaoConformance(t *testing.T) {
+	datatest.TestUserDao(t, func(users []model.User) service.UserDao {
+		dao := data.NewUserDao(NewStatefulUserPoolClient(users), SampleUserPoolId)
+		return &dao
+	})
+}
+
+// Creates a table shaped like the primary table in the API stack; the table is deleted when the test finishes
+func createPrimaryTable(t *testing.T, client *dynamodb.DynamoDB) string {
+	tableName := "conformance-" + uuid.NewString()
+	_, err := client.CreateTable(&dynamodb.CreateTableInput{
+		TableName:   &tableName,
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("Id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("Sort"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("Owner"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("AuditLog"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("Id"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String("Sort"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName:  aws.String("sort-key-gsi"),
+				KeySchema:  []*dynamodb.KeySchemaElement{{AttributeName: aws.String("Sort"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			},
+			{
+				IndexName: aws.String("owner-gsi"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("Owner"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String("Id"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeKeysOnly)},
+			},
+			{
+				IndexName: aws.String("audit-gsi"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("AuditLog"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String("Id"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.DeleteTable(&dynamodb.DeleteTableInput{TableName: &tableName})
+	})
+	return tableName
+}
+
+// User pool client which keeps users in memory and pages through them like Cognito
+type StatefulUserPoolClient struct {
+	users []model.User
+}
+
+func NewStatefulUserPoolClient(users []model.User) *StatefulUserPoolClient {
+	sorted := append([]model.User{}, users...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Username < sorted[j].Username })
+	return &StatefulUserPoolClient{users: sorted}
+}
+
+func (c *StatefulUserPoolClient) AdminGetUserWithContext(ctx aws.Context, input *cognito.AdminGetUserInput, _ ...request.Option) (*cognito.AdminGetUserOutput, error) {
+	if ctx.Err() != nil {
+		return nil, newCanceledError(ctx)
+	}
+	for _, user := range c.users {
+		if user.Username == *input.Username {
+			return &cognito.AdminGetUserOutput{Username: &user.Username, UserAttributes: convertUserToAttributes(user)}, nil
+		}
+	}
+	return nil, &cognito.UserNotFoundException{}
+}
+
+func (c *StatefulUserPoolClient) ListUsersWithContext(ctx aws.Context, input *cognito.ListUsersInput, _ ...request.Option) (*cognito.ListUsersOutput, error) {
+	if ctx.Err() != nil {
+		return nil, newCanceledError(ctx)
+	}
+	start := 0
+	if input.PaginationToken != nil {
+		var err error
+		start, err = strconv.Atoi(*input.PaginationToken)
+		if err != nil || start < 0 || start >= len(c.users) {
+			return nil, &cognito.InvalidParameterException{Message_: aws.String("invalid pagination token")}
+		}
+	}
+	if input.Limit == nil || *input.Limit < 1 || *input.Limit > 60 {
+		return nil, errors.New("limit must be between 1 and 60")
+	}
+
+	end := start + int(*input.Limit)
+	if end > len(c.users) {
+		end = len(c.users)
+	}
+	output := &cognito.ListUsersOutput{Users: []*cognito.UserType{}}
+	for i := start; i < end; i++ {
+		user := c.users[i]
+		output.Users = append(output.Users, &cognito.UserType{Username: &user.Username, Attributes: convertUserToAttributes(user)})
+	}
+	if end < len(c.users) {
+		output.PaginationToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (c *StatefulUserPoolClient) DescribeUserPoolWithContext(ctx aws.Context, _ *cognito.DescribeUserPoolInput, _ ...request.Option) (*cognito.DescribeUserPoolOutput, error) {
+	if ctx.Err() != nil {
+		return nil, newCanceledError(ctx)
+	}
+	count := int64(len(c.users))
+	return &cognito.DescribeUserPoolOutput{UserPool: &cognito.UserPoolType{EstimatedNumberOfUsers: &count}}, nil
+}
+
+// Error the SDK returns when a request's context is done
+func newCanceledError(ctx aws.Context) error {
+	return awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func convertUserToAttributes(user model.User) []*cognito.AttributeType {
+	attrs := []*cognito.AttributeType{{Name: aws.String("email"), Value: aws.String(user.Email)}}
+	if user.Name != "" {
+		attrs = append(attrs, &cognito.AttributeType{Name: aws.String("name"), Value: aws.String(user.Name)})
+	}
+	return attrs
+}
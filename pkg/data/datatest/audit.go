@@ -0,0 +1,237 @@
+package datatest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// The sample audit events happened at the start of the last three days (UTC), so they haven't expired, with one
+	// that has
+	SampleAuditDay1   = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	SampleAuditDay2   = SampleAuditDay1.AddDate(0, 0, 1)
+	SampleAuditDay3   = SampleAuditDay1.AddDate(0, 0, 2)
+	SampleAuditEvent1 = model.AuditEvent{
+		Id:        SampleAuditDay1.Format(model.AuditEventIdTimeLayout) + "-1",
+		Time:      SampleAuditDay1.Format(time.RFC3339),
+		Username:  "user-1",
+		Groups:    []string{"admin", "vet"},
+		Field:     "Mutation.createPet",
+		Arguments: `{"input":{"name":"Pet 1"}}`,
+		Decisions: []model.AuthorizationDecision{{Action: "pet:create", Allowed: true, Reason: "allowed"}},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleAuditEvent2 = model.AuditEvent{
+		Id:        SampleAuditDay2.Format(model.AuditEventIdTimeLayout) + "-2",
+		Time:      SampleAuditDay2.Format(time.RFC3339),
+		Username:  "user-2",
+		Groups:    []string{},
+		Field:     "Mutation.deletePet",
+		Arguments: `{"input":{"id":"1"}}`,
+		Decisions: []model.AuthorizationDecision{{Action: "pet:delete", Allowed: false, Reason: "denied"}},
+		Outcome:   string(apperror.CodeForbidden),
+		Error:     "not authorized to delete pet",
+	}
+	SampleAuditEvent3 = model.AuditEvent{
+		Id:        SampleAuditDay3.Format(model.AuditEventIdTimeLayout) + "-3",
+		Time:      SampleAuditDay3.Format(time.RFC3339),
+		Username:  "user-1",
+		Groups:    []string{},
+		Field:     "Mutation.deletePet",
+		Arguments: `{"input":{"id":"1"}}`,
+		Decisions: []model.AuthorizationDecision{},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleOldAuditEvent = model.AuditEvent{
+		Id:        SampleAuditDay1.Add(-2*model.AuditEventsMaxWindow).Format(model.AuditEventIdTimeLayout) + "-5",
+		Time:      SampleAuditDay1.Add(-2 * model.AuditEventsMaxWindow).Format(time.RFC3339),
+		Username:  "user-2",
+		Groups:    []string{},
+		Field:     "Mutation.createPet",
+		Arguments: `{"input":{"name":"Pet 2"}}`,
+		Decisions: []model.AuthorizationDecision{},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleExpiredAuditEvent = model.AuditEvent{
+		Id:        SampleAuditDay1.Add(-model.AuditEventRetention).Format(model.AuditEventIdTimeLayout) + "-4",
+		Time:      SampleAuditDay1.Add(-model.AuditEventRetention).Format(time.RFC3339),
+		Username:  "user-1",
+		Groups:    []string{},
+		Field:     "Mutation.deletePet",
+		Arguments: `{"input":{"id":"1"}}`,
+		Decisions: []model.AuthorizationDecision{},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+)
+
+// Runs the conformance tests for an audit DAO; newDaos must return an audit DAO and a pet DAO backed by the same empty
+// data store (audit events are stored alongside pets)
+func TestAuditDao(t *testing.T, newDaos func() (service.AuditDao, service.PetDao)) {
+	tests := []func(*testing.T, service.AuditDao, service.PetDao){
+		testAuditInsert,
+		testAuditQuery,
+		testAuditQueryFilter,
+		testAuditQueryExpired,
+		testAuditQueryWindow,
+		testAuditAlongsidePets,
+		testAuditCanceledContext,
+	}
+	for _, test := range tests {
+		dao, petDao := newDaos()
+		test(t, dao, petDao)
+	}
+}
+
+func testAuditInsert(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	overwrite := SampleAuditEvent2
+	overwrite.Id = SampleAuditEvent1.Id
+
+	// Execute
+	err := dao.Insert(ctx, SampleAuditEvent1)
+	conflictErr := dao.Insert(ctx, overwrite)
+	events, _, queryErr := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+
+	// Verify
+	assert.Nil(t, err, "insert audit event")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(conflictErr), "insert audit event: events are never overwritten")
+	assert.Nil(t, queryErr, "insert audit event: query after insert")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, events, "insert audit event: query after insert")
+}
+
+func testAuditQuery(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertAuditEvents(t, dao, SampleAuditEvent2, SampleAuditEvent1, SampleAuditEvent3)
+
+	// Execute
+	all, allHasNext, allErr := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+	first, firstHasNext, firstErr := dao.Query(ctx, model.AuditEventsFilter{}, 2, "")
+	rest, restHasNext, restErr := dao.Query(ctx, model.AuditEventsFilter{}, 10, SampleAuditEvent2.Id)
+	none, noneHasNext, noneErr := dao.Query(ctx, model.AuditEventsFilter{}, 0, "")
+
+	// Verify
+	assert.Nil(t, allErr, "query audit events")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3, SampleAuditEvent2, SampleAuditEvent1}, all, "query audit events: newest first")
+	assert.False(t, allHasNext, "query audit events: no next page")
+	assert.Nil(t, firstErr, "query audit events: first page")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3, SampleAuditEvent2}, first, "query audit events: first page")
+	assert.True(t, firstHasNext, "query audit events: first page has a next page")
+	assert.Nil(t, restErr, "query audit events: after start")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, rest, "query audit events: after start")
+	assert.False(t, restHasNext, "query audit events: after start has no next page")
+	assert.Nil(t, noneErr, "query audit events: none requested")
+	assert.Equal(t, []model.AuditEvent{}, none, "query audit events: none requested")
+	assert.True(t, noneHasNext, "query audit events: none requested still reports events")
+}
+
+func testAuditQueryFilter(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertAuditEvents(t, dao, SampleAuditEvent1, SampleAuditEvent2, SampleAuditEvent3)
+
+	// Execute
+	byUser, _, byUserErr := dao.Query(ctx, model.AuditEventsFilter{Username: "user-1"}, 10, "")
+	byField, _, byFieldErr := dao.Query(ctx, model.AuditEventsFilter{Field: "Mutation.deletePet", Outcome: model.AuditOutcomeSuccess}, 10, "")
+	byTime, _, byTimeErr := dao.Query(ctx, model.AuditEventsFilter{From: SampleAuditEvent2.Time, To: SampleAuditEvent3.Time}, 10, "")
+	userPage, userPageHasNext, userPageErr := dao.Query(ctx, model.AuditEventsFilter{Username: "user-1"}, 1, "")
+	toOnly, _, toOnlyErr := dao.Query(ctx, model.AuditEventsFilter{To: SampleAuditDay1.Format("2006-01-02T15:04:05+00:00")}, 10, "")
+
+	// Verify
+	assert.Nil(t, byUserErr, "filter audit events by username")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3, SampleAuditEvent1}, byUser, "filter audit events by username")
+	assert.Nil(t, byFieldErr, "filter audit events by field and outcome")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3}, byField, "filter audit events by field and outcome")
+	assert.Nil(t, byTimeErr, "filter audit events by time")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3, SampleAuditEvent2}, byTime, "filter audit events by time: bounds are inclusive")
+	assert.Nil(t, userPageErr, "filter audit events: page")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent3}, userPage, "filter audit events: page")
+	assert.True(t, userPageHasNext, "filter audit events: page has a next page")
+	assert.Nil(t, toOnlyErr, "filter audit events up to a time")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, toOnly, "filter audit events up to a time")
+}
+
+func testAuditQueryExpired(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertAuditEvents(t, dao, SampleExpiredAuditEvent, SampleAuditEvent1)
+
+	// Execute
+	events, hasNext, err := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+	from, _, fromErr := dao.Query(ctx, model.AuditEventsFilter{From: SampleExpiredAuditEvent.Time}, 10, "")
+
+	// Verify
+	assert.Nil(t, err, "query expired audit events")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, events, "query expired audit events: expired events aren't included")
+	assert.False(t, hasNext, "query expired audit events: no next page")
+	assert.Nil(t, fromErr, "query expired audit events: from before the retention period")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, from, "query expired audit events: from before the retention period")
+}
+
+func testAuditQueryWindow(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertAuditEvents(t, dao, SampleOldAuditEvent, SampleAuditEvent1)
+	to := SampleAuditDay1.Add(-2*model.AuditEventsMaxWindow + time.Hour).Format(time.RFC3339)
+
+	// Execute
+	events, hasNext, err := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+	old, _, oldErr := dao.Query(ctx, model.AuditEventsFilter{To: to}, 10, "")
+
+	// Verify
+	assert.Nil(t, err, "query audit events window")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, events, "query audit events window: events before the longest window aren't included")
+	assert.False(t, hasNext, "query audit events window: no next page")
+	assert.Nil(t, oldErr, "query audit events window: ending before the window")
+	assert.Equal(t, []model.AuditEvent{SampleOldAuditEvent}, old, "query audit events window: ending before the window")
+}
+
+func testAuditAlongsidePets(t *testing.T, dao service.AuditDao, petDao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, petDao, SamplePet1)
+	insertAuditEvents(t, dao, SampleAuditEvent1)
+
+	// Execute
+	pets, _, queryErr := petDao.Query(ctx, 10, "")
+	count, countErr := petDao.GetTotalCount(ctx)
+	events, _, eventsErr := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+
+	// Verify
+	assert.Nil(t, queryErr, "audit event alongside pet: query pets")
+	assert.Equal(t, []model.Pet{SamplePet1}, pets, "audit event alongside pet: audit events aren't pets")
+	assert.Nil(t, countErr, "audit event alongside pet: count pets")
+	assert.Equal(t, 1, count, "audit event alongside pet: audit events aren't counted as pets")
+	assert.Nil(t, eventsErr, "audit event alongside pet: query audit events")
+	assert.Equal(t, []model.AuditEvent{SampleAuditEvent1}, events, "audit event alongside pet: pets aren't audit events")
+}
+
+func testAuditCanceledContext(t *testing.T, dao service.AuditDao, _ service.PetDao) {
+	// Setup
+	insertAuditEvents(t, dao, SampleAuditEvent1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	insertErr := dao.Insert(ctx, SampleAuditEvent2)
+	_, _, queryErr := dao.Query(ctx, model.AuditEventsFilter{}, 10, "")
+
+	// Verify
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(insertErr), "canceled context: insert audit event")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryErr), "canceled context: query audit events")
+}
+
+func insertAuditEvents(t *testing.T, dao service.AuditDao, events ...model.AuditEvent) {
+	ctx := context.Background()
+	for _, event := range events {
+		err := dao.Insert(ctx, event)
+		assert.Nil(t, err, "insert audit event "+event.Id)
+	}
+}
@@ -0,0 +1,616 @@
+// Package datatest contains conformance tests shared by every implementation of the data access objects
+package datatest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SamplePet1 = model.Pet{Id: "conformance-pet-1", Name: "pet 1", Age: 1, Owners: []string{"user-1"}, Version: 1}
+	SamplePet2 = model.Pet{Id: "conformance-pet-2", Name: "pet 2", Age: 2, Owners: []string{"user-2"}, Version: 1}
+	SamplePet3 = model.Pet{Id: "conformance-pet-3", Name: "pet 3", Age: 3, Owners: []string{}, Version: 1}
+	SamplePet4 = model.Pet{Id: "conformance-pet-4", Name: "pet 4", Species: model.SpeciesDog, Breed: "Beagle", BirthDate: "2018-02-03", Owners: []string{}, Version: 1}
+)
+
+// Username the conformance tests change pets as
+const changedBy = "conformance-user"
+
+// Runs the conformance tests for a pet DAO; newDao must return a DAO backed by an empty data store
+func TestPetDao(t *testing.T, newDao func() service.PetDao) {
+	testPetGetById(t, newDao())
+	testPetBirthDate(t, newDao())
+	testPetPatch(t, newDao())
+	testPetOwners(t, newDao())
+	testPetDelete(t, newDao())
+	testPetRestore(t, newDao())
+	testPetPurge(t, newDao())
+	testPetHistory(t, newDao())
+	testPetGetAsOf(t, newDao())
+	testPetVersionConflict(t, newDao())
+	testPetGetTotalCount(t, newDao())
+	testPetQuery(t, newDao())
+	testPetQueryByOwner(t, newDao())
+	testPetQueryByOwnerPrivate(t, newDao())
+	testPetCanceledContext(t, newDao())
+}
+
+func testPetGetById(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1)
+
+	// Execute
+	pet, err := dao.GetById(ctx, SamplePet1.Id)
+	_, notFoundErr := dao.GetById(ctx, "unknown")
+
+	// Verify
+	assert.Nil(t, err, "get by id: existing pet")
+	assert.Equal(t, SamplePet1, pet, "get by id: existing pet")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "get by id: unknown pet")
+}
+
+func testPetBirthDate(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet4)
+	expected := SamplePet4.WithAgeOn(time.Now())
+	birthDate := "2020-02-03"
+
+	// Execute
+	pet, err := dao.GetById(ctx, SamplePet4.Id)
+	pets, _, queryErr := dao.Query(ctx, 10, "")
+	patched, patchErr := dao.Patch(ctx, SamplePet4.Id, SamplePet4.Version, model.PetPatch{BirthDate: &birthDate}, changedBy)
+
+	// Verify
+	assert.Nil(t, err, "birth date: get by id")
+	assert.Equal(t, expected, pet, "birth date: species, breed and birth date round trip and age is computed")
+	assert.Nil(t, queryErr, "birth date: query")
+	assert.Equal(t, []model.Pet{expected}, pets, "birth date: query computes age")
+	assert.Nil(t, patchErr, "birth date: patch")
+	assert.Equal(t, birthDate, patched.BirthDate, "birth date: patch")
+	assert.Equal(t, model.Pet{BirthDate: birthDate}.WithAgeOn(time.Now()).Age, patched.Age, "birth date: patched birth date changes the age")
+}
+
+func testPetPatch(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1)
+	name := "patched name"
+	noOwners := []string{}
+	expected := SamplePet1
+	expected.Name = name
+	expected.Owners = noOwners
+	expected = withNextChange(expected, SamplePet1.Version+1)
+	before := time.Now()
+
+	// Execute
+	pet, err := dao.Patch(ctx, SamplePet1.Id, SamplePet1.Version, model.PetPatch{Name: &name, Owners: &noOwners}, changedBy)
+	stored, getErr := dao.GetById(ctx, SamplePet1.Id)
+	unchanged, emptyErr := dao.Patch(ctx, SamplePet1.Id, expected.Version, model.PetPatch{}, "someone else")
+	_, notFoundErr := dao.Patch(ctx, "unknown", 1, model.PetPatch{Name: &name}, changedBy)
+
+	// Verify
+	assert.Nil(t, err, "patch: existing pet")
+	assertChangedSince(t, before, pet, "patch: change time")
+	assert.Equal(t, expected, withoutChangedAt(pet), "patch: returns the updated pet with its version incremented and who changed it")
+	assert.Nil(t, getErr, "patch: get after patch")
+	assert.Equal(t, pet, stored, "patch: fields left out of the patch are unchanged")
+	assert.Nil(t, emptyErr, "patch: empty patch")
+	assert.Equal(t, pet, unchanged, "patch: empty patch changes nothing (not even the version)")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "patch: unknown pet")
+}
+
+func testPetOwners(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	pet := SamplePet1
+	pet.Owners = []string{"user-3", "user-1", "user-3"}
+	insertPets(t, dao, pet)
+	owners := []string{"user-2", "user-1"}
+
+	// Execute
+	inserted, getErr := dao.GetById(ctx, pet.Id)
+	patched, patchErr := dao.Patch(ctx, pet.Id, pet.Version, model.PetPatch{Owners: &owners}, changedBy)
+	owners[0] = "changed after the patch"
+	stored, storedErr := dao.GetById(ctx, pet.Id)
+
+	// Verify
+	assert.Nil(t, getErr, "owners: get after insert")
+	assert.Equal(t, []string{"user-1", "user-3"}, inserted.Owners, "owners: stored as a set in ascending order")
+	assert.Nil(t, patchErr, "owners: patch")
+	assert.Equal(t, []string{"user-1", "user-2"}, patched.Owners, "owners: patch replaces every owner")
+	assert.Nil(t, storedErr, "owners: get after patch")
+	assert.Equal(t, []string{"user-1", "user-2"}, stored.Owners, "owners: stored owners aren't tied to the patched slice")
+}
+
+func testPetDelete(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1, SamplePet2, SamplePet3)
+	before := time.Now()
+
+	// Execute
+	err := dao.Delete(ctx, SamplePet1.Id, nil, changedBy)
+	_, getErr := dao.GetById(ctx, SamplePet1.Id)
+	deleted, getDeletedErr := dao.GetDeletedById(ctx, SamplePet1.Id)
+	notFoundErr := dao.Delete(ctx, SamplePet1.Id, nil, changedBy)
+	versionErr := dao.Delete(ctx, SamplePet2.Id, &SamplePet2.Version, changedBy)
+	versionNotFoundErr := dao.Delete(ctx, SamplePet2.Id, &SamplePet2.Version, changedBy)
+	pets, _, queryErr := dao.Query(ctx, 10, "")
+	count, countErr := dao.GetTotalCount(ctx)
+	deletedPets, hasNextPage, queryDeletedErr := dao.QueryDeleted(ctx, 10, "")
+	deletedCount, deletedCountErr := dao.GetDeletedTotalCount(ctx)
+	_, getUnknownErr := dao.GetDeletedById(ctx, SamplePet3.Id)
+
+	// Verify
+	assert.Nil(t, err, "delete: existing pet")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getErr), "delete: pet is hidden")
+	assert.Nil(t, getDeletedErr, "delete: pet is kept as a deleted pet")
+	deletedAt, parseErr := time.Parse(time.RFC3339, deleted.DeletedAt)
+	assert.Nil(t, parseErr, "delete: deleted time")
+	assert.WithinDuration(t, before, deletedAt, time.Minute, "delete: deleted time")
+	assert.Equal(t, deleted.DeletedAt, deleted.ChangedAt, "delete: deleting is the change")
+	deleted.DeletedAt = ""
+	assert.Equal(t, withNextChange(SamplePet1, SamplePet1.Version+1), withoutChangedAt(deleted), "delete: deleted pet keeps its attributes")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "delete: unknown pet")
+	assert.Nil(t, versionErr, "delete: existing pet with expected version")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(versionNotFoundErr), "delete: unknown pet with expected version")
+	assert.Nil(t, queryErr, "delete: query")
+	assert.Equal(t, []model.Pet{SamplePet3}, pets, "delete: query leaves out deleted pets")
+	assert.Nil(t, countErr, "delete: count")
+	assert.Equal(t, 1, count, "delete: count leaves out deleted pets")
+	assert.Nil(t, queryDeletedErr, "delete: query deleted")
+	assert.Equal(t, 2, len(deletedPets), "delete: query deleted")
+	assert.False(t, hasNextPage, "delete: query deleted")
+	assert.Nil(t, deletedCountErr, "delete: count deleted")
+	assert.Equal(t, 2, deletedCount, "delete: count deleted")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getUnknownErr), "delete: pet which wasn't deleted")
+}
+
+func testPetRestore(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1, SamplePet2)
+	assert.Nil(t, dao.Delete(ctx, SamplePet1.Id, nil, "someone else"), "restore: delete")
+	assert.Nil(t, dao.Delete(ctx, SamplePet2.Id, nil, "someone else"), "restore: delete")
+	stale := SamplePet2.Version
+
+	// Execute
+	pet, err := dao.Restore(ctx, SamplePet1.Id, nil, changedBy)
+	stored, getErr := dao.GetById(ctx, SamplePet1.Id)
+	_, getDeletedErr := dao.GetDeletedById(ctx, SamplePet1.Id)
+	_, notFoundErr := dao.Restore(ctx, SamplePet1.Id, nil, changedBy)
+	_, versionErr := dao.Restore(ctx, SamplePet2.Id, &stale, changedBy)
+
+	// Verify
+	assert.Nil(t, err, "restore: deleted pet")
+	assert.Equal(t, withNextChange(SamplePet1, SamplePet1.Version+2), withoutChangedAt(pet), "restore: deleted pet")
+	assert.Nil(t, getErr, "restore: get after restore")
+	assert.Equal(t, pet, stored, "restore: get after restore")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getDeletedErr), "restore: no longer deleted")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "restore: pet which isn't deleted")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(versionErr), "restore: stale version")
+}
+
+func testPetPurge(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1, SamplePet2, SamplePet3)
+	assert.Nil(t, dao.Delete(ctx, SamplePet2.Id, nil, changedBy), "purge: delete")
+	stale := SamplePet3.Version - 1
+
+	// Execute
+	err := dao.Purge(ctx, SamplePet1.Id, &SamplePet1.Version)
+	_, getErr := dao.GetById(ctx, SamplePet1.Id)
+	deletedErr := dao.Purge(ctx, SamplePet2.Id, nil)
+	_, getDeletedErr := dao.GetDeletedById(ctx, SamplePet2.Id)
+	notFoundErr := dao.Purge(ctx, SamplePet1.Id, nil)
+	versionErr := dao.Purge(ctx, SamplePet3.Id, &stale)
+	_, getStaleErr := dao.GetById(ctx, SamplePet3.Id)
+	historyCount, historyCountErr := dao.GetHistoryCount(ctx, SamplePet2.Id)
+
+	// Verify
+	assert.Nil(t, err, "purge: existing pet")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getErr), "purge: pet is gone")
+	assert.Nil(t, deletedErr, "purge: deleted pet")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getDeletedErr), "purge: deleted pet is gone")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "purge: unknown pet")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(versionErr), "purge: stale version")
+	assert.Nil(t, getStaleErr, "purge: pet is kept after a conflict")
+	assert.Nil(t, historyCountErr, "purge: history count")
+	assert.Equal(t, 0, historyCount, "purge: history is gone")
+}
+
+func testPetHistory(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	created := SamplePet1
+	created.ChangedBy = "creator"
+	created.ChangedAt = "2020-01-01T00:00:00Z"
+	insertPets(t, dao, created, SamplePet2)
+	name := "patched name"
+	_, err := dao.Patch(ctx, SamplePet1.Id, 1, model.PetPatch{Name: &name}, changedBy)
+	assert.Nil(t, err, "history: patch")
+	assert.Nil(t, dao.Delete(ctx, SamplePet1.Id, nil, changedBy), "history: delete")
+	_, err = dao.Restore(ctx, SamplePet1.Id, nil, changedBy)
+	assert.Nil(t, err, "history: restore")
+
+	// Execute
+	versions, hasNextPage, err := dao.QueryHistory(ctx, SamplePet1.Id, 10, 0)
+	firstPage, firstHasNextPage, firstErr := dao.QueryHistory(ctx, SamplePet1.Id, 2, 0)
+	secondPage, secondHasNextPage, secondErr := dao.QueryHistory(ctx, SamplePet1.Id, 2, 3)
+	count, countErr := dao.GetHistoryCount(ctx, SamplePet1.Id)
+	unknown, _, unknownErr := dao.QueryHistory(ctx, "unknown", 10, 0)
+	unknownCount, unknownCountErr := dao.GetHistoryCount(ctx, "unknown")
+
+	// Verify
+	assert.Nil(t, err, "history: query")
+	assert.False(t, hasNextPage, "history: query")
+	if assert.Equal(t, 4, len(versions), "history: every version is kept") {
+		assert.Equal(t, withNextChange(withName(SamplePet1, name), 4), withoutChangedAt(versions[0]), "history: restored version")
+		assert.NotEmpty(t, versions[1].DeletedAt, "history: deleted version")
+		assert.Equal(t, 3, versions[1].Version, "history: deleted version")
+		assert.Equal(t, withNextChange(withName(SamplePet1, name), 2), withoutChangedAt(versions[2]), "history: patched version")
+		assertChangedSince(t, time.Now().Add(-time.Minute), versions[2], "history: patched version")
+		assert.Equal(t, created, versions[3], "history: inserted version")
+	}
+	assert.Nil(t, firstErr, "history: first page")
+	assert.Equal(t, []int{4, 3}, petVersions(firstPage), "history: first page is newest first")
+	assert.True(t, firstHasNextPage, "history: first page")
+	assert.Nil(t, secondErr, "history: second page")
+	assert.Equal(t, []int{2, 1}, petVersions(secondPage), "history: second page is after the start version")
+	assert.True(t, secondHasNextPage, "history: second page (limit reached)")
+	assert.Nil(t, countErr, "history: count")
+	assert.Equal(t, 4, count, "history: count")
+	assert.Nil(t, unknownErr, "history: unknown pet")
+	assert.Empty(t, unknown, "history: unknown pet")
+	assert.Nil(t, unknownCountErr, "history: unknown pet count")
+	assert.Equal(t, 0, unknownCount, "history: unknown pet count")
+}
+
+func testPetGetAsOf(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	created := SamplePet1
+	created.ChangedBy = "creator"
+	created.ChangedAt = "2020-01-01T00:00:00Z"
+	insertPets(t, dao, created)
+	name := "patched name"
+	patched, err := dao.Patch(ctx, SamplePet1.Id, 1, model.PetPatch{Name: &name}, changedBy)
+	assert.Nil(t, err, "as of: patch")
+	later := time.Now().Add(time.Minute)
+
+	// Execute
+	original, originalErr := dao.GetAsOf(ctx, SamplePet1.Id, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	exact, exactErr := dao.GetAsOf(ctx, SamplePet1.Id, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	current, currentErr := dao.GetAsOf(ctx, SamplePet1.Id, later)
+	_, beforeErr := dao.GetAsOf(ctx, SamplePet1.Id, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, unknownErr := dao.GetAsOf(ctx, "unknown", later)
+	assert.Nil(t, dao.Delete(ctx, SamplePet1.Id, nil, changedBy), "as of: delete")
+	_, deletedErr := dao.GetAsOf(ctx, SamplePet1.Id, later)
+	beforeDelete, beforeDeleteErr := dao.GetAsOf(ctx, SamplePet1.Id, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// Verify
+	assert.Nil(t, originalErr, "as of: before the patch")
+	assert.Equal(t, created, original, "as of: before the patch")
+	assert.Nil(t, exactErr, "as of: exactly when created")
+	assert.Equal(t, created, exact, "as of: exactly when created")
+	assert.Nil(t, currentErr, "as of: after the patch")
+	assert.Equal(t, patched, current, "as of: after the patch")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(beforeErr), "as of: before the pet existed")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(unknownErr), "as of: unknown pet")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(deletedErr), "as of: after the pet was deleted")
+	assert.Nil(t, beforeDeleteErr, "as of: before the pet was deleted")
+	assert.Equal(t, created, beforeDelete, "as of: before the pet was deleted")
+}
+
+func testPetVersionConflict(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1)
+	name := "first writer"
+	_, err := dao.Patch(ctx, SamplePet1.Id, SamplePet1.Version, model.PetPatch{Name: &name}, changedBy)
+	assert.Nil(t, err, "version conflict: first write")
+	stale := SamplePet1.Version
+	staleName := "second writer"
+
+	// Execute
+	_, patchErr := dao.Patch(ctx, SamplePet1.Id, stale, model.PetPatch{Name: &staleName}, changedBy)
+	_, emptyPatchErr := dao.Patch(ctx, SamplePet1.Id, stale, model.PetPatch{}, changedBy)
+	deleteErr := dao.Delete(ctx, SamplePet1.Id, &stale, changedBy)
+	pet, getErr := dao.GetById(ctx, SamplePet1.Id)
+
+	// Verify
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(patchErr), "version conflict: patch")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(emptyPatchErr), "version conflict: empty patch")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(deleteErr), "version conflict: delete")
+	assert.Nil(t, getErr, "version conflict: get after conflicts")
+	assert.Equal(t, name, pet.Name, "version conflict: the first write is kept")
+	assert.Equal(t, SamplePet1.Version+1, pet.Version, "version conflict: version only moved on once")
+}
+
+func testPetGetTotalCount(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1, SamplePet2, SamplePet3)
+
+	// Execute
+	count, err := dao.GetTotalCount(ctx)
+
+	// Verify
+	assert.Nil(t, err, "get total count")
+	assert.Equal(t, 3, count, "get total count")
+}
+
+func testPetQuery(t *testing.T, dao service.PetDao) {
+	// Define test struct
+	type Test struct {
+		name                string
+		count               int
+		exclusiveStartId    func(firstPage []model.Pet) string
+		expectedCount       int
+		expectedHasNextPage bool
+	}
+
+	// Setup
+	ctx := context.Background()
+	insertPets(t, dao, SamplePet1, SamplePet2, SamplePet3)
+	firstPage, _, err := dao.Query(ctx, 2, "")
+	assert.Nil(t, err, "query: first page")
+	if len(firstPage) != 2 {
+		assert.Fail(t, "query: first page should have 2 pets")
+		return
+	}
+	fromStart := func([]model.Pet) string { return "" }
+	afterFirstPage := func(page []model.Pet) string { return page[len(page)-1].Id }
+
+	// Define tests (ordering is implementation specific, so cursors are taken from the first page)
+	tests := []Test{
+		{
+			name:                "query: request more pets than exist",
+			count:               10,
+			exclusiveStartId:    fromStart,
+			expectedCount:       3,
+			expectedHasNextPage: false,
+		},
+		{
+			name:                "query: request less pets than exist",
+			count:               2,
+			exclusiveStartId:    fromStart,
+			expectedCount:       2,
+			expectedHasNextPage: true,
+		},
+		{
+			name:                "query: limit reached exactly at end of pets",
+			count:               3,
+			exclusiveStartId:    fromStart,
+			expectedCount:       3,
+			expectedHasNextPage: true,
+		},
+		{
+			name:                "query: reach end of pets",
+			count:               2,
+			exclusiveStartId:    afterFirstPage,
+			expectedCount:       1,
+			expectedHasNextPage: false,
+		},
+		{
+			name:                "query: count=0 at start",
+			count:               0,
+			exclusiveStartId:    fromStart,
+			expectedCount:       0,
+			expectedHasNextPage: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Execute
+		pets, hasNextPage, err := dao.Query(ctx, test.count, test.exclusiveStartId(firstPage))
+
+		// Verify
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expectedCount, len(pets), test.name)
+		assert.Equal(t, test.expectedHasNextPage, hasNextPage, test.name)
+	}
+
+	// Paging through every pet returns each pet exactly once
+	secondPage, _, _ := dao.Query(ctx, 2, afterFirstPage(firstPage))
+	assert.ElementsMatch(t, []model.Pet{SamplePet1, SamplePet2, SamplePet3}, append(firstPage, secondPage...), "query: pages cover every pet")
+
+	// Nothing is after the last pet
+	lastPage := append(firstPage, secondPage...)
+	pets, hasNextPage, err := dao.Query(ctx, 0, afterFirstPage(lastPage))
+	assert.Nil(t, err, "query: count=0 at end")
+	assert.Empty(t, pets, "query: count=0 at end")
+	assert.False(t, hasNextPage, "query: count=0 at end")
+}
+
+func testPetQueryByOwner(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	shared := SamplePet3
+	shared.Owners = []string{"user-1", "user-2"}
+	insertPets(t, dao, SamplePet1, SamplePet2, shared)
+	ids := func(pets []model.Pet) []string {
+		ids := []string{}
+		for _, pet := range pets {
+			ids = append(ids, pet.Id)
+		}
+		return ids
+	}
+
+	// Execute
+	all, allHasNextPage, allErr := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	first, firstHasNextPage, firstErr := dao.QueryByOwner(ctx, "user-1", true, 1, "")
+	second, secondHasNextPage, secondErr := dao.QueryByOwner(ctx, "user-1", true, 1, SamplePet1.Id)
+	none, noneHasNextPage, noneErr := dao.QueryByOwner(ctx, "user-1", true, 0, "")
+	count, countErr := dao.GetTotalCountByOwner(ctx, "user-1", true)
+
+	// Verify
+	assert.Nil(t, allErr, "query by owner: every pet")
+	assert.Equal(t, []model.Pet{SamplePet1, shared}, all, "query by owner: every pet, ordered by ID")
+	assert.False(t, allHasNextPage, "query by owner: every pet")
+	assert.Nil(t, firstErr, "query by owner: first page")
+	assert.Equal(t, []string{SamplePet1.Id}, ids(first), "query by owner: first page")
+	assert.True(t, firstHasNextPage, "query by owner: first page")
+	assert.Nil(t, secondErr, "query by owner: second page")
+	assert.Equal(t, []string{shared.Id}, ids(second), "query by owner: second page")
+	assert.True(t, secondHasNextPage, "query by owner: limit reached exactly at end of pets")
+	assert.Nil(t, noneErr, "query by owner: count=0")
+	assert.Empty(t, none, "query by owner: count=0")
+	assert.True(t, noneHasNextPage, "query by owner: count=0")
+	assert.Nil(t, countErr, "query by owner: total count")
+	assert.Equal(t, 2, count, "query by owner: total count")
+
+	// Pets follow their owners through patches, deletes and restores
+	patched := []string{"user-2"}
+	_, patchErr := dao.Patch(ctx, shared.Id, shared.Version, model.PetPatch{Owners: &patched}, changedBy)
+	afterPatch, _, _ := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	added := []string{"user-1"}
+	_, addErr := dao.Patch(ctx, SamplePet2.Id, SamplePet2.Version, model.PetPatch{Owners: &added}, changedBy)
+	afterAdd, _, _ := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	deleteErr := dao.Delete(ctx, SamplePet1.Id, nil, changedBy)
+	afterDelete, _, _ := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	afterDeleteCount, _ := dao.GetTotalCountByOwner(ctx, "user-1", true)
+	_, restoreErr := dao.Restore(ctx, SamplePet1.Id, nil, changedBy)
+	afterRestore, _, _ := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	formerOwner, _, _ := dao.QueryByOwner(ctx, "user-2", true, 10, "")
+	purgeErr := dao.Purge(ctx, SamplePet1.Id, nil)
+	afterPurge, _, _ := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+
+	assert.Nil(t, patchErr, "query by owner: patch")
+	assert.Equal(t, []string{SamplePet1.Id}, ids(afterPatch), "query by owner: removed owner no longer lists the pet")
+	assert.Nil(t, addErr, "query by owner: patch adding an owner")
+	assert.Equal(t, []string{SamplePet1.Id, SamplePet2.Id}, ids(afterAdd), "query by owner: new owner lists the pet")
+	assert.Nil(t, deleteErr, "query by owner: delete")
+	assert.Equal(t, []string{SamplePet2.Id}, ids(afterDelete), "query by owner: deleted pets aren't listed")
+	assert.Equal(t, 1, afterDeleteCount, "query by owner: deleted pets aren't counted")
+	assert.Nil(t, restoreErr, "query by owner: restore")
+	assert.Equal(t, []string{SamplePet1.Id, SamplePet2.Id}, ids(afterRestore), "query by owner: restored pets are listed again")
+	assert.Equal(t, []string{shared.Id}, ids(formerOwner), "query by owner: other owners are unaffected")
+	assert.Nil(t, purgeErr, "query by owner: purge")
+	assert.Equal(t, []string{SamplePet2.Id}, ids(afterPurge), "query by owner: purged pets aren't listed")
+}
+
+func testPetQueryByOwnerPrivate(t *testing.T, dao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	private := SamplePet2
+	private.Owners = []string{"user-1"}
+	private.Private = true
+	insertPets(t, dao, SamplePet1, private)
+
+	// Execute
+	withPrivate, _, withPrivateErr := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	withPrivateCount, withPrivateCountErr := dao.GetTotalCountByOwner(ctx, "user-1", true)
+	withoutPrivate, withoutPrivateHasNextPage, withoutPrivateErr := dao.QueryByOwner(ctx, "user-1", false, 10, "")
+	withoutPrivateCount, withoutPrivateCountErr := dao.GetTotalCountByOwner(ctx, "user-1", false)
+	afterPublic, _, afterPublicErr := dao.QueryByOwner(ctx, "user-1", false, 1, SamplePet1.Id)
+
+	// Verify
+	assert.Nil(t, withPrivateErr, "query by owner: private pets included")
+	assert.Equal(t, []model.Pet{SamplePet1, private}, withPrivate, "query by owner: private pets included")
+	assert.Nil(t, withPrivateCountErr, "query by owner: private pets counted")
+	assert.Equal(t, 2, withPrivateCount, "query by owner: private pets counted")
+	assert.Nil(t, withoutPrivateErr, "query by owner: private pets left out")
+	assert.Equal(t, []model.Pet{SamplePet1}, withoutPrivate, "query by owner: private pets left out")
+	assert.False(t, withoutPrivateHasNextPage, "query by owner: private pets left out")
+	assert.Nil(t, withoutPrivateCountErr, "query by owner: private pets not counted")
+	assert.Equal(t, 1, withoutPrivateCount, "query by owner: private pets not counted")
+	assert.Nil(t, afterPublicErr, "query by owner: only private pets left")
+	assert.Empty(t, afterPublic, "query by owner: only private pets left")
+}
+
+func testPetCanceledContext(t *testing.T, dao service.PetDao) {
+	// Setup
+	insertPets(t, dao, SamplePet1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	_, getErr := dao.GetById(ctx, SamplePet1.Id)
+	_, _, queryErr := dao.Query(ctx, 10, "")
+	_, countErr := dao.GetTotalCount(ctx)
+	_, _, queryByOwnerErr := dao.QueryByOwner(ctx, "user-1", true, 10, "")
+	_, ownerCountErr := dao.GetTotalCountByOwner(ctx, "user-1", true)
+	insertErr := dao.Insert(ctx, SamplePet2)
+	_, patchErr := dao.Patch(ctx, SamplePet1.Id, SamplePet1.Version, model.PetPatch{Name: &SamplePet2.Name}, changedBy)
+	deleteErr := dao.Delete(ctx, SamplePet1.Id, nil, changedBy)
+	_, restoreErr := dao.Restore(ctx, SamplePet1.Id, nil, changedBy)
+	purgeErr := dao.Purge(ctx, SamplePet1.Id, nil)
+	_, getDeletedErr := dao.GetDeletedById(ctx, SamplePet1.Id)
+	_, _, queryDeletedErr := dao.QueryDeleted(ctx, 10, "")
+	_, deletedCountErr := dao.GetDeletedTotalCount(ctx)
+	_, asOfErr := dao.GetAsOf(ctx, SamplePet1.Id, time.Now())
+	_, _, historyErr := dao.QueryHistory(ctx, SamplePet1.Id, 10, 0)
+	_, historyCountErr := dao.GetHistoryCount(ctx, SamplePet1.Id)
+
+	// Verify
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(getErr), "canceled context: get by id")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryErr), "canceled context: query")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(countErr), "canceled context: get total count")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryByOwnerErr), "canceled context: query by owner")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(ownerCountErr), "canceled context: get total count by owner")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(insertErr), "canceled context: insert")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(patchErr), "canceled context: patch")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(deleteErr), "canceled context: delete")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(restoreErr), "canceled context: restore")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(purgeErr), "canceled context: purge")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(getDeletedErr), "canceled context: get deleted by id")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryDeletedErr), "canceled context: query deleted")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(deletedCountErr), "canceled context: get deleted total count")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(asOfErr), "canceled context: get as of")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(historyErr), "canceled context: query history")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(historyCountErr), "canceled context: get history count")
+}
+
+// Gets a copy of the pet at another version, last changed by the conformance tests (at an unknown time)
+func withNextChange(pet model.Pet, version int) model.Pet {
+	pet.Version = version
+	pet.ChangedBy = changedBy
+	return pet
+}
+
+// Gets a copy of the pet without its change time, which depends on when the test ran
+func withoutChangedAt(pet model.Pet) model.Pet {
+	pet.ChangedAt = ""
+	return pet
+}
+
+// Checks a pet was changed after the given time (change times only have second precision)
+func assertChangedSince(t *testing.T, before time.Time, pet model.Pet, name string) {
+	changedAt, err := time.Parse(time.RFC3339, pet.ChangedAt)
+	assert.Nil(t, err, name)
+	assert.WithinDuration(t, before, changedAt, time.Minute, name)
+}
+
+// Gets a copy of the pet with another name
+func withName(pet model.Pet, name string) model.Pet {
+	pet.Name = name
+	return pet
+}
+
+// Gets the versions of the pets in order
+func petVersions(pets []model.Pet) []int {
+	versions := []int{}
+	for _, pet := range pets {
+		versions = append(versions, pet.Version)
+	}
+	return versions
+}
+
+func insertPets(t *testing.T, dao service.PetDao, pets ...model.Pet) {
+	ctx := context.Background()
+	for _, pet := range pets {
+		err := dao.Insert(ctx, pet)
+		assert.Nil(t, err, "insert "+pet.Id)
+	}
+}
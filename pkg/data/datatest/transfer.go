@@ -0,0 +1,144 @@
+package datatest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleTransfer1 = model.PetTransfer{PetId: SamplePet1.Id, Sender: "user-1", Recipient: "user-2", RequestedAt: "2022-01-01T00:00:00Z"}
+	SampleTransfer2 = model.PetTransfer{PetId: SamplePet2.Id, Sender: "user-2", Recipient: "user-3", RequestedAt: "2022-01-02T00:00:00Z", AddsOwner: true}
+	SampleTransfer3 = model.PetTransfer{PetId: SamplePet3.Id, Sender: "user-3", Recipient: "user-1", RequestedAt: "2022-01-03T00:00:00Z", ReplacesOwners: true}
+)
+
+// Runs the conformance tests for a pet transfer DAO; newDaos must return a transfer DAO and a pet DAO backed by the
+// same empty data store (transfers are stored alongside pets)
+func TestPetTransferDao(t *testing.T, newDaos func() (service.PetTransferDao, service.PetDao)) {
+	tests := []func(*testing.T, service.PetTransferDao, service.PetDao){
+		testTransferInsert,
+		testTransferDelete,
+		testTransferQueryByUser,
+		testTransferAlongsidePets,
+		testTransferCanceledContext,
+	}
+	for _, test := range tests {
+		dao, petDao := newDaos()
+		test(t, dao, petDao)
+	}
+}
+
+func testTransferInsert(t *testing.T, dao service.PetTransferDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	second := SampleTransfer2
+	second.PetId = SampleTransfer1.PetId
+
+	// Execute
+	err := dao.Insert(ctx, SampleTransfer1)
+	transfer, getErr := dao.GetByPetId(ctx, SampleTransfer1.PetId)
+	conflictErr := dao.Insert(ctx, second)
+	_, notFoundErr := dao.GetByPetId(ctx, "unknown")
+
+	// Verify
+	assert.Nil(t, err, "insert transfer")
+	assert.Nil(t, getErr, "insert transfer: get after insert")
+	assert.Equal(t, SampleTransfer1, transfer, "insert transfer: get after insert")
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(conflictErr), "insert transfer: pet already has a pending transfer")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "insert transfer: unknown pet")
+}
+
+func testTransferDelete(t *testing.T, dao service.PetTransferDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertTransfers(t, dao, SampleTransfer1)
+
+	// Execute
+	err := dao.Delete(ctx, SampleTransfer1.PetId)
+	_, getErr := dao.GetByPetId(ctx, SampleTransfer1.PetId)
+	senderTransfers, senderErr := dao.QueryByUser(ctx, SampleTransfer1.Sender)
+	recipientTransfers, recipientErr := dao.QueryByUser(ctx, SampleTransfer1.Recipient)
+	notFoundErr := dao.Delete(ctx, SampleTransfer1.PetId)
+	insertErr := dao.Insert(ctx, SampleTransfer1)
+
+	// Verify
+	assert.Nil(t, err, "delete transfer")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(getErr), "delete transfer: transfer is gone")
+	assert.Nil(t, senderErr, "delete transfer: sender's transfers")
+	assert.Equal(t, []model.PetTransfer{}, senderTransfers, "delete transfer: sender's transfers")
+	assert.Nil(t, recipientErr, "delete transfer: recipient's transfers")
+	assert.Equal(t, []model.PetTransfer{}, recipientTransfers, "delete transfer: recipient's transfers")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "delete transfer: unknown transfer")
+	assert.Nil(t, insertErr, "delete transfer: a new transfer can be requested")
+}
+
+func testTransferQueryByUser(t *testing.T, dao service.PetTransferDao, _ service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertTransfers(t, dao, SampleTransfer1, SampleTransfer2, SampleTransfer3)
+
+	// Execute
+	user1Transfers, err := dao.QueryByUser(ctx, "user-1")
+	unknownTransfers, unknownErr := dao.QueryByUser(ctx, "unknown")
+
+	// Verify
+	assert.Nil(t, err, "query transfers by user")
+	assert.ElementsMatch(t, []model.PetTransfer{SampleTransfer1, SampleTransfer3}, user1Transfers, "query transfers by user: sent and received")
+	assert.Nil(t, unknownErr, "query transfers by user: no transfers")
+	assert.Equal(t, []model.PetTransfer{}, unknownTransfers, "query transfers by user: no transfers")
+}
+
+func testTransferAlongsidePets(t *testing.T, dao service.PetTransferDao, petDao service.PetDao) {
+	// Setup
+	ctx := context.Background()
+	insertPets(t, petDao, SamplePet1)
+	insertTransfers(t, dao, SampleTransfer1)
+
+	// Execute
+	pet, getErr := petDao.GetById(ctx, SamplePet1.Id)
+	pets, _, queryErr := petDao.Query(ctx, 10, "")
+	count, countErr := petDao.GetTotalCount(ctx)
+	deleteErr := dao.Delete(ctx, SampleTransfer1.PetId)
+	_, petAfterDeleteErr := petDao.GetById(ctx, SamplePet1.Id)
+
+	// Verify
+	assert.Nil(t, getErr, "transfer alongside pet: get pet")
+	assert.Equal(t, SamplePet1, pet, "transfer alongside pet: get pet")
+	assert.Nil(t, queryErr, "transfer alongside pet: query pets")
+	assert.Equal(t, []model.Pet{SamplePet1}, pets, "transfer alongside pet: transfers aren't pets")
+	assert.Nil(t, countErr, "transfer alongside pet: count pets")
+	assert.Equal(t, 1, count, "transfer alongside pet: transfers aren't counted as pets")
+	assert.Nil(t, deleteErr, "transfer alongside pet: delete transfer")
+	assert.Nil(t, petAfterDeleteErr, "transfer alongside pet: deleting the transfer keeps the pet")
+}
+
+func testTransferCanceledContext(t *testing.T, dao service.PetTransferDao, _ service.PetDao) {
+	// Setup
+	insertTransfers(t, dao, SampleTransfer1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	_, getErr := dao.GetByPetId(ctx, SampleTransfer1.PetId)
+	_, queryErr := dao.QueryByUser(ctx, SampleTransfer1.Sender)
+	insertErr := dao.Insert(ctx, SampleTransfer2)
+	deleteErr := dao.Delete(ctx, SampleTransfer1.PetId)
+
+	// Verify
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(getErr), "canceled context: get transfer by pet id")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryErr), "canceled context: query transfers by user")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(insertErr), "canceled context: insert transfer")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(deleteErr), "canceled context: delete transfer")
+}
+
+func insertTransfers(t *testing.T, dao service.PetTransferDao, transfers ...model.PetTransfer) {
+	ctx := context.Background()
+	for _, transfer := range transfers {
+		err := dao.Insert(ctx, transfer)
+		assert.Nil(t, err, "insert transfer "+transfer.PetId)
+	}
+}
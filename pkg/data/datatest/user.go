@@ -0,0 +1,98 @@
+package datatest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleUser1 = model.User{Username: "conformance-user-1", Email: "user1@email.com", Name: "User 1"}
+	SampleUser2 = model.User{Username: "conformance-user-2", Email: "user2@email.com", Name: "User 2"}
+	SampleUser3 = model.User{Username: "conformance-user-3", Email: "user3@email.com"}
+	SampleUsers = []model.User{SampleUser1, SampleUser2, SampleUser3}
+)
+
+// Runs the conformance tests for a user DAO; newDao must return a DAO backed by a data store holding exactly the given users
+func TestUserDao(t *testing.T, newDao func(users []model.User) service.UserDao) {
+	testUserGetByUsername(t, newDao(SampleUsers))
+	testUserGetTotalCount(t, newDao(SampleUsers))
+	testUserList(t, newDao(SampleUsers))
+	testUserCanceledContext(t, newDao(SampleUsers))
+}
+
+func testUserGetByUsername(t *testing.T, dao service.UserDao) {
+	// Setup
+	ctx := context.Background()
+
+	// Execute
+	user, err := dao.GetByUsername(ctx, SampleUser1.Username)
+	_, notFoundErr := dao.GetByUsername(ctx, "unknown")
+
+	// Verify
+	assert.Nil(t, err, "get by username: existing user")
+	assert.Equal(t, SampleUser1, user, "get by username: existing user")
+	assert.Equal(t, apperror.CodeNotFound, apperror.CodeOf(notFoundErr), "get by username: unknown user")
+}
+
+func testUserGetTotalCount(t *testing.T, dao service.UserDao) {
+	// Setup
+	ctx := context.Background()
+
+	// Execute
+	count, err := dao.GetTotalCount(ctx)
+
+	// Verify
+	assert.Nil(t, err, "get total count")
+	assert.Equal(t, len(SampleUsers), count, "get total count")
+}
+
+func testUserList(t *testing.T, dao service.UserDao) {
+	ctx := context.Background()
+
+	// Request more users than exist
+	users, token, err := dao.List(ctx, 10, "")
+	assert.Nil(t, err, "list: request more users than exist")
+	assert.ElementsMatch(t, SampleUsers, users, "list: request more users than exist")
+	assert.Equal(t, "", token, "list: request more users than exist")
+
+	// Request no users
+	users, token, err = dao.List(ctx, 0, "")
+	assert.Nil(t, err, "list: request no users")
+	assert.Empty(t, users, "list: request no users")
+	assert.Equal(t, "", token, "list: request no users")
+
+	// Page through the users
+	firstPage, token, err := dao.List(ctx, 2, "")
+	assert.Nil(t, err, "list: first page")
+	assert.Equal(t, 2, len(firstPage), "list: first page")
+	assert.NotEqual(t, "", token, "list: first page has a token")
+	secondPage, lastToken, err := dao.List(ctx, 2, token)
+	assert.Nil(t, err, "list: second page")
+	assert.Equal(t, "", lastToken, "list: second page is the last")
+	assert.ElementsMatch(t, SampleUsers, append(firstPage, secondPage...), "list: pages cover every user")
+
+	// Tokens must come from a previous list
+	_, _, err = dao.List(ctx, 1, "not a real token")
+	assert.Equal(t, apperror.CodeValidation, apperror.CodeOf(err), "list: invalid token")
+}
+
+func testUserCanceledContext(t *testing.T, dao service.UserDao) {
+	// Setup
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	_, getErr := dao.GetByUsername(ctx, SampleUser1.Username)
+	_, _, listErr := dao.List(ctx, 10, "")
+	_, countErr := dao.GetTotalCount(ctx)
+
+	// Verify
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(getErr), "canceled context: get by username")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(listErr), "canceled context: list")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(countErr), "canceled context: get total count")
+}
@@ -1,38 +1,84 @@
 package data_test
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 const (
 	SampleTableName  = "table"
 	SampleUserPoolId = "user-pool-id"
+	SampleBucketName = "bucket"
 )
 
 type FakeDynamoDbClient struct {
-	deleteItemOutput *dynamodb.DeleteItemOutput
-	deleteItemErr    error
-	getItemOutput    *dynamodb.GetItemOutput
-	getItemErr       error
-	putItemOutput    *dynamodb.PutItemOutput
-	putItemErr       error
-	queryOutput      *dynamodb.QueryOutput
-	queryErr         error
+	batchGetItemInputs  []*dynamodb.BatchGetItemInput
+	batchGetItemOutputs []*dynamodb.BatchGetItemOutput // returned in order, one per call
+	batchGetItemErr     error
+	deleteItemOutput    *dynamodb.DeleteItemOutput
+	deleteItemErr       error
+	getItemOutput       *dynamodb.GetItemOutput
+	getItemErr          error
+	putItemInput        *dynamodb.PutItemInput
+	putItemOutput       *dynamodb.PutItemOutput
+	putItemErr          error
+	queryInput          *dynamodb.QueryInput
+	queryInputs         []dynamodb.QueryInput // a copy of each input, since callers may reuse it
+	queryOutput         *dynamodb.QueryOutput
+	queryOutputs        []*dynamodb.QueryOutput // if set, returned in order (one per call, then empty) instead of queryOutput
+	queryErr            error
+	transactInput       *dynamodb.TransactWriteItemsInput
+	transactErr         error
+	updateItemInput     *dynamodb.UpdateItemInput
+	updateItemInputs    []*dynamodb.UpdateItemInput
+	updateItemOutput    *dynamodb.UpdateItemOutput
+	updateItemErr       error
 }
 
-func (f *FakeDynamoDbClient) DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+func (f *FakeDynamoDbClient) BatchGetItemWithContext(_ aws.Context, input *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	call := len(f.batchGetItemInputs)
+	f.batchGetItemInputs = append(f.batchGetItemInputs, input)
+	if f.batchGetItemErr != nil {
+		return nil, f.batchGetItemErr
+	}
+	return f.batchGetItemOutputs[call], nil
+}
+func (f *FakeDynamoDbClient) DeleteItemWithContext(aws.Context, *dynamodb.DeleteItemInput, ...request.Option) (*dynamodb.DeleteItemOutput, error) {
 	return f.deleteItemOutput, f.deleteItemErr
 }
-func (f *FakeDynamoDbClient) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (f *FakeDynamoDbClient) GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error) {
 	return f.getItemOutput, f.getItemErr
 }
-func (f *FakeDynamoDbClient) PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (f *FakeDynamoDbClient) PutItemWithContext(_ aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	f.putItemInput = input
 	return f.putItemOutput, f.putItemErr
 }
-func (f *FakeDynamoDbClient) Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+func (f *FakeDynamoDbClient) QueryWithContext(_ aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	call := len(f.queryInputs)
+	f.queryInput = input
+	f.queryInputs = append(f.queryInputs, *input)
+	if f.queryOutputs != nil {
+		if call >= len(f.queryOutputs) {
+			return &dynamodb.QueryOutput{}, f.queryErr
+		}
+		return f.queryOutputs[call], f.queryErr
+	}
 	return f.queryOutput, f.queryErr
 }
+func (f *FakeDynamoDbClient) TransactWriteItemsWithContext(_ aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.transactInput = input
+	return &dynamodb.TransactWriteItemsOutput{}, f.transactErr
+}
+func (f *FakeDynamoDbClient) UpdateItemWithContext(_ aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	f.updateItemInput = input
+	f.updateItemInputs = append(f.updateItemInputs, input)
+	return f.updateItemOutput, f.updateItemErr
+}
 
 type FakeUserPoolClient struct {
 	adminGetUserOutput     *cognito.AdminGetUserOutput
@@ -43,12 +89,47 @@ type FakeUserPoolClient struct {
 	describeUserPoolErr    error
 }
 
-func (f *FakeUserPoolClient) AdminGetUser(*cognito.AdminGetUserInput) (*cognito.AdminGetUserOutput, error) {
+func (f *FakeUserPoolClient) AdminGetUserWithContext(aws.Context, *cognito.AdminGetUserInput, ...request.Option) (*cognito.AdminGetUserOutput, error) {
 	return f.adminGetUserOutput, f.adminGetUserErr
 }
-func (f *FakeUserPoolClient) ListUsers(*cognito.ListUsersInput) (*cognito.ListUsersOutput, error) {
+func (f *FakeUserPoolClient) ListUsersWithContext(aws.Context, *cognito.ListUsersInput, ...request.Option) (*cognito.ListUsersOutput, error) {
 	return f.listUsersOutput, f.listUsersErr
 }
-func (f *FakeUserPoolClient) DescribeUserPool(*cognito.DescribeUserPoolInput) (*cognito.DescribeUserPoolOutput, error) {
+func (f *FakeUserPoolClient) DescribeUserPoolWithContext(aws.Context, *cognito.DescribeUserPoolInput, ...request.Option) (*cognito.DescribeUserPoolOutput, error) {
 	return f.describeUserPoolOutput, f.describeUserPoolErr
 }
+
+// Presigns with a real S3 client (presigning happens offline); listing returns the given pages in order
+type FakeS3Client struct {
+	*s3.S3
+	listObjectsInputs  []*s3.ListObjectsV2Input
+	listObjectsOutputs []*s3.ListObjectsV2Output
+	listObjectsErr     error
+	deleteInputs       []*s3.DeleteObjectsInput
+	deleteOutput       *s3.DeleteObjectsOutput
+	deleteErr          error
+}
+
+func NewFakeS3Client() FakeS3Client {
+	session := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("access-key-id", "secret-access-key", ""),
+	}))
+	return FakeS3Client{S3: s3.New(session)}
+}
+
+func (f *FakeS3Client) DeleteObjectsWithContext(_ aws.Context, input *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	f.deleteInputs = append(f.deleteInputs, input)
+	if f.deleteOutput == nil {
+		return &s3.DeleteObjectsOutput{}, f.deleteErr
+	}
+	return f.deleteOutput, f.deleteErr
+}
+func (f *FakeS3Client) ListObjectsV2WithContext(_ aws.Context, input *s3.ListObjectsV2Input, _ ...request.Option) (*s3.ListObjectsV2Output, error) {
+	page := len(f.listObjectsInputs)
+	f.listObjectsInputs = append(f.listObjectsInputs, input)
+	if f.listObjectsErr != nil {
+		return nil, f.listObjectsErr
+	}
+	return f.listObjectsOutputs[page], nil
+}
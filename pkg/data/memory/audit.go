@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Object containing the audit log held in memory; safe for concurrent use. Events are never removed (nothing expires
+// them like the table's TTL does), but those older than the retention period are left out of queries, as the DynamoDB
+// store only reads the days within it
+//
+// Like the AWS SDK, calls fail once their context is done
+type AuditDao struct {
+	mutex  *sync.RWMutex
+	events []model.AuditEvent // newest (greatest ID) first
+}
+
+// Creates an empty in-memory audit log data store
+func NewAuditDao() AuditDao {
+	return AuditDao{
+		mutex:  &sync.RWMutex{},
+		events: []model.AuditEvent{},
+	}
+}
+
+// Inserts an audit event; fails with a conflict if an event with the same ID already exists
+func (a *AuditDao) Insert(ctx context.Context, event model.AuditEvent) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error adding audit event", ctx.Err())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	i := sort.Search(len(a.events), func(i int) bool { return a.events[i].Id <= event.Id })
+	if i < len(a.events) && a.events[i].Id == event.Id {
+		return apperror.NewConflict("audit event already exists", nil)
+	}
+	a.events = append(a.events, model.AuditEvent{})
+	copy(a.events[i+1:], a.events[i:])
+	a.events[i] = event
+
+	return nil
+}
+
+// Query for a set of audit events matching the filter (first n events after the exclusive start ID), newest first;
+// events older than the retention period have expired and aren't included, nor are events before the longest window
+func (a *AuditDao) Query(ctx context.Context, filter model.AuditEventsFilter, count int, exclusiveStartId string) ([]model.AuditEvent, bool, error) {
+	if ctx.Err() != nil {
+		return []model.AuditEvent{}, false, apperror.NewInternal("error retrieving audit events", ctx.Err())
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	from, to := auditIdTimeBound(filter.From, ""), auditIdTimeBound(filter.To, "~")
+	oldest := auditOldestBound(filter, time.Now())
+	events := []model.AuditEvent{}
+	for _, event := range a.events {
+		if exclusiveStartId != "" && event.Id >= exclusiveStartId {
+			continue
+		}
+		if event.Id < oldest {
+			break // older events have expired or are outside the window too
+		}
+		if (from != "" && event.Id < from) || (to != "" && event.Id > to) || !matchesAuditEventsFilter(event, filter) {
+			continue
+		}
+		if len(events) == count {
+			return events, true, nil
+		}
+		events = append(events, event)
+	}
+
+	return events, false, nil
+}
+
+// Whether the event matches the filter's (optional) username, field and outcome
+func matchesAuditEventsFilter(event model.AuditEvent, filter model.AuditEventsFilter) bool {
+	return (filter.Username == "" || event.Username == filter.Username) &&
+		(filter.Field == "" || event.Field == filter.Field) &&
+		(filter.Outcome == "" || event.Outcome == filter.Outcome)
+}
+
+// Gets the lowest event ID which is listed: the start of the oldest day the DynamoDB store reads, which hasn't expired
+// and is within the longest window before the filter's end time (or now)
+func auditOldestBound(filter model.AuditEventsFilter, now time.Time) string {
+	newest := now
+	if to, err := time.Parse(time.RFC3339, filter.To); err == nil && to.Before(now) {
+		newest = to
+	}
+	oldest := now.Add(-model.AuditEventRetention).UTC().Truncate(24 * time.Hour)
+	if windowStart := newest.UTC().Truncate(24 * time.Hour).Add(-model.AuditEventsMaxWindow); windowStart.After(oldest) {
+		oldest = windowStart
+	}
+	return oldest.Format(model.AuditEventIdTimeLayout)
+}
+
+// Gets the bound on event IDs for an (optional) RFC 3339 time, as the DynamoDB store does; "" if there is no time
+func auditIdTimeBound(value string, suffix string) string {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if value == "" || err != nil {
+		return ""
+	}
+	return parsed.UTC().Format(model.AuditEventIdTimeLayout) + suffix
+}
@@ -0,0 +1,38 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/data/datatest"
+	"github.com/mcwiet/go-test/pkg/data/memory"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+)
+
+func TestPetDaoConformance(t *testing.T) {
+	datatest.TestPetDao(t, func() service.PetDao {
+		dao := memory.NewPetDao()
+		return &dao
+	})
+}
+
+func TestAuditDaoConformance(t *testing.T) {
+	datatest.TestAuditDao(t, func() (service.AuditDao, service.PetDao) {
+		dao, petDao := memory.NewAuditDao(), memory.NewPetDao()
+		return &dao, &petDao
+	})
+}
+
+func TestPetTransferDaoConformance(t *testing.T) {
+	datatest.TestPetTransferDao(t, func() (service.PetTransferDao, service.PetDao) {
+		dao, petDao := memory.NewPetTransferDao(), memory.NewPetDao()
+		return &dao, &petDao
+	})
+}
+
+func TestUserDaoConformance(t *testing.T) {
+	datatest.TestUserDao(t, func(users []model.User) service.UserDao {
+		dao := memory.NewUserDao(users...)
+		return &dao
+	})
+}
@@ -0,0 +1,391 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Object containing pets held in memory; safe for concurrent use
+//
+// Like the AWS SDK, calls fail once their context is done; like the DynamoDB DAO, the age of pets with a birth date is
+// worked out when they are read
+type PetDao struct {
+	mutex   *sync.RWMutex
+	pets    map[string]model.Pet
+	deleted map[string]model.Pet   // deleted pets, kept until purged (unlike DynamoDB, they don't expire)
+	history map[string][]model.Pet // every version of each pet, oldest first
+}
+
+// Creates an empty in-memory pet data store
+func NewPetDao() PetDao {
+	return PetDao{
+		mutex:   &sync.RWMutex{},
+		pets:    map[string]model.Pet{},
+		deleted: map[string]model.Pet{},
+		history: map[string][]model.Pet{},
+	}
+}
+
+// Moves a pet to the deleted pets, where it keeps its attributes (and the time it was deleted) so it can be restored;
+// if an expected version is given, the pet is only deleted if it has that version
+func (p *PetDao) Delete(ctx context.Context, id string, expectedVersion *int, changedBy string) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error deleting pet", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pet, exists := p.pets[id]
+	if !exists {
+		return apperror.NewNotFound("could not delete pet; pet not found", nil)
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return newVersionConflict()
+	}
+	pet = withChange(pet, changedBy)
+	pet.DeletedAt = pet.ChangedAt
+	delete(p.pets, id)
+	p.deleted[id] = pet
+	p.addToHistory(pet)
+
+	return nil
+}
+
+// Moves a deleted pet back to the pets and returns it; if an expected version is given, the pet is only restored if it
+// has that version
+func (p *PetDao) Restore(ctx context.Context, id string, expectedVersion *int, changedBy string) (model.Pet, error) {
+	if ctx.Err() != nil {
+		return model.Pet{}, apperror.NewInternal("error restoring pet", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pet, exists := p.deleted[id]
+	if !exists {
+		return model.Pet{}, apperror.NewNotFound("could not restore pet; deleted pet not found", nil)
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return model.Pet{}, newVersionConflict()
+	}
+	pet = withChange(pet, changedBy)
+	pet.DeletedAt = ""
+	delete(p.deleted, id)
+	p.pets[id] = pet
+	p.addToHistory(pet)
+
+	return withOwnerSet(pet).WithAgeOn(time.Now()), nil
+}
+
+// Deletes a pet and its history for good, whether or not it has been deleted (and could still be restored); if an
+// expected version is given, the pet is only purged if it has that version
+func (p *PetDao) Purge(ctx context.Context, id string, expectedVersion *int) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error purging pet", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pets := p.pets
+	pet, exists := pets[id]
+	if !exists {
+		pets = p.deleted
+		pet, exists = pets[id]
+	}
+	if !exists {
+		return apperror.NewNotFound("could not purge pet; pet not found", nil)
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return newVersionConflict()
+	}
+	delete(pets, id)
+	delete(p.history, id)
+
+	return nil
+}
+
+// Gets a pet from the data store using the ID (deleted pets aren't found)
+func (p *PetDao) GetById(ctx context.Context, id string) (model.Pet, error) {
+	return p.get(ctx, p.pets, id, "pet not found")
+}
+
+// Gets a deleted pet from the data store using the ID
+func (p *PetDao) GetDeletedById(ctx context.Context, id string) (model.Pet, error) {
+	return p.get(ctx, p.deleted, id, "deleted pet not found")
+}
+
+// Gets the pet with the ID from the pets or the deleted pets
+func (p *PetDao) get(ctx context.Context, pets map[string]model.Pet, id string, notFoundMessage string) (model.Pet, error) {
+	if ctx.Err() != nil {
+		return model.Pet{}, apperror.NewInternal("error retrieving pet", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	pet, exists := pets[id]
+	if !exists {
+		return model.Pet{}, apperror.NewNotFound(notFoundMessage, nil)
+	}
+
+	return withOwnerSet(pet).WithAgeOn(time.Now()), nil
+}
+
+// Gets the pet as it was at the given time, i.e. the latest version in its history changed at or before then; pets
+// which didn't exist (or were deleted) at the time aren't found
+func (p *PetDao) GetAsOf(ctx context.Context, id string, asOf time.Time) (model.Pet, error) {
+	if ctx.Err() != nil {
+		return model.Pet{}, apperror.NewInternal("error retrieving pet history", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	// Compared as strings, like the DynamoDB DAO (change times are all RFC 3339 in UTC)
+	at := asOf.UTC().Format(time.RFC3339)
+	versions := p.history[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].ChangedAt <= at {
+			if versions[i].DeletedAt != "" {
+				break
+			}
+			return withOwnerSet(versions[i]).WithAgeOn(time.Now()), nil
+		}
+	}
+
+	return model.Pet{}, apperror.NewNotFound("pet not found", nil)
+}
+
+// Query for a set of a pet's past and current versions, newest first (first n versions older than the exclusive start
+// version, or the newest versions if it is 0)
+//
+// Like a DynamoDB query with a limit, there is said to be a next page whenever the limit is reached
+func (p *PetDao) QueryHistory(ctx context.Context, id string, count int, exclusiveStartVersion int) ([]model.Pet, bool, error) {
+	if ctx.Err() != nil {
+		return []model.Pet{}, false, apperror.NewInternal("error retrieving pet history", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	now := time.Now()
+	remaining := []model.Pet{}
+	versions := p.history[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if exclusiveStartVersion == 0 || versions[i].Version < exclusiveStartVersion {
+			remaining = append(remaining, withOwnerSet(versions[i]).WithAgeOn(now))
+		}
+	}
+
+	return page(remaining, count)
+}
+
+// Get the number of versions in a pet's history
+func (p *PetDao) GetHistoryCount(ctx context.Context, id string) (int, error) {
+	if ctx.Err() != nil {
+		return 0, apperror.NewInternal("error getting pet history count", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return len(p.history[id]), nil
+}
+
+// Inserts a pet (as given, including who changed it and when) to the data store, along with the first snapshot of its
+// history (replacing any pet with the same ID, like a DynamoDB put)
+func (p *PetDao) Insert(ctx context.Context, pet model.Pet) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error adding pet", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pets[pet.Id] = withOwnerSet(pet)
+	p.addToHistory(pet)
+
+	return nil
+}
+
+// Query for a set of pets (first n pets after the exclusive start value); pets are ordered by ID and deleted pets
+// aren't included
+//
+// Like a DynamoDB query with a limit, there is said to be a next page whenever the limit is reached
+func (p *PetDao) Query(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	return p.query(ctx, p.pets, count, exclusiveStartId, "error retrieving pets")
+}
+
+// Query for a set of the pets a user owns (first n pets after the exclusive start value); pets are ordered by ID and
+// deleted pets aren't included, nor are private pets unless they're included
+func (p *PetDao) QueryByOwner(ctx context.Context, owner string, includePrivate bool, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	if ctx.Err() != nil {
+		return []model.Pet{}, false, apperror.NewInternal("error retrieving pets", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	now := time.Now()
+	remaining := []model.Pet{}
+	for _, id := range sortedIds(p.pets) {
+		if id > exclusiveStartId && p.pets[id].HasOwner(owner) && (includePrivate || !p.pets[id].Private) {
+			remaining = append(remaining, withOwnerSet(p.pets[id]).WithAgeOn(now))
+		}
+	}
+
+	return page(remaining, count)
+}
+
+// Get the total count of the pets a user owns (deleted pets aren't counted, nor are private pets unless they're
+// included)
+func (p *PetDao) GetTotalCountByOwner(ctx context.Context, owner string, includePrivate bool) (int, error) {
+	if ctx.Err() != nil {
+		return 0, apperror.NewInternal("error getting total pets count", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	count := 0
+	for _, pet := range p.pets {
+		if pet.HasOwner(owner) && (includePrivate || !pet.Private) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Query for a set of deleted pets (first n deleted pets after the exclusive start value); pets are ordered by ID
+func (p *PetDao) QueryDeleted(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	return p.query(ctx, p.deleted, count, exclusiveStartId, "error retrieving deleted pets")
+}
+
+// Query for a set of the pets or the deleted pets
+func (p *PetDao) query(ctx context.Context, pets map[string]model.Pet, count int, exclusiveStartId string, errMessage string) ([]model.Pet, bool, error) {
+	if ctx.Err() != nil {
+		return []model.Pet{}, false, apperror.NewInternal(errMessage, ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	now := time.Now()
+	remaining := []model.Pet{}
+	for _, id := range sortedIds(pets) {
+		if id > exclusiveStartId {
+			remaining = append(remaining, withOwnerSet(pets[id]).WithAgeOn(now))
+		}
+	}
+
+	return page(remaining, count)
+}
+
+// Get the total count of pets (deleted pets aren't counted)
+func (p *PetDao) GetTotalCount(ctx context.Context) (int, error) {
+	return p.count(ctx, p.pets, "error getting total pets count")
+}
+
+// Get the total count of deleted pets
+func (p *PetDao) GetDeletedTotalCount(ctx context.Context) (int, error) {
+	return p.count(ctx, p.deleted, "error getting total deleted pets count")
+}
+
+// Get the total count of the pets or the deleted pets
+func (p *PetDao) count(ctx context.Context, pets map[string]model.Pet, errMessage string) (int, error) {
+	if ctx.Err() != nil {
+		return 0, apperror.NewInternal(errMessage, ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return len(pets), nil
+}
+
+// Changes only the fields set in the patch, adds the new version to the pet's history and returns the updated pet; the
+// stored pet must still have the expected version, which is then incremented (an empty patch changes nothing, not even
+// the version)
+func (p *PetDao) Patch(ctx context.Context, id string, expectedVersion int, patch model.PetPatch, changedBy string) (model.Pet, error) {
+	if ctx.Err() != nil {
+		return model.Pet{}, apperror.NewInternal("error updating pet", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pet, exists := p.pets[id]
+	if !exists {
+		if patch.IsEmpty() {
+			return model.Pet{}, apperror.NewNotFound("pet not found", nil)
+		}
+		return model.Pet{}, apperror.NewNotFound("could not update pet; pet not found", nil)
+	}
+	if pet.Version != expectedVersion {
+		return model.Pet{}, newVersionConflict()
+	}
+	if patch.IsEmpty() {
+		return withOwnerSet(pet).WithAgeOn(time.Now()), nil
+	}
+	pet = withChange(pet.WithPatch(patch), changedBy)
+	p.pets[id] = withOwnerSet(pet)
+	p.addToHistory(pet)
+
+	return withOwnerSet(pet).WithAgeOn(time.Now()), nil
+}
+
+// Adds a version of a pet to its history (caller must hold the lock)
+func (p *PetDao) addToHistory(pet model.Pet) {
+	p.history[pet.Id] = append(p.history[pet.Id], withOwnerSet(pet))
+}
+
+// Gets the next version of a pet, changed by the user now
+func withChange(pet model.Pet, changedBy string) model.Pet {
+	pet.Version++
+	pet.ChangedBy = changedBy
+	pet.ChangedAt = time.Now().UTC().Format(time.RFC3339)
+	return pet
+}
+
+// Gets the first count pets and whether there are more (like a DynamoDB query with a limit, there is said to be a next
+// page whenever the limit is reached)
+func page(pets []model.Pet, count int) ([]model.Pet, bool, error) {
+	if count == 0 {
+		return []model.Pet{}, len(pets) > 0, nil
+	}
+
+	if len(pets) < count {
+		return pets, false, nil
+	}
+
+	return pets[:count], true, nil
+}
+
+// Gets the pet with its owners as a set (like the DynamoDB string set) in a slice of its own, so pets handed out and
+// pets held never share owners
+func withOwnerSet(pet model.Pet) model.Pet {
+	pet.Owners = model.NewOwners(pet.Owners...)
+	return pet
+}
+
+// IDs of all pets in ascending order (caller must hold the lock)
+func sortedIds(pets map[string]model.Pet) []string {
+	ids := []string{}
+	for id := range pets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Creates the error returned when a pet has been changed since the caller read it (matches the DynamoDB DAO)
+func newVersionConflict() error {
+	return apperror.NewConflict("pet has been changed by another request; get the latest version and try again", nil)
+}
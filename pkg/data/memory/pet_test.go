@@ -0,0 +1,52 @@
+package memory_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/data/memory"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPetConcurrentAccess(t *testing.T) {
+	// Setup
+	dao := memory.NewPetDao()
+	var wg sync.WaitGroup
+
+	// Execute
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pet := model.Pet{Id: strconv.Itoa(i), Name: "pet", Age: i}
+			dao.Insert(context.Background(), pet)
+			dao.GetById(context.Background(), pet.Id)
+			dao.Query(context.Background(), 10, "")
+		}(i)
+	}
+	wg.Wait()
+
+	// Verify
+	count, err := dao.GetTotalCount(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 50, count)
+}
+
+func TestPetQueryOrder(t *testing.T) {
+	// Setup
+	dao := memory.NewPetDao()
+	dao.Insert(context.Background(), model.Pet{Id: "b"})
+	dao.Insert(context.Background(), model.Pet{Id: "c"})
+	dao.Insert(context.Background(), model.Pet{Id: "a"})
+
+	// Execute
+	pets, hasNextPage, err := dao.Query(context.Background(), 2, "a")
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Pet{{Id: "b", Owners: []string{}}, {Id: "c", Owners: []string{}}}, pets)
+	assert.True(t, hasNextPage, "limit reached")
+}
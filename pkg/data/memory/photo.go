@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+)
+
+// Object containing photos held in memory; safe for concurrent use
+//
+// Photo URLs point at baseUrl (e.g. a handler calling Get and Put) and aren't signed, so they never expire
+type PhotoDao struct {
+	baseUrl string
+	mutex   *sync.RWMutex
+	photos  map[string][]byte
+}
+
+// Creates an empty in-memory photo data store whose photo URLs start with the base URL
+func NewPhotoDao(baseUrl string) PhotoDao {
+	return PhotoDao{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		mutex:   &sync.RWMutex{},
+		photos:  map[string][]byte{},
+	}
+}
+
+// Gets the content of a photo; returns false if no photo has the key
+func (p *PhotoDao) Get(key string) ([]byte, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	content, exists := p.photos[key]
+	return content, exists
+}
+
+// Stores the content of a photo (replacing any photo with the same key)
+func (p *PhotoDao) Put(key string, content []byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.photos[key] = content
+}
+
+// Lists the keys of every photo stored under a prefix, in key order
+func (p *PhotoDao) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, apperror.NewInternal("error listing photos", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	keys := []string{}
+	for key := range p.photos {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Deletes every photo stored under a prefix
+func (p *PhotoDao) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error deleting photos", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key := range p.photos {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.photos, key)
+		}
+	}
+	return nil
+}
+
+// Creates a URL which the photo can be downloaded from
+func (p *PhotoDao) PresignDownload(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return p.url(ctx, key)
+}
+
+// Creates a URL which the photo can be uploaded to (with an HTTP PUT); the handler serving the base URL is trusted to
+// check the content type and length
+func (p *PhotoDao) PresignUpload(ctx context.Context, key string, contentType string, contentLength int64, expiry time.Duration) (string, error) {
+	return p.url(ctx, key)
+}
+
+func (p *PhotoDao) url(ctx context.Context, key string) (string, error) {
+	if ctx.Err() != nil {
+		return "", apperror.NewInternal("error creating photo URL", ctx.Err())
+	}
+	return p.baseUrl + "/" + (&url.URL{Path: key}).EscapedPath(), nil
+}
@@ -0,0 +1,68 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/data/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotoListKeys(t *testing.T) {
+	// Setup
+	dao := memory.NewPhotoDao("http://localhost/photos")
+	dao.Put("pets/2/photos/b", []byte("b"))
+	dao.Put("pets/1/photos/b", []byte("b"))
+	dao.Put("pets/1/photos/a", []byte("a"))
+
+	// Execute
+	keys, err := dao.ListKeys(context.Background(), "pets/1/")
+	none, noneErr := dao.ListKeys(context.Background(), "pets/3/")
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pets/1/photos/a", "pets/1/photos/b"}, keys)
+	assert.Nil(t, noneErr)
+	assert.Equal(t, []string{}, none)
+}
+
+func TestPhotoDeleteByPrefix(t *testing.T) {
+	// Setup
+	dao := memory.NewPhotoDao("http://localhost/photos")
+	dao.Put("pets/1/photos/a", []byte("a"))
+	dao.Put("pets/1/photos/b", []byte("b"))
+	dao.Put("pets/10/photos/a", []byte("a"))
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	err := dao.DeleteByPrefix(context.Background(), "pets/1/")
+	canceledErr := dao.DeleteByPrefix(canceled, "pets/10/")
+	keys, _ := dao.ListKeys(context.Background(), "pets/")
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(canceledErr))
+	assert.Equal(t, []string{"pets/10/photos/a"}, keys)
+}
+
+func TestPhotoPresign(t *testing.T) {
+	// Setup
+	dao := memory.NewPhotoDao("http://localhost/photos/")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Execute
+	downloadUrl, downloadErr := dao.PresignDownload(context.Background(), "pets/1/photos/a b", time.Hour)
+	uploadUrl, uploadErr := dao.PresignUpload(context.Background(), "pets/1/photos/a b", "image/png", 10, time.Hour)
+	_, canceledErr := dao.PresignUpload(canceled, "pets/1/photos/a", "image/png", 10, time.Hour)
+
+	// Verify
+	assert.Nil(t, downloadErr)
+	assert.Nil(t, uploadErr)
+	assert.Equal(t, "http://localhost/photos/pets/1/photos/a%20b", downloadUrl)
+	assert.Equal(t, "http://localhost/photos/pets/1/photos/a%20b", uploadUrl)
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(canceledErr))
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Object containing pending pet transfers held in memory; safe for concurrent use
+//
+// Like the AWS SDK, calls fail once their context is done
+type PetTransferDao struct {
+	mutex     *sync.RWMutex
+	transfers map[string]model.PetTransfer // by pet ID
+}
+
+// Creates an empty in-memory pet transfer data store
+func NewPetTransferDao() PetTransferDao {
+	return PetTransferDao{
+		mutex:     &sync.RWMutex{},
+		transfers: map[string]model.PetTransfer{},
+	}
+}
+
+// Deletes the pending transfer of a pet
+func (p *PetTransferDao) Delete(ctx context.Context, petId string) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error deleting pet transfer", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, exists := p.transfers[petId]; !exists {
+		return apperror.NewNotFound("could not delete pet transfer; pet transfer not found", nil)
+	}
+	delete(p.transfers, petId)
+
+	return nil
+}
+
+// Gets the pending transfer of a pet
+func (p *PetTransferDao) GetByPetId(ctx context.Context, petId string) (model.PetTransfer, error) {
+	if ctx.Err() != nil {
+		return model.PetTransfer{}, apperror.NewInternal("error retrieving pet transfer", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	transfer, exists := p.transfers[petId]
+	if !exists {
+		return model.PetTransfer{}, apperror.NewNotFound("pet transfer not found", nil)
+	}
+
+	return transfer, nil
+}
+
+// Inserts the pending transfer of a pet; fails with a conflict if the pet already has one
+func (p *PetTransferDao) Insert(ctx context.Context, transfer model.PetTransfer) error {
+	if ctx.Err() != nil {
+		return apperror.NewInternal("error adding pet transfer", ctx.Err())
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, exists := p.transfers[transfer.PetId]; exists {
+		return apperror.NewConflict("pet already has a pending transfer", nil)
+	}
+	p.transfers[transfer.PetId] = transfer
+
+	return nil
+}
+
+// Gets every pending transfer a user sent or received
+func (p *PetTransferDao) QueryByUser(ctx context.Context, username string) ([]model.PetTransfer, error) {
+	if ctx.Err() != nil {
+		return []model.PetTransfer{}, apperror.NewInternal("error retrieving pet transfers", ctx.Err())
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	transfers := []model.PetTransfer{}
+	for _, transfer := range p.transfers {
+		if transfer.Sender == username || transfer.Recipient == username {
+			transfers = append(transfers, transfer)
+		}
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Object containing users held in memory; safe for concurrent use
+//
+// Like the AWS SDK, calls fail once their context is done
+type UserDao struct {
+	mutex *sync.RWMutex
+	users map[string]model.User
+}
+
+// Creates an in-memory user data store seeded with the given users
+func NewUserDao(users ...model.User) UserDao {
+	dao := UserDao{
+		mutex: &sync.RWMutex{},
+		users: map[string]model.User{},
+	}
+	for _, user := range users {
+		dao.users[user.Username] = user
+	}
+	return dao
+}
+
+// Adds a user to the data store (replacing any user with the same username)
+func (u *UserDao) Put(user model.User) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.users[user.Username] = user
+}
+
+// Get a user given a username
+func (u *UserDao) GetByUsername(ctx context.Context, username string) (model.User, error) {
+	if ctx.Err() != nil {
+		return model.User{}, apperror.NewInternal("error retrieving user", ctx.Err())
+	}
+
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	user, exists := u.users[username]
+	if !exists {
+		return model.User{}, apperror.NewNotFound("user not found", nil)
+	}
+
+	return user, nil
+}
+
+// List users; returns users along with a token to continue listing (if more users exist)
+//
+// Like Cognito, the token is opaque to callers; here it is the username the next page starts at
+func (u *UserDao) List(ctx context.Context, first int, after string) ([]model.User, string, error) {
+	if ctx.Err() != nil {
+		return []model.User{}, "", apperror.NewInternal("error retrieving users", ctx.Err())
+	}
+
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	usernames := u.sortedUsernames()
+	start := 0
+	if after != "" {
+		start = sort.SearchStrings(usernames, after)
+		if start == len(usernames) || usernames[start] != after {
+			return []model.User{}, "", apperror.NewValidation("invalid pagination token", nil).With("field", "after")
+		}
+	}
+
+	// Cognito is never called when no users are requested, so the token is passed back untouched
+	if first <= 0 {
+		return []model.User{}, after, nil
+	}
+
+	users := []model.User{}
+	end := start
+	for end < len(usernames) && len(users) < first {
+		users = append(users, u.users[usernames[end]])
+		end++
+	}
+
+	token := ""
+	if end < len(usernames) {
+		token = usernames[end]
+	}
+
+	return users, token, nil
+}
+
+// Get the (estimated) total count of users in the data store
+func (u *UserDao) GetTotalCount(ctx context.Context) (int, error) {
+	if ctx.Err() != nil {
+		return 0, apperror.NewInternal("error getting total number of users", ctx.Err())
+	}
+
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	return len(u.users), nil
+}
+
+// Usernames of all users in ascending order (caller must hold the lock)
+func (u *UserDao) sortedUsernames() []string {
+	usernames := []string{}
+	for username := range u.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
@@ -0,0 +1,37 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/data/memory"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserPut(t *testing.T) {
+	// Setup
+	dao := memory.NewUserDao()
+	user := model.User{Username: "user", Email: "user@email.com"}
+
+	// Execute
+	dao.Put(user)
+	found, err := dao.GetByUsername(context.Background(), user.Username)
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, user, found)
+}
+
+func TestUserListOrder(t *testing.T) {
+	// Setup
+	dao := memory.NewUserDao(model.User{Username: "c"}, model.User{Username: "a"}, model.User{Username: "b"})
+
+	// Execute
+	users, token, err := dao.List(context.Background(), 2, "")
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, []model.User{{Username: "a"}, {Username: "b"}}, users)
+	assert.Equal(t, "c", token)
+}
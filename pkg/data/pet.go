@@ -1,22 +1,33 @@
 package data
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
 	"github.com/mcwiet/go-test/pkg/model"
 )
 
 type DynamoItem = map[string]*dynamodb.AttributeValue
 
 type DynamoDbClient interface {
-	DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
-	GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
-	PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
-	Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	BatchGetItemWithContext(aws.Context, *dynamodb.BatchGetItemInput, ...request.Option) (*dynamodb.BatchGetItemOutput, error)
+	DeleteItemWithContext(aws.Context, *dynamodb.DeleteItemInput, ...request.Option) (*dynamodb.DeleteItemOutput, error)
+	GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error)
+	PutItemWithContext(aws.Context, *dynamodb.PutItemInput, ...request.Option) (*dynamodb.PutItemOutput, error)
+	QueryWithContext(aws.Context, *dynamodb.QueryInput, ...request.Option) (*dynamodb.QueryOutput, error)
+	TransactWriteItemsWithContext(aws.Context, *dynamodb.TransactWriteItemsInput, ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+	UpdateItemWithContext(aws.Context, *dynamodb.UpdateItemInput, ...request.Option) (*dynamodb.UpdateItemOutput, error)
 }
 
 // Object containing information needed to access the pet data store
@@ -26,7 +37,26 @@ type PetDao struct {
 }
 
 const (
-	petSortLabel = "pet"
+	petSortLabel         = "pet"
+	petTransferSortLabel = "petTransfer" // pending transfer of the pet with the same ID
+	deletedPetSortLabel  = "deletedPet"  // pet which has been deleted but can still be restored
+	// Snapshots of each version of a pet are stored next to it, with the version zero-padded so they sort in order
+	petSnapshotSortPrefix = "pet#v"
+	petSnapshotSortFormat = petSnapshotSortPrefix + "%010d"
+	// Each owner of a pet has an item next to it holding their username in Owner, which ownerIndex is keyed on (a set
+	// can't be an index key); pets stored before pets had several owners are indexed through their own Owner attribute
+	petOwnerSortPrefix = "petOwner#"
+	ownerIndex         = "owner-gsi"
+	// A pending transfer has a copy under its sender and one under its recipient (e.g. 'petTransfer#sender#user-1'), so
+	// the transfers a user sent or received can be read from the sort key index without reading every transfer
+	petTransferSenderSortPrefix    = "petTransfer#sender#"
+	petTransferRecipientSortPrefix = "petTransfer#recipient#"
+	// Most keys a batch get can read at once
+	maxBatchGetKeys = 100
+	// How long deleted pets can be restored for before the table's TTL purges them (it can take DynamoDB a while longer)
+	petRetention = 30 * 24 * time.Hour
+	// Attributes read for a pet (see petProjectionNames for the attribute names behind the placeholders)
+	petProjection = "Id, #name, #species, #breed, #birthDate, Age, #owners, #owner, #private, #version, #deletedAt, #changedBy, #changedAt, ExpiresAt"
 )
 
 // Creates a pet data store access object
@@ -37,50 +67,271 @@ func NewPetDao(client DynamoDbClient, tableName string) PetDao {
 	}
 }
 
-// Deletes a pet from the data store
-func (p *PetDao) Delete(id string) error {
-	_, err := p.client.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: &p.tableName,
-		Key: DynamoItem{
-			"Id":   {S: jsii.String(id)},
-			"Sort": {S: jsii.String(petSortLabel)},
-		},
-		ConditionExpression: jsii.String("attribute_exists(Id)"),
-	})
+// Moves a pet to the deleted pets, where it keeps its attributes (and the time it was deleted) so it can be restored
+// until the table's TTL purges it along with the pet's history; if an expected version is given, the pet is only
+// deleted if it has that version
+//
+// The history is set to expire once the pet has moved; snapshots left without an expiry by a failure in between are
+// logged, and removed when the pet is purged
+func (p *PetDao) Delete(ctx context.Context, id string, expectedVersion *int, changedBy string) error {
+	pet, err := p.GetById(ctx, id)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return apperror.NewNotFound("could not delete pet; pet not found", err)
+	} else if err != nil {
+		return err
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return newVersionConflict()
+	}
+
+	names, values := map[string]*string{}, DynamoItem{}
+	condition := "attribute_exists(Id) AND " + versionCondition(pet.Version, names, values)
+	deletedAt := time.Now().UTC()
+	expiresAt := deletedAt.Add(petRetention)
+	deleted := withChange(pet, changedBy, deletedAt)
+	deleted.DeletedAt = deleted.ChangedAt
+	snapshot := p.putSnapshot(deleted)
+	snapshot.Put.Item["ExpiresAt"] = expiresAtValue(expiresAt)
+
+	err = p.transact(ctx, id, append([]*dynamodb.TransactWriteItem{
+		{Delete: &dynamodb.Delete{
+			TableName:                 &p.tableName,
+			Key:                       petKey(id, petSortLabel),
+			ConditionExpression:       &condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: valuesOrNil(values),
+		}},
+		{Put: &dynamodb.Put{
+			TableName: &p.tableName,
+			Item:      convertDeletedPetToItem(deleted, expiresAt),
+		}},
+		snapshot,
+	}, p.changeOwnerships(id, pet.Owners, nil)...))
 
 	if err != nil {
-		log.Println(err)
-		var notFoundError *dynamodb.ConditionalCheckFailedException
-		if errors.As(err, &notFoundError) {
-			return errors.New("could not delete pet; pet not found")
-		} else {
-			return errors.New("error deleting pet")
+		if isConditionFailure(err) {
+			return p.explainConditionFailure(ctx, id, petSortLabel, "could not delete pet; pet not found", err)
 		}
+		return apperror.NewInternal("error deleting pet", err)
+	}
+
+	if err := p.setHistoryExpiry(ctx, id, &expiresAt); err != nil {
+		logging.FromContext(ctx).Error("could not set deleted pet history to expire", err, logging.Fields{"petId": id})
 	}
 
 	return nil
 }
 
-// Gets a pet from the data store using the ID
-func (p *PetDao) GetById(id string) (model.Pet, error) {
-	ret, err := p.client.GetItem(&dynamodb.GetItemInput{
-		TableName: &p.tableName,
-		Key: DynamoItem{
-			"Id":   {S: jsii.String(id)},
-			"Sort": {S: jsii.String(petSortLabel)},
-		},
-		ProjectionExpression: jsii.String("Id, #name, Age, #owner"),
-		ExpressionAttributeNames: map[string]*string{
-			"#name":  jsii.String("Name"),
-			"#owner": jsii.String("Owner"),
+// Moves a deleted pet back to the pets and returns it; if an expected version is given, the pet is only restored if it
+// has that version
+//
+// The pet's history stops expiring before the pet moves back, so a restored pet never loses its history; a restore
+// which fails after that leaves the history of the still deleted pet without an expiry until it is purged
+func (p *PetDao) Restore(ctx context.Context, id string, expectedVersion *int, changedBy string) (model.Pet, error) {
+	pet, err := p.GetDeletedById(ctx, id)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.Pet{}, apperror.NewNotFound("could not restore pet; deleted pet not found", err)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return model.Pet{}, newVersionConflict()
+	}
+	if err := p.setHistoryExpiry(ctx, id, nil); err != nil {
+		return model.Pet{}, err
+	}
+
+	// The deleted pet may have expired since it was read
+	names, values := map[string]*string{}, DynamoItem{}
+	condition := "attribute_exists(Id) AND " + unexpiredCondition(time.Now(), values) + " AND " + versionCondition(pet.Version, names, values)
+	restored := withChange(pet, changedBy, time.Now().UTC())
+	restored.DeletedAt = ""
+
+	err = p.transact(ctx, id, append([]*dynamodb.TransactWriteItem{
+		{Delete: &dynamodb.Delete{
+			TableName:                 &p.tableName,
+			Key:                       petKey(id, deletedPetSortLabel),
+			ConditionExpression:       &condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: valuesOrNil(values),
+		}},
+		{Put: &dynamodb.Put{
+			TableName:           &p.tableName,
+			Item:                convertPetToItem(restored),
+			ConditionExpression: jsii.String("attribute_not_exists(Id)"),
+		}},
+		p.putSnapshot(restored),
+	}, p.changeOwnerships(id, nil, restored.Owners)...))
+
+	if err != nil {
+		if isConditionFailure(err) {
+			return model.Pet{}, p.explainConditionFailure(ctx, id, deletedPetSortLabel, "could not restore pet; deleted pet not found", err)
+		}
+		return model.Pet{}, apperror.NewInternal("error restoring pet", err)
+	}
+
+	return restored.WithAgeOn(time.Now()), nil
+}
+
+// Deletes a pet and its history for good, whether or not it has been deleted (and could still be restored); if an
+// expected version is given, the pet is only purged if it has that version
+//
+// The pet goes first and its history after it; history left behind by a purge which fails part way is removed by the
+// next purge of the pet (which reports the pet as not found)
+func (p *PetDao) Purge(ctx context.Context, id string, expectedVersion *int) error {
+	sortLabel := petSortLabel
+	pet, err := p.GetById(ctx, id)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		sortLabel = deletedPetSortLabel
+		pet, err = p.GetDeletedById(ctx, id)
+	}
+	if apperror.Is(err, apperror.CodeNotFound) {
+		if err := p.purgeRelated(ctx, id); err != nil {
+			return err
+		}
+		return apperror.NewNotFound("could not purge pet; pet not found", err)
+	} else if err != nil {
+		return err
+	}
+	if expectedVersion != nil && pet.Version != *expectedVersion {
+		return newVersionConflict()
+	}
+
+	names, values := map[string]*string{}, DynamoItem{}
+	condition := "attribute_exists(Id) AND " + versionCondition(pet.Version, names, values)
+
+	err = p.deleteItem(ctx, id, &dynamodb.DeleteItemInput{
+		TableName:                 &p.tableName,
+		Key:                       petKey(id, sortLabel),
+		ConditionExpression:       &condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: valuesOrNil(values),
+	})
+
+	if err != nil {
+		if isConditionFailure(err) {
+			return p.explainConditionFailure(ctx, id, sortLabel, "could not purge pet; pet not found", err)
+		}
+		return apperror.NewInternal("error purging pet", err)
+	}
+
+	return p.purgeRelated(ctx, id)
+}
+
+// Deletes every snapshot of a pet and the items listing it under its owners
+func (p *PetDao) purgeRelated(ctx context.Context, id string) error {
+	if err := p.purgeItems(ctx, id, petSnapshotSortPrefix, "error purging pet history"); err != nil {
+		return err
+	}
+	return p.purgeItems(ctx, id, petOwnerSortPrefix, "error purging pet owners")
+}
+
+// Deletes every item of a pet whose sort key starts with the prefix
+func (p *PetDao) purgeItems(ctx context.Context, id string, sortPrefix string, errMessage string) error {
+	return p.forEachItem(ctx, id, sortPrefix, errMessage, func(key DynamoItem) error {
+		return p.deleteItem(ctx, id, &dynamodb.DeleteItemInput{TableName: &p.tableName, Key: key})
+	})
+}
+
+// Sets every snapshot of a pet to expire at the time (so the table's TTL removes them along with the deleted pet) or,
+// given no time, to never expire
+func (p *PetDao) setHistoryExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	return p.forEachItem(ctx, id, petSnapshotSortPrefix, "error changing pet history expiry", func(key DynamoItem) error {
+		input := dynamodb.UpdateItemInput{
+			TableName:           &p.tableName,
+			Key:                 key,
+			UpdateExpression:    jsii.String("REMOVE ExpiresAt"),
+			ConditionExpression: jsii.String("attribute_exists(Id)"), // snapshots purged in the meantime stay gone
+		}
+		if expiresAt != nil {
+			input.UpdateExpression = jsii.String("SET ExpiresAt = :expiresAt")
+			input.ExpressionAttributeValues = DynamoItem{":expiresAt": expiresAtValue(*expiresAt)}
+		}
+
+		start := time.Now()
+		_, err := p.client.UpdateItemWithContext(ctx, &input)
+		metrics.FromContext(ctx).RecordCall("DynamoDB.UpdateItem", start, err)
+
+		if err != nil && !isConditionFailure(err) {
+			logging.FromContext(ctx).Error("dynamodb update item failed", err, logging.Fields{"petId": id})
+			return err
+		}
+		return nil
+	})
+}
+
+// Calls the function with the key of every item of a pet whose sort key starts with the prefix, stopping at the first
+// error
+func (p *PetDao) forEachItem(ctx context.Context, id string, sortPrefix string, errMessage string, fn func(key DynamoItem) error) error {
+	input := dynamodb.QueryInput{
+		TableName:              &p.tableName,
+		KeyConditionExpression: jsii.String("Id = :id AND begins_with(Sort, :prefix)"),
+		ExpressionAttributeValues: DynamoItem{
+			":id":     {S: jsii.String(id)},
+			":prefix": {S: jsii.String(sortPrefix)},
 		},
+		ProjectionExpression: jsii.String("Id, Sort"),
+	}
+	for {
+		start := time.Now()
+		ret, err := p.client.QueryWithContext(ctx, &input)
+		metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+		if err != nil {
+			logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"petId": id})
+			return apperror.NewInternal(errMessage, err)
+		}
+
+		for _, key := range ret.Items {
+			if err := fn(key); err != nil {
+				return apperror.NewInternal(errMessage, err)
+			}
+		}
+
+		if len(ret.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = ret.LastEvaluatedKey
+	}
+}
+
+// Deletes an item belonging to the pet with the ID
+func (p *PetDao) deleteItem(ctx context.Context, id string, input *dynamodb.DeleteItemInput) error {
+	start := time.Now()
+	_, err := p.client.DeleteItemWithContext(ctx, input)
+	metrics.FromContext(ctx).RecordCall("DynamoDB.DeleteItem", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb delete item failed", err, logging.Fields{"petId": id})
+	}
+	return err
+}
+
+// Gets a pet from the data store using the ID (deleted pets aren't found)
+func (p *PetDao) GetById(ctx context.Context, id string) (model.Pet, error) {
+	return p.get(ctx, id, petSortLabel, "pet not found")
+}
+
+// Gets a deleted pet from the data store using the ID
+func (p *PetDao) GetDeletedById(ctx context.Context, id string) (model.Pet, error) {
+	return p.get(ctx, id, deletedPetSortLabel, "deleted pet not found")
+}
+
+// Gets the pet stored with the ID and sort label
+func (p *PetDao) get(ctx context.Context, id string, sortLabel string, notFoundMessage string) (model.Pet, error) {
+	start := time.Now()
+	ret, err := p.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:                &p.tableName,
+		Key:                      petKey(id, sortLabel),
+		ProjectionExpression:     jsii.String(petProjection),
+		ExpressionAttributeNames: petProjectionNames(),
 	})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.GetItem", start, err)
 
 	if err != nil {
-		log.Println(err)
-		return model.Pet{}, errors.New("error retrieving pet")
-	} else if ret == nil || ret.Item == nil {
-		return model.Pet{}, errors.New("pet not found")
+		logging.FromContext(ctx).Error("dynamodb get item failed", err, logging.Fields{"petId": id})
+		return model.Pet{}, apperror.NewInternal("error retrieving pet", err)
+	} else if ret == nil || ret.Item == nil || isExpired(ret.Item, time.Now()) {
+		return model.Pet{}, apperror.NewNotFound(notFoundMessage, nil)
 	}
 
 	pet := convertItemToPet(ret.Item)
@@ -88,65 +339,249 @@ func (p *PetDao) GetById(id string) (model.Pet, error) {
 	return pet, err
 }
 
-// Inserts a pet to the data store
-func (p *PetDao) Insert(pet model.Pet) error {
-	_, err := p.client.PutItem(&dynamodb.PutItemInput{
-		TableName: &p.tableName,
-		Item:      convertPetToItem(pet),
-	})
+// Inserts a pet (as given, including who changed it and when) to the data store, along with the first snapshot of its
+// history and an item for each of its owners
+func (p *PetDao) Insert(ctx context.Context, pet model.Pet) error {
+	err := p.transact(ctx, pet.Id, append([]*dynamodb.TransactWriteItem{
+		{Put: &dynamodb.Put{
+			TableName: &p.tableName,
+			Item:      convertPetToItem(pet),
+		}},
+		p.putSnapshot(pet),
+	}, p.changeOwnerships(pet.Id, nil, pet.Owners)...))
 
 	if err != nil {
-		log.Println(err)
-		return errors.New("error adding pet")
+		return apperror.NewInternal("error adding pet", err)
 	}
 
 	return nil
 }
 
-// Query for a set of pets (first n pets after the exclusive start value)
-func (p *PetDao) Query(count int, exclusiveStartId string) ([]model.Pet, bool, error) {
-	queryInput := buildQueryInput(p.tableName, count, exclusiveStartId)
+// Query for a set of pets (first n pets after the exclusive start value); deleted pets aren't included
+func (p *PetDao) Query(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	return p.query(ctx, petSortLabel, count, exclusiveStartId, "error retrieving pets")
+}
 
-	ret, err := p.client.Query(&queryInput)
+// Query for a set of deleted pets (first n deleted pets after the exclusive start value); expired pets the table's TTL
+// hasn't removed yet aren't included
+func (p *PetDao) QueryDeleted(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	return p.query(ctx, deletedPetSortLabel, count, exclusiveStartId, "error retrieving deleted pets")
+}
 
-	if err != nil {
-		log.Println(err)
-		return []model.Pet{}, false, errors.New("error retrieving pets")
+// Query for a set of the pets stored with the sort label
+func (p *PetDao) query(ctx context.Context, sortLabel string, count int, exclusiveStartId string, errMessage string) ([]model.Pet, bool, error) {
+	pets := []model.Pet{}
+	queryInput := buildQueryInput(p.tableName, sortLabel, count, exclusiveStartId)
+	for {
+		start := time.Now()
+		ret, err := p.client.QueryWithContext(ctx, &queryInput)
+		metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("dynamodb query failed", err, nil)
+			return []model.Pet{}, false, apperror.NewInternal(errMessage, err)
+		}
+
+		page, hasNextPage := convertPage(ret, count-len(pets))
+		pets = append(pets, page...)
+
+		// Expired deleted pets are filtered out after a page is read, so keep reading until the page is full or every pet
+		// has been seen
+		if len(pets) >= count || !hasNextPage {
+			return pets, hasNextPage, nil
+		}
+		limit := int64(count - len(pets))
+		queryInput.ExclusiveStartKey, queryInput.Limit = ret.LastEvaluatedKey, &limit
 	}
+}
 
-	hasNextPage := len(ret.LastEvaluatedKey) != 0
+// Get the total count of pets (deleted pets aren't counted)
+func (p *PetDao) GetTotalCount(ctx context.Context) (int, error) {
+	return p.count(ctx, petSortLabel, "error getting total pets count")
+}
 
-	// If count is zero, double check value for hasNextPage and ensure un-requested items are not returned
+// Get the total count of deleted pets; like QueryDeleted, expired pets aren't counted
+func (p *PetDao) GetDeletedTotalCount(ctx context.Context) (int, error) {
+	return p.count(ctx, deletedPetSortLabel, "error getting total deleted pets count")
+}
+
+// Query for a set of the pets a user owns (first n pets after the exclusive start value), ordered by ID; deleted pets
+// aren't included, nor are private pets unless they're included
+//
+// The owner index only holds keys, so the page of pets is read from the table afterwards; pets deleted in between are
+// left out of the page
+func (p *PetDao) QueryByOwner(ctx context.Context, owner string, includePrivate bool, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+	limit := int64(count)
 	if count == 0 {
-		if len(ret.Items) > 0 {
-			hasNextPage = true
+		limit = 1 // Dynamo minimum limit is 1
+	}
+	queryInput := ownerQueryInput(p.tableName, owner)
+	queryInput.Limit = &limit
+	if exclusiveStartId != "" {
+		queryInput.ExclusiveStartKey = ownershipItem(exclusiveStartId, owner)
+	}
+
+	pets := []model.Pet{}
+	for {
+		ret, err := p.queryOwner(ctx, owner, &queryInput, "error retrieving pets")
+		if err != nil {
+			return []model.Pet{}, false, err
 		}
-		ret.Items = []DynamoItem{}
+
+		hasNextPage := len(ret.LastEvaluatedKey) != 0
+		ids := []string{}
+		for _, item := range ret.Items {
+			ids = append(ids, *item["Id"].S)
+		}
+		// If count is zero, double check value for hasNextPage and ensure un-requested pets are not returned
+		if count == 0 {
+			return pets, hasNextPage || len(ids) > 0, nil
+		}
+
+		page, err := p.getByIds(ctx, ids)
+		if err != nil {
+			return []model.Pet{}, false, err
+		}
+		for _, pet := range page {
+			if includePrivate || !pet.Private {
+				pets = append(pets, pet)
+			}
+		}
+
+		// Private pets are filtered out after a page is read, so keep reading until the page is full or every pet has
+		// been seen
+		if len(pets) >= count || !hasNextPage {
+			return pets, hasNextPage, nil
+		}
+		limit := int64(count - len(pets))
+		queryInput.ExclusiveStartKey, queryInput.Limit = ret.LastEvaluatedKey, &limit
 	}
+}
 
-	// Convert items to pets
+// Get the total count of the pets a user owns (deleted pets aren't counted, nor are private pets unless they're
+// included)
+//
+// Whether a pet is private isn't in the owner index, so leaving private pets out means reading every pet the user owns
+func (p *PetDao) GetTotalCountByOwner(ctx context.Context, owner string, includePrivate bool) (int, error) {
+	queryInput := ownerQueryInput(p.tableName, owner)
+	if includePrivate {
+		queryInput.Select = jsii.String(dynamodb.SelectCount)
+		ret, err := p.queryOwner(ctx, owner, &queryInput, "error getting total pets count")
+		if err != nil {
+			return 0, err
+		}
+		return int(*ret.Count), nil
+	}
+
+	limit := int64(maxBatchGetKeys)
+	queryInput.Limit = &limit
+	count := 0
+	for {
+		ret, err := p.queryOwner(ctx, owner, &queryInput, "error getting total pets count")
+		if err != nil {
+			return 0, err
+		}
+
+		ids := []string{}
+		for _, item := range ret.Items {
+			ids = append(ids, *item["Id"].S)
+		}
+		pets, err := p.getByIds(ctx, ids)
+		if err != nil {
+			return 0, err
+		}
+		for _, pet := range pets {
+			if !pet.Private {
+				count++
+			}
+		}
+
+		if len(ret.LastEvaluatedKey) == 0 {
+			return count, nil
+		}
+		queryInput.ExclusiveStartKey = ret.LastEvaluatedKey
+	}
+}
+
+// Queries the owner index for the keys of the pets a user owns
+func (p *PetDao) queryOwner(ctx context.Context, owner string, queryInput *dynamodb.QueryInput, errMessage string) (*dynamodb.QueryOutput, error) {
+	start := time.Now()
+	ret, err := p.client.QueryWithContext(ctx, queryInput)
+	metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"owner": owner})
+		return nil, apperror.NewInternal(errMessage, err)
+	}
+	return ret, nil
+}
+
+// Gets the pets with the IDs in the same order (at most maxBatchGetKeys); pets which don't exist are left out
+func (p *PetDao) getByIds(ctx context.Context, ids []string) ([]model.Pet, error) {
 	pets := []model.Pet{}
-	for _, item := range ret.Items {
-		pets = append(pets, convertItemToPet(item))
+	if len(ids) == 0 {
+		return pets, nil
+	}
+
+	keys := []DynamoItem{}
+	for _, id := range ids {
+		keys = append(keys, petKey(id, petSortLabel))
+	}
+	requestItems := map[string]*dynamodb.KeysAndAttributes{
+		p.tableName: {
+			Keys:                     keys,
+			ProjectionExpression:     jsii.String(petProjection),
+			ExpressionAttributeNames: petProjectionNames(),
+		},
+	}
+
+	// DynamoDB can leave keys unprocessed (e.g. when throttled), so keep asking for them until every pet has been read
+	found := map[string]model.Pet{}
+	for len(requestItems) > 0 {
+		start := time.Now()
+		ret, err := p.client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{RequestItems: requestItems})
+		metrics.FromContext(ctx).RecordCall("DynamoDB.BatchGetItem", start, err)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("dynamodb batch get item failed", err, nil)
+			return []model.Pet{}, apperror.NewInternal("error retrieving pets", err)
+		}
+
+		for _, item := range ret.Responses[p.tableName] {
+			pet := convertItemToPet(item)
+			found[pet.Id] = pet
+		}
+		requestItems = ret.UnprocessedKeys
 	}
 
-	return pets, hasNextPage, err
+	for _, id := range ids {
+		if pet, exists := found[id]; exists {
+			pets = append(pets, pet)
+		}
+	}
+
+	return pets, nil
 }
 
-// Get the total count of pets
-func (p *PetDao) GetTotalCount() (int, error) {
-	ret, err := p.client.Query(&dynamodb.QueryInput{
+// Get the total count of the pets stored with the sort label
+func (p *PetDao) count(ctx context.Context, sortLabel string, errMessage string) (int, error) {
+	queryInput := dynamodb.QueryInput{
 		TableName:              &p.tableName,
 		IndexName:              jsii.String("sort-key-gsi"),
 		KeyConditionExpression: jsii.String("Sort = :sortVal"),
 		ExpressionAttributeValues: DynamoItem{
-			":sortVal": {S: jsii.String(petSortLabel)},
+			":sortVal": {S: jsii.String(sortLabel)},
 		},
-	})
+	}
+	filterExpired(&queryInput, sortLabel)
+
+	start := time.Now()
+	ret, err := p.client.QueryWithContext(ctx, &queryInput)
+	metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
 
 	if err != nil {
-		log.Println(err)
-		return 0, errors.New("error getting total pets count")
+		logging.FromContext(ctx).Error("dynamodb query failed", err, nil)
+		return 0, apperror.NewInternal(errMessage, err)
 	}
 
 	count := int(*ret.Count)
@@ -154,75 +589,539 @@ func (p *PetDao) GetTotalCount() (int, error) {
 	return count, err
 }
 
-// Updates a pet in the data store by performing a full replace
-func (p *PetDao) Update(pet model.Pet) error {
-	_, err := p.client.PutItem(&dynamodb.PutItemInput{
-		TableName: &p.tableName,
-		Item:      convertPetToItem(pet),
+// Changes only the attributes set in the patch, adds the new version to the pet's history and returns the updated pet;
+// the stored pet must still have the expected version, which is then incremented (an empty patch changes nothing, not
+// even the version)
+//
+// The snapshot is worked out from the pet as it was read, which the version condition guarantees is what gets patched
+func (p *PetDao) Patch(ctx context.Context, id string, expectedVersion int, patch model.PetPatch, changedBy string) (model.Pet, error) {
+	pet, err := p.GetById(ctx, id)
+	if apperror.Is(err, apperror.CodeNotFound) && !patch.IsEmpty() {
+		return model.Pet{}, apperror.NewNotFound("could not update pet; pet not found", err)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+	if pet.Version != expectedVersion {
+		return model.Pet{}, newVersionConflict()
+	}
+	if patch.IsEmpty() {
+		return pet, nil
+	}
+
+	patched := withChange(pet.WithPatch(patch), changedBy, time.Now().UTC())
+	update := buildPatchUpdate(p.tableName, id, expectedVersion, patch, patched)
+
+	items := []*dynamodb.TransactWriteItem{
+		{Update: &update},
+		p.putSnapshot(patched),
+	}
+	if patch.Owners != nil {
+		items = append(items, p.changeOwnerships(id, pet.Owners, patched.Owners)...)
+	}
+
+	err = p.transact(ctx, id, items)
+
+	if err != nil {
+		if isConditionFailure(err) {
+			return model.Pet{}, p.explainConditionFailure(ctx, id, petSortLabel, "could not update pet; pet not found", err)
+		}
+		return model.Pet{}, apperror.NewInternal("error updating pet", err)
+	}
+
+	return patched.WithAgeOn(time.Now()), nil
+}
+
+// Gets the pet as it was at the given time, i.e. the latest version in its history changed at or before then; pets
+// which didn't exist (or were deleted) at the time aren't found
+func (p *PetDao) GetAsOf(ctx context.Context, id string, asOf time.Time) (model.Pet, error) {
+	names := petProjectionNames()
+	input := dynamodb.QueryInput{
+		TableName:                &p.tableName,
+		KeyConditionExpression:   jsii.String("Id = :id AND begins_with(Sort, :snapshot)"),
+		FilterExpression:         jsii.String("#changedAt <= :asOf"),
+		ProjectionExpression:     jsii.String(petProjection),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: DynamoItem{
+			":id":       {S: jsii.String(id)},
+			":snapshot": {S: jsii.String(petSnapshotSortPrefix)},
+			":asOf":     {S: jsii.String(asOf.UTC().Format(time.RFC3339))},
+		},
+		ScanIndexForward: jsii.Bool(false), // newest first
+	}
+
+	// The filter is applied after each page is read, so a page can come back empty even though later pages match
+	for {
+		start := time.Now()
+		ret, err := p.client.QueryWithContext(ctx, &input)
+		metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"petId": id})
+			return model.Pet{}, apperror.NewInternal("error retrieving pet history", err)
+		}
+		if len(ret.Items) > 0 {
+			pet := convertItemToPet(ret.Items[0])
+			if pet.DeletedAt != "" {
+				return model.Pet{}, apperror.NewNotFound("pet not found", nil)
+			}
+			return pet, nil
+		}
+		if len(ret.LastEvaluatedKey) == 0 {
+			return model.Pet{}, apperror.NewNotFound("pet not found", nil)
+		}
+		input.ExclusiveStartKey = ret.LastEvaluatedKey
+	}
+}
+
+// Query for a set of a pet's past and current versions, newest first (first n versions older than the exclusive start
+// version, or the newest versions if it is 0)
+func (p *PetDao) QueryHistory(ctx context.Context, id string, count int, exclusiveStartVersion int) ([]model.Pet, bool, error) {
+	limit := int64(count)
+	if count == 0 {
+		limit = 1 // Dynamo minimum limit is 1
+	}
+	var exclusiveStartKey DynamoItem
+	if exclusiveStartVersion > 0 {
+		exclusiveStartKey = petKey(id, petSnapshotSortLabel(exclusiveStartVersion))
+	}
+
+	start := time.Now()
+	ret, err := p.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:                &p.tableName,
+		KeyConditionExpression:   jsii.String("Id = :id AND begins_with(Sort, :snapshot)"),
+		ProjectionExpression:     jsii.String(petProjection),
+		ExpressionAttributeNames: petProjectionNames(),
+		ExpressionAttributeValues: DynamoItem{
+			":id":       {S: jsii.String(id)},
+			":snapshot": {S: jsii.String(petSnapshotSortPrefix)},
+		},
+		ScanIndexForward:  jsii.Bool(false), // newest first
+		ExclusiveStartKey: exclusiveStartKey,
+		Limit:             &limit,
 	})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
 
 	if err != nil {
-		log.Println(err)
-		return errors.New("error updating pet")
+		logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"petId": id})
+		return []model.Pet{}, false, apperror.NewInternal("error retrieving pet history", err)
 	}
 
-	return nil
+	pets, hasNextPage := convertPage(ret, count)
+
+	return pets, hasNextPage, nil
 }
 
-// Convert a DynamoDB item to a pet
+// Get the number of versions in a pet's history
+func (p *PetDao) GetHistoryCount(ctx context.Context, id string) (int, error) {
+	start := time.Now()
+	ret, err := p.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              &p.tableName,
+		KeyConditionExpression: jsii.String("Id = :id AND begins_with(Sort, :snapshot)"),
+		ExpressionAttributeValues: DynamoItem{
+			":id":       {S: jsii.String(id)},
+			":snapshot": {S: jsii.String(petSnapshotSortPrefix)},
+		},
+		Select: jsii.String(dynamodb.SelectCount),
+	})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"petId": id})
+		return 0, apperror.NewInternal("error getting pet history count", err)
+	}
+
+	return int(*ret.Count), nil
+}
+
+// Writes the items of a transaction affecting the pet with the ID
+func (p *PetDao) transact(ctx context.Context, id string, items []*dynamodb.TransactWriteItem) error {
+	start := time.Now()
+	_, err := p.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.TransactWriteItems", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb transact write items failed", err, logging.Fields{"petId": id})
+	}
+	return err
+}
+
+// Transaction item writing a version of a pet to its history; snapshots are immutable, so the write fails if the
+// version is already in the history
+func (p *PetDao) putSnapshot(pet model.Pet) *dynamodb.TransactWriteItem {
+	item := convertPetToItem(pet)
+	item["Sort"] = &dynamodb.AttributeValue{S: jsii.String(petSnapshotSortLabel(pet.Version))}
+	return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName:           &p.tableName,
+		Item:                item,
+		ConditionExpression: jsii.String("attribute_not_exists(Id)"),
+	}}
+}
+
+// Transaction items listing a pet under each of its owners and removing it from the owners it no longer has; every
+// owner's item is written again, since pets stored before pets had several owners don't have any
+func (p *PetDao) changeOwnerships(id string, before []string, after []string) []*dynamodb.TransactWriteItem {
+	items := []*dynamodb.TransactWriteItem{}
+	kept := map[string]bool{}
+	for _, owner := range after {
+		kept[owner] = true
+	}
+	for _, owner := range before {
+		if !kept[owner] {
+			items = append(items, &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+				TableName: &p.tableName,
+				Key:       petKey(id, petOwnerSortPrefix+owner),
+			}})
+		}
+	}
+	for _, owner := range model.NewOwners(after...) {
+		items = append(items, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName: &p.tableName,
+			Item:      ownershipItem(id, owner),
+		}})
+	}
+	return items
+}
+
+// Works out why a conditional write to the pet stored with the sort label failed; either the pet doesn't exist or it
+// has been changed since it was read
+func (p *PetDao) explainConditionFailure(ctx context.Context, id string, sortLabel string, notFoundMessage string, err error) error {
+	_, getErr := p.get(ctx, id, sortLabel, notFoundMessage)
+	if apperror.Is(getErr, apperror.CodeNotFound) {
+		return apperror.NewNotFound(notFoundMessage, err)
+	} else if getErr != nil {
+		return getErr
+	}
+	return newVersionConflict()
+}
+
+// Checks whether a write failed because its condition (or, in a transaction, one of its conditions) wasn't met
+func isConditionFailure(err error) bool {
+	var conditionError *dynamodb.ConditionalCheckFailedException
+	if errors.As(err, &conditionError) {
+		return true
+	}
+	var transactionError *dynamodb.TransactionCanceledException
+	if errors.As(err, &transactionError) {
+		for _, reason := range transactionError.CancellationReasons {
+			if reason != nil && aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Creates the error returned when a pet has been changed since the caller read it
+func newVersionConflict() error {
+	return apperror.NewConflict("pet has been changed by another request; get the latest version and try again", nil)
+}
+
+// Convert a page of query results holding up to count pets to the pets and whether there is a next page
+func convertPage(ret *dynamodb.QueryOutput, count int) ([]model.Pet, bool) {
+	hasNextPage := len(ret.LastEvaluatedKey) != 0
+
+	// If count is zero, double check value for hasNextPage and ensure un-requested items are not returned
+	if count == 0 {
+		if len(ret.Items) > 0 {
+			hasNextPage = true
+		}
+		ret.Items = []DynamoItem{}
+	}
+
+	// Convert items to pets
+	pets := []model.Pet{}
+	for _, item := range ret.Items {
+		pets = append(pets, convertItemToPet(item))
+	}
+
+	return pets, hasNextPage
+}
+
+// Gets the next version of a pet, changed by the user at the given time
+func withChange(pet model.Pet, changedBy string, changedAt time.Time) model.Pet {
+	pet.Version++
+	pet.ChangedBy = changedBy
+	pet.ChangedAt = changedAt.Format(time.RFC3339)
+	return pet
+}
+
+// Sort key of the snapshot of a version of a pet
+func petSnapshotSortLabel(version int) string {
+	return fmt.Sprintf(petSnapshotSortFormat, version)
+}
+
+// Convert a DynamoDB item to a pet; the age of pets with a birth date is worked out as of now
+//
+// Items stored before species, breed, birth date and version were added don't have those attributes, items with a birth
+// date don't store an age, and items stored before pets had several owners keep their only owner in Owner
 func convertItemToPet(item DynamoItem) model.Pet {
-	age, _ := strconv.Atoi(*item["Age"].N)
-	owner := ""
-	if item["Owner"] != nil {
-		owner = *item["Owner"].S
+	pet := model.Pet{
+		Id:   *item["Id"].S,
+		Name: *item["Name"].S,
+	}
+	if item["Species"] != nil {
+		pet.Species = model.Species(*item["Species"].S)
+	}
+	if item["Breed"] != nil {
+		pet.Breed = *item["Breed"].S
+	}
+	if item["BirthDate"] != nil {
+		pet.BirthDate = *item["BirthDate"].S
+	}
+	if item["Age"] != nil {
+		pet.Age, _ = strconv.Atoi(*item["Age"].N)
+	}
+	if item["Owners"] != nil {
+		pet.Owners = model.NewOwners(aws.StringValueSlice(item["Owners"].SS)...)
+	} else if item["Owner"] != nil {
+		pet.Owners = model.NewOwners(*item["Owner"].S)
+	} else {
+		pet.Owners = []string{}
 	}
-	return model.Pet{
-		Id:    *item["Id"].S,
-		Name:  *item["Name"].S,
-		Age:   age,
-		Owner: owner,
+	if item["Private"] != nil {
+		pet.Private = *item["Private"].BOOL
 	}
+	if item["Version"] != nil {
+		pet.Version, _ = strconv.Atoi(*item["Version"].N)
+	}
+	if item["DeletedAt"] != nil {
+		pet.DeletedAt = *item["DeletedAt"].S
+	}
+	if item["ChangedBy"] != nil {
+		pet.ChangedBy = *item["ChangedBy"].S
+	}
+	if item["ChangedAt"] != nil {
+		pet.ChangedAt = *item["ChangedAt"].S
+	}
+	return pet.WithAgeOn(time.Now())
 }
 
-// Convert a pet to a DynamoDB item
+// Convert a pet to a DynamoDB item; the age is only stored for pets without a birth date (it would go stale otherwise),
+// the owners are left out when there are none (DynamoDB doesn't store empty sets) and only private pets store Private
 func convertPetToItem(pet model.Pet) DynamoItem {
-	age := strconv.Itoa(pet.Age)
+	version := strconv.Itoa(pet.Version)
+	item := DynamoItem{
+		"Id":      {S: jsii.String(pet.Id)},
+		"Sort":    {S: jsii.String(petSortLabel)},
+		"Name":    {S: &pet.Name},
+		"Version": {N: &version},
+	}
+	if owners := model.NewOwners(pet.Owners...); len(owners) > 0 {
+		item["Owners"] = &dynamodb.AttributeValue{SS: aws.StringSlice(owners)}
+	}
+	if pet.Private {
+		item["Private"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	if pet.Species != "" {
+		item["Species"] = &dynamodb.AttributeValue{S: jsii.String(string(pet.Species))}
+	}
+	if pet.Breed != "" {
+		item["Breed"] = &dynamodb.AttributeValue{S: &pet.Breed}
+	}
+	if pet.BirthDate != "" {
+		item["BirthDate"] = &dynamodb.AttributeValue{S: &pet.BirthDate}
+	} else {
+		item["Age"] = &dynamodb.AttributeValue{N: jsii.String(strconv.Itoa(pet.Age))}
+	}
+	for name, value := range map[string]string{"DeletedAt": pet.DeletedAt, "ChangedBy": pet.ChangedBy, "ChangedAt": pet.ChangedAt} {
+		if value != "" {
+			item[name] = &dynamodb.AttributeValue{S: jsii.String(value)}
+		}
+	}
+	return item
+}
+
+// Convert a deleted pet to a DynamoDB item, which the table's TTL removes some time after it expires
+func convertDeletedPetToItem(pet model.Pet, expiresAt time.Time) DynamoItem {
+	item := convertPetToItem(pet)
+	item["Sort"] = &dynamodb.AttributeValue{S: jsii.String(deletedPetSortLabel)}
+	item["ExpiresAt"] = expiresAtValue(expiresAt)
+	return item
+}
+
+// Value of the ExpiresAt attribute (in Unix seconds) the table's TTL reads
+func expiresAtValue(expiresAt time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: jsii.String(strconv.FormatInt(expiresAt.Unix(), 10))}
+}
+
+// Item listing a pet under one of its owners in the owner index
+func ownershipItem(id string, owner string) DynamoItem {
+	item := petKey(id, petOwnerSortPrefix+owner)
+	item["Owner"] = &dynamodb.AttributeValue{S: jsii.String(owner)}
+	return item
+}
+
+// Key of the pet stored with the sort label
+func petKey(id string, sortLabel string) DynamoItem {
 	return DynamoItem{
-		"Id":    {S: jsii.String(pet.Id)},
-		"Sort":  {S: jsii.String(petSortLabel)},
-		"Name":  {S: &pet.Name},
-		"Age":   {N: &age},
-		"Owner": {S: &pet.Owner},
+		"Id":   {S: jsii.String(id)},
+		"Sort": {S: jsii.String(sortLabel)},
+	}
+}
+
+// Names behind the placeholders in the pet projection (some attribute names are reserved words)
+func petProjectionNames() map[string]*string {
+	return map[string]*string{
+		"#name":      jsii.String("Name"),
+		"#species":   jsii.String("Species"),
+		"#breed":     jsii.String("Breed"),
+		"#birthDate": jsii.String("BirthDate"),
+		"#owners":    jsii.String("Owners"),
+		"#owner":     jsii.String("Owner"), // only on items stored before pets had several owners
+		"#private":   jsii.String("Private"),
+		"#version":   jsii.String("Version"),
+		"#deletedAt": jsii.String("DeletedAt"),
+		"#changedBy": jsii.String("ChangedBy"),
+		"#changedAt": jsii.String("ChangedAt"),
 	}
 }
 
 // Build input to query for pets
-func buildQueryInput(tableName string, count int, exclusiveStartId string) dynamodb.QueryInput {
+func buildQueryInput(tableName string, sortLabel string, count int, exclusiveStartId string) dynamodb.QueryInput {
 	limit := int64(count)
 	if count == 0 {
 		limit = 1 // Dynamo minimum limit is 1
 	}
-	exclusiveStartKey := DynamoItem{
-		"Id":   {S: &exclusiveStartId},
-		"Sort": {S: jsii.String(petSortLabel)},
-	}
+	exclusiveStartKey := petKey(exclusiveStartId, sortLabel)
 	if exclusiveStartId == "" {
 		exclusiveStartKey = nil
 	}
 
-	return dynamodb.QueryInput{
-		TableName:              &tableName,
-		IndexName:              jsii.String("sort-key-gsi"),
-		KeyConditionExpression: jsii.String("Sort = :sortVal"),
-		ProjectionExpression:   jsii.String("Id, #name, Age, #owner"),
-		ExpressionAttributeNames: map[string]*string{
-			"#name":  jsii.String("Name"),
-			"#owner": jsii.String("Owner"),
-		},
+	queryInput := dynamodb.QueryInput{
+		TableName:                &tableName,
+		IndexName:                jsii.String("sort-key-gsi"),
+		KeyConditionExpression:   jsii.String("Sort = :sortVal"),
+		ProjectionExpression:     jsii.String(petProjection),
+		ExpressionAttributeNames: petProjectionNames(),
 		ExpressionAttributeValues: DynamoItem{
-			":sortVal": {S: jsii.String(petSortLabel)},
+			":sortVal": {S: jsii.String(sortLabel)},
 		},
 		ExclusiveStartKey: exclusiveStartKey,
 		Limit:             &limit,
 	}
+	filterExpired(&queryInput, sortLabel)
+	return queryInput
+}
+
+// Build input to query the owner index for the keys of the pets a user owns
+func ownerQueryInput(tableName string, owner string) dynamodb.QueryInput {
+	return dynamodb.QueryInput{
+		TableName:                &tableName,
+		IndexName:                jsii.String(ownerIndex),
+		KeyConditionExpression:   jsii.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{"#owner": jsii.String("Owner")},
+		ExpressionAttributeValues: DynamoItem{
+			":owner": {S: &owner},
+		},
+	}
+}
+
+// Leaves deleted pets which have expired, but which the table's TTL hasn't removed yet (it can take up to a couple of
+// days), out of a query of the pets stored with the sort label
+func filterExpired(queryInput *dynamodb.QueryInput, sortLabel string) {
+	if sortLabel == deletedPetSortLabel {
+		queryInput.FilterExpression = jsii.String(unexpiredCondition(time.Now(), queryInput.ExpressionAttributeValues))
+	}
+}
+
+// Adds a condition that an item hasn't expired by the time to an expression's values
+func unexpiredCondition(now time.Time, values DynamoItem) string {
+	values[":now"] = &dynamodb.AttributeValue{N: jsii.String(strconv.FormatInt(now.Unix(), 10))}
+	return "ExpiresAt > :now"
+}
+
+// Checks whether an item has expired by the time; the table's TTL removes expired items lazily, so they can still be
+// read for a while
+func isExpired(item DynamoItem, now time.Time) bool {
+	if item["ExpiresAt"] == nil || item["ExpiresAt"].N == nil {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(*item["ExpiresAt"].N, 10, 64)
+	return err == nil && expiresAt <= now.Unix()
+}
+
+// Build a transaction item to update the attributes set in a patch (the patch must not be empty) and move the pet on to
+// the patched version (taking its version and change details); the pet must already exist with the expected version
+//
+// Changing the owners also removes the Owner attribute of items stored before pets had several owners
+func buildPatchUpdate(tableName string, id string, expectedVersion int, patch model.PetPatch, patched model.Pet) dynamodb.Update {
+	assignments := []string{}
+	removals := []string{}
+	names := map[string]*string{}
+	values := DynamoItem{}
+	set := func(attribute string, value *dynamodb.AttributeValue) {
+		placeholder := strings.ToLower(attribute[:1]) + attribute[1:]
+		assignments = append(assignments, "#"+placeholder+" = :"+placeholder)
+		names["#"+placeholder] = jsii.String(attribute)
+		values[":"+placeholder] = value
+	}
+	remove := func(attribute string) {
+		placeholder := strings.ToLower(attribute[:1]) + attribute[1:]
+		removals = append(removals, "#"+placeholder)
+		names["#"+placeholder] = jsii.String(attribute)
+	}
+
+	if patch.Name != nil {
+		set("Name", &dynamodb.AttributeValue{S: patch.Name})
+	}
+	if patch.Species != nil {
+		set("Species", &dynamodb.AttributeValue{S: jsii.String(string(*patch.Species))})
+	}
+	if patch.Breed != nil {
+		set("Breed", &dynamodb.AttributeValue{S: patch.Breed})
+	}
+	if patch.BirthDate != nil {
+		set("BirthDate", &dynamodb.AttributeValue{S: patch.BirthDate})
+	}
+	if patch.Age != nil {
+		set("Age", &dynamodb.AttributeValue{N: jsii.String(strconv.Itoa(*patch.Age))})
+	}
+	if patch.Private != nil {
+		set("Private", &dynamodb.AttributeValue{BOOL: patch.Private})
+	}
+	if patch.Owners != nil {
+		if owners := model.NewOwners(*patch.Owners...); len(owners) > 0 {
+			set("Owners", &dynamodb.AttributeValue{SS: aws.StringSlice(owners)})
+		} else {
+			remove("Owners")
+		}
+		remove("Owner")
+	}
+	condition := "attribute_exists(Id) AND " + versionCondition(expectedVersion, names, values)
+	set("Version", &dynamodb.AttributeValue{N: jsii.String(strconv.Itoa(patched.Version))})
+	set("ChangedBy", &dynamodb.AttributeValue{S: jsii.String(patched.ChangedBy)})
+	set("ChangedAt", &dynamodb.AttributeValue{S: jsii.String(patched.ChangedAt)})
+
+	updateExpression := "SET " + strings.Join(assignments, ", ")
+	if len(removals) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removals, ", ")
+	}
+
+	return dynamodb.Update{
+		TableName:                 &tableName,
+		Key:                       petKey(id, petSortLabel),
+		UpdateExpression:          &updateExpression,
+		ConditionExpression:       &condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+}
+
+// Adds a condition that the stored pet has the expected version to an expression's names and values; pets stored
+// before versions were added have no version attribute and count as version 0
+func versionCondition(expectedVersion int, names map[string]*string, values DynamoItem) string {
+	names["#version"] = jsii.String("Version")
+	if expectedVersion == 0 {
+		return "attribute_not_exists(#version)"
+	}
+	values[":expectedVersion"] = &dynamodb.AttributeValue{N: jsii.String(strconv.Itoa(expectedVersion))}
+	return "#version = :expectedVersion"
+}
+
+// DynamoDB rejects an empty map of expression values, so leave it out when there are none
+func valuesOrNil(values DynamoItem) DynamoItem {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
 }
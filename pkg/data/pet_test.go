@@ -1,12 +1,18 @@
 package data_test
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/jsii-runtime-go"
 	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/metrics"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/openlyinc/pointy"
 	"github.com/stretchr/testify/assert"
@@ -14,63 +20,397 @@ import (
 
 var (
 	SamplePet1 = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "pet 1",
-		Age:   10,
-		Owner: "User1",
+		Id:      uuid.NewString(),
+		Name:    "pet 1",
+		Age:     10,
+		Owners:  []string{"User1", "User3"},
+		Version: 2,
 	}
 	SamplePet2 = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "pet 2",
-		Age:   92,
-		Owner: "User2",
+		Id:     uuid.NewString(),
+		Name:   "pet 2",
+		Age:    92,
+		Owners: []string{"User2"},
 	}
 	SamplePet1Item = data.DynamoItem{
-		"Id":    {S: &SamplePet1.Id},
-		"Name":  {S: &SamplePet1.Name},
-		"Age":   {N: jsii.String("10")},
-		"Owner": {S: &SamplePet1.Owner},
+		"Id":      {S: &SamplePet1.Id},
+		"Name":    {S: &SamplePet1.Name},
+		"Age":     {N: jsii.String("10")},
+		"Owners":  {SS: *jsii.Strings("User3", "User1")}, // sets have no order
+		"Version": {N: jsii.String("2")},
 	}
+	// Stored before versions and co-owners were added, so it has no version attribute (version 0) and a single owner
 	SamplePet2Item = data.DynamoItem{
 		"Id":    {S: &SamplePet2.Id},
 		"Name":  {S: &SamplePet2.Name},
 		"Age":   {N: jsii.String("92")},
-		"Owner": {S: &SamplePet2.Owner},
+		"Owner": {S: jsii.String("User2")},
+	}
+	SamplePet3 = model.Pet{
+		Id:        uuid.NewString(),
+		Name:      "pet 3",
+		Species:   model.SpeciesCat,
+		Breed:     "Siamese",
+		BirthDate: "2015-06-30",
+		Owners:    []string{},
+		Version:   1,
+	}
+	// Has a birth date instead of a stored age
+	SamplePet3Item = data.DynamoItem{
+		"Id":        {S: &SamplePet3.Id},
+		"Name":      {S: &SamplePet3.Name},
+		"Species":   {S: jsii.String("CAT")},
+		"Breed":     {S: &SamplePet3.Breed},
+		"BirthDate": {S: &SamplePet3.BirthDate},
+		"Version":   {N: jsii.String("1")},
+	}
+	SamplePet4 = model.Pet{
+		Id:      uuid.NewString(),
+		Name:    "pet 4",
+		Age:     3,
+		Owners:  []string{"User1"},
+		Private: true,
+		Version: 1,
+	}
+	// Only private pets store Private
+	SamplePet4Item = data.DynamoItem{
+		"Id":      {S: &SamplePet4.Id},
+		"Name":    {S: &SamplePet4.Name},
+		"Age":     {N: jsii.String("3")},
+		"Owners":  {SS: *jsii.Strings("User1")},
+		"Private": {BOOL: jsii.Bool(true)},
+		"Version": {N: jsii.String("1")},
 	}
 )
 
+// Keys of the snapshots of sample pet 1, as queried for its history
+var SamplePet1HistoryKeys = &dynamodb.QueryOutput{Items: []data.DynamoItem{
+	{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("pet#v0000000001")}},
+	{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("pet#v0000000002")}},
+}}
+
 func TestPetDelete(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name      string
-		dbClient  FakeDynamoDbClient
-		petId     string
-		expectErr bool
+		name            string
+		dbClient        FakeDynamoDbClient
+		petId           string
+		expectedVersion *int
+		expectErr       bool
+		expectedErrCode apperror.Code
 	}
 
 	// Define tests
 	tests := []Test{
 		{
-			name:      "valid delete",
-			dbClient:  FakeDynamoDbClient{},
+			name: "valid delete",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				queryOutput:   SamplePet1HistoryKeys,
+			},
+			petId:     SamplePet1.Id,
+			expectErr: false,
+		},
+		{
+			name: "history not set to expire (which is only logged)",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				queryOutput:   SamplePet1HistoryKeys,
+				updateItemErr: assert.AnError,
+			},
 			petId:     SamplePet1.Id,
 			expectErr: false,
 		},
+		{
+			name: "db get error",
+			dbClient: FakeDynamoDbClient{
+				getItemErr: assert.AnError,
+			},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "pet not found",
+			dbClient:        FakeDynamoDbClient{},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "pet not at expected version",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name: "db transaction error",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				transactErr:   assert.AnError,
+			},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "pet changed before it was moved",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				transactErr: &dynamodb.TransactionCanceledException{
+					CancellationReasons: []*dynamodb.CancellationReason{{Code: jsii.String("ConditionalCheckFailed")}, {Code: jsii.String("None")}},
+				},
+			},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+
+		// Execute
+		err := dao.Delete(context.Background(), test.petId, test.expectedVersion, "User1")
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetDeleteMovesPetToDeletedPets(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item}, queryOutput: SamplePet1HistoryKeys}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+	before := time.Now()
+
+	// Execute
+	err := dao.Delete(context.Background(), SamplePet1.Id, nil, "User1")
+
+	// Verify
+	assert.Nil(t, err)
+	items := dbClient.transactInput.TransactItems
+	assert.Equal(t, 5, len(items))
+	assert.Equal(t, "pet", *items[0].Delete.Key["Sort"].S)
+	assert.Equal(t, "attribute_exists(Id) AND #version = :expectedVersion", *items[0].Delete.ConditionExpression)
+	assert.Equal(t, "petOwner#User1", *items[3].Delete.Key["Sort"].S, "the pet is no longer listed under its owners")
+	assert.Equal(t, "petOwner#User3", *items[4].Delete.Key["Sort"].S)
+	deleted := items[1].Put.Item
+	assert.Equal(t, "deletedPet", *deleted["Sort"].S)
+	assert.Equal(t, "3", *deleted["Version"].N)
+	deletedAt, parseErr := time.Parse(time.RFC3339, *deleted["DeletedAt"].S)
+	assert.Nil(t, parseErr)
+	assert.WithinDuration(t, before, deletedAt, time.Minute)
+	expiresAt, _ := strconv.ParseInt(*deleted["ExpiresAt"].N, 10, 64)
+	assert.Equal(t, deletedAt.Add(30*24*time.Hour).Unix(), expiresAt)
+	assert.Equal(t, "User1", *deleted["ChangedBy"].S)
+	assert.Equal(t, *deleted["DeletedAt"].S, *deleted["ChangedAt"].S)
+	snapshot := items[2].Put.Item
+	assert.Equal(t, "pet#v0000000003", *snapshot["Sort"].S, "the deleted version is kept in the history")
+	assert.Equal(t, *deleted["DeletedAt"].S, *snapshot["DeletedAt"].S)
+	assert.Equal(t, *deleted["ExpiresAt"].N, *snapshot["ExpiresAt"].N, "the history expires with the deleted pet")
+	assert.Equal(t, "attribute_not_exists(Id)", *items[2].Put.ConditionExpression)
+	assert.Equal(t, "pet#v", *dbClient.queryInput.ExpressionAttributeValues[":prefix"].S)
+	assert.Equal(t, 2, len(dbClient.updateItemInputs), "every earlier snapshot expires too")
+	for _, update := range dbClient.updateItemInputs {
+		assert.Equal(t, "SET ExpiresAt = :expiresAt", *update.UpdateExpression)
+		assert.Equal(t, *deleted["ExpiresAt"].N, *update.ExpressionAttributeValues[":expiresAt"].N)
+		assert.Equal(t, "attribute_exists(Id)", *update.ConditionExpression)
+	}
+	assert.Equal(t, "pet#v0000000002", *dbClient.updateItemInputs[1].Key["Sort"].S)
+}
+
+func TestPetRestore(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		dbClient        FakeDynamoDbClient
+		expectedVersion *int
+		expectedPet     model.Pet
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	deletedItem := data.DynamoItem{}
+	for name, value := range SamplePet1Item {
+		deletedItem[name] = value
+	}
+	deletedItem["DeletedAt"] = &dynamodb.AttributeValue{S: jsii.String("2022-01-01T00:00:00Z")}
+	deletedItem["ExpiresAt"] = &dynamodb.AttributeValue{N: jsii.String(strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))}
+	expiredItem := data.DynamoItem{}
+	for name, value := range deletedItem {
+		expiredItem[name] = value
+	}
+	expiredItem["ExpiresAt"] = &dynamodb.AttributeValue{N: jsii.String(strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))}
+	restored := SamplePet1
+	restored.Version = 3
+	restored.ChangedBy = "User1"
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "valid restore",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: deletedItem},
+				queryOutput:   SamplePet1HistoryKeys,
+			},
+			expectedPet: restored,
+		},
+		{
+			name:            "deleted pet not found",
+			dbClient:        FakeDynamoDbClient{},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "deleted pet expired but not yet removed",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: expiredItem},
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "deleted pet not at expected version",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: deletedItem},
+			},
+			expectedVersion: pointy.Int(1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name: "db history expiry error",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: deletedItem},
+				queryOutput:   SamplePet1HistoryKeys,
+				updateItemErr: assert.AnError,
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "db transaction error",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: deletedItem},
+				queryOutput:   SamplePet1HistoryKeys,
+				transactErr:   assert.AnError,
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+
+		// Execute
+		pet, err := dao.Restore(context.Background(), SamplePet1.Id, test.expectedVersion, "User1")
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.NotEmpty(t, pet.ChangedAt, test.name)
+			pet.ChangedAt = ""
+			assert.Equal(t, test.expectedPet, pet, test.name)
+			items := test.dbClient.transactInput.TransactItems
+			assert.Equal(t, "deletedPet", *items[0].Delete.Key["Sort"].S, test.name)
+			assert.Contains(t, *items[0].Delete.ConditionExpression, "ExpiresAt > :now", "deleted pet can expire after it is read")
+			assert.Equal(t, "pet", *items[1].Put.Item["Sort"].S, test.name)
+			assert.Nil(t, items[1].Put.Item["DeletedAt"], test.name)
+			assert.Nil(t, items[1].Put.Item["ExpiresAt"], test.name)
+			assert.Equal(t, "pet#v0000000003", *items[2].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, "petOwner#User1", *items[3].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, "petOwner#User3", *items[4].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, 2, len(test.dbClient.updateItemInputs), "the history stops expiring")
+			for _, update := range test.dbClient.updateItemInputs {
+				assert.Equal(t, "REMOVE ExpiresAt", *update.UpdateExpression, test.name)
+			}
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.dbClient.updateItemErr != nil {
+			assert.Nil(t, test.dbClient.transactInput, "not restored while its history still expires")
+		}
+	}
+}
+
+func TestPetPurge(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		dbClient        FakeDynamoDbClient
+		expectedVersion *int
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	snapshotKey := data.DynamoItem{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("pet#v0000000001")}}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "valid purge",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				queryOutput:   &dynamodb.QueryOutput{Items: []data.DynamoItem{snapshotKey}},
+			},
+		},
+		{
+			name: "pet not found",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{},
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "db history query error",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				queryErr:      assert.AnError,
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "pet not at expected version",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion: pointy.Int(1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
 		{
 			name: "db delete error",
 			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
 				deleteItemErr: assert.AnError,
 			},
-			petId:     SamplePet1.Id,
-			expectErr: true,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
 		},
 		{
-			name: "db item not found error",
+			name: "pet changed before it was purged",
 			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
 				deleteItemErr: &dynamodb.ConditionalCheckFailedException{},
 			},
-			petId:     SamplePet1.Id,
-			expectErr: true,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
 		},
 	}
 
@@ -80,13 +420,15 @@ func TestPetDelete(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		err := dao.Delete(test.petId)
+		err := dao.Purge(context.Background(), SamplePet1.Id, test.expectedVersion)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
+			prefix := test.dbClient.queryInput.ExpressionAttributeValues[":prefix"]
+			assert.Equal(t, "petOwner#", *prefix.S, "the owner items are purged after the history")
 		} else {
-			assert.NotNil(t, err, test.name)
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
 		}
 	}
 }
@@ -94,11 +436,12 @@ func TestPetDelete(t *testing.T) {
 func TestPetGetById(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name        string
-		dbClient    FakeDynamoDbClient
-		petId       string
-		expectedPet model.Pet
-		expectErr   bool
+		name            string
+		dbClient        FakeDynamoDbClient
+		petId           string
+		expectedPet     model.Pet
+		expectErr       bool
+		expectedErrCode apperror.Code
 	}
 
 	// Define tests
@@ -112,21 +455,41 @@ func TestPetGetById(t *testing.T) {
 			expectedPet: SamplePet1,
 			expectErr:   false,
 		},
+		{
+			name: "pet with a birth date has its age computed",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet3Item},
+			},
+			petId:       SamplePet3.Id,
+			expectedPet: SamplePet3.WithAgeOn(time.Now()),
+			expectErr:   false,
+		},
+		{
+			name: "private pet",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet4Item},
+			},
+			petId:       SamplePet4.Id,
+			expectedPet: SamplePet4,
+			expectErr:   false,
+		},
 		{
 			name: "pet not found",
 			dbClient: FakeDynamoDbClient{
 				getItemOutput: &dynamodb.GetItemOutput{Item: nil},
 			},
-			petId:     SamplePet1.Id,
-			expectErr: true,
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
 		},
 		{
 			name: "db get error",
 			dbClient: FakeDynamoDbClient{
 				getItemErr: assert.AnError,
 			},
-			petId:     SamplePet1.Id,
-			expectErr: true,
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
 		},
 	}
 
@@ -136,14 +499,14 @@ func TestPetGetById(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		pet, err := dao.GetById(test.petId)
+		pet, err := dao.GetById(context.Background(), test.petId)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
 			assert.Equal(t, test.expectedPet, pet, test.name)
 		} else {
-			assert.NotNil(t, err, test.name)
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
 		}
 	}
 }
@@ -166,9 +529,9 @@ func TestPetInsert(t *testing.T) {
 			expectErr: false,
 		},
 		{
-			name: "db put error",
+			name: "db transaction error",
 			dbClient: FakeDynamoDbClient{
-				putItemErr: assert.AnError,
+				transactErr: assert.AnError,
 			},
 			pet:       SamplePet1,
 			expectErr: true,
@@ -181,17 +544,59 @@ func TestPetInsert(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		err := dao.Insert(test.pet)
+		err := dao.Insert(context.Background(), test.pet)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
+			items := test.dbClient.transactInput.TransactItems
+			assert.Equal(t, "pet", *items[0].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, "pet#v0000000002", *items[1].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, "attribute_not_exists(Id)", *items[1].Put.ConditionExpression, test.name)
+			assert.Equal(t, "petOwner#User1", *items[2].Put.Item["Sort"].S, test.name)
+			assert.Equal(t, "petOwner#User3", *items[3].Put.Item["Sort"].S, test.name)
 		} else {
 			assert.NotNil(t, err, test.name)
 		}
 	}
 }
 
+func TestPetInsertStoresBirthDateInsteadOfAge(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+
+	// Execute
+	err := dao.Insert(context.Background(), SamplePet3.WithAgeOn(time.Now()))
+
+	// Verify
+	assert.Nil(t, err)
+	item := dbClient.transactInput.TransactItems[0].Put.Item
+	assert.Equal(t, SamplePet3.BirthDate, *item["BirthDate"].S)
+	assert.Equal(t, "CAT", *item["Species"].S)
+	assert.Equal(t, SamplePet3.Breed, *item["Breed"].S)
+	assert.NotContains(t, item, "Age", "age goes stale, so it is computed on read instead")
+	assert.NotContains(t, item, "Owners", "dynamodb doesn't store empty sets")
+	assert.NotContains(t, item, "Private", "only private pets store it")
+}
+
+func TestPetInsertStoresOwnersAsSet(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+	pet := SamplePet1
+	pet.Owners = []string{"User3", "User1", "User3"}
+
+	// Execute
+	err := dao.Insert(context.Background(), pet)
+
+	// Verify
+	assert.Nil(t, err)
+	item := dbClient.transactInput.TransactItems[0].Put.Item
+	assert.Equal(t, []*string{jsii.String("User1"), jsii.String("User3")}, item["Owners"].SS)
+	assert.NotContains(t, item, "Owner")
+}
+
 func TestPetQuery(t *testing.T) {
 	// Define test struct
 	type Test struct {
@@ -304,7 +709,7 @@ func TestPetQuery(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		pets, hasNextPage, err := dao.Query(test.count, test.exclusiveStartId)
+		pets, hasNextPage, err := dao.Query(context.Background(), test.count, test.exclusiveStartId)
 
 		// Verify
 		if !test.expectErr {
@@ -317,6 +722,44 @@ func TestPetQuery(t *testing.T) {
 	}
 }
 
+func TestPetQueryDeleted(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+		{Items: []data.DynamoItem{}, LastEvaluatedKey: SamplePet1Item}, // every pet on the page had expired
+		{Items: []data.DynamoItem{SamplePet2Item}, LastEvaluatedKey: data.DynamoItem{}},
+	}}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+
+	// Execute
+	pets, hasNextPage, err := dao.QueryDeleted(context.Background(), 2, "")
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Pet{SamplePet2}, pets, "pages are read until every pet has been seen")
+	assert.False(t, hasNextPage)
+	assert.Equal(t, 2, len(dbClient.queryInputs))
+	assert.Equal(t, "ExpiresAt > :now", *dbClient.queryInputs[0].FilterExpression, "expired pets are left out")
+	assert.Equal(t, "deletedPet", *dbClient.queryInputs[0].ExpressionAttributeValues[":sortVal"].S)
+	assert.Equal(t, SamplePet1Item, dbClient.queryInputs[1].ExclusiveStartKey, "second page follows the first")
+	assert.Equal(t, int64(2), *dbClient.queryInputs[1].Limit, "second page fills the rest")
+}
+
+func TestPetQueryFiltersExpiredDeletedPets(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{queryOutput: &dynamodb.QueryOutput{Items: []data.DynamoItem{}, Count: pointy.Int64(0)}}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+
+	// Execute
+	dao.Query(context.Background(), 1, "")
+	queryInput := dbClient.queryInput
+	dao.GetDeletedTotalCount(context.Background())
+	countInput := dbClient.queryInput
+
+	// Verify
+	assert.Nil(t, queryInput.FilterExpression, "live pets don't expire")
+	assert.Equal(t, "ExpiresAt > :now", *countInput.FilterExpression, "expired deleted pets aren't counted")
+}
+
 func TestPetGetTotalCount(t *testing.T) {
 	// Define test struct
 	type Test struct {
@@ -352,7 +795,7 @@ func TestPetGetTotalCount(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		count, err := dao.GetTotalCount()
+		count, err := dao.GetTotalCount(context.Background())
 
 		// Verify
 		if !test.expectErr {
@@ -364,29 +807,131 @@ func TestPetGetTotalCount(t *testing.T) {
 	}
 }
 
-func TestPetUpdate(t *testing.T) {
+func TestPetQueryByOwner(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name      string
-		dbClient  FakeDynamoDbClient
-		pet       model.Pet
-		expectErr bool
+		name                string
+		dbClient            FakeDynamoDbClient
+		includePrivate      bool
+		count               int
+		exclusiveStartId    string
+		expectedPets        []model.Pet
+		expectedHasNextPage bool
+		expectedBatchGets   int
+		expectErr           bool
+	}
+
+	ownerItems := []data.DynamoItem{
+		{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("petOwner#User1")}, "Owner": {S: jsii.String("User1")}},
+		{"Id": {S: &SamplePet2.Id}, "Sort": {S: jsii.String("petOwner#User1")}, "Owner": {S: jsii.String("User1")}},
+	}
+	privateOwnerItem := data.DynamoItem{"Id": {S: &SamplePet4.Id}, "Sort": {S: jsii.String("petOwner#User1")}, "Owner": {S: jsii.String("User1")}}
+	responses := func(items ...data.DynamoItem) map[string][]map[string]*dynamodb.AttributeValue {
+		return map[string][]map[string]*dynamodb.AttributeValue{SampleTableName: items}
 	}
 
 	// Define tests
 	tests := []Test{
 		{
-			name:      "valid update",
-			dbClient:  FakeDynamoDbClient{},
-			pet:       SamplePet1,
-			expectErr: false,
+			name: "pets in the order they were found",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: ownerItems},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{Responses: responses(SamplePet2Item, SamplePet1Item)},
+				},
+			},
+			count:               2,
+			expectedPets:        []model.Pet{SamplePet1, SamplePet2},
+			expectedHasNextPage: false,
+			expectedBatchGets:   1,
 		},
 		{
-			name: "db put error",
+			name: "unprocessed keys are read again",
 			dbClient: FakeDynamoDbClient{
-				putItemErr: assert.AnError,
+				queryOutput: &dynamodb.QueryOutput{Items: ownerItems, LastEvaluatedKey: ownerItems[1]},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{
+						Responses: responses(SamplePet1Item),
+						UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{
+							SampleTableName: {Keys: []map[string]*dynamodb.AttributeValue{{"Id": {S: &SamplePet2.Id}}}},
+						},
+					},
+					{Responses: responses(SamplePet2Item)},
+				},
 			},
-			pet:       SamplePet1,
+			count:               2,
+			exclusiveStartId:    "some id",
+			expectedPets:        []model.Pet{SamplePet1, SamplePet2},
+			expectedHasNextPage: true,
+			expectedBatchGets:   2,
+		},
+		{
+			name: "pets deleted since they were found are left out",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: ownerItems},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{Responses: responses(SamplePet1Item)},
+				},
+			},
+			count:             2,
+			expectedPets:      []model.Pet{SamplePet1},
+			expectedBatchGets: 1,
+		},
+		{
+			name: "private pets included",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: []data.DynamoItem{ownerItems[0], privateOwnerItem}},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{Responses: responses(SamplePet1Item, SamplePet4Item)},
+				},
+			},
+			includePrivate:    true,
+			count:             2,
+			expectedPets:      []model.Pet{SamplePet1, SamplePet4},
+			expectedBatchGets: 1,
+		},
+		{
+			name: "private pets left out, reading on until the page is full",
+			dbClient: FakeDynamoDbClient{
+				queryOutputs: []*dynamodb.QueryOutput{
+					{Items: []data.DynamoItem{ownerItems[0], privateOwnerItem}, LastEvaluatedKey: privateOwnerItem},
+					{Items: ownerItems[1:]},
+				},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{Responses: responses(SamplePet1Item, SamplePet4Item)},
+					{Responses: responses(SamplePet2Item)},
+				},
+			},
+			includePrivate:    false,
+			count:             2,
+			expectedPets:      []model.Pet{SamplePet1, SamplePet2},
+			expectedBatchGets: 2,
+		},
+		{
+			name: "request 0 items",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: ownerItems[:1]},
+			},
+			count:               0,
+			expectedPets:        []model.Pet{},
+			expectedHasNextPage: true,
+			expectedBatchGets:   0,
+		},
+		{
+			name: "db query error",
+			dbClient: FakeDynamoDbClient{
+				queryErr: assert.AnError,
+			},
+			count:     2,
+			expectErr: true,
+		},
+		{
+			name: "db batch get error",
+			dbClient: FakeDynamoDbClient{
+				queryOutput:     &dynamodb.QueryOutput{Items: ownerItems},
+				batchGetItemErr: assert.AnError,
+			},
+			count:     2,
 			expectErr: true,
 		},
 	}
@@ -397,13 +942,481 @@ func TestPetUpdate(t *testing.T) {
 		dao := data.NewPetDao(&test.dbClient, SampleTableName)
 
 		// Execute
-		err := dao.Update(test.pet)
+		pets, hasNextPage, err := dao.QueryByOwner(context.Background(), "User1", test.includePrivate, test.count, test.exclusiveStartId)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPets, pets, test.name)
+			assert.Equal(t, test.expectedHasNextPage, hasNextPage, test.name)
+			assert.Equal(t, test.expectedBatchGets, len(test.dbClient.batchGetItemInputs), test.name)
+			assert.Equal(t, "owner-gsi", *test.dbClient.queryInput.IndexName, test.name)
+			if test.exclusiveStartId != "" {
+				startKey := test.dbClient.queryInput.ExclusiveStartKey
+				assert.Equal(t, test.exclusiveStartId, *startKey["Id"].S, test.name)
+				assert.Equal(t, "petOwner#User1", *startKey["Sort"].S, test.name)
+				assert.Equal(t, "User1", *startKey["Owner"].S, test.name)
+			}
 		} else {
 			assert.NotNil(t, err, test.name)
 		}
 	}
 }
+
+func TestPetGetTotalCountByOwner(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name           string
+		dbClient       FakeDynamoDbClient
+		includePrivate bool
+		expectedCount  int
+		expectErr      bool
+	}
+
+	ownerItem := func(id string) data.DynamoItem {
+		return data.DynamoItem{"Id": {S: &id}, "Sort": {S: jsii.String("petOwner#User1")}, "Owner": {S: jsii.String("User1")}}
+	}
+	responses := func(items ...data.DynamoItem) map[string][]map[string]*dynamodb.AttributeValue {
+		return map[string][]map[string]*dynamodb.AttributeValue{SampleTableName: items}
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "count owner's pets",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Count: pointy.Int64(2)},
+			},
+			includePrivate: true,
+			expectedCount:  2,
+		},
+		{
+			name: "count owner's pets which aren't private",
+			dbClient: FakeDynamoDbClient{
+				queryOutputs: []*dynamodb.QueryOutput{
+					{Items: []data.DynamoItem{ownerItem(SamplePet1.Id), ownerItem(SamplePet4.Id)}, LastEvaluatedKey: ownerItem(SamplePet4.Id)},
+					{Items: []data.DynamoItem{ownerItem(SamplePet2.Id)}},
+				},
+				batchGetItemOutputs: []*dynamodb.BatchGetItemOutput{
+					{Responses: responses(SamplePet1Item, SamplePet4Item)},
+					{Responses: responses(SamplePet2Item)},
+				},
+			},
+			includePrivate: false,
+			expectedCount:  2,
+		},
+		{
+			name: "db query error",
+			dbClient: FakeDynamoDbClient{
+				queryErr: assert.AnError,
+			},
+			includePrivate: true,
+			expectErr:      true,
+		},
+		{
+			name: "db batch get error",
+			dbClient: FakeDynamoDbClient{
+				queryOutput:     &dynamodb.QueryOutput{Items: []data.DynamoItem{ownerItem(SamplePet1.Id)}},
+				batchGetItemErr: assert.AnError,
+			},
+			includePrivate: false,
+			expectErr:      true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+
+		// Execute
+		count, err := dao.GetTotalCountByOwner(context.Background(), "User1", test.includePrivate)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedCount, count, test.name)
+			assert.Equal(t, "owner-gsi", *test.dbClient.queryInput.IndexName, test.name)
+			assert.Equal(t, "User1", *test.dbClient.queryInput.ExpressionAttributeValues[":owner"].S, test.name)
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+	}
+}
+
+func TestPetPatch(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		dbClient           FakeDynamoDbClient
+		expectedVersion    int
+		patch              model.PetPatch
+		expectedPet        model.Pet
+		expectedExpression string
+		expectedCondition  string
+		expectedOwnerItems []string // the owner index items written, as "put" or "delete" and their sort keys
+		expectErr          bool
+		expectedErrCode    apperror.Code
+	}
+
+	changed := func(pet model.Pet, version int) model.Pet {
+		pet.Version = version
+		pet.ChangedBy = "User1"
+		return pet
+	}
+	canceled := &dynamodb.TransactionCanceledException{
+		CancellationReasons: []*dynamodb.CancellationReason{{Code: jsii.String("ConditionalCheckFailed")}, {Code: jsii.String("None")}},
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "patch name and age",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion:    2,
+			patch:              model.PetPatch{Name: &SamplePet2.Name, Age: pointy.Int(11)},
+			expectedPet:        changed(model.Pet{Id: SamplePet1.Id, Name: SamplePet2.Name, Age: 11, Owners: []string{"User1", "User3"}}, 3),
+			expectedExpression: "SET #name = :name, #age = :age, #version = :version, #changedBy = :changedBy, #changedAt = :changedAt",
+			expectedCondition:  "attribute_exists(Id) AND #version = :expectedVersion",
+			expectErr:          false,
+		},
+		{
+			name: "patch private",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion:    2,
+			patch:              model.PetPatch{Private: jsii.Bool(true)},
+			expectedPet:        changed(model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, Age: 10, Owners: []string{"User1", "User3"}, Private: true}, 3),
+			expectedExpression: "SET #private = :private, #version = :version, #changedBy = :changedBy, #changedAt = :changedAt",
+			expectedCondition:  "attribute_exists(Id) AND #version = :expectedVersion",
+			expectErr:          false,
+		},
+		{
+			name: "patch owners",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet2Item},
+			},
+			expectedVersion:    0,
+			patch:              model.PetPatch{Owners: &[]string{"User3", "User2"}},
+			expectedPet:        changed(model.Pet{Id: SamplePet2.Id, Name: SamplePet2.Name, Age: 92, Owners: []string{"User2", "User3"}}, 1),
+			expectedExpression: "SET #owners = :owners, #version = :version, #changedBy = :changedBy, #changedAt = :changedAt REMOVE #owner",
+			expectedCondition:  "attribute_exists(Id) AND attribute_not_exists(#version)",
+			expectedOwnerItems: []string{"put petOwner#User2", "put petOwner#User3"},
+			expectErr:          false,
+		},
+		{
+			name: "patch out an owner",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion:    2,
+			patch:              model.PetPatch{Owners: &[]string{"User3"}},
+			expectedPet:        changed(model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, Age: 10, Owners: []string{"User3"}}, 3),
+			expectedExpression: "SET #owners = :owners, #version = :version, #changedBy = :changedBy, #changedAt = :changedAt REMOVE #owner",
+			expectedCondition:  "attribute_exists(Id) AND #version = :expectedVersion",
+			expectedOwnerItems: []string{"delete petOwner#User1", "put petOwner#User3"},
+			expectErr:          false,
+		},
+		{
+			name: "patch owners to none",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet3Item},
+			},
+			expectedVersion:    1,
+			patch:              model.PetPatch{Owners: &[]string{}},
+			expectedPet:        changed(SamplePet3.WithAgeOn(time.Now()), 2),
+			expectedExpression: "SET #version = :version, #changedBy = :changedBy, #changedAt = :changedAt REMOVE #owners, #owner",
+			expectedCondition:  "attribute_exists(Id) AND #version = :expectedVersion",
+			expectErr:          false,
+		},
+		{
+			name: "empty patch gets the pet",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion: 2,
+			patch:           model.PetPatch{},
+			expectedPet:     SamplePet1,
+			expectErr:       false,
+		},
+		{
+			name: "empty patch of a changed pet",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion: 1,
+			patch:           model.PetPatch{},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name: "db get error",
+			dbClient: FakeDynamoDbClient{
+				getItemErr: assert.AnError,
+			},
+			patch:           model.PetPatch{Age: pointy.Int(1)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "pet not found",
+			dbClient:        FakeDynamoDbClient{},
+			patch:           model.PetPatch{Age: pointy.Int(1)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "pet not at expected version",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+			},
+			expectedVersion: 1,
+			patch:           model.PetPatch{Age: pointy.Int(1)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name: "db transaction error",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				transactErr:   assert.AnError,
+			},
+			expectedVersion: 2,
+			patch:           model.PetPatch{Age: pointy.Int(1)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "pet changed since it was read",
+			dbClient: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SamplePet1Item},
+				transactErr:   canceled,
+			},
+			expectedVersion: 2,
+			patch:           model.PetPatch{Age: pointy.Int(1)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+
+		// Execute
+		pet, err := dao.Patch(context.Background(), SamplePet1.Id, test.expectedVersion, test.patch, "User1")
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			if test.expectedExpression != "" {
+				assert.NotEmpty(t, pet.ChangedAt, test.name)
+				pet.ChangedAt = ""
+			}
+			assert.Equal(t, test.expectedPet, pet, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedExpression != "" {
+			items := test.dbClient.transactInput.TransactItems
+			assert.Equal(t, test.expectedExpression, *items[0].Update.UpdateExpression, test.name)
+			assert.Equal(t, test.expectedCondition, *items[0].Update.ConditionExpression, test.name)
+			snapshot := items[1].Put.Item
+			assert.Equal(t, "pet#v"+fmt.Sprintf("%010d", test.expectedPet.Version), *snapshot["Sort"].S, test.name)
+			ownerItems := []string{}
+			for _, item := range items[2:] {
+				if item.Delete != nil {
+					ownerItems = append(ownerItems, "delete "+*item.Delete.Key["Sort"].S)
+				} else {
+					ownerItems = append(ownerItems, "put "+*item.Put.Item["Sort"].S)
+				}
+			}
+			assert.ElementsMatch(t, test.expectedOwnerItems, ownerItems, test.name)
+			assert.Equal(t, "User1", *snapshot["ChangedBy"].S, test.name)
+			assert.Equal(t, *items[0].Update.ExpressionAttributeValues[":changedAt"].S, *snapshot["ChangedAt"].S, test.name)
+		}
+	}
+}
+
+func TestPetGetAsOf(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		dbClient        FakeDynamoDbClient
+		expectedPet     model.Pet
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	deletedItem := data.DynamoItem{}
+	for name, value := range SamplePet1Item {
+		deletedItem[name] = value
+	}
+	deletedItem["DeletedAt"] = &dynamodb.AttributeValue{S: jsii.String("2022-01-01T00:00:00Z")}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "version found",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: []data.DynamoItem{SamplePet1Item}},
+			},
+			expectedPet: SamplePet1,
+		},
+		{
+			name: "no version at the time",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{},
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "pet deleted at the time",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: []data.DynamoItem{deletedItem}},
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "db query error",
+			dbClient: FakeDynamoDbClient{
+				queryErr: assert.AnError,
+			},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+		asOf := time.Date(2022, 6, 1, 12, 0, 0, 0, time.FixedZone("", 2*60*60))
+
+		// Execute
+		pet, err := dao.GetAsOf(context.Background(), SamplePet1.Id, asOf)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPet, pet, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		input := test.dbClient.queryInput
+		assert.Equal(t, "2022-06-01T10:00:00Z", *input.ExpressionAttributeValues[":asOf"].S, test.name+": compared in UTC")
+		assert.False(t, *input.ScanIndexForward, test.name+": newest first")
+	}
+}
+
+func TestPetQueryHistory(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                  string
+		dbClient              FakeDynamoDbClient
+		count                 int
+		exclusiveStartVersion int
+		expectedStartKey      data.DynamoItem
+		expectedPets          []model.Pet
+		expectedHasNextPage   bool
+		expectErr             bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "first page",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{
+					Items:            []data.DynamoItem{SamplePet1Item},
+					LastEvaluatedKey: data.DynamoItem{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("pet#v0000000002")}},
+				},
+			},
+			count:               1,
+			expectedPets:        []model.Pet{SamplePet1},
+			expectedHasNextPage: true,
+		},
+		{
+			name: "after a version",
+			dbClient: FakeDynamoDbClient{
+				queryOutput: &dynamodb.QueryOutput{Items: []data.DynamoItem{SamplePet1Item}},
+			},
+			count:                 10,
+			exclusiveStartVersion: 3,
+			expectedStartKey:      data.DynamoItem{"Id": {S: &SamplePet1.Id}, "Sort": {S: jsii.String("pet#v0000000003")}},
+			expectedPets:          []model.Pet{SamplePet1},
+			expectedHasNextPage:   false,
+		},
+		{
+			name: "db query error",
+			dbClient: FakeDynamoDbClient{
+				queryErr: assert.AnError,
+			},
+			count:     1,
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetDao(&test.dbClient, SampleTableName)
+
+		// Execute
+		pets, hasNextPage, err := dao.QueryHistory(context.Background(), SamplePet1.Id, test.count, test.exclusiveStartVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPets, pets, test.name)
+			assert.Equal(t, test.expectedHasNextPage, hasNextPage, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(err), test.name)
+		}
+		input := test.dbClient.queryInput
+		assert.Equal(t, test.expectedStartKey, input.ExclusiveStartKey, test.name)
+		assert.Equal(t, "pet#v", *input.ExpressionAttributeValues[":snapshot"].S, test.name)
+		assert.False(t, *input.ScanIndexForward, test.name+": newest first")
+	}
+}
+
+func TestPetGetHistoryCount(t *testing.T) {
+	// Setup
+	dbClient := FakeDynamoDbClient{queryOutput: &dynamodb.QueryOutput{Count: pointy.Int64(4)}}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+	errClient := FakeDynamoDbClient{queryErr: assert.AnError}
+	errDao := data.NewPetDao(&errClient, SampleTableName)
+
+	// Execute
+	count, err := dao.GetHistoryCount(context.Background(), SamplePet1.Id)
+	_, queryErr := errDao.GetHistoryCount(context.Background(), SamplePet1.Id)
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, dynamodb.SelectCount, *dbClient.queryInput.Select)
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(queryErr))
+}
+
+func TestPetDaoRecordsCalls(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	ctx := metrics.NewContext(context.Background(), metrics.NewRecorder(&capture, metrics.Namespace, nil).With(metrics.Dimensions{"Field": "Query.pet"}))
+	dbClient := FakeDynamoDbClient{getItemErr: assert.AnError}
+	dao := data.NewPetDao(&dbClient, SampleTableName)
+
+	// Execute
+	dao.GetById(ctx, SamplePet1.Id)
+
+	// Verify
+	records := capture.Find("Calls")
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, metrics.Dimensions{"Field": "Query.pet", "Operation": "DynamoDB.GetItem"}, records[0].Dimensions)
+	assert.Equal(t, float64(1), records[0].Values["CallErrors"])
+}
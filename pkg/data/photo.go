@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
+)
+
+type S3Client interface {
+	DeleteObjectsWithContext(aws.Context, *s3.DeleteObjectsInput, ...request.Option) (*s3.DeleteObjectsOutput, error)
+	GetObjectRequest(*s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+	ListObjectsV2WithContext(aws.Context, *s3.ListObjectsV2Input, ...request.Option) (*s3.ListObjectsV2Output, error)
+	PutObjectRequest(*s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput)
+}
+
+// Object containing information needed to access stored photos
+type PhotoDao struct {
+	client     S3Client
+	bucketName string
+}
+
+// Creates a photo data store access object
+func NewPhotoDao(client S3Client, bucketName string) PhotoDao {
+	return PhotoDao{
+		client:     client,
+		bucketName: bucketName,
+	}
+}
+
+// Lists the keys of every photo stored under a prefix, in key order
+func (p *PhotoDao) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	var continuationToken *string
+	for {
+		start := time.Now()
+		ret, err := p.client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &p.bucketName,
+			Prefix:            &prefix,
+			ContinuationToken: continuationToken,
+		})
+		metrics.FromContext(ctx).RecordCall("S3.ListObjectsV2", start, err)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("s3 list objects failed", err, logging.Fields{"prefix": prefix})
+			return nil, apperror.NewInternal("error listing photos", err)
+		}
+
+		for _, object := range ret.Contents {
+			keys = append(keys, *object.Key)
+		}
+
+		if ret.NextContinuationToken == nil {
+			return keys, nil
+		}
+		continuationToken = ret.NextContinuationToken
+	}
+}
+
+// Deletes every photo stored under a prefix; each page of keys listed (at most 1000, as many as S3 deletes at once) is
+// deleted before the next is listed
+func (p *PhotoDao) DeleteByPrefix(ctx context.Context, prefix string) error {
+	var continuationToken *string
+	for {
+		start := time.Now()
+		ret, err := p.client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &p.bucketName,
+			Prefix:            &prefix,
+			ContinuationToken: continuationToken,
+		})
+		metrics.FromContext(ctx).RecordCall("S3.ListObjectsV2", start, err)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("s3 list objects failed", err, logging.Fields{"prefix": prefix})
+			return apperror.NewInternal("error deleting photos", err)
+		}
+
+		if len(ret.Contents) > 0 {
+			objects := []*s3.ObjectIdentifier{}
+			for _, object := range ret.Contents {
+				objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+			}
+			start = time.Now()
+			deleted, err := p.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket: &p.bucketName,
+				Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			metrics.FromContext(ctx).RecordCall("S3.DeleteObjects", start, err)
+
+			// Objects S3 couldn't delete are reported in the output rather than failing the request
+			if err == nil && len(deleted.Errors) > 0 {
+				err = errors.New(aws.StringValue(deleted.Errors[0].Code) + ": " + aws.StringValue(deleted.Errors[0].Message))
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("s3 delete objects failed", err, logging.Fields{"prefix": prefix})
+				return apperror.NewInternal("error deleting photos", err)
+			}
+		}
+
+		if ret.NextContinuationToken == nil {
+			return nil
+		}
+		continuationToken = ret.NextContinuationToken
+	}
+}
+
+// Creates a URL which the photo can be downloaded from until it expires; presigning happens offline (no AWS call)
+func (p *PhotoDao) PresignDownload(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	req, _ := p.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: &p.bucketName,
+		Key:    &key,
+	})
+	return p.presign(ctx, req, key, expiry)
+}
+
+// Creates a URL which the photo can be uploaded to (with an HTTP PUT) until it expires; the content type and length are
+// signed, so S3 rejects uploads of any other type or size. Presigning happens offline (no AWS call)
+func (p *PhotoDao) PresignUpload(ctx context.Context, key string, contentType string, contentLength int64, expiry time.Duration) (string, error) {
+	req, _ := p.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        &p.bucketName,
+		Key:           &key,
+		ContentType:   &contentType,
+		ContentLength: &contentLength,
+	})
+	return p.presign(ctx, req, key, expiry)
+}
+
+func (p *PhotoDao) presign(ctx context.Context, req *request.Request, key string, expiry time.Duration) (string, error) {
+	url, err := req.Presign(expiry)
+	if err != nil {
+		logging.FromContext(ctx).Error("s3 presign failed", err, logging.Fields{"key": key})
+		return "", apperror.NewInternal("error creating photo URL", err)
+	}
+	return url, nil
+}
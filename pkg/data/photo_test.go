@@ -0,0 +1,193 @@
+package data_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotoListKeys(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name              string
+		listOutputs       []*s3.ListObjectsV2Output
+		listErr           error
+		expectedKeys      []string
+		expectedListCalls int
+		expectErr         bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:              "no photos",
+			listOutputs:       []*s3.ListObjectsV2Output{{}},
+			expectedKeys:      []string{},
+			expectedListCalls: 1,
+			expectErr:         false,
+		},
+		{
+			name: "photos over several pages",
+			listOutputs: []*s3.ListObjectsV2Output{
+				{Contents: []*s3.Object{{Key: jsii.String("prefix/1")}, {Key: jsii.String("prefix/2")}}, NextContinuationToken: jsii.String("token")},
+				{Contents: []*s3.Object{{Key: jsii.String("prefix/3")}}},
+			},
+			expectedKeys:      []string{"prefix/1", "prefix/2", "prefix/3"},
+			expectedListCalls: 2,
+			expectErr:         false,
+		},
+		{
+			name:              "s3 list error",
+			listErr:           assert.AnError,
+			expectedListCalls: 1,
+			expectErr:         true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		client := NewFakeS3Client()
+		client.listObjectsOutputs = test.listOutputs
+		client.listObjectsErr = test.listErr
+		dao := data.NewPhotoDao(&client, SampleBucketName)
+
+		// Execute
+		keys, err := dao.ListKeys(context.Background(), "prefix/")
+
+		// Verify
+		assert.Equal(t, test.expectedListCalls, len(client.listObjectsInputs), test.name)
+		assert.Equal(t, "prefix/", *client.listObjectsInputs[0].Prefix, test.name)
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedKeys, keys, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedListCalls > 1 {
+			assert.Equal(t, "token", *client.listObjectsInputs[1].ContinuationToken, test.name)
+		}
+	}
+}
+
+func TestPhotoDeleteByPrefix(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                string
+		listOutputs         []*s3.ListObjectsV2Output
+		listErr             error
+		deleteOutput        *s3.DeleteObjectsOutput
+		deleteErr           error
+		expectedDeletedKeys [][]string // of each delete
+		expectedListCalls   int
+		expectErr           bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:                "no photos",
+			listOutputs:         []*s3.ListObjectsV2Output{{}},
+			expectedDeletedKeys: [][]string{},
+			expectedListCalls:   1,
+		},
+		{
+			name: "photos over several pages",
+			listOutputs: []*s3.ListObjectsV2Output{
+				{Contents: []*s3.Object{{Key: jsii.String("prefix/1")}, {Key: jsii.String("prefix/2")}}, NextContinuationToken: jsii.String("token")},
+				{Contents: []*s3.Object{{Key: jsii.String("prefix/3")}}},
+			},
+			expectedDeletedKeys: [][]string{{"prefix/1", "prefix/2"}, {"prefix/3"}},
+			expectedListCalls:   2,
+		},
+		{
+			name:                "s3 list error",
+			listErr:             assert.AnError,
+			expectedDeletedKeys: [][]string{},
+			expectedListCalls:   1,
+			expectErr:           true,
+		},
+		{
+			name:                "s3 delete error",
+			listOutputs:         []*s3.ListObjectsV2Output{{Contents: []*s3.Object{{Key: jsii.String("prefix/1")}}}},
+			deleteErr:           assert.AnError,
+			expectedDeletedKeys: [][]string{{"prefix/1"}},
+			expectedListCalls:   1,
+			expectErr:           true,
+		},
+		{
+			name:                "photo s3 couldn't delete",
+			listOutputs:         []*s3.ListObjectsV2Output{{Contents: []*s3.Object{{Key: jsii.String("prefix/1")}}}},
+			deleteOutput:        &s3.DeleteObjectsOutput{Errors: []*s3.Error{{Key: jsii.String("prefix/1"), Code: jsii.String("AccessDenied")}}},
+			expectedDeletedKeys: [][]string{{"prefix/1"}},
+			expectedListCalls:   1,
+			expectErr:           true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		client := NewFakeS3Client()
+		client.listObjectsOutputs = test.listOutputs
+		client.listObjectsErr = test.listErr
+		client.deleteOutput = test.deleteOutput
+		client.deleteErr = test.deleteErr
+		dao := data.NewPhotoDao(&client, SampleBucketName)
+
+		// Execute
+		err := dao.DeleteByPrefix(context.Background(), "prefix/")
+
+		// Verify
+		assert.Equal(t, test.expectedListCalls, len(client.listObjectsInputs), test.name)
+		assert.Equal(t, "prefix/", *client.listObjectsInputs[0].Prefix, test.name)
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(err), test.name)
+		}
+		deletedKeys := [][]string{}
+		for _, input := range client.deleteInputs {
+			assert.Equal(t, SampleBucketName, *input.Bucket, test.name)
+			keys := []string{}
+			for _, object := range input.Delete.Objects {
+				keys = append(keys, *object.Key)
+			}
+			deletedKeys = append(deletedKeys, keys)
+		}
+		assert.Equal(t, test.expectedDeletedKeys, deletedKeys, test.name)
+	}
+}
+
+func TestPhotoPresign(t *testing.T) {
+	// Setup
+	client := NewFakeS3Client()
+	dao := data.NewPhotoDao(&client, SampleBucketName)
+	ctx := context.Background()
+
+	// Execute
+	downloadUrl, downloadErr := dao.PresignDownload(ctx, "pets/1/photos/a", time.Hour)
+	uploadUrl, uploadErr := dao.PresignUpload(ctx, "pets/1/photos/b", "image/png", 1024, 15*time.Minute)
+
+	// Verify
+	assert.Nil(t, downloadErr)
+	assert.Nil(t, uploadErr)
+	download, _ := url.Parse(downloadUrl)
+	assert.Equal(t, "bucket.s3.amazonaws.com", download.Host)
+	assert.Equal(t, "/pets/1/photos/a", download.Path)
+	assert.Equal(t, "3600", download.Query().Get("X-Amz-Expires"))
+	assert.NotEmpty(t, download.Query().Get("X-Amz-Signature"))
+	upload, _ := url.Parse(uploadUrl)
+	assert.Equal(t, "bucket.s3.amazonaws.com", upload.Host)
+	assert.Equal(t, "/pets/1/photos/b", upload.Path)
+	assert.Equal(t, "900", upload.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "content-length;content-type;host", upload.Query().Get("X-Amz-SignedHeaders"), "the content type and length are signed")
+	assert.NotEmpty(t, upload.Query().Get("X-Amz-Signature"))
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Object containing information needed to access pending pet transfers; they share the primary table with pets
+type PetTransferDao struct {
+	client    DynamoDbClient
+	tableName string
+}
+
+// Creates a pet transfer data store access object
+func NewPetTransferDao(client DynamoDbClient, tableName string) PetTransferDao {
+	return PetTransferDao{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Deletes the pending transfer of a pet, along with its copies under the sender and recipient
+func (p *PetTransferDao) Delete(ctx context.Context, petId string) error {
+	transfer, err := p.GetByPetId(ctx, petId)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return apperror.NewNotFound("could not delete pet transfer; pet transfer not found", err)
+	} else if err != nil {
+		return err
+	}
+
+	// The transfer is only deleted if it is still the one read, so copies of a newer transfer aren't left behind
+	items := []*dynamodb.TransactWriteItem{{Delete: &dynamodb.Delete{
+		TableName:           &p.tableName,
+		Key:                 transferKey(petId),
+		ConditionExpression: jsii.String("Sender = :sender AND Recipient = :recipient"),
+		ExpressionAttributeValues: DynamoItem{
+			":sender":    {S: jsii.String(transfer.Sender)},
+			":recipient": {S: jsii.String(transfer.Recipient)},
+		},
+	}}}
+	for _, sortLabel := range transferUserSortLabels(transfer) {
+		items = append(items, &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+			TableName: &p.tableName,
+			Key:       petKey(petId, sortLabel),
+		}})
+	}
+	err = p.transact(ctx, petId, items)
+
+	if isConditionFailure(err) {
+		return apperror.NewNotFound("could not delete pet transfer; pet transfer not found", err)
+	} else if err != nil {
+		return apperror.NewInternal("error deleting pet transfer", err)
+	}
+
+	return nil
+}
+
+// Gets the pending transfer of a pet
+func (p *PetTransferDao) GetByPetId(ctx context.Context, petId string) (model.PetTransfer, error) {
+	start := time.Now()
+	ret, err := p.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: &p.tableName,
+		Key:       transferKey(petId),
+	})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.GetItem", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb get item failed", err, logging.Fields{"petId": petId})
+		return model.PetTransfer{}, apperror.NewInternal("error retrieving pet transfer", err)
+	} else if ret == nil || ret.Item == nil {
+		return model.PetTransfer{}, apperror.NewNotFound("pet transfer not found", nil)
+	}
+
+	return convertItemToTransfer(ret.Item), nil
+}
+
+// Inserts the pending transfer of a pet, along with its copies under the sender and recipient; fails with a conflict if
+// the pet already has one
+func (p *PetTransferDao) Insert(ctx context.Context, transfer model.PetTransfer) error {
+	items := []*dynamodb.TransactWriteItem{{Put: &dynamodb.Put{
+		TableName:           &p.tableName,
+		Item:                convertTransferToItem(transfer),
+		ConditionExpression: jsii.String("attribute_not_exists(Id)"),
+	}}}
+	for _, sortLabel := range transferUserSortLabels(transfer) {
+		item := convertTransferToItem(transfer)
+		item["Sort"] = &dynamodb.AttributeValue{S: jsii.String(sortLabel)}
+		items = append(items, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName: &p.tableName,
+			Item:      item,
+		}})
+	}
+	err := p.transact(ctx, transfer.PetId, items)
+
+	if isConditionFailure(err) {
+		return apperror.NewConflict("pet already has a pending transfer", err)
+	} else if err != nil {
+		return apperror.NewInternal("error adding pet transfer", err)
+	}
+
+	return nil
+}
+
+// Gets every pending transfer a user sent or received; each is read from its copy under the user, which the sort key
+// index is keyed on
+func (p *PetTransferDao) QueryByUser(ctx context.Context, username string) ([]model.PetTransfer, error) {
+	transfers := []model.PetTransfer{}
+	found := map[string]bool{}
+	for _, sortLabel := range []string{petTransferSenderSortPrefix + username, petTransferRecipientSortPrefix + username} {
+		var exclusiveStartKey DynamoItem
+		for {
+			start := time.Now()
+			ret, err := p.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+				TableName:              &p.tableName,
+				IndexName:              jsii.String("sort-key-gsi"),
+				KeyConditionExpression: jsii.String("Sort = :sortVal"),
+				ExpressionAttributeValues: DynamoItem{
+					":sortVal": {S: jsii.String(sortLabel)},
+				},
+				ExclusiveStartKey: exclusiveStartKey,
+			})
+			metrics.FromContext(ctx).RecordCall("DynamoDB.Query", start, err)
+
+			if err != nil {
+				logging.FromContext(ctx).Error("dynamodb query failed", err, logging.Fields{"username": username})
+				return []model.PetTransfer{}, apperror.NewInternal("error retrieving pet transfers", err)
+			}
+
+			// A transfer a user sent themselves is under them twice
+			for _, item := range ret.Items {
+				if transfer := convertItemToTransfer(item); !found[transfer.PetId] {
+					found[transfer.PetId] = true
+					transfers = append(transfers, transfer)
+				}
+			}
+
+			if len(ret.LastEvaluatedKey) == 0 {
+				break
+			}
+			exclusiveStartKey = ret.LastEvaluatedKey
+		}
+	}
+
+	return transfers, nil
+}
+
+// Writes the items of a transaction affecting the transfer of the pet with the ID
+func (p *PetTransferDao) transact(ctx context.Context, petId string, items []*dynamodb.TransactWriteItem) error {
+	start := time.Now()
+	_, err := p.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	metrics.FromContext(ctx).RecordCall("DynamoDB.TransactWriteItems", start, err)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("dynamodb transact write items failed", err, logging.Fields{"petId": petId})
+	}
+	return err
+}
+
+// Sort labels of the copies of a transfer stored under its sender and recipient
+func transferUserSortLabels(transfer model.PetTransfer) []string {
+	return []string{
+		petTransferSenderSortPrefix + transfer.Sender,
+		petTransferRecipientSortPrefix + transfer.Recipient,
+	}
+}
+
+func transferKey(petId string) DynamoItem {
+	return DynamoItem{
+		"Id":   {S: jsii.String(petId)},
+		"Sort": {S: jsii.String(petTransferSortLabel)},
+	}
+}
+
+func convertItemToTransfer(item DynamoItem) model.PetTransfer {
+	transfer := model.PetTransfer{
+		PetId:       *item["Id"].S,
+		Sender:      *item["Sender"].S,
+		Recipient:   *item["Recipient"].S,
+		RequestedAt: *item["RequestedAt"].S,
+	}
+	if item["ReplacesOwners"] != nil {
+		transfer.ReplacesOwners = *item["ReplacesOwners"].BOOL
+	}
+	if item["AddsOwner"] != nil {
+		transfer.AddsOwner = *item["AddsOwner"].BOOL
+	}
+	return transfer
+}
+
+// Only transfers which replace every owner store ReplacesOwners, and only those which add an owner store AddsOwner
+func convertTransferToItem(transfer model.PetTransfer) DynamoItem {
+	item := DynamoItem{
+		"Id":          {S: jsii.String(transfer.PetId)},
+		"Sort":        {S: jsii.String(petTransferSortLabel)},
+		"Sender":      {S: jsii.String(transfer.Sender)},
+		"Recipient":   {S: jsii.String(transfer.Recipient)},
+		"RequestedAt": {S: jsii.String(transfer.RequestedAt)},
+	}
+	if transfer.ReplacesOwners {
+		item["ReplacesOwners"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	if transfer.AddsOwner {
+		item["AddsOwner"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	return item
+}
@@ -0,0 +1,323 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleTransfer = model.PetTransfer{
+		PetId:       "1",
+		Sender:      "User 1",
+		Recipient:   "User 2",
+		RequestedAt: "2022-01-01T00:00:00Z",
+	}
+	SampleTransferItem = data.DynamoItem{
+		"Id":          {S: jsii.String(SampleTransfer.PetId)},
+		"Sort":        {S: jsii.String("petTransfer")},
+		"Sender":      {S: jsii.String(SampleTransfer.Sender)},
+		"Recipient":   {S: jsii.String(SampleTransfer.Recipient)},
+		"RequestedAt": {S: jsii.String(SampleTransfer.RequestedAt)},
+	}
+	SampleReplacingTransfer = model.PetTransfer{
+		PetId:          "2",
+		Sender:         "Shelter Staff",
+		Recipient:      "User 2",
+		RequestedAt:    "2022-01-02T00:00:00Z",
+		ReplacesOwners: true,
+	}
+	// Only transfers which replace every owner store ReplacesOwners
+	SampleReplacingTransferItem = data.DynamoItem{
+		"Id":             {S: jsii.String(SampleReplacingTransfer.PetId)},
+		"Sort":           {S: jsii.String("petTransfer")},
+		"Sender":         {S: jsii.String(SampleReplacingTransfer.Sender)},
+		"Recipient":      {S: jsii.String(SampleReplacingTransfer.Recipient)},
+		"RequestedAt":    {S: jsii.String(SampleReplacingTransfer.RequestedAt)},
+		"ReplacesOwners": {BOOL: jsii.Bool(true)},
+	}
+	SampleAddingTransfer = model.PetTransfer{
+		PetId:       "3",
+		Sender:      "User 1",
+		Recipient:   "User 3",
+		RequestedAt: "2022-01-03T00:00:00Z",
+		AddsOwner:   true,
+	}
+	SampleAddingTransferItem = data.DynamoItem{
+		"Id":          {S: jsii.String(SampleAddingTransfer.PetId)},
+		"Sort":        {S: jsii.String("petTransfer")},
+		"Sender":      {S: jsii.String(SampleAddingTransfer.Sender)},
+		"Recipient":   {S: jsii.String(SampleAddingTransfer.Recipient)},
+		"RequestedAt": {S: jsii.String(SampleAddingTransfer.RequestedAt)},
+		"AddsOwner":   {BOOL: jsii.Bool(true)},
+	}
+)
+
+func TestPetTransferDelete(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name            string
+		client          FakeDynamoDbClient
+		expectDeletes   bool
+		expectedErrCode apperror.Code
+	}{
+		{
+			name:          "valid delete",
+			client:        FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{Item: SampleTransferItem}},
+			expectDeletes: true,
+		},
+		{
+			name:            "transfer not found",
+			client:          FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{}},
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name: "transfer changed since it was read",
+			client: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SampleTransferItem},
+				transactErr:   &dynamodb.TransactionCanceledException{CancellationReasons: []*dynamodb.CancellationReason{{Code: jsii.String("ConditionalCheckFailed")}}},
+			},
+			expectDeletes:   true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "dynamodb get error",
+			client:          FakeDynamoDbClient{getItemErr: assert.AnError},
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "dynamodb transact error",
+			client: FakeDynamoDbClient{
+				getItemOutput: &dynamodb.GetItemOutput{Item: SampleTransferItem},
+				transactErr:   assert.AnError,
+			},
+			expectDeletes:   true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetTransferDao(&test.client, SampleTableName)
+
+		// Execute
+		err := dao.Delete(context.Background(), SampleTransfer.PetId)
+
+		// Verify
+		if test.expectedErrCode == "" {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectDeletes {
+			sorts := []string{}
+			for _, item := range test.client.transactInput.TransactItems {
+				sorts = append(sorts, *item.Delete.Key["Sort"].S)
+			}
+			assert.Equal(t, []string{"petTransfer", "petTransfer#sender#User 1", "petTransfer#recipient#User 2"}, sorts, test.name)
+			assert.Equal(t, "User 1", *test.client.transactInput.TransactItems[0].Delete.ExpressionAttributeValues[":sender"].S, test.name)
+		} else {
+			assert.Nil(t, test.client.transactInput, test.name)
+		}
+	}
+}
+
+func TestPetTransferGetByPetId(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name             string
+		client           FakeDynamoDbClient
+		expectedTransfer model.PetTransfer
+		expectedErrCode  apperror.Code
+	}{
+		{
+			name:             "transfer found",
+			client:           FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{Item: SampleTransferItem}},
+			expectedTransfer: SampleTransfer,
+		},
+		{
+			name:             "transfer replacing every owner found",
+			client:           FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{Item: SampleReplacingTransferItem}},
+			expectedTransfer: SampleReplacingTransfer,
+		},
+		{
+			name:             "transfer adding an owner found",
+			client:           FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{Item: SampleAddingTransferItem}},
+			expectedTransfer: SampleAddingTransfer,
+		},
+		{
+			name:            "transfer not found",
+			client:          FakeDynamoDbClient{getItemOutput: &dynamodb.GetItemOutput{}},
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "dynamodb get error",
+			client:          FakeDynamoDbClient{getItemErr: assert.AnError},
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetTransferDao(&test.client, SampleTableName)
+
+		// Execute
+		transfer, err := dao.GetByPetId(context.Background(), SampleTransfer.PetId)
+
+		// Verify
+		if test.expectedErrCode == "" {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedTransfer, transfer, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetTransferInsert(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name            string
+		client          FakeDynamoDbClient
+		transfer        model.PetTransfer
+		expectedItem    data.DynamoItem
+		expectedErrCode apperror.Code
+	}{
+		{
+			name:         "valid insert",
+			client:       FakeDynamoDbClient{},
+			transfer:     SampleTransfer,
+			expectedItem: SampleTransferItem,
+		},
+		{
+			name:         "transfer replacing every owner",
+			client:       FakeDynamoDbClient{},
+			transfer:     SampleReplacingTransfer,
+			expectedItem: SampleReplacingTransferItem,
+		},
+		{
+			name:         "transfer adding an owner",
+			client:       FakeDynamoDbClient{},
+			transfer:     SampleAddingTransfer,
+			expectedItem: SampleAddingTransferItem,
+		},
+		{
+			name:            "pet already has a pending transfer",
+			client:          FakeDynamoDbClient{transactErr: &dynamodb.TransactionCanceledException{CancellationReasons: []*dynamodb.CancellationReason{{Code: jsii.String("ConditionalCheckFailed")}}}},
+			transfer:        SampleTransfer,
+			expectedItem:    SampleTransferItem,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "dynamodb put error",
+			client:          FakeDynamoDbClient{transactErr: assert.AnError},
+			transfer:        SampleTransfer,
+			expectedItem:    SampleTransferItem,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetTransferDao(&test.client, SampleTableName)
+
+		// Execute
+		err := dao.Insert(context.Background(), test.transfer)
+
+		// Verify
+		items := test.client.transactInput.TransactItems
+		assert.Equal(t, 3, len(items), test.name)
+		assert.Equal(t, test.expectedItem, items[0].Put.Item, test.name)
+		assert.Equal(t, "attribute_not_exists(Id)", *items[0].Put.ConditionExpression, test.name)
+		for i, sort := range []string{"petTransfer#sender#" + test.transfer.Sender, "petTransfer#recipient#" + test.transfer.Recipient} {
+			copied := data.DynamoItem{}
+			for name, value := range test.expectedItem {
+				copied[name] = value
+			}
+			copied["Sort"] = &dynamodb.AttributeValue{S: jsii.String(sort)}
+			assert.Equal(t, copied, items[i+1].Put.Item, test.name)
+		}
+		if test.expectedErrCode == "" {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetTransferQueryByUser(t *testing.T) {
+	// Define tests
+	tests := []struct {
+		name              string
+		client            FakeDynamoDbClient
+		expectedTransfers []model.PetTransfer
+		expectedSorts     []string // of each query
+		expectErr         bool
+	}{
+		{
+			name: "transfers sent and received",
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleTransferItem}, LastEvaluatedKey: SampleTransferItem},
+				{Items: []data.DynamoItem{SampleAddingTransferItem}},
+				{Items: []data.DynamoItem{SampleReplacingTransferItem}},
+			}},
+			expectedTransfers: []model.PetTransfer{SampleTransfer, SampleAddingTransfer, SampleReplacingTransfer},
+			expectedSorts:     []string{"petTransfer#sender#User 1", "petTransfer#sender#User 1", "petTransfer#recipient#User 1"},
+		},
+		{
+			name: "transfer sent to themselves",
+			client: FakeDynamoDbClient{queryOutputs: []*dynamodb.QueryOutput{
+				{Items: []data.DynamoItem{SampleTransferItem}},
+				{Items: []data.DynamoItem{SampleTransferItem}},
+			}},
+			expectedTransfers: []model.PetTransfer{SampleTransfer},
+			expectedSorts:     []string{"petTransfer#sender#User 1", "petTransfer#recipient#User 1"},
+		},
+		{
+			name:              "no transfers",
+			client:            FakeDynamoDbClient{queryOutput: &dynamodb.QueryOutput{}},
+			expectedTransfers: []model.PetTransfer{},
+			expectedSorts:     []string{"petTransfer#sender#User 1", "petTransfer#recipient#User 1"},
+		},
+		{
+			name:          "dynamodb query error",
+			client:        FakeDynamoDbClient{queryErr: assert.AnError},
+			expectedSorts: []string{"petTransfer#sender#User 1"},
+			expectErr:     true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		dao := data.NewPetTransferDao(&test.client, SampleTableName)
+
+		// Execute
+		transfers, err := dao.QueryByUser(context.Background(), SampleTransfer.Sender)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedTransfers, transfers, test.name)
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+		sorts := []string{}
+		for _, input := range test.client.queryInputs {
+			assert.Equal(t, "sort-key-gsi", *input.IndexName, test.name)
+			assert.Equal(t, "Sort = :sortVal", *input.KeyConditionExpression, test.name)
+			assert.Nil(t, input.FilterExpression, test.name)
+			sorts = append(sorts, *input.ExpressionAttributeValues[":sortVal"].S)
+		}
+		assert.Equal(t, test.expectedSorts, sorts, test.name)
+	}
+}
@@ -1,18 +1,24 @@
 package data
 
 import (
+	"context"
 	"errors"
-	"log"
 	"math"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/metrics"
 	"github.com/mcwiet/go-test/pkg/model"
 )
 
 type UserPoolClient interface {
-	AdminGetUser(*cognito.AdminGetUserInput) (*cognito.AdminGetUserOutput, error)
-	ListUsers(*cognito.ListUsersInput) (*cognito.ListUsersOutput, error)
-	DescribeUserPool(*cognito.DescribeUserPoolInput) (*cognito.DescribeUserPoolOutput, error)
+	AdminGetUserWithContext(aws.Context, *cognito.AdminGetUserInput, ...request.Option) (*cognito.AdminGetUserOutput, error)
+	ListUsersWithContext(aws.Context, *cognito.ListUsersInput, ...request.Option) (*cognito.ListUsersOutput, error)
+	DescribeUserPoolWithContext(aws.Context, *cognito.DescribeUserPoolInput, ...request.Option) (*cognito.DescribeUserPoolOutput, error)
 }
 
 type UserDao struct {
@@ -29,22 +35,28 @@ func NewUserDao(client UserPoolClient, userPoolId string) UserDao {
 }
 
 // Get a user given a username
-func (u *UserDao) GetByUsername(username string) (model.User, error) {
-	ret, err := u.client.AdminGetUser(&cognito.AdminGetUserInput{
+func (u *UserDao) GetByUsername(ctx context.Context, username string) (model.User, error) {
+	start := time.Now()
+	ret, err := u.client.AdminGetUserWithContext(ctx, &cognito.AdminGetUserInput{
 		UserPoolId: &u.userPoolId,
 		Username:   &username,
 	})
+	metrics.FromContext(ctx).RecordCall("Cognito.AdminGetUser", start, err)
 
 	if err != nil {
-		log.Println(err)
-		return model.User{}, errors.New("error retrieving user")
+		logging.FromContext(ctx).Error("cognito admin get user failed", err, nil)
+		var notFoundError *cognito.UserNotFoundException
+		if errors.As(err, &notFoundError) {
+			return model.User{}, apperror.NewNotFound("user not found", err)
+		}
+		return model.User{}, apperror.NewInternal("error retrieving user", err)
 	}
 
 	return convertAttributesToUser(username, ret.UserAttributes), nil
 }
 
 // List users; returns users along with a token to continue listing (if more users exist)
-func (u *UserDao) List(first int, after string) ([]model.User, string, error) {
+func (u *UserDao) List(ctx context.Context, first int, after string) ([]model.User, string, error) {
 	remaining := first
 	users := []model.User{}
 	paginationToken := after
@@ -56,15 +68,21 @@ func (u *UserDao) List(first int, after string) ([]model.User, string, error) {
 		if *tempToken == "" {
 			tempToken = nil
 		}
-		ret, err := u.client.ListUsers(&cognito.ListUsersInput{
+		start := time.Now()
+		ret, err := u.client.ListUsersWithContext(ctx, &cognito.ListUsersInput{
 			UserPoolId:      &u.userPoolId,
 			Limit:           &limit,
 			PaginationToken: tempToken,
 		})
+		metrics.FromContext(ctx).RecordCall("Cognito.ListUsers", start, err)
 
 		if err != nil {
-			log.Println(err)
-			return []model.User{}, "", errors.New("error retrieving users")
+			logging.FromContext(ctx).Error("cognito list users failed", err, nil)
+			var invalidParameterError *cognito.InvalidParameterException
+			if errors.As(err, &invalidParameterError) {
+				return []model.User{}, "", apperror.NewValidation("invalid pagination token", err).With("field", "after")
+			}
+			return []model.User{}, "", apperror.NewInternal("error retrieving users", err)
 		}
 
 		for _, userData := range ret.Users {
@@ -85,14 +103,16 @@ func (u *UserDao) List(first int, after string) ([]model.User, string, error) {
 }
 
 // Get the (estimated) total count of users in the user pool
-func (u *UserDao) GetTotalCount() (int, error) {
-	ret, err := u.client.DescribeUserPool(&cognito.DescribeUserPoolInput{
+func (u *UserDao) GetTotalCount(ctx context.Context) (int, error) {
+	start := time.Now()
+	ret, err := u.client.DescribeUserPoolWithContext(ctx, &cognito.DescribeUserPoolInput{
 		UserPoolId: &u.userPoolId,
 	})
+	metrics.FromContext(ctx).RecordCall("Cognito.DescribeUserPool", start, err)
 
 	if err != nil {
-		log.Println(err)
-		return 0, errors.New("error getting total number of users")
+		logging.FromContext(ctx).Error("cognito describe user pool failed", err, nil)
+		return 0, apperror.NewInternal("error getting total number of users", err)
 	}
 
 	return int(*ret.UserPool.EstimatedNumberOfUsers), nil
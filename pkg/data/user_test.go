@@ -1,11 +1,14 @@
 package data_test
 
 import (
+	"context"
 	"testing"
 
 	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/data"
+	"github.com/mcwiet/go-test/pkg/metrics"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/openlyinc/pointy"
 	"github.com/stretchr/testify/assert"
@@ -36,11 +39,12 @@ var (
 func TestUserGetByUsername(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name           string
-		userPoolClient FakeUserPoolClient
-		username       string
-		expectedUser   model.User
-		expectErr      bool
+		name            string
+		userPoolClient  FakeUserPoolClient
+		username        string
+		expectedUser    model.User
+		expectErr       bool
+		expectedErrCode apperror.Code
 	}
 
 	// Define tests
@@ -61,8 +65,18 @@ func TestUserGetByUsername(t *testing.T) {
 			userPoolClient: FakeUserPoolClient{
 				adminGetUserErr: assert.AnError,
 			},
-			username:  SampleUser1.Username,
-			expectErr: true,
+			username:        SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name: "user not found",
+			userPoolClient: FakeUserPoolClient{
+				adminGetUserErr: &cognito.UserNotFoundException{},
+			},
+			username:        SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
 		},
 	}
 
@@ -72,14 +86,14 @@ func TestUserGetByUsername(t *testing.T) {
 		userDao := data.NewUserDao(&test.userPoolClient, SampleUserPoolId)
 
 		// Execute
-		user, err := userDao.GetByUsername(test.username)
+		user, err := userDao.GetByUsername(context.Background(), test.username)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
 			assert.Equal(t, test.expectedUser, user, test.name)
 		} else {
-			assert.NotNil(t, err, test.name)
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
 		}
 	}
 }
@@ -169,7 +183,7 @@ func TestUserList(t *testing.T) {
 		userDao := data.NewUserDao(&test.userPoolClient, SampleUserPoolId)
 
 		// Execute
-		users, token, err := userDao.List(test.first, test.after)
+		users, token, err := userDao.List(context.Background(), test.first, test.after)
 
 		// Verify
 		if !test.expectErr {
@@ -220,7 +234,7 @@ func TestUserGetTotalCountUsers(t *testing.T) {
 		userDao := data.NewUserDao(&test.userPoolClient, SampleUserPoolId)
 
 		// Execute
-		count, err := userDao.GetTotalCount()
+		count, err := userDao.GetTotalCount(context.Background())
 
 		// Verify
 		if !test.expectErr {
@@ -231,3 +245,22 @@ func TestUserGetTotalCountUsers(t *testing.T) {
 		}
 	}
 }
+
+func TestUserDaoRecordsCalls(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	ctx := metrics.NewContext(context.Background(), metrics.NewRecorder(&capture, metrics.Namespace, nil))
+	userPoolClient := FakeUserPoolClient{
+		adminGetUserOutput: &cognito.AdminGetUserOutput{UserAttributes: SampleUser1Attrs},
+	}
+	userDao := data.NewUserDao(&userPoolClient, SampleUserPoolId)
+
+	// Execute
+	userDao.GetByUsername(ctx, SampleUser1.Username)
+
+	// Verify
+	records := capture.Find("Calls")
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "Cognito.AdminGetUser", records[0].Dimensions["Operation"])
+	assert.Equal(t, float64(0), records[0].Values["CallErrors"])
+}
@@ -2,19 +2,32 @@ package infra
 
 import (
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsappsync"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
 	"github.com/aws/aws-cdk-go/awscdkappsyncalpha/v2"
 	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/controller"
 )
 
+// Turns the error in a Lambda result into a GraphQL error with the error's type and info (see cmd/api/response.go)
+const resultResponseTemplate = `#if($ctx.error)
+  $util.error($ctx.error.message, $ctx.error.type)
+#end
+#if($ctx.result.errorType)
+  $util.error($ctx.result.errorMessage, $ctx.result.errorType, $ctx.result.data, $ctx.result.errorInfo)
+#end
+$util.toJson($ctx.result.data)`
+
 type ApiStackProps struct {
 	awscdk.StackProps
-	EnvName string
+	EnvName   string
+	Resolvers []controller.Resolver // fields resolved by the API Lambda
 }
 
 func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) awscdk.Stack {
@@ -58,13 +71,9 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 	})
 
 	// Resolvers
-	createResolver(api, "Query", "pet", lambdaSource)
-	createResolver(api, "Query", "pets", lambdaSource)
-	createResolver(api, "Query", "user", lambdaSource)
-	createResolver(api, "Query", "users", lambdaSource)
-	createResolver(api, "Mutation", "createPet", lambdaSource)
-	createResolver(api, "Mutation", "deletePet", lambdaSource)
-	createResolver(api, "Mutation", "updatePetOwner", lambdaSource)
+	for _, resolver := range props.Resolvers {
+		createResolver(api, resolver.TypeName, resolver.FieldName, resolver.MaxBatchSize, lambdaSource)
+	}
 
 	// Primary Dynamo DB table
 	primaryTableName := *stackName + "-primary-table"
@@ -75,12 +84,29 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 		PartitionKey: &primaryTablePartitionKey,
 		SortKey:      &primaryTableSortKey,
 		BillingMode:  awsdynamodb.BillingMode_PAY_PER_REQUEST,
+		// Deleted pets and audit events are purged some time after they expire
+		TimeToLiveAttribute: jsii.String("ExpiresAt"),
 	})
 	primaryTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
 		IndexName:      jsii.String("sort-key-gsi"),
 		ProjectionType: awsdynamodb.ProjectionType_ALL,
 		PartitionKey:   &primaryTableSortKey,
 	})
+	// Pets by owner; keys only, since the pets themselves are read in batches
+	primaryTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName:      jsii.String("owner-gsi"),
+		ProjectionType: awsdynamodb.ProjectionType_KEYS_ONLY,
+		PartitionKey:   &awsdynamodb.Attribute{Name: jsii.String("Owner"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:        &primaryTablePartitionKey,
+	})
+	// Audit events, sharded by the (UTC) day they happened (e.g. 'audit#2022-01-31') so no one partition takes every
+	// write, and ordered within a day by their IDs (which start with the time of the event)
+	primaryTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName:      jsii.String("audit-gsi"),
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
+		PartitionKey:   &awsdynamodb.Attribute{Name: jsii.String("AuditLog"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:        &primaryTablePartitionKey,
+	})
 
 	// Permission for Lambda to access Primary Dynamo DB table
 	lambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
@@ -98,6 +124,35 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 		Resources: jsii.Strings(*primaryTable.TableArn(), *primaryTable.TableArn()+"/*"),
 	}))
 
+	// Pet photo bucket (name generated by CloudFormation, since bucket names are global); clients upload and download
+	// photos directly using URLs presigned by the Lambda, so browsers need CORS
+	photoBucket := awss3.NewBucket(stack, jsii.String(*stackName+"-photo-bucket"), &awss3.BucketProps{
+		BlockPublicAccess: awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:        awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:        jsii.Bool(true),
+		Cors: &[]*awss3.CorsRule{{
+			AllowedMethods: &[]awss3.HttpMethods{awss3.HttpMethods_GET, awss3.HttpMethods_PUT},
+			AllowedOrigins: jsii.Strings("*"),
+			AllowedHeaders: jsii.Strings("*"),
+		}},
+	})
+
+	// Permission for Lambda to presign photo uploads / downloads (a presigned URL carries the permissions of its signer),
+	// to list photos and to delete the photos of purged pets
+	lambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect: awsiam.Effect_ALLOW,
+		Actions: jsii.Strings(
+			"s3:DeleteObject",
+			"s3:GetObject",
+			"s3:PutObject"),
+		Resources: jsii.Strings(*photoBucket.ArnForObjects(jsii.String("pets/*"))),
+	}))
+	lambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("s3:ListBucket"),
+		Resources: jsii.Strings(*photoBucket.BucketArn()),
+	}))
+
 	// Permission for Lambda to access Cognito User Pool
 	userPoolArn := GetInfraParameter(stack, props.EnvName, ParamUserPoolArn)
 	lambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
@@ -113,14 +168,31 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 	// Add environment variables to Lambda to reference other infra
 	lambda.AddEnvironment(jsii.String("DDB_PRIMARY_TABLE_NAME"), &primaryTableName, nil)
 	lambda.AddEnvironment(jsii.String("USER_POOL_ID"), &userPoolId, nil)
+	lambda.AddEnvironment(jsii.String("PHOTO_BUCKET_NAME"), photoBucket.BucketName(), nil)
+	lambda.AddEnvironment(jsii.String("ENV_NAME"), &props.EnvName, nil)
 
 	return stack
 }
 
-func createResolver(api awscdkappsyncalpha.GraphqlApi, typeName string, fieldName string, source awscdkappsyncalpha.BaseDataSource) {
-	api.CreateResolver(&awscdkappsyncalpha.ExtendedResolverProps{
-		TypeName:   &typeName,
-		FieldName:  &fieldName,
-		DataSource: source,
+// Creates a resolver for a field; a max batch size greater than 0 makes AppSync batch invocations of the data source
+//
+// Requests are always sent to the Lambda directly; AppSync reads the errors of batch results itself, other results go
+// through a response mapping template so errors keep their info
+func createResolver(api awscdkappsyncalpha.GraphqlApi, typeName string, fieldName string, maxBatchSize int, source awscdkappsyncalpha.BaseDataSource) {
+	var responseTemplate awscdkappsyncalpha.MappingTemplate
+	if maxBatchSize == 0 {
+		responseTemplate = awscdkappsyncalpha.MappingTemplate_FromString(jsii.String(resultResponseTemplate))
+	}
+	resolver := api.CreateResolver(&awscdkappsyncalpha.ExtendedResolverProps{
+		TypeName:                &typeName,
+		FieldName:               &fieldName,
+		DataSource:              source,
+		ResponseMappingTemplate: responseTemplate,
 	})
+
+	// The L2 construct doesn't expose the batch size yet, so set it on the underlying CloudFormation resource
+	if maxBatchSize > 0 {
+		cfnResolver := resolver.Node().DefaultChild().(awsappsync.CfnResolver)
+		cfnResolver.SetMaxBatchSize(jsii.Number(float64(maxBatchSize)))
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/mcwiet/go-test/pkg/authorization"
 )
 
 type AuthStackProps struct {
@@ -33,13 +34,15 @@ func NewAuthStack(scope constructs.Construct, id string, props *AuthStackProps)
 	NewInfraParameter(stack, props.EnvName, ParamUserPoolArn, *userPool.UserPoolArn())
 	NewInfraParameter(stack, props.EnvName, ParamUserPoolId, *userPool.UserPoolId())
 
-	// Cognito User Pool Admin Group
-	userPoolAdminGroupName := *stackName + "-user-pool-admin-group"
-	awscognito.NewCfnUserPoolGroup(stack, &userPoolAdminGroupName, &awscognito.CfnUserPoolGroupProps{
-		GroupName:   jsii.String("admin"),
-		Description: jsii.String("Application administrators"),
-		UserPoolId:  userPool.UserPoolId(),
-	})
+	// Cognito User Pool Groups (one per role, which callers are given by being in the group)
+	for _, role := range authorization.Roles {
+		userPoolGroupName := *stackName + "-user-pool-" + role.String() + "-group"
+		awscognito.NewCfnUserPoolGroup(stack, &userPoolGroupName, &awscognito.CfnUserPoolGroupProps{
+			GroupName:   jsii.String(role.String()),
+			Description: jsii.String(role.Description()),
+			UserPoolId:  userPool.UserPoolId(),
+		})
+	}
 
 	// API App Client
 	appClientName := userPoolName + "-api-client"
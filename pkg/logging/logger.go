@@ -0,0 +1,115 @@
+// Package logging writes structured (JSON lines) logs; the logger travels in the context so every line from one
+// invocation carries the same request details
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+)
+
+// Values attached to a log line
+type Fields map[string]interface{}
+
+// Object which writes log lines as JSON objects; safe for concurrent use
+type Logger struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	fields Fields
+}
+
+type contextKey struct{}
+
+// Logger used when the context doesn't carry one
+var defaultLogger = NewLogger(os.Stdout)
+
+// Creates a logger which writes to out
+func NewLogger(out io.Writer) Logger {
+	return Logger{
+		out:    out,
+		mutex:  &sync.Mutex{},
+		fields: Fields{},
+	}
+}
+
+// Creates a logger which adds the given fields to every line (on top of the fields this logger already adds)
+func (l Logger) With(fields Fields) Logger {
+	merged := Fields{}
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return Logger{
+		out:    l.out,
+		mutex:  l.mutex,
+		fields: merged,
+	}
+}
+
+// Writes an informational line
+func (l Logger) Info(message string, fields Fields) {
+	l.write("info", message, fields)
+}
+
+// Writes an error line; the error's class is its app error code and its cause (which clients never see) is included
+func (l Logger) Error(message string, err error, fields Fields) {
+	errorFields := Fields{
+		"error":      err.Error(),
+		"errorClass": apperror.CodeOf(err),
+	}
+	if cause := errors.Unwrap(err); cause != nil {
+		errorFields["cause"] = cause.Error()
+	}
+	for key, value := range fields {
+		errorFields[key] = value
+	}
+	l.write("error", message, errorFields)
+}
+
+func (l Logger) write(level string, message string, fields Fields) {
+	line := Fields{}
+	for key, value := range l.fields {
+		line[key] = value
+	}
+	for key, value := range fields {
+		line[key] = value
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["message"] = message
+
+	lineBytes, err := json.Marshal(line)
+	if err != nil {
+		lineBytes, _ = json.Marshal(Fields{"level": "error", "message": "could not encode log line", "error": err.Error()})
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(append(lineBytes, '\n'))
+}
+
+// Creates a context which carries the logger
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Gets the logger carried by the context (or a logger writing to stdout if there isn't one)
+func FromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return logger
+	}
+	return defaultLogger
+}
+
+// Gets the number of milliseconds since start, for the duration of an operation
+func Since(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
@@ -0,0 +1,92 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// Decodes every JSON line written to a buffer
+func readLines(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, text := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		line := map[string]interface{}{}
+		err := json.Unmarshal([]byte(text), &line)
+		assert.Nil(t, err, "line is JSON: "+text)
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggerInfo(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	logger := logging.NewLogger(&buffer).With(logging.Fields{"requestId": "request-1"})
+
+	// Execute
+	logger.With(logging.Fields{"resolver": "Query.pet"}).Info("request handled", logging.Fields{"durationMs": 1.5})
+
+	// Verify
+	lines := readLines(t, &buffer)
+	assert.Equal(t, 1, len(lines))
+	assert.Equal(t, "info", lines[0]["level"])
+	assert.Equal(t, "request handled", lines[0]["message"])
+	assert.Equal(t, "request-1", lines[0]["requestId"])
+	assert.Equal(t, "Query.pet", lines[0]["resolver"])
+	assert.Equal(t, 1.5, lines[0]["durationMs"])
+	assert.NotEmpty(t, lines[0]["time"])
+}
+
+func TestLoggerError(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	logger := logging.NewLogger(&buffer)
+	err := apperror.NewInternal("error retrieving pet", errors.New("connection reset"))
+
+	// Execute
+	logger.Error("get item failed", err, nil)
+	logger.Error("plain failure", errors.New("plain"), nil)
+
+	// Verify
+	lines := readLines(t, &buffer)
+	assert.Equal(t, "error", lines[0]["level"])
+	assert.Equal(t, "error retrieving pet", lines[0]["error"])
+	assert.Equal(t, "INTERNAL", lines[0]["errorClass"])
+	assert.Equal(t, "connection reset", lines[0]["cause"])
+	assert.Nil(t, lines[1]["cause"], "error without a cause")
+}
+
+func TestLoggerWithDoesNotChangeParent(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	parent := logging.NewLogger(&buffer).With(logging.Fields{"requestId": "request-1"})
+
+	// Execute
+	parent.With(logging.Fields{"username": "user"})
+	parent.Info("parent", nil)
+
+	// Verify
+	lines := readLines(t, &buffer)
+	assert.Nil(t, lines[0]["username"])
+}
+
+func TestContext(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	logger := logging.NewLogger(&buffer).With(logging.Fields{"requestId": "request-1"})
+	ctx := logging.NewContext(context.Background(), logger)
+
+	// Execute
+	logging.FromContext(ctx).Info("from context", nil)
+
+	// Verify
+	lines := readLines(t, &buffer)
+	assert.Equal(t, "request-1", lines[0]["requestId"])
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Metrics from one EMF line
+type Record struct {
+	Namespace  string
+	Dimensions Dimensions
+	Values     map[string]float64
+}
+
+// Writer which keeps everything a recorder writes so tests can assert which metrics were recorded
+type Capture struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.buffer.Write(p)
+}
+
+// Gets every record written so far, in order
+func (c *Capture) Records() []Record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(bytes.NewReader(c.buffer.Bytes()))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		records = append(records, parseRecord(line))
+	}
+	return records
+}
+
+// Gets the records which have a metric with the given name
+func (c *Capture) Find(name string) []Record {
+	found := []Record{}
+	for _, record := range c.Records() {
+		if _, exists := record.Values[name]; exists {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// Reads the metric definitions of an EMF line and looks up their values and dimensions
+func parseRecord(line map[string]interface{}) Record {
+	record := Record{Dimensions: Dimensions{}, Values: map[string]float64{}}
+	metadata, _ := line["_aws"].(map[string]interface{})
+	directives, _ := metadata["CloudWatchMetrics"].([]interface{})
+	for _, directive := range directives {
+		directive, _ := directive.(map[string]interface{})
+		record.Namespace, _ = directive["Namespace"].(string)
+		dimensionSets, _ := directive["Dimensions"].([]interface{})
+		for _, dimensionSet := range dimensionSets {
+			names, _ := dimensionSet.([]interface{})
+			for _, name := range names {
+				name, _ := name.(string)
+				record.Dimensions[name], _ = line[name].(string)
+			}
+		}
+		definitions, _ := directive["Metrics"].([]interface{})
+		for _, definition := range definitions {
+			definition, _ := definition.(map[string]interface{})
+			name, _ := definition["Name"].(string)
+			record.Values[name], _ = line[name].(float64)
+		}
+	}
+	return record
+}
@@ -0,0 +1,152 @@
+// Package metrics records CloudWatch metrics using the Embedded Metric Format (EMF); CloudWatch Logs turns each JSON
+// line written to a Lambda's stdout into metrics, so no API calls are needed
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Namespace the API's metrics are published under
+const Namespace = "GoTestApi"
+
+// Unit of a metric value
+type Unit string
+
+const (
+	UnitCount        Unit = "Count"
+	UnitMilliseconds Unit = "Milliseconds"
+)
+
+// Single metric value
+type Metric struct {
+	Name  string
+	Unit  Unit
+	Value float64
+}
+
+// Names and values of the dimensions a metric is recorded under
+type Dimensions map[string]string
+
+// Object which writes metrics as EMF JSON lines; safe for concurrent use
+type Recorder struct {
+	out        io.Writer
+	mutex      *sync.Mutex
+	namespace  string
+	dimensions Dimensions
+}
+
+type contextKey struct{}
+
+// Recorder used when the context doesn't carry one; metrics are dropped
+var discardRecorder = NewRecorder(io.Discard, Namespace, nil)
+
+// Creates a recorder which writes to out; every metric is recorded under the given dimensions
+func NewRecorder(out io.Writer, namespace string, dimensions Dimensions) Recorder {
+	return Recorder{
+		out:        out,
+		mutex:      &sync.Mutex{},
+		namespace:  namespace,
+		dimensions: mergeDimensions(dimensions, nil),
+	}
+}
+
+// Creates a recorder which adds the given dimensions to every metric (on top of the dimensions this recorder adds)
+func (r Recorder) With(dimensions Dimensions) Recorder {
+	return Recorder{
+		out:        r.out,
+		mutex:      r.mutex,
+		namespace:  r.namespace,
+		dimensions: mergeDimensions(r.dimensions, dimensions),
+	}
+}
+
+// Records metrics under the recorder's dimensions
+func (r Recorder) Record(metrics ...Metric) {
+	names := []string{}
+	for name := range r.dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	definitions := []map[string]string{}
+	line := map[string]interface{}{}
+	for _, metric := range metrics {
+		definitions = append(definitions, map[string]string{"Name": metric.Name, "Unit": string(metric.Unit)})
+		line[metric.Name] = metric.Value
+	}
+	for name, value := range r.dimensions {
+		line[name] = value
+	}
+	line["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  r.namespace,
+			"Dimensions": [][]string{names},
+			"Metrics":    definitions,
+		}},
+	}
+
+	lineBytes, _ := json.Marshal(line)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.out.Write(append(lineBytes, '\n'))
+}
+
+// Records a call to a data store operation (e.g. 'DynamoDB.GetItem') which started at start
+func (r Recorder) RecordCall(operation string, start time.Time, err error) {
+	r.With(Dimensions{"Operation": operation}).Record(
+		Metric{Name: "Calls", Unit: UnitCount, Value: 1},
+		Metric{Name: "CallErrors", Unit: UnitCount, Value: countOf(err != nil)},
+		Metric{Name: "CallDuration", Unit: UnitMilliseconds, Value: millisecondsSince(start)},
+	)
+}
+
+// Records requests handled together (a single request or a batch) which started at start
+func (r Recorder) RecordRequests(requests int, failed int, start time.Time) {
+	r.Record(
+		Metric{Name: "Requests", Unit: UnitCount, Value: float64(requests)},
+		Metric{Name: "Errors", Unit: UnitCount, Value: float64(failed)},
+		Metric{Name: "Duration", Unit: UnitMilliseconds, Value: millisecondsSince(start)},
+	)
+}
+
+// Creates a context which carries the recorder
+func NewContext(ctx context.Context, recorder Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, recorder)
+}
+
+// Gets the recorder carried by the context (or a recorder which drops metrics if there isn't one)
+func FromContext(ctx context.Context) Recorder {
+	if recorder, ok := ctx.Value(contextKey{}).(Recorder); ok {
+		return recorder
+	}
+	return discardRecorder
+}
+
+func mergeDimensions(base Dimensions, extra Dimensions) Dimensions {
+	merged := Dimensions{}
+	for name, value := range base {
+		merged[name] = value
+	}
+	for name, value := range extra {
+		merged[name] = value
+	}
+	return merged
+}
+
+func countOf(condition bool) float64 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+func millisecondsSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
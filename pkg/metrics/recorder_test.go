@@ -0,0 +1,93 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderWritesEmf(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	recorder := metrics.NewRecorder(&buffer, "Namespace", metrics.Dimensions{"Environment": "test"})
+
+	// Execute
+	recorder.With(metrics.Dimensions{"Field": "Query.pet"}).Record(metrics.Metric{Name: "Requests", Unit: metrics.UnitCount, Value: 2})
+
+	// Verify
+	var line struct {
+		Aws struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []map[string]string
+			}
+		} `json:"_aws"`
+		Environment string
+		Field       string
+		Requests    float64
+	}
+	err := json.Unmarshal(buffer.Bytes(), &line)
+	assert.Nil(t, err)
+	assert.NotZero(t, line.Aws.Timestamp)
+	assert.Equal(t, "Namespace", line.Aws.CloudWatchMetrics[0].Namespace)
+	assert.Equal(t, [][]string{{"Environment", "Field"}}, line.Aws.CloudWatchMetrics[0].Dimensions)
+	assert.Equal(t, []map[string]string{{"Name": "Requests", "Unit": "Count"}}, line.Aws.CloudWatchMetrics[0].Metrics)
+	assert.Equal(t, "test", line.Environment)
+	assert.Equal(t, "Query.pet", line.Field)
+	assert.Equal(t, float64(2), line.Requests)
+}
+
+func TestRecorderRecordCall(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	recorder := metrics.NewRecorder(&capture, metrics.Namespace, metrics.Dimensions{"Environment": "test"})
+
+	// Execute
+	recorder.RecordCall("DynamoDB.GetItem", time.Now(), nil)
+	recorder.RecordCall("DynamoDB.GetItem", time.Now(), errors.New("failed"))
+
+	// Verify
+	records := capture.Find("Calls")
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, metrics.Dimensions{"Environment": "test", "Operation": "DynamoDB.GetItem"}, records[0].Dimensions)
+	assert.Equal(t, float64(0), records[0].Values["CallErrors"])
+	assert.Equal(t, float64(1), records[1].Values["CallErrors"])
+	assert.Contains(t, records[0].Values, "CallDuration")
+}
+
+func TestRecorderRecordRequests(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	recorder := metrics.NewRecorder(&capture, metrics.Namespace, nil)
+
+	// Execute
+	recorder.RecordRequests(3, 1, time.Now())
+
+	// Verify
+	records := capture.Records()
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, float64(3), records[0].Values["Requests"])
+	assert.Equal(t, float64(1), records[0].Values["Errors"])
+	assert.Contains(t, records[0].Values, "Duration")
+}
+
+func TestContext(t *testing.T) {
+	// Setup
+	var capture metrics.Capture
+	ctx := metrics.NewContext(context.Background(), metrics.NewRecorder(&capture, metrics.Namespace, nil))
+
+	// Execute
+	metrics.FromContext(ctx).RecordRequests(1, 0, time.Now())
+	metrics.FromContext(context.Background()).RecordRequests(1, 0, time.Now())
+
+	// Verify
+	assert.Equal(t, 1, len(capture.Records()), "context without a recorder drops metrics")
+}
@@ -0,0 +1,73 @@
+package model
+
+import "time"
+
+// Outcome of a mutation which succeeded; failed mutations have the code of their error as their outcome instead
+const AuditOutcomeSuccess = "SUCCESS"
+
+// Layout of the time at the start of an audit event's ID, so ordering events by ID orders them by when they happened
+const AuditEventIdTimeLayout = "20060102T150405.000000000Z"
+
+// How long audit events are kept; older events have expired and aren't listed
+const AuditEventRetention = 365 * 24 * time.Hour
+
+// How far back audit events are listed from when the filter has no start time
+const AuditEventsDefaultWindow = 7 * 24 * time.Hour
+
+// Longest time range audit events can be listed over, which bounds how many days of the log a query reads
+const AuditEventsMaxWindow = 31 * 24 * time.Hour
+
+// Gets the time at the start of an audit event's ID
+func AuditEventIdTime(id string) (time.Time, error) {
+	prefix := id
+	if len(prefix) > len(AuditEventIdTimeLayout) {
+		prefix = prefix[:len(AuditEventIdTimeLayout)]
+	}
+	return time.Parse(AuditEventIdTimeLayout, prefix)
+}
+
+// Record of a mutation: who made it, with which arguments, what authorization decided and how it turned out
+type AuditEvent struct {
+	Id        string                  `json:"id"`
+	Time      string                  `json:"time"` // RFC 3339 (UTC)
+	Username  string                  `json:"username"`
+	Groups    []string                `json:"groups"`    // in ascending order
+	Field     string                  `json:"field"`     // e.g. 'Mutation.createPet'
+	Arguments string                  `json:"arguments"` // JSON, with personal data redacted
+	Decisions []AuthorizationDecision `json:"decisions"` // in the order they were made
+	Outcome   string                  `json:"outcome"`
+	Error     string                  `json:"error,omitempty"` // message of the error the mutation failed with
+}
+
+// Decision on whether a caller could perform an action, with the reason it was made
+type AuthorizationDecision struct {
+	Action  string `json:"action"` // e.g. 'pet:update'
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+type AuditEventEdge struct {
+	Node   AuditEvent `json:"node"`
+	Cursor string     `json:"cursor"`
+}
+
+// Page of audit events; unlike other connections it has no total count, since counting the log means reading all of it
+type AuditEventConnection struct {
+	Edges    []AuditEventEdge `json:"edges"`
+	PageInfo PageInfo         `json:"pageInfo"`
+}
+
+// Limits which audit events are listed; fields left empty don't limit them
+type AuditEventsFilter struct {
+	Username string `json:"username"`
+	Field    string `json:"field"`
+	Outcome  string `json:"outcome"`
+	From     string `json:"from"` // RFC 3339; inclusive
+	To       string `json:"to"`   // RFC 3339; inclusive
+}
+
+type AuditEventsInput struct {
+	Filter AuditEventsFilter `json:"filter"`
+	First  int               `json:"first"`
+	After  string            `json:"after"`
+}
@@ -1,10 +1,150 @@
 package model
 
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Layout of dates (e.g. a pet's birth date)
+const DateLayout = "2006-01-02"
+
 type Pet struct {
-	Id    string `json:"id"`
-	Name  string `json:"name"`
-	Age   int    `json:"age"`
-	Owner string `json:"owner,omitempty"`
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Species   Species  `json:"species,omitempty"`
+	Breed     string   `json:"breed,omitempty"`
+	BirthDate string   `json:"birthDate,omitempty"` // YYYY-MM-DD; when set, the age is worked out from it when the pet is read
+	Age       int      `json:"age"`
+	Owners    []string `json:"owners"`              // usernames in ascending order; every owner has the same rights over the pet
+	Private   bool     `json:"private"`             // the owners of private pets are only shown to the owners themselves (and admins)
+	Version   int      `json:"version"`             // incremented on every change; writes only succeed if the version hasn't moved on
+	DeletedAt string   `json:"deletedAt,omitempty"` // RFC 3339; only set on deleted pets, which can be restored until purged
+	ChangedBy string   `json:"changedBy,omitempty"` // username of whoever made the change which gave the pet its version
+	ChangedAt string   `json:"changedAt,omitempty"` // RFC 3339 (UTC); when that change was made
+}
+
+// Encodes the pet with the deprecated owner field (the first of its owners, or null without any) which clients from
+// before pets had co-owners still read
+func (p Pet) MarshalJSON() ([]byte, error) {
+	type pet Pet // without this method, so encoding it doesn't recurse
+	var owner *string
+	if len(p.Owners) > 0 {
+		owner = &p.Owners[0]
+	}
+	return json.Marshal(struct {
+		pet
+		Owner *string `json:"owner"`
+	}{pet(p), owner})
+}
+
+// Checks whether the user is one of the pet's owners
+func (p Pet) HasOwner(username string) bool {
+	for _, owner := range p.Owners {
+		if owner == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the set of owners given by the usernames, i.e. without blanks or duplicates and in ascending order
+func NewOwners(usernames ...string) []string {
+	owners := []string{}
+	seen := map[string]bool{}
+	for _, username := range usernames {
+		if username != "" && !seen[username] {
+			seen[username] = true
+			owners = append(owners, username)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// Gets the pet with its age worked out from its birth date as of the given time; pets without a (valid) birth date
+// keep the age they were stored with
+func (p Pet) WithAgeOn(now time.Time) Pet {
+	birthDate, err := time.Parse(DateLayout, p.BirthDate)
+	if err != nil {
+		return p
+	}
+
+	age := now.Year() - birthDate.Year()
+	if now.Month() < birthDate.Month() || (now.Month() == birthDate.Month() && now.Day() < birthDate.Day()) {
+		age-- // birthday hasn't happened yet this year
+	}
+	if age < 0 {
+		age = 0
+	}
+	p.Age = age
+	return p
+}
+
+// Kind of animal a pet is
+type Species string
+
+const (
+	SpeciesDog     Species = "DOG"
+	SpeciesCat     Species = "CAT"
+	SpeciesBird    Species = "BIRD"
+	SpeciesRabbit  Species = "RABBIT"
+	SpeciesFish    Species = "FISH"
+	SpeciesReptile Species = "REPTILE"
+	SpeciesOther   Species = "OTHER"
+)
+
+// Checks whether the species is one of the species in the schema
+func (s Species) IsValid() bool {
+	switch s {
+	case SpeciesDog, SpeciesCat, SpeciesBird, SpeciesRabbit, SpeciesFish, SpeciesReptile, SpeciesOther:
+		return true
+	default:
+		return false
+	}
+}
+
+// Changes to make to a pet; fields which are nil are left unchanged
+type PetPatch struct {
+	Name      *string
+	Species   *Species
+	Breed     *string
+	BirthDate *string
+	Age       *int
+	Owners    *[]string // replaces every owner
+	Private   *bool
+}
+
+// Checks whether the patch changes nothing
+func (p PetPatch) IsEmpty() bool {
+	return p.Name == nil && p.Species == nil && p.Breed == nil && p.BirthDate == nil && p.Age == nil && p.Owners == nil &&
+		p.Private == nil
+}
+
+// Gets the pet with the fields set in the patch changed (the version and change details are left as they are)
+func (p Pet) WithPatch(patch PetPatch) Pet {
+	if patch.Name != nil {
+		p.Name = *patch.Name
+	}
+	if patch.Species != nil {
+		p.Species = *patch.Species
+	}
+	if patch.Breed != nil {
+		p.Breed = *patch.Breed
+	}
+	if patch.BirthDate != nil {
+		p.BirthDate = *patch.BirthDate
+	}
+	if patch.Age != nil {
+		p.Age = *patch.Age
+	}
+	if patch.Owners != nil {
+		p.Owners = NewOwners(*patch.Owners...)
+	}
+	if patch.Private != nil {
+		p.Private = *patch.Private
+	}
+	return p
 }
 
 type PetEdge struct {
@@ -19,37 +159,107 @@ type PetConnection struct {
 }
 
 type CreatePetInput struct {
-	Name  string `json:"name"`
-	Age   int    `json:"age"`
-	Owner string `json:"owner,omitempty"`
+	Name      string   `json:"name"`
+	Species   Species  `json:"species,omitempty"`
+	Breed     string   `json:"breed,omitempty"`
+	BirthDate string   `json:"birthDate,omitempty"`
+	Age       *int     `json:"age,omitempty"` // only for pets whose birth date isn't known
+	Owners    []string `json:"owners,omitempty"`
+	Private   bool     `json:"private,omitempty"`
 }
 
 type CreatePetPayload struct {
 	Pet Pet `json:"pet"`
 }
 
+type AddPetOwnerInput struct {
+	Id              string `json:"id"`
+	Owner           string `json:"owner"`
+	ExpectedVersion *int   `json:"expectedVersion"`
+}
+
+type AddPetOwnerPayload struct {
+	Pet Pet `json:"pet"`
+}
+
 type DeletePetInput struct {
-	Id string `json:"id"`
+	Id              string `json:"id"`
+	ExpectedVersion *int   `json:"expectedVersion"`
+	Purge           bool   `json:"purge"` // delete for good instead of keeping the pet so it can be restored
 }
 
 type DeletePetPayload struct {
 	Id string `json:"id"`
 }
 
+type RestorePetInput struct {
+	Id              string `json:"id"`
+	ExpectedVersion *int   `json:"expectedVersion"`
+}
+
+type RestorePetPayload struct {
+	Pet Pet `json:"pet"`
+}
+
 type PetInput struct {
-	Id string `json:"id"`
+	Id   string `json:"id"`
+	AsOf string `json:"asOf"` // RFC 3339; gets the pet as it was at that time instead of as it is now
+}
+
+type PetHistoryInput struct {
+	Id    string `json:"id"`
+	First int    `json:"first"`
+	After string `json:"after"`
+}
+
+type DeletedPetsInput struct {
+	First int    `json:"first"`
+	After string `json:"after"`
+}
+
+type MyPetsInput struct {
+	First int    `json:"first"`
+	After string `json:"after"`
 }
 
 type PetsInput struct {
 	First int    `json:"first"`
 	After string `json:"after"`
+	Owner string `json:"owner"` // only lists the pets this user owns
+}
+
+type RemovePetOwnerInput struct {
+	Id              string `json:"id"`
+	Owner           string `json:"owner"`
+	ExpectedVersion *int   `json:"expectedVersion"`
+}
+
+type RemovePetOwnerPayload struct {
+	Pet Pet `json:"pet"`
 }
 
 type UpdatePetOwnerInput struct {
-	Id    string `json:"id"`
-	Owner string `json:"owner"`
+	Id              string `json:"id"`
+	Owner           string `json:"owner"`
+	ExpectedVersion *int   `json:"expectedVersion"`
 }
 
 type UpdatePetOwnerPayload struct {
 	Pet Pet `json:"pet"`
 }
+
+type UpdatePetInput struct {
+	Id              string    `json:"id"`
+	Name            *string   `json:"name"`
+	Species         *Species  `json:"species"`
+	Breed           *string   `json:"breed"`
+	BirthDate       *string   `json:"birthDate"`
+	Age             *int      `json:"age"`
+	Owners          *[]string `json:"owners"`
+	Private         *bool     `json:"private"`
+	ExpectedVersion *int      `json:"expectedVersion"`
+}
+
+type UpdatePetPayload struct {
+	Pet Pet `json:"pet"`
+}
@@ -0,0 +1,24 @@
+package model
+
+// Photo of a pet along with a short-lived URL for downloading it
+type PetPhoto struct {
+	Key string `json:"key"`
+	Url string `json:"url"`
+}
+
+// Short-lived URL which a photo of a pet can be uploaded to (with an HTTP PUT of the requested content type and length)
+type PetPhotoUpload struct {
+	Key       string `json:"key"`
+	UploadUrl string `json:"uploadUrl"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type RequestPetPhotoUploadInput struct {
+	PetId         string `json:"petId"`
+	ContentType   string `json:"contentType"`
+	ContentLength int    `json:"contentLength"`
+}
+
+type RequestPetPhotoUploadPayload struct {
+	PhotoUpload PetPhotoUpload `json:"photoUpload"`
+}
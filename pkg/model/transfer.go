@@ -0,0 +1,41 @@
+package model
+
+// Pending handover of a pet from its owner (the sender) to another user (the recipient); a pet has at most one
+type PetTransfer struct {
+	PetId       string `json:"petId"`
+	Sender      string `json:"sender"`
+	Recipient   string `json:"recipient"`
+	RequestedAt string `json:"requestedAt"`
+	// Whether the recipient takes the place of every owner rather than just the sender's; set when the sender doesn't
+	// own the pet (e.g. shelter staff rehoming it)
+	ReplacesOwners bool `json:"replacesOwners"`
+	// Whether the recipient joins the owners rather than taking the sender's place; set when the transfer invites them
+	// to co-own the pet (addPetOwner)
+	AddsOwner bool `json:"addsOwner"`
+}
+
+type RequestPetTransferInput struct {
+	PetId     string `json:"petId"`
+	Recipient string `json:"recipient"`
+}
+
+type RequestPetTransferPayload struct {
+	Transfer PetTransfer `json:"transfer"`
+}
+
+// Identifies the pending transfer to accept, decline or cancel
+type PetTransferInput struct {
+	PetId string `json:"petId"`
+}
+
+type AcceptPetTransferPayload struct {
+	Pet Pet `json:"pet"`
+}
+
+type DeclinePetTransferPayload struct {
+	PetId string `json:"petId"`
+}
+
+type CancelPetTransferPayload struct {
+	PetId string `json:"petId"`
+}
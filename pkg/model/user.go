@@ -2,7 +2,7 @@ package model
 
 type User struct {
 	Username string `json:"username"`
-	Email    string `json:"email"`
+	Email    string `json:"email,omitempty"` // redacted for callers who may not see it
 	Name     string `json:"name,omitempty"`
 }
 
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/mcwiet/go-test/pkg/validation"
+)
+
+type AuditDao interface {
+	Insert(ctx context.Context, event model.AuditEvent) error
+	Query(ctx context.Context, filter model.AuditEventsFilter, count int, exclusiveStartId string) ([]model.AuditEvent, bool, error)
+}
+
+type AuditAuthorizer interface {
+	AuthorizeList(context.Context, model.Identity) error
+}
+
+// Value personal data is replaced with in the arguments of audit events
+const redacted = "[REDACTED]"
+
+// Arguments which always hold personal data (compared ignoring case); any other string which looks like an email
+// address is redacted too
+var personalArguments = map[string]bool{
+	"email":       true,
+	"phone":       true,
+	"phonenumber": true,
+	"address":     true,
+}
+
+var emailPattern = regexp.MustCompile(`[^\s@]+@[^\s@]+\.[^\s@]+`)
+
+// Object containing data needed to record and read the audit log of mutations
+type AuditService struct {
+	auditDao   AuditDao
+	authorizer AuditAuthorizer
+	encoder    CursorEncoder
+}
+
+// Creates an audit service object
+func NewAuditService(auditDao AuditDao, authorizer AuditAuthorizer, encoder CursorEncoder) AuditService {
+	return AuditService{
+		auditDao:   auditDao,
+		authorizer: authorizer,
+		encoder:    encoder,
+	}
+}
+
+// Lists audit events matching the filter, newest first (admins only)
+func (s *AuditService) List(ctx context.Context, requestor model.Identity, filter model.AuditEventsFilter, first int, after string) (connection model.AuditEventConnection, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.List")
+	defer func() { span.End(err) }()
+
+	err = trace(ctx, "Authorizer.AuthorizeList", func(ctx context.Context) error {
+		return s.authorizer.AuthorizeList(ctx, requestor)
+	})
+	if err != nil {
+		return model.AuditEventConnection{}, err
+	}
+
+	v := validation.NewValidator("input")
+	validateFirst(&v, first)
+	exclusiveStartId, err := s.encoder.Decode(after)
+	if err == nil && exclusiveStartId != "" {
+		_, err = model.AuditEventIdTime(exclusiveStartId)
+	}
+	if err != nil {
+		v.Add("after", "is not a valid cursor")
+	}
+	validateAuditEventsFilter(&v, &filter, time.Now())
+	if err := v.Err(); err != nil {
+		return model.AuditEventConnection{}, err
+	}
+
+	var events []model.AuditEvent
+	var hasNextPage bool
+	err = trace(ctx, "AuditDao.Query", func(ctx context.Context) (err error) {
+		events, hasNextPage, err = s.auditDao.Query(ctx, filter, first, exclusiveStartId)
+		return err
+	})
+	if err != nil {
+		return model.AuditEventConnection{}, err
+	}
+
+	connection = model.AuditEventConnection{
+		Edges:    []model.AuditEventEdge{},
+		PageInfo: model.PageInfo{HasNextPage: hasNextPage},
+	}
+	for _, event := range events {
+		cursor := s.encoder.Encode(event.Id)
+		connection.Edges = append(connection.Edges, model.AuditEventEdge{Node: event, Cursor: cursor})
+		connection.PageInfo.EndCursor = cursor
+	}
+
+	return connection, nil
+}
+
+// Records a mutation in the audit log along with the authorization decisions made while handling it and the error it
+// failed with (if any); the arguments are stored as JSON with personal data redacted
+func (s *AuditService) Record(ctx context.Context, requestor model.Identity, field string, arguments map[string]interface{}, decisions []model.AuthorizationDecision, mutationErr error) (err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer func() { span.End(err) }()
+
+	argumentsJson, err := json.Marshal(redact(arguments))
+	if err != nil {
+		return apperror.NewInternal("could not encode audit event arguments", err)
+	}
+
+	now := time.Now().UTC()
+	event := model.AuditEvent{
+		Id:        now.Format(model.AuditEventIdTimeLayout) + "-" + uuid.NewString(),
+		Time:      now.Format(time.RFC3339Nano),
+		Username:  requestor.Username,
+		Groups:    groupsOf(requestor),
+		Field:     field,
+		Arguments: string(argumentsJson),
+		Decisions: decisions,
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	if event.Decisions == nil {
+		event.Decisions = []model.AuthorizationDecision{}
+	}
+	if mutationErr != nil {
+		event.Outcome = string(apperror.CodeOf(mutationErr))
+		event.Error = mutationErr.Error()
+	}
+
+	return trace(ctx, "AuditDao.Insert", func(ctx context.Context) error {
+		return s.auditDao.Insert(ctx, event)
+	})
+}
+
+// Checks the (optional) times an audit events filter is limited to are RFC 3339 times, in order and at most the longest
+// window apart, defaulting the start time to the default window before the end time (or now)
+func validateAuditEventsFilter(v *validation.Validator, filter *model.AuditEventsFilter, now time.Time) {
+	from, fromErr := time.Parse(time.RFC3339, filter.From)
+	if filter.From != "" && fromErr != nil {
+		v.Add("filter.from", "must be an RFC 3339 time")
+	}
+	to, toErr := time.Parse(time.RFC3339, filter.To)
+	if filter.To != "" && toErr != nil {
+		v.Add("filter.to", "must be an RFC 3339 time")
+	}
+	if fromErr == nil && toErr == nil && to.Before(from) {
+		v.Add("filter.to", "cannot be before filter.from")
+	}
+
+	// Without a start time only the last week (before the end time) is listed, and the time range is capped so a query
+	// never reads more than a month of the log
+	if filter.To == "" {
+		to, toErr = now, nil
+	}
+	if filter.From == "" && toErr == nil {
+		filter.From = to.Add(-model.AuditEventsDefaultWindow).UTC().Format(time.RFC3339)
+	} else if fromErr == nil && toErr == nil && to.Sub(from) > model.AuditEventsMaxWindow {
+		v.Add("filter.from", "cannot be more than 31 days before filter.to")
+	}
+}
+
+// Gets a copy of the arguments with personal data redacted
+func redact(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := map[string]interface{}{}
+		for key, nested := range value {
+			if personalArguments[strings.ToLower(key)] && nested != nil {
+				copied[key] = redacted
+			} else {
+				copied[key] = redact(nested)
+			}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, nested := range value {
+			copied[i] = redact(nested)
+		}
+		return copied
+	case string:
+		return emailPattern.ReplaceAllString(value, redacted)
+	}
+	return value
+}
+
+// Gets the names of the groups a requestor belongs to, in ascending order
+func groupsOf(requestor model.Identity) []string {
+	groups := []string{}
+	for group, member := range requestor.Groups {
+		if member {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
@@ -0,0 +1,250 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleAuditEvent = model.AuditEvent{
+		Id:        "20220101T000000.000000000Z-1",
+		Time:      "2022-01-01T00:00:00Z",
+		Username:  "test-user",
+		Groups:    []string{},
+		Field:     "Mutation.deletePet",
+		Arguments: `{"input":{"id":"1"}}`,
+		Decisions: []model.AuthorizationDecision{{Action: "pet:delete", Allowed: true, Reason: "allowed"}},
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	SampleDecision = model.AuthorizationDecision{Action: "pet:update", Allowed: false, Reason: "denied"}
+)
+
+func TestAuditList(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		auditDao           FakeAuditDao
+		authorizer         FakeAuditAuthorizer
+		encoder            FakeEncoder
+		filter             model.AuditEventsFilter
+		first              int
+		after              string
+		expectedFilter     model.AuditEventsFilter
+		expectedConnection model.AuditEventConnection
+		expectedViolations []string
+		expectErr          bool
+		expectedErrCode    apperror.Code
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:           "list",
+			auditDao:       FakeAuditDao{queryEvents: []model.AuditEvent{SampleAuditEvent}, queryHasNextPage: true},
+			filter:         model.AuditEventsFilter{Username: "test-user", From: "2022-01-01T00:00:00Z", To: "2022-01-01T00:00:00Z"},
+			first:          1,
+			after:          SampleEncoder.Encode("20211231T000000.000000000Z-2"),
+			expectedFilter: model.AuditEventsFilter{Username: "test-user", From: "2022-01-01T00:00:00Z", To: "2022-01-01T00:00:00Z"},
+			expectedConnection: model.AuditEventConnection{
+				Edges: []model.AuditEventEdge{{Node: SampleAuditEvent, Cursor: SampleEncoder.Encode(SampleAuditEvent.Id)}},
+				PageInfo: model.PageInfo{
+					EndCursor:   SampleEncoder.Encode(SampleAuditEvent.Id),
+					HasNextPage: true,
+				},
+			},
+		},
+		{
+			name:  "empty page",
+			first: 10,
+			expectedConnection: model.AuditEventConnection{
+				Edges: []model.AuditEventEdge{},
+			},
+		},
+		{
+			name:           "last week before the end time by default",
+			filter:         model.AuditEventsFilter{To: "2022-01-08T12:00:00Z"},
+			first:          10,
+			expectedFilter: model.AuditEventsFilter{From: "2022-01-01T12:00:00Z", To: "2022-01-08T12:00:00Z"},
+			expectedConnection: model.AuditEventConnection{
+				Edges: []model.AuditEventEdge{},
+			},
+		},
+		{
+			name:            "not authorized",
+			authorizer:      FakeAuditAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			first:           10,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:               "invalid input",
+			encoder:            FakeEncoder{decodeErr: assert.AnError},
+			filter:             model.AuditEventsFilter{From: "yesterday", To: "2022-01-01"},
+			first:              101,
+			after:              "bad",
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.first", "input.after", "input.filter.from", "input.filter.to"},
+		},
+		{
+			name:               "cursor isn't an event ID",
+			first:              10,
+			after:              SampleEncoder.Encode("not an event"),
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.after"},
+		},
+		{
+			name:               "times out of order",
+			filter:             model.AuditEventsFilter{From: "2022-01-02T00:00:00Z", To: "2022-01-01T00:00:00Z"},
+			first:              10,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.filter.to"},
+		},
+		{
+			name:               "time range too long",
+			filter:             model.AuditEventsFilter{From: "2022-01-01T00:00:00Z", To: "2022-02-01T00:00:01Z"},
+			first:              10,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.filter.from"},
+		},
+		{
+			name:               "time range too long ending now",
+			filter:             model.AuditEventsFilter{From: "2022-01-01T00:00:00Z"},
+			first:              10,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.filter.from"},
+		},
+		{
+			name:            "query error",
+			auditDao:        FakeAuditDao{queryErr: apperror.NewInternal("error", nil)},
+			first:           10,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewAuditService(&test.auditDao, &test.authorizer, &test.encoder)
+
+		// Execute
+		connection, err := service.List(context.Background(), SampleIdentity, test.filter, test.first, test.after)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedConnection, connection, test.name)
+			if test.filter == (model.AuditEventsFilter{}) {
+				from, err := time.Parse(time.RFC3339, test.auditDao.queryFilter.From)
+				assert.Nil(t, err, test.name)
+				assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), from, time.Minute, test.name)
+			} else {
+				assert.Equal(t, test.expectedFilter, test.auditDao.queryFilter, test.name)
+			}
+			if test.after != "" {
+				assert.Equal(t, "20211231T000000.000000000Z-2", test.auditDao.queryExclusiveStartId, test.name)
+			}
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestAuditRecord(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name              string
+		auditDao          FakeAuditDao
+		arguments         map[string]interface{}
+		decisions         []model.AuthorizationDecision
+		mutationErr       error
+		expectedArguments string
+		expectedDecisions []model.AuthorizationDecision
+		expectedOutcome   string
+		expectedError     string
+		expectErr         bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:              "successful mutation",
+			arguments:         map[string]interface{}{"input": map[string]interface{}{"id": "1", "owners": []interface{}{"user1"}}},
+			decisions:         []model.AuthorizationDecision{SampleDecision},
+			expectedArguments: `{"input":{"id":"1","owners":["user1"]}}`,
+			expectedDecisions: []model.AuthorizationDecision{SampleDecision},
+			expectedOutcome:   model.AuditOutcomeSuccess,
+		},
+		{
+			name:              "failed mutation",
+			arguments:         map[string]interface{}{"input": map[string]interface{}{"id": "1"}},
+			mutationErr:       apperror.NewForbidden("not authorized to delete this pet", nil),
+			expectedArguments: `{"input":{"id":"1"}}`,
+			expectedDecisions: []model.AuthorizationDecision{},
+			expectedOutcome:   string(apperror.CodeForbidden),
+			expectedError:     "not authorized to delete this pet",
+		},
+		{
+			name: "personal data redacted",
+			arguments: map[string]interface{}{"input": map[string]interface{}{
+				"Email":     "someone@example.com",
+				"address":   nil,
+				"name":      "write to someone@example.com",
+				"recipient": "user2",
+				"owners":    []interface{}{"someone@example.com"},
+			}},
+			expectedArguments: `{"input":{"Email":"[REDACTED]","address":null,"name":"write to [REDACTED]","owners":["[REDACTED]"],"recipient":"user2"}}`,
+			expectedDecisions: []model.AuthorizationDecision{},
+			expectedOutcome:   model.AuditOutcomeSuccess,
+		},
+		{
+			name:      "insert error",
+			auditDao:  FakeAuditDao{insertErr: apperror.NewInternal("error", nil)},
+			arguments: map[string]interface{}{},
+			expectErr: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewAuditService(&test.auditDao, &FakeAuditAuthorizer{}, &SampleEncoder)
+		requestor := model.Identity{Username: "test-user", Groups: map[string]bool{"vet": true, "admin": true, "former": false}}
+		before := time.Now().UTC()
+
+		// Execute
+		err := service.Record(context.Background(), requestor, "Mutation.updatePet", test.arguments, test.decisions, test.mutationErr)
+
+		// Verify
+		if test.expectErr {
+			assert.NotNil(t, err, test.name)
+			continue
+		}
+		assert.Nil(t, err, test.name)
+		event := test.auditDao.insertedEvent
+		assert.Equal(t, "test-user", event.Username, test.name)
+		assert.Equal(t, []string{"admin", "vet"}, event.Groups, test.name)
+		assert.Equal(t, "Mutation.updatePet", event.Field, test.name)
+		assert.JSONEq(t, test.expectedArguments, event.Arguments, test.name)
+		assert.Equal(t, test.expectedDecisions, event.Decisions, test.name)
+		assert.Equal(t, test.expectedOutcome, event.Outcome, test.name)
+		assert.Equal(t, test.expectedError, event.Error, test.name)
+		recordedAt, _ := time.Parse(time.RFC3339Nano, event.Time)
+		assert.False(t, recordedAt.Before(before), test.name)
+		assert.Contains(t, event.Id, recordedAt.Format(model.AuditEventIdTimeLayout)+"-", test.name+": IDs start with the time")
+	}
+}
@@ -1,10 +1,16 @@
 package service_test
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
 
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/mcwiet/go-test/pkg/validation"
 )
 
 var (
@@ -16,6 +22,16 @@ var (
 	}
 )
 
+// Gets the path of every violation in a validation error
+func violationPaths(err error) []string {
+	paths := []string{}
+	violations, _ := apperror.InfoOf(err)["violations"].([]validation.Violation)
+	for _, violation := range violations {
+		paths = append(paths, violation.Path)
+	}
+	return paths
+}
+
 type FakeEncoder struct {
 	decodeErr error
 }
@@ -32,44 +48,139 @@ func (e *FakeEncoder) Decode(input string) (string, error) {
 	}
 }
 
+// Authorizer which returns the same error for every action, or only forbids the denied action (if one is given)
 type FakePetAuthorizer struct {
-	IsAuthorizedResult bool
+	authorizeErr       error
+	deniedAction       service.PetAction
+	authorizedTransfer model.PetTransfer
 }
 
-func (f *FakePetAuthorizer) IsAuthorized(model.Identity, model.Pet, service.PetAction) bool {
-	return f.IsAuthorizedResult
+func (f *FakePetAuthorizer) Authorize(_ context.Context, _ model.Identity, _ model.Pet, action service.PetAction) error {
+	if f.deniedAction != service.PetActionUndefined && action == f.deniedAction {
+		return apperror.NewForbidden("not authorized", nil)
+	}
+	return f.authorizeErr
+}
+func (f *FakePetAuthorizer) AuthorizeTransfer(ctx context.Context, identity model.Identity, transfer model.PetTransfer, action service.PetAction) error {
+	f.authorizedTransfer = transfer
+	return f.Authorize(ctx, identity, model.Pet{}, action)
 }
 
 type FakePetDao struct {
-	deleteErr          error
-	getByIdPet         model.Pet
-	getByIdErr         error
-	getTotalCountValue int
-	getTotalCountErr   error
-	insertErr          error
-	queryPets          []model.Pet
-	queryHasNextPage   bool
-	queryErr           error
-	updateErr          error
+	changedBy                  string
+	countByOwnerIncludePrivate bool
+	deleteErr                  error
+	getAsOfPet                 model.Pet
+	getAsOfErr                 error
+	getAsOfTime                time.Time
+	getByIdPet                 model.Pet
+	getByIdErr                 error
+	getDeletedByIdPet          model.Pet
+	getDeletedByIdErr          error
+	getDeletedTotalCountValue  int
+	getDeletedTotalCountErr    error
+	getHistoryCountValue       int
+	getHistoryCountErr         error
+	getTotalCountValue         int
+	getTotalCountErr           error
+	getTotalCountByOwnerValue  int
+	getTotalCountByOwnerErr    error
+	insertedPet                model.Pet
+	insertErr                  error
+	patchErr                   error
+	purgeErr                   error
+	purgedVersion              *int
+	queryPets                  []model.Pet
+	queryHasNextPage           bool
+	queryErr                   error
+	queryByOwnerOwner          string
+	queryByOwnerIncludePrivate bool
+	queryByOwnerPets           []model.Pet
+	queryByOwnerHasNextPage    bool
+	queryByOwnerErr            error
+	queryDeletedPets           []model.Pet
+	queryDeletedErr            error
+	queryHistoryPets           []model.Pet
+	queryHistoryHasNextPage    bool
+	queryHistoryErr            error
+	queryHistoryStartVersion   int
+	restoreErr                 error
 }
 
-func (f *FakePetDao) Delete(string) error {
+func (f *FakePetDao) Delete(_ context.Context, _ string, _ *int, changedBy string) error {
+	f.changedBy = changedBy
 	return f.deleteErr
 }
-func (f *FakePetDao) GetById(string) (model.Pet, error) {
+func (f *FakePetDao) GetAsOf(_ context.Context, _ string, asOf time.Time) (model.Pet, error) {
+	f.getAsOfTime = asOf
+	return f.getAsOfPet, f.getAsOfErr
+}
+func (f *FakePetDao) GetById(context.Context, string) (model.Pet, error) {
 	return f.getByIdPet, f.getByIdErr
 }
-func (f *FakePetDao) GetTotalCount() (int, error) {
+func (f *FakePetDao) GetDeletedById(context.Context, string) (model.Pet, error) {
+	return f.getDeletedByIdPet, f.getDeletedByIdErr
+}
+func (f *FakePetDao) GetDeletedTotalCount(context.Context) (int, error) {
+	return f.getDeletedTotalCountValue, f.getDeletedTotalCountErr
+}
+func (f *FakePetDao) GetHistoryCount(context.Context, string) (int, error) {
+	return f.getHistoryCountValue, f.getHistoryCountErr
+}
+func (f *FakePetDao) GetTotalCount(context.Context) (int, error) {
 	return f.getTotalCountValue, f.getTotalCountErr
 }
-func (f *FakePetDao) Insert(model.Pet) error {
+func (f *FakePetDao) GetTotalCountByOwner(_ context.Context, _ string, includePrivate bool) (int, error) {
+	f.countByOwnerIncludePrivate = includePrivate
+	return f.getTotalCountByOwnerValue, f.getTotalCountByOwnerErr
+}
+func (f *FakePetDao) Insert(_ context.Context, pet model.Pet) error {
+	f.insertedPet = pet
 	return f.insertErr
 }
-func (f *FakePetDao) Query(count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+func (f *FakePetDao) Patch(_ context.Context, _ string, _ int, patch model.PetPatch, changedBy string) (model.Pet, error) {
+	f.changedBy = changedBy
+	pet := f.getByIdPet
+	if patch.Name != nil {
+		pet.Name = *patch.Name
+	}
+	if patch.Age != nil {
+		pet.Age = *patch.Age
+	}
+	if patch.Owners != nil {
+		pet.Owners = model.NewOwners(*patch.Owners...)
+	}
+	if patch.Private != nil {
+		pet.Private = *patch.Private
+	}
+	pet.Version++
+	return pet, f.patchErr
+}
+func (f *FakePetDao) Purge(_ context.Context, _ string, expectedVersion *int) error {
+	f.purgedVersion = expectedVersion
+	return f.purgeErr
+}
+func (f *FakePetDao) Query(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
 	return f.queryPets, f.queryHasNextPage, f.queryErr
 }
-func (f *FakePetDao) Update(pet model.Pet) error {
-	return f.updateErr
+func (f *FakePetDao) QueryByOwner(_ context.Context, owner string, includePrivate bool, _ int, _ string) ([]model.Pet, bool, error) {
+	f.queryByOwnerOwner = owner
+	f.queryByOwnerIncludePrivate = includePrivate
+	return f.queryByOwnerPets, f.queryByOwnerHasNextPage, f.queryByOwnerErr
+}
+func (f *FakePetDao) QueryDeleted(context.Context, int, string) ([]model.Pet, bool, error) {
+	return f.queryDeletedPets, false, f.queryDeletedErr
+}
+func (f *FakePetDao) QueryHistory(_ context.Context, _ string, _ int, exclusiveStartVersion int) ([]model.Pet, bool, error) {
+	f.queryHistoryStartVersion = exclusiveStartVersion
+	return f.queryHistoryPets, f.queryHistoryHasNextPage, f.queryHistoryErr
+}
+func (f *FakePetDao) Restore(_ context.Context, _ string, _ *int, changedBy string) (model.Pet, error) {
+	f.changedBy = changedBy
+	pet := f.getDeletedByIdPet
+	pet.DeletedAt = ""
+	pet.Version++
+	return pet, f.restoreErr
 }
 
 type FakeUserDao struct {
@@ -82,12 +193,149 @@ type FakeUserDao struct {
 	listErr            error
 }
 
-func (u *FakeUserDao) GetByUsername(string) (model.User, error) {
+func (u *FakeUserDao) GetByUsername(context.Context, string) (model.User, error) {
 	return u.getByUsernameUser, u.getByUsernameErr
 }
-func (u *FakeUserDao) GetTotalCount() (int, error) {
+func (u *FakeUserDao) GetTotalCount(context.Context) (int, error) {
 	return u.getTotalCountValue, u.getTotalCountErr
 }
-func (u *FakeUserDao) List(int, string) ([]model.User, string, error) {
+func (u *FakeUserDao) List(context.Context, int, string) ([]model.User, string, error) {
 	return u.listUsers, u.listToken, u.listErr
 }
+
+// User DAO which finds users in a map and counts how often each username is looked up
+type CountingUserDao struct {
+	FakeUserDao
+	users map[string]model.User
+	mutex sync.Mutex
+	calls map[string]int
+}
+
+func (u *CountingUserDao) GetByUsername(_ context.Context, username string) (model.User, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.calls == nil {
+		u.calls = map[string]int{}
+	}
+	u.calls[username]++
+	user, found := u.users[username]
+	if !found {
+		return model.User{}, errors.New("user not found")
+	}
+	return user, nil
+}
+
+// Photo DAO listing listKeys (or, if set, the keys under each prefix in listKeysByPrefix, which is safe for concurrent
+// use and fails for other prefixes)
+type FakePhotoDao struct {
+	listKeys           []string
+	listKeysByPrefix   map[string][]string
+	listKeysErr        error
+	listedPrefix       string
+	presignErr         error
+	presignExpiry      time.Duration
+	presignContentType string
+	presignLength      int64
+	deletedPrefix      string
+	deleteErr          error
+}
+
+func (f *FakePhotoDao) DeleteByPrefix(ctx context.Context, prefix string) error {
+	f.deletedPrefix = prefix
+	return f.deleteErr
+}
+
+func (f *FakePhotoDao) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	if f.listKeysByPrefix != nil {
+		keys, found := f.listKeysByPrefix[prefix]
+		if !found {
+			return nil, apperror.NewInternal("error listing photos", nil)
+		}
+		return keys, nil
+	}
+	f.listedPrefix = prefix
+	return f.listKeys, f.listKeysErr
+}
+func (f *FakePhotoDao) PresignDownload(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	f.presignExpiry = expiry
+	return "https://download/" + key, f.presignErr
+}
+func (f *FakePhotoDao) PresignUpload(ctx context.Context, key string, contentType string, contentLength int64, expiry time.Duration) (string, error) {
+	f.presignExpiry, f.presignContentType, f.presignLength = expiry, contentType, contentLength
+	return "https://upload/" + key, f.presignErr
+}
+
+// Pet transfer DAO which keeps transfers in a map (by pet ID); errors given for an operation are returned instead
+type FakePetTransferDao struct {
+	transfers     map[string]model.PetTransfer
+	deleteErr     error
+	getByPetIdErr error
+	insertErr     error
+	queryByUser   []model.PetTransfer
+	queryErr      error
+}
+
+func (f *FakePetTransferDao) Delete(_ context.Context, petId string) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	if _, exists := f.transfers[petId]; !exists {
+		return apperror.NewNotFound("pet transfer not found", nil)
+	}
+	delete(f.transfers, petId)
+	return nil
+}
+func (f *FakePetTransferDao) GetByPetId(_ context.Context, petId string) (model.PetTransfer, error) {
+	if f.getByPetIdErr != nil {
+		return model.PetTransfer{}, f.getByPetIdErr
+	}
+	transfer, exists := f.transfers[petId]
+	if !exists {
+		return model.PetTransfer{}, apperror.NewNotFound("pet transfer not found", nil)
+	}
+	return transfer, nil
+}
+func (f *FakePetTransferDao) Insert(_ context.Context, transfer model.PetTransfer) error {
+	if f.insertErr != nil {
+		return f.insertErr
+	}
+	if _, exists := f.transfers[transfer.PetId]; exists {
+		return apperror.NewConflict("pet already has a pending transfer", nil)
+	}
+	if f.transfers == nil {
+		f.transfers = map[string]model.PetTransfer{}
+	}
+	f.transfers[transfer.PetId] = transfer
+	return nil
+}
+func (f *FakePetTransferDao) QueryByUser(context.Context, string) ([]model.PetTransfer, error) {
+	return f.queryByUser, f.queryErr
+}
+
+// Authorizer which forbids listing audit events if authorizeErr is set
+type FakeAuditAuthorizer struct {
+	authorizeErr error
+}
+
+func (f *FakeAuditAuthorizer) AuthorizeList(_ context.Context, _ model.Identity) error {
+	return f.authorizeErr
+}
+
+type FakeAuditDao struct {
+	insertedEvent         model.AuditEvent
+	insertErr             error
+	queryEvents           []model.AuditEvent
+	queryHasNextPage      bool
+	queryErr              error
+	queryFilter           model.AuditEventsFilter
+	queryExclusiveStartId string
+}
+
+func (f *FakeAuditDao) Insert(_ context.Context, event model.AuditEvent) error {
+	f.insertedEvent = event
+	return f.insertErr
+}
+func (f *FakeAuditDao) Query(_ context.Context, filter model.AuditEventsFilter, count int, exclusiveStartId string) ([]model.AuditEvent, bool, error) {
+	f.queryFilter, f.queryExclusiveStartId = filter, exclusiveStartId
+	return f.queryEvents, f.queryHasNextPage, f.queryErr
+}
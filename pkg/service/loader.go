@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mcwiet/go-test/pkg/model"
+)
+
+// Maximum number of users fetched from the data store at the same time
+const userLoaderConcurrency = 10
+
+// Loads users by username for the lifetime of a single request; each distinct username is only fetched once
+type UserLoader struct {
+	userDao UserDao
+	mutex   *sync.Mutex
+	cache   map[string]userResult
+}
+
+type userResult struct {
+	user model.User
+	err  error
+}
+
+// Creates a user loader with an empty cache (create one per request so results aren't shared between callers)
+func NewUserLoader(userDao UserDao) UserLoader {
+	return UserLoader{
+		userDao: userDao,
+		mutex:   &sync.Mutex{},
+		cache:   map[string]userResult{},
+	}
+}
+
+// Loads many users at once; users and errors are index aligned with the usernames
+func (l *UserLoader) LoadMany(ctx context.Context, usernames []string) ([]model.User, []error) {
+	// Find the usernames which haven't been loaded yet
+	l.mutex.Lock()
+	missing := []string{}
+	queued := map[string]bool{}
+	for _, username := range usernames {
+		if _, cached := l.cache[username]; !cached && !queued[username] {
+			missing = append(missing, username)
+			queued[username] = true
+		}
+	}
+	l.mutex.Unlock()
+
+	// Fetch the missing users concurrently
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, userLoaderConcurrency)
+	for _, username := range missing {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(username string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			var user model.User
+			err := trace(ctx, "UserDao.GetByUsername", func(ctx context.Context) (err error) {
+				user, err = l.userDao.GetByUsername(ctx, username)
+				return err
+			})
+			l.mutex.Lock()
+			l.cache[username] = userResult{user: user, err: err}
+			l.mutex.Unlock()
+		}(username)
+	}
+	wg.Wait()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	users := make([]model.User, len(usernames))
+	errs := make([]error, len(usernames))
+	for i, username := range usernames {
+		result := l.cache[username]
+		users[i], errs[i] = result.user, result.err
+	}
+
+	return users, errs
+}
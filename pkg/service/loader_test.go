@@ -0,0 +1,39 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserLoaderCachesAcrossCalls(t *testing.T) {
+	// Setup
+	userDao := CountingUserDao{
+		users: map[string]model.User{SampleUser1.Username: SampleUser1},
+	}
+	loader := service.NewUserLoader(&userDao)
+
+	// Execute
+	loader.LoadMany(context.Background(), []string{SampleUser1.Username})
+	users, errs := loader.LoadMany(context.Background(), []string{SampleUser1.Username, SampleUser1.Username})
+
+	// Verify
+	assert.Equal(t, []model.User{SampleUser1, SampleUser1}, users)
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 1, userDao.calls[SampleUser1.Username], "cached user is not fetched again")
+}
+
+func TestUserLoaderEmpty(t *testing.T) {
+	// Setup
+	loader := service.NewUserLoader(&CountingUserDao{})
+
+	// Execute
+	users, errs := loader.LoadMany(context.Background(), []string{})
+
+	// Verify
+	assert.Empty(t, users)
+	assert.Empty(t, errs)
+}
@@ -1,23 +1,38 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/mcwiet/go-test/pkg/validation"
 )
 
 type PetDao interface {
-	Delete(id string) error
-	GetById(id string) (model.Pet, error)
-	GetTotalCount() (int, error)
-	Insert(model.Pet) error
-	Query(count int, exclusiveStartId string) ([]model.Pet, bool, error)
-	Update(model.Pet) error
+	Delete(ctx context.Context, id string, expectedVersion *int, changedBy string) error
+	GetAsOf(ctx context.Context, id string, asOf time.Time) (model.Pet, error)
+	GetById(ctx context.Context, id string) (model.Pet, error)
+	GetDeletedById(ctx context.Context, id string) (model.Pet, error)
+	GetDeletedTotalCount(ctx context.Context) (int, error)
+	GetHistoryCount(ctx context.Context, id string) (int, error)
+	GetTotalCount(ctx context.Context) (int, error)
+	GetTotalCountByOwner(ctx context.Context, owner string, includePrivate bool) (int, error)
+	Insert(ctx context.Context, pet model.Pet) error
+	Patch(ctx context.Context, id string, expectedVersion int, patch model.PetPatch, changedBy string) (model.Pet, error)
+	Purge(ctx context.Context, id string, expectedVersion *int) error
+	Query(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error)
+	QueryByOwner(ctx context.Context, owner string, includePrivate bool, count int, exclusiveStartId string) ([]model.Pet, bool, error)
+	QueryDeleted(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error)
+	QueryHistory(ctx context.Context, id string, count int, exclusiveStartVersion int) ([]model.Pet, bool, error)
+	Restore(ctx context.Context, id string, expectedVersion *int, changedBy string) (model.Pet, error)
 }
 
 type Authorizer interface {
-	IsAuthorized(model.Identity, model.Pet, PetAction) bool
+	Authorize(context.Context, model.Identity, model.Pet, PetAction) error
 }
 
 type CursorEncoder interface {
@@ -29,6 +44,7 @@ type CursorEncoder interface {
 type PetService struct {
 	authorizer Authorizer
 	petDao     PetDao
+	photoDao   PhotoDao
 	userDao    UserDao
 	encoder    CursorEncoder
 }
@@ -38,64 +54,423 @@ type PetAction int
 
 const (
 	PetActionUndefined PetAction = iota
-	PetActionUpdateOwner
+	PetActionUpdate
+	PetActionUploadPhoto
+	PetActionTransfer
+	PetActionAddOwner
+	PetActionRemoveOwner
+	PetActionRemoveLastOwner // leaving a pet which has owners without any
+	PetActionRestore
+	PetActionPurge
+	PetActionListDeleted // the pet is empty, since the action isn't on any one pet
+	PetActionCreate      // the pet is the one about to be created
+	PetActionRead
+	PetActionDelete
+	PetActionReadPrivateOwners // seeing who owns a private pet
+	PetActionUpdatePrivacy
+	PetActionAcceptTransfer  // the pet's only owner is the transfer's recipient
+	PetActionDeclineTransfer // the pet's only owner is the transfer's recipient
 )
 
 // Creates a Pet service object
-func NewPetService(petDao PetDao, userDao UserDao, authorizer Authorizer, encoder CursorEncoder) PetService {
+func NewPetService(petDao PetDao, photoDao PhotoDao, userDao UserDao, authorizer Authorizer, encoder CursorEncoder) PetService {
 	return PetService{
 		authorizer: authorizer,
 		petDao:     petDao,
+		photoDao:   photoDao,
 		userDao:    userDao,
 		encoder:    encoder,
 	}
 }
 
-// Create a new pet
-func (s *PetService) Create(name string, age int, owner string) (model.Pet, error) {
-	pet := model.Pet{
-		Id:    uuid.NewString(),
-		Name:  name,
-		Age:   age,
-		Owner: owner,
+// Create a new pet; its age is worked out from its birth date unless only an age is given
+func (s *PetService) Create(ctx context.Context, requestor model.Identity, input model.CreatePetInput) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.Create")
+	defer func() { span.End(err) }()
+
+	// Authorized before the owners are looked up, so callers can't probe for users
+	err = s.authorize(ctx, requestor, model.Pet{Owners: model.NewOwners(input.Owners...)}, PetActionCreate)
+	if err != nil {
+		return model.Pet{}, err
 	}
-	err := s.petDao.Insert(pet)
-	return pet, err
+
+	now := time.Now()
+	v := validation.NewValidator("input")
+	validatePetName(&v, input.Name)
+	validatePetSpecies(&v, input.Species)
+	validatePetBreed(&v, input.Breed)
+	validatePetBirthDateOrAge(&v, input.BirthDate, input.Age, now)
+	if err := validateOwners(ctx, &v, s.userDao, input.Owners); err != nil {
+		return model.Pet{}, err
+	}
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet = model.Pet{
+		Id:        uuid.NewString(),
+		Name:      input.Name,
+		Species:   input.Species,
+		Breed:     input.Breed,
+		BirthDate: input.BirthDate,
+		Owners:    model.NewOwners(input.Owners...),
+		Private:   input.Private,
+		Version:   1,
+		ChangedBy: requestor.Username,
+		ChangedAt: now.UTC().Format(time.RFC3339),
+	}
+	if input.Age != nil {
+		pet.Age = *input.Age
+	}
+	err = trace(ctx, "PetDao.Insert", func(ctx context.Context) error {
+		return s.petDao.Insert(ctx, pet)
+	})
+	return pet.WithAgeOn(now), err
 }
 
-// Deletes a pet
-func (s *PetService) Delete(id string) error {
-	err := s.petDao.Delete(id)
-	return err
+// Deletes a pet, which can be restored until it is purged
+//
+// The pet is only deleted if it hasn't changed since it was read (or since the expected version, if one is given)
+func (s *PetService) Delete(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) (err error) {
+	ctx, span := tracing.Start(ctx, "PetService.Delete")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	pet, err := s.find(ctx, id, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionDelete)
+	if err != nil {
+		return err
+	}
+
+	return trace(ctx, "PetDao.Delete", func(ctx context.Context) error {
+		return s.petDao.Delete(ctx, id, &pet.Version, requestor.Username)
+	})
 }
 
-// Gets a single pet
-func (s *PetService) GetById(id string) (model.Pet, error) {
-	pet, err := s.petDao.GetById(id)
+// Deletes a pet for good, whether or not it has already been deleted, along with its photos
+//
+// The pet is only purged if it hasn't changed since it was read (or since the expected version, if one is given); its
+// photos are deleted once it is gone, so a purge which fails leaves them in place
+func (s *PetService) Purge(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) (err error) {
+	ctx, span := tracing.Start(ctx, "PetService.Purge")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	pet, err := s.find(ctx, id, expectedVersion)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		var deletedErr error
+		pet, deletedErr = s.findDeleted(ctx, id, expectedVersion)
+		if !apperror.Is(deletedErr, apperror.CodeNotFound) {
+			err = deletedErr // otherwise the pet is reported missing like any other pet
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionPurge)
+	if err != nil {
+		return err
+	}
+
+	err = trace(ctx, "PetDao.Purge", func(ctx context.Context) error {
+		return s.petDao.Purge(ctx, id, &pet.Version)
+	})
+	if err != nil {
+		return err
+	}
+
+	return trace(ctx, "PhotoDao.DeleteByPrefix", func(ctx context.Context) error {
+		return s.photoDao.DeleteByPrefix(ctx, petPhotoPrefix(id))
+	})
+}
+
+// Restores a deleted pet
+//
+// The pet is only restored if it hasn't changed since it was read (or since the expected version, if one is given)
+func (s *PetService) Restore(ctx context.Context, requestor model.Identity, id string, expectedVersion *int) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.Restore")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet, err = s.findDeleted(ctx, id, expectedVersion)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionRestore)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.Restore", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.Restore(ctx, id, &pet.Version, requestor.Username)
+		return err
+	})
+
 	return pet, err
 }
 
+// Gets a single pet
+func (s *PetService) GetById(ctx context.Context, requestor model.Identity, id string) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.GetById")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, id)
+		return err
+	})
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionRead)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+// Gets a pet as it was at the given time (RFC 3339); like the versions History lists, it has the pet's current privacy
+func (s *PetService) GetAsOf(ctx context.Context, requestor model.Identity, id string, asOf string) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.GetAsOf")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	at, parseErr := time.Parse(time.RFC3339, asOf)
+	if parseErr != nil {
+		v.Add("asOf", "must be a timestamp (RFC 3339)")
+	}
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.GetAsOf", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetAsOf(ctx, id, at)
+		return err
+	})
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionRead)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	pet.Private, err = s.currentPrivacy(ctx, id)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+// Lists the versions of a pet (including the current one), newest first, with who made each change and when; the
+// history only goes back to when versions were first recorded, and the requestor must be allowed to read every version
+// in the page
+//
+// Every version has the pet's current privacy rather than its own, so making a pet private hides who owned it before
+func (s *PetService) History(ctx context.Context, requestor model.Identity, id string, first int, after string) (connection model.PetConnection, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.History")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	validateFirst(&v, first)
+	exclusiveStartVersion := 0
+	if after != "" {
+		decoded, err := s.encoder.Decode(after)
+		if err == nil {
+			exclusiveStartVersion, err = strconv.Atoi(decoded)
+		}
+		if err != nil || exclusiveStartVersion < 1 {
+			v.Add("after", "is not a valid cursor")
+		}
+	}
+	if err := v.Err(); err != nil {
+		return model.PetConnection{}, err
+	}
+
+	var pets []model.Pet
+	var hasNextPage bool
+	err = trace(ctx, "PetDao.QueryHistory", func(ctx context.Context) (err error) {
+		pets, hasNextPage, err = s.petDao.QueryHistory(ctx, id, first, exclusiveStartVersion)
+		return err
+	})
+	if err != nil {
+		return model.PetConnection{}, err
+	}
+	if err := s.authorizeEach(ctx, requestor, pets, PetActionRead); err != nil {
+		return model.PetConnection{}, err
+	}
+	private, err := s.currentPrivacy(ctx, id)
+	if err != nil {
+		return model.PetConnection{}, err
+	}
+	versions := make([]model.Pet, len(pets))
+	for i, pet := range pets {
+		pet.Private = private
+		versions[i] = pet
+	}
+
+	var totalCount int
+	err = trace(ctx, "PetDao.GetHistoryCount", func(ctx context.Context) (err error) {
+		totalCount, err = s.petDao.GetHistoryCount(ctx, id)
+		return err
+	})
+	if err != nil {
+		return model.PetConnection{}, err
+	}
+
+	return s.connection(versions, hasNextPage, totalCount, func(pet model.Pet) string {
+		return strconv.Itoa(pet.Version)
+	}), nil
+}
+
 // Lists pets
-func (s *PetService) List(first int, after string) (model.PetConnection, error) {
+func (s *PetService) List(ctx context.Context, requestor model.Identity, first int, after string) (connection model.PetConnection, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.List")
+	defer func() { span.End(err) }()
+
+	return s.list(ctx, requestor, validation.NewValidator("input"), first, after, petQuery{
+		name:      "PetDao.Query",
+		query:     s.petDao.Query,
+		countName: "PetDao.GetTotalCount",
+		count:     s.petDao.GetTotalCount,
+	})
+}
+
+// Lists the pets a user owns; private pets (which would give away who owns them) are only listed, and counted, for
+// requestors allowed to see their owners (the owner themselves or an admin)
+func (s *PetService) ListByOwner(ctx context.Context, requestor model.Identity, owner string, first int, after string) (connection model.PetConnection, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.ListByOwner")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("owner", owner)
+
+	includePrivate := false
+	if owner != "" {
+		err = s.authorize(ctx, requestor, model.Pet{Owners: []string{owner}}, PetActionReadPrivateOwners)
+		if err != nil && !apperror.Is(err, apperror.CodeForbidden) {
+			return model.PetConnection{}, err
+		}
+		includePrivate = err == nil
+	}
+
+	return s.list(ctx, requestor, v, first, after, petQuery{
+		name: "PetDao.QueryByOwner",
+		query: func(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error) {
+			return s.petDao.QueryByOwner(ctx, owner, includePrivate, count, exclusiveStartId)
+		},
+		countName: "PetDao.GetTotalCountByOwner",
+		count: func(ctx context.Context) (int, error) {
+			return s.petDao.GetTotalCountByOwner(ctx, owner, includePrivate)
+		},
+	})
+}
+
+// Lists deleted pets (which can still be restored)
+func (s *PetService) ListDeleted(ctx context.Context, requestor model.Identity, first int, after string) (connection model.PetConnection, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.ListDeleted")
+	defer func() { span.End(err) }()
+
+	err = s.authorize(ctx, requestor, model.Pet{}, PetActionListDeleted)
+	if err != nil {
+		return model.PetConnection{}, err
+	}
+
+	return s.list(ctx, requestor, validation.NewValidator("input"), first, after, petQuery{
+		name:      "PetDao.QueryDeleted",
+		query:     s.petDao.QueryDeleted,
+		countName: "PetDao.GetDeletedTotalCount",
+		count:     s.petDao.GetDeletedTotalCount,
+	})
+}
+
+// DAO calls (and the names of their spans) used to list a set of pets
+type petQuery struct {
+	name      string
+	query     func(ctx context.Context, count int, exclusiveStartId string) ([]model.Pet, bool, error)
+	countName string
+	count     func(ctx context.Context) (int, error)
+}
+
+// Lists a page of the pets found by the query, each of which the requestor must be allowed to read; the validator may
+// already hold violations of other input
+func (s *PetService) list(ctx context.Context, requestor model.Identity, v validation.Validator, first int, after string, q petQuery) (connection model.PetConnection, err error) {
+	validateFirst(&v, first)
 	exclusiveStartId, err := s.encoder.Decode(after)
 	if err != nil {
+		v.Add("after", "is not a valid cursor")
+	}
+	if err := v.Err(); err != nil {
 		return model.PetConnection{}, err
 	}
 
-	pets, hasNextPage, err := s.petDao.Query(first, exclusiveStartId)
+	var pets []model.Pet
+	var hasNextPage bool
+	err = trace(ctx, q.name, func(ctx context.Context) (err error) {
+		pets, hasNextPage, err = q.query(ctx, first, exclusiveStartId)
+		return err
+	})
 	if err != nil {
 		return model.PetConnection{}, err
 	}
+	if err := s.authorizeEach(ctx, requestor, pets, PetActionRead); err != nil {
+		return model.PetConnection{}, err
+	}
 
-	totalCount, err := s.petDao.GetTotalCount()
+	var totalCount int
+	err = trace(ctx, q.countName, func(ctx context.Context) (err error) {
+		totalCount, err = q.count(ctx)
+		return err
+	})
 	if err != nil {
 		return model.PetConnection{}, err
 	}
 
+	return s.connection(pets, hasNextPage, totalCount, func(pet model.Pet) string {
+		return pet.Id
+	}), nil
+}
+
+// Builds a connection from a page of pets; each pet's cursor is the encoded key the page was read after
+func (s *PetService) connection(pets []model.Pet, hasNextPage bool, totalCount int, key func(model.Pet) string) model.PetConnection {
 	endCursor := ""
 	if len(pets) > 0 {
-		lastId := pets[len(pets)-1].Id
-		endCursor = s.encoder.Encode(lastId)
+		endCursor = s.encoder.Encode(key(pets[len(pets)-1]))
 	}
 
 	connection := model.PetConnection{
@@ -109,34 +484,219 @@ func (s *PetService) List(first int, after string) (model.PetConnection, error)
 	for _, pet := range pets {
 		connection.Edges = append(connection.Edges, model.PetEdge{
 			Node:   pet,
-			Cursor: s.encoder.Encode(pet.Id),
+			Cursor: s.encoder.Encode(key(pet)),
 		})
 	}
 
-	return connection, err
+	return connection
 }
 
-// Updates the owner of a pet
-func (s *PetService) UpdateOwner(requestor model.Identity, id string, owner string) (model.Pet, error) {
-	pet, err := s.petDao.GetById(id)
+// Updates the fields set in the patch; fields which aren't set are left unchanged, and the owners can't be changed here
+// (they only change with the new owner's consent, through a transfer)
+//
+// The write only succeeds if the pet hasn't changed since it was read (or since the expected version, if one is given)
+func (s *PetService) Update(ctx context.Context, requestor model.Identity, id string, patch model.PetPatch, expectedVersion *int) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.Update")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	if patch.Name != nil {
+		validatePetName(&v, *patch.Name)
+	}
+	if patch.Species != nil {
+		validatePetSpecies(&v, *patch.Species)
+	}
+	if patch.Breed != nil {
+		validatePetBreed(&v, *patch.Breed)
+	}
+	if patch.BirthDate != nil && patch.Age != nil {
+		v.Add("age", "cannot be given together with birthDate")
+	} else if patch.BirthDate != nil {
+		validatePetBirthDate(&v, *patch.BirthDate, time.Now())
+	} else if patch.Age != nil {
+		validatePetAge(&v, *patch.Age)
+	}
+	if patch.Owners != nil {
+		v.Add("owners", "cannot be changed with updatePet; use requestPetTransfer")
+	}
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet, err = s.find(ctx, id, expectedVersion)
 	if err != nil {
-		return model.Pet{}, errors.New("could not find pet ID " + id)
+		return model.Pet{}, err
 	}
 
-	authorized := s.authorizer.IsAuthorized(requestor, pet, PetActionUpdateOwner)
-	if !authorized {
-		return model.Pet{}, errors.New("not authorized to update the owner on this pet")
+	err = s.authorize(ctx, requestor, pet, PetActionUpdate)
+	if err == nil && patch.Private != nil {
+		err = s.authorize(ctx, requestor, pet, PetActionUpdatePrivacy)
+	}
+	if err != nil {
+		return model.Pet{}, err
 	}
 
-	if owner != "" {
-		_, err = s.userDao.GetByUsername(owner)
-		if err != nil {
-			return model.Pet{}, errors.New(owner + " is not a valid user")
+	// Checks which depend on the stored pet (or other users) happen after authorization so callers can't probe pets
+	// they can't change
+	if patch.Age != nil && pet.BirthDate != "" {
+		v.Add("age", "cannot be set on a pet with a birthDate") // it would be ignored in favour of the birth date
+	}
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.Patch", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.Patch(ctx, id, pet.Version, patch, requestor.Username)
+		return err
+	})
+
+	return pet, err
+}
+
+// Removes a user from the owners of a pet; only admins may remove the last owner
+//
+// The write only succeeds if the pet hasn't changed since it was read (or since the expected version, if one is given)
+func (s *PetService) RemoveOwner(ctx context.Context, requestor model.Identity, id string, owner string, expectedVersion *int) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetService.RemoveOwner")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("id", id)
+	v.Required("owner", owner)
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet, err = s.find(ctx, id, expectedVersion)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = s.authorize(ctx, requestor, pet, PetActionRemoveOwner)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	if !pet.HasOwner(owner) {
+		v.Add("owner", "doesn't own the pet")
+	}
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+	owners := []string{}
+	for _, current := range pet.Owners {
+		if current != owner {
+			owners = append(owners, current)
 		}
 	}
+	if err := s.authorizeOwners(ctx, requestor, pet, owners); err != nil {
+		return model.Pet{}, err
+	}
 
-	pet.Owner = owner
-	err = s.petDao.Update(pet)
+	err = trace(ctx, "PetDao.Patch", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.Patch(ctx, id, pet.Version, model.PetPatch{Owners: &owners}, requestor.Username)
+		return err
+	})
 
 	return pet, err
 }
+
+// Gets a pet which is about to be changed; a missing pet is reported with its ID, and a pet which has moved on from the
+// expected version (if one is given) is reported as a conflict
+func (s *PetService) find(ctx context.Context, id string, expectedVersion *int) (pet model.Pet, err error) {
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, id)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.Pet{}, apperror.NewNotFound("could not find pet ID "+id, err).With("id", id)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+
+	if err := checkVersion(pet, expectedVersion); err != nil {
+		return model.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+// Gets a deleted pet which is about to be restored or purged; like find, a missing pet is reported with its ID, and a
+// pet which has moved on from the expected version (if one is given) is reported as a conflict
+func (s *PetService) findDeleted(ctx context.Context, id string, expectedVersion *int) (pet model.Pet, err error) {
+	err = trace(ctx, "PetDao.GetDeletedById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetDeletedById(ctx, id)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.Pet{}, apperror.NewNotFound("could not find deleted pet ID "+id, err).With("id", id)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+
+	if err := checkVersion(pet, expectedVersion); err != nil {
+		return model.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+// Gets whether a pet is private now, whether or not it has been deleted; a pet which can't be found any more is treated
+// as private
+func (s *PetService) currentPrivacy(ctx context.Context, id string) (private bool, err error) {
+	var pet model.Pet
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, id)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		err = trace(ctx, "PetDao.GetDeletedById", func(ctx context.Context) (err error) {
+			pet, err = s.petDao.GetDeletedById(ctx, id)
+			return err
+		})
+	}
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return pet.Private, nil
+}
+
+// Checks the requestor may give the pet the (new) owners; only admins may leave a pet which has owners without any
+func (s *PetService) authorizeOwners(ctx context.Context, requestor model.Identity, pet model.Pet, owners []string) error {
+	if len(owners) == 0 && len(pet.Owners) > 0 {
+		return s.authorize(ctx, requestor, pet, PetActionRemoveLastOwner)
+	}
+	return nil
+}
+
+// Checks the requestor may perform the action on the pet
+func (s *PetService) authorize(ctx context.Context, requestor model.Identity, pet model.Pet, action PetAction) error {
+	return trace(ctx, "Authorizer.Authorize", func(ctx context.Context) error {
+		return s.authorizer.Authorize(ctx, requestor, pet, action)
+	})
+}
+
+// Checks the requestor may perform the action on every pet
+func (s *PetService) authorizeEach(ctx context.Context, requestor model.Identity, pets []model.Pet, action PetAction) error {
+	for _, pet := range pets {
+		if err := s.authorize(ctx, requestor, pet, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks a pet is still at the expected version (if one is given)
+func checkVersion(pet model.Pet, expectedVersion *int) error {
+	if expectedVersion != nil && *expectedVersion != pet.Version {
+		return apperror.NewConflict("pet has been changed since the expected version", nil).
+			With("expectedVersion", *expectedVersion).
+			With("currentVersion", pet.Version)
+	}
+	return nil
+}
@@ -1,27 +1,35 @@
 package service_test
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/authorization"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/openlyinc/pointy"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	SamplePet1 = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "pet 1",
-		Age:   12,
-		Owner: "User 1",
+		Id:      uuid.NewString(),
+		Name:    "pet 1",
+		Age:     12,
+		Owners:  []string{"User 1"},
+		Version: 3,
 	}
 	SamplePet2 = model.Pet{
-		Id:    uuid.NewString(),
-		Name:  "pet 2",
-		Age:   20,
-		Owner: "User 2",
+		Id:      uuid.NewString(),
+		Name:    "pet 2",
+		Age:     20,
+		Owners:  []string{"User 2"},
+		Version: 1,
 	}
 	SamplePet1Edge = model.PetEdge{
 		Node:   SamplePet1,
@@ -36,59 +44,165 @@ var (
 func TestPetCreate(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name      string
-		petDao    FakePetDao
-		petName   string
-		petAge    int
-		petOwner  string
-		expectErr bool
+		name               string
+		petDao             FakePetDao
+		authorizer         FakePetAuthorizer
+		userDao            FakeUserDao
+		input              model.CreatePetInput
+		expectedAge        int
+		expectErr          bool
+		expectedViolations []string
 	}
 
 	// Define tests
+	threeYearsAgo := time.Now().AddDate(-3, 0, -1).Format(model.DateLayout)
 	tests := []Test{
 		{
-			name:      "valid create",
-			petDao:    FakePetDao{},
-			petName:   SamplePet1.Name,
-			petAge:    SamplePet1.Age,
-			petOwner:  SamplePet1.Owner,
-			expectErr: false,
+			name:        "valid create",
+			petDao:      FakePetDao{},
+			userDao:     FakeUserDao{getByUsernameUser: SampleUser1},
+			input:       model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age, Owners: SamplePet1.Owners},
+			expectedAge: SamplePet1.Age,
+			expectErr:   false,
+		},
+		{
+			name:        "valid create with co-owners",
+			petDao:      FakePetDao{},
+			userDao:     FakeUserDao{getByUsernameUser: SampleUser1},
+			input:       model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age, Owners: []string{"User 2", "User 1", "User 2"}},
+			expectedAge: SamplePet1.Age,
+			expectErr:   false,
+		},
+		{
+			name:        "valid create without owner",
+			petDao:      FakePetDao{},
+			userDao:     FakeUserDao{getByUsernameErr: assert.AnError},
+			input:       model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age},
+			expectedAge: SamplePet1.Age,
+			expectErr:   false,
+		},
+		{
+			name:   "valid create with species, breed and birth date",
+			petDao: FakePetDao{},
+			input: model.CreatePetInput{
+				Name:      SamplePet1.Name,
+				Species:   model.SpeciesDog,
+				Breed:     "Beagle",
+				BirthDate: threeYearsAgo,
+			},
+			expectedAge: 3,
+			expectErr:   false,
 		},
 		{
 			name:      "DAO insert error",
 			petDao:    FakePetDao{insertErr: errors.New("dao error")},
-			petName:   SamplePet1.Name,
-			petAge:    SamplePet1.Age,
+			input:     model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age},
 			expectErr: true,
 		},
+		{
+			name:      "user DAO get error",
+			petDao:    FakePetDao{},
+			userDao:   FakeUserDao{getByUsernameErr: assert.AnError},
+			input:     model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age, Owners: SamplePet1.Owners},
+			expectErr: true,
+		},
+		{
+			name:               "every invalid field is reported",
+			petDao:             FakePetDao{},
+			userDao:            FakeUserDao{getByUsernameErr: apperror.NewNotFound("user not found", nil)},
+			input:              model.CreatePetInput{Name: " ", Species: "DRAGON", Breed: strings.Repeat("a", 51), Age: pointy.Int(-1), Owners: []string{"unknown", ""}},
+			expectErr:          true,
+			expectedViolations: []string{"input.name", "input.species", "input.breed", "input.age", "input.owners[0]", "input.owners[1]"},
+		},
+		{
+			name:               "name too long and age too high",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: strings.Repeat("a", 51), Age: pointy.Int(101)},
+			expectErr:          true,
+			expectedViolations: []string{"input.name", "input.age"},
+		},
+		{
+			name:               "neither birth date nor age",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: SamplePet1.Name},
+			expectErr:          true,
+			expectedViolations: []string{"input.birthDate"},
+		},
+		{
+			name:               "both birth date and age",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: SamplePet1.Name, BirthDate: threeYearsAgo, Age: pointy.Int(3)},
+			expectErr:          true,
+			expectedViolations: []string{"input.age"},
+		},
+		{
+			name:               "birth date is not a date",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: SamplePet1.Name, BirthDate: "03/04/2020"},
+			expectErr:          true,
+			expectedViolations: []string{"input.birthDate"},
+		},
+		{
+			name:               "birth date is in the future",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: SamplePet1.Name, BirthDate: time.Now().AddDate(0, 0, 2).Format(model.DateLayout)},
+			expectErr:          true,
+			expectedViolations: []string{"input.birthDate"},
+		},
+		{
+			name:               "birth date is too long ago",
+			petDao:             FakePetDao{},
+			input:              model.CreatePetInput{Name: SamplePet1.Name, BirthDate: "1900-01-01"},
+			expectErr:          true,
+			expectedViolations: []string{"input.birthDate"},
+		},
+		{
+			name:       "not authorized",
+			petDao:     FakePetDao{},
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionCreate},
+			userDao:    FakeUserDao{getByUsernameUser: SampleUser1},
+			input:      model.CreatePetInput{Name: SamplePet1.Name, Age: &SamplePet1.Age, Owners: SamplePet1.Owners},
+			expectErr:  true,
+		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		service := service.NewPetService(&test.petDao, nil, nil, nil)
+		service := service.NewPetService(&test.petDao, nil, &test.userDao, &test.authorizer, nil)
 
 		// Execute
-		pet, err := service.Create(test.petName, test.petAge, test.petOwner)
+		pet, err := service.Create(context.Background(), SampleIdentity, test.input)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
 			_, uuidErr := uuid.Parse(pet.Id)
 			assert.Nil(t, uuidErr, test.name)
-			assert.Equal(t, pet.Name, test.petName, test.name)
-			assert.Equal(t, pet.Age, test.petAge, test.name)
+			assert.Equal(t, test.input.Name, pet.Name, test.name)
+			assert.Equal(t, test.input.Species, pet.Species, test.name)
+			assert.Equal(t, test.input.Breed, pet.Breed, test.name)
+			assert.Equal(t, test.input.BirthDate, pet.BirthDate, test.name)
+			assert.Equal(t, test.expectedAge, pet.Age, test.name)
+			assert.Equal(t, model.NewOwners(test.input.Owners...), pet.Owners, test.name)
+			assert.Equal(t, 1, pet.Version, test.name)
+			assert.Equal(t, SampleIdentity.Username, test.petDao.insertedPet.ChangedBy, test.name)
+			_, timeErr := time.Parse(time.RFC3339, test.petDao.insertedPet.ChangedAt)
+			assert.Nil(t, timeErr, test.name)
 		} else {
 			assert.NotNil(t, err, test.name)
 		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
 	}
 }
-
 func TestPetGetById(t *testing.T) {
 	// Define test struct
 	type Test struct {
 		name        string
 		petDao      FakePetDao
+		authorizer  FakePetAuthorizer
 		petId       string
 		expectedPet model.Pet
 		expectErr   bool
@@ -110,15 +224,22 @@ func TestPetGetById(t *testing.T) {
 			expectedPet: SamplePet1,
 			expectErr:   true,
 		},
+		{
+			name:       "not authorized",
+			petDao:     FakePetDao{getByIdPet: SamplePet1},
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionRead},
+			petId:      SamplePet1.Id,
+			expectErr:  true,
+		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		service := service.NewPetService(&test.petDao, nil, nil, &SampleEncoder)
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &SampleEncoder)
 
 		// Execute
-		pet, err := service.GetById(test.petId)
+		pet, err := service.GetById(context.Background(), SampleIdentity, test.petId)
 
 		// Verify
 		if !test.expectErr {
@@ -130,39 +251,645 @@ func TestPetGetById(t *testing.T) {
 	}
 }
 
-func TestPetDelete(t *testing.T) {
+func TestPetGetAsOf(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name      string
-		petDao    FakePetDao
-		petId     string
-		expectErr bool
+		name               string
+		petDao             FakePetDao
+		authorizer         FakePetAuthorizer
+		petId              string
+		asOf               string
+		expectedPet        model.Pet
+		expectedTime       time.Time
+		expectErr          bool
+		expectedViolations []string
 	}
+	privatePet := SamplePet1
+	privatePet.Private = true
 
 	// Define tests
 	tests := []Test{
 		{
-			name:      "valid delete",
-			petDao:    FakePetDao{deleteErr: nil},
+			name:         "valid get as of",
+			petDao:       FakePetDao{getAsOfPet: SamplePet1},
+			petId:        SamplePet1.Id,
+			asOf:         "2022-06-01T12:00:00+02:00",
+			expectedPet:  SamplePet1,
+			expectedTime: time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC),
+			expectErr:    false,
+		},
+		{
+			name:         "version of a pet which is private now",
+			petDao:       FakePetDao{getAsOfPet: SamplePet1, getByIdPet: privatePet},
+			petId:        SamplePet1.Id,
+			asOf:         "2022-06-01T12:00:00Z",
+			expectedPet:  privatePet,
+			expectedTime: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectErr:    false,
+		},
+		{
+			name:         "private version of a pet which is public now",
+			petDao:       FakePetDao{getAsOfPet: privatePet, getByIdPet: SamplePet1},
+			petId:        SamplePet1.Id,
+			asOf:         "2022-06-01T12:00:00Z",
+			expectedPet:  SamplePet1,
+			expectedTime: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectErr:    false,
+		},
+		{
+			name:         "version of a deleted pet which is private",
+			petDao:       FakePetDao{getAsOfPet: SamplePet1, getByIdErr: apperror.NewNotFound("pet not found", nil), getDeletedByIdPet: privatePet},
+			petId:        SamplePet1.Id,
+			asOf:         "2022-06-01T12:00:00Z",
+			expectedPet:  privatePet,
+			expectedTime: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectErr:    false,
+		},
+		{
+			name:         "version of a pet which can't be found any more",
+			petDao:       FakePetDao{getAsOfPet: SamplePet1, getByIdErr: apperror.NewNotFound("pet not found", nil), getDeletedByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:        SamplePet1.Id,
+			asOf:         "2022-06-01T12:00:00Z",
+			expectedPet:  privatePet,
+			expectedTime: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectErr:    false,
+		},
+		{
+			name:      "DAO error getting the current pet",
+			petDao:    FakePetDao{getAsOfPet: SamplePet1, getByIdErr: assert.AnError},
 			petId:     SamplePet1.Id,
-			expectErr: false,
+			asOf:      "2022-06-01T12:00:00Z",
+			expectErr: true,
+		},
+		{
+			name:               "missing id and invalid time",
+			petDao:             FakePetDao{},
+			petId:              "",
+			asOf:               "yesterday",
+			expectErr:          true,
+			expectedViolations: []string{"input.id", "input.asOf"},
+		},
+		{
+			name:      "DAO get error",
+			petDao:    FakePetDao{getAsOfErr: apperror.NewNotFound("pet not found", nil)},
+			petId:     SamplePet1.Id,
+			asOf:      "2022-06-01T12:00:00Z",
+			expectErr: true,
+		},
+		{
+			name:       "not authorized",
+			petDao:     FakePetDao{getAsOfPet: SamplePet1},
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionRead},
+			petId:      SamplePet1.Id,
+			asOf:       "2022-06-01T12:00:00Z",
+			expectErr:  true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &SampleEncoder)
+
+		// Execute
+		pet, err := service.GetAsOf(context.Background(), SampleIdentity, test.petId, test.asOf)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPet, pet, test.name)
+			assert.True(t, test.expectedTime.Equal(test.petDao.getAsOfTime), test.name)
+		} else {
+			assert.NotNil(t, err, test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetHistory(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                 string
+		petDao               FakePetDao
+		authorizer           FakePetAuthorizer
+		encoder              FakeEncoder
+		first                int
+		after                string
+		expectedStartVersion int
+		expectedConnection   model.PetConnection
+		expectErr            bool
+		expectedViolations   []string
+	}
+
+	version2 := SamplePet1
+	version2.Version = 2
+	version1 := SamplePet1
+	version1.Version = 1
+	privateVersion2 := version2
+	privateVersion2.Private = true
+	privateVersion1 := version1
+	privateVersion1.Private = true
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "newest versions",
+			petDao: FakePetDao{
+				queryHistoryPets:        []model.Pet{version2, version1},
+				queryHistoryHasNextPage: true,
+				getHistoryCountValue:    3,
+			},
+			encoder: SampleEncoder,
+			first:   2,
+			expectedConnection: model.PetConnection{
+				TotalCount: 3,
+				Edges: []model.PetEdge{
+					{Node: version2, Cursor: SampleEncoder.Encode("2")},
+					{Node: version1, Cursor: SampleEncoder.Encode("1")},
+				},
+				PageInfo: model.PageInfo{EndCursor: SampleEncoder.Encode("1"), HasNextPage: true},
+			},
+		},
+		{
+			name: "versions after a cursor",
+			petDao: FakePetDao{
+				queryHistoryPets:     []model.Pet{version1},
+				getHistoryCountValue: 2,
+			},
+			encoder:              SampleEncoder,
+			first:                2,
+			after:                SampleEncoder.Encode("2"),
+			expectedStartVersion: 2,
+			expectedConnection: model.PetConnection{
+				TotalCount: 2,
+				Edges:      []model.PetEdge{{Node: version1, Cursor: SampleEncoder.Encode("1")}},
+				PageInfo:   model.PageInfo{EndCursor: SampleEncoder.Encode("1"), HasNextPage: false},
+			},
+		},
+		{
+			name: "versions of a pet which is private now",
+			petDao: FakePetDao{
+				queryHistoryPets:     []model.Pet{version2, privateVersion1},
+				getByIdPet:           privateVersion1,
+				getHistoryCountValue: 2,
+			},
+			encoder: SampleEncoder,
+			first:   2,
+			expectedConnection: model.PetConnection{
+				TotalCount: 2,
+				Edges: []model.PetEdge{
+					{Node: privateVersion2, Cursor: SampleEncoder.Encode("2")},
+					{Node: privateVersion1, Cursor: SampleEncoder.Encode("1")},
+				},
+				PageInfo: model.PageInfo{EndCursor: SampleEncoder.Encode("1"), HasNextPage: false},
+			},
+		},
+		{
+			name: "private versions of a pet which is public now",
+			petDao: FakePetDao{
+				queryHistoryPets:     []model.Pet{version2, privateVersion1},
+				getByIdPet:           version2,
+				getHistoryCountValue: 2,
+			},
+			encoder: SampleEncoder,
+			first:   2,
+			expectedConnection: model.PetConnection{
+				TotalCount: 2,
+				Edges: []model.PetEdge{
+					{Node: version2, Cursor: SampleEncoder.Encode("2")},
+					{Node: version1, Cursor: SampleEncoder.Encode("1")},
+				},
+				PageInfo: model.PageInfo{EndCursor: SampleEncoder.Encode("1"), HasNextPage: false},
+			},
+		},
+		{
+			name:      "DAO error getting the current pet",
+			petDao:    FakePetDao{queryHistoryPets: []model.Pet{version2}, getByIdErr: assert.AnError},
+			encoder:   SampleEncoder,
+			first:     2,
+			expectErr: true,
+		},
+		{
+			name:               "cursor isn't a version",
+			encoder:            SampleEncoder,
+			first:              2,
+			after:              SampleEncoder.Encode(SamplePet1.Id),
+			expectErr:          true,
+			expectedViolations: []string{"input.after"},
+		},
+		{
+			name:               "invalid first and cursor",
+			encoder:            FakeEncoder{decodeErr: assert.AnError},
+			first:              -1,
+			after:              "bad cursor",
+			expectErr:          true,
+			expectedViolations: []string{"input.first", "input.after"},
+		},
+		{
+			name:      "DAO query error",
+			petDao:    FakePetDao{queryHistoryErr: assert.AnError},
+			encoder:   SampleEncoder,
+			first:     2,
+			expectErr: true,
+		},
+		{
+			name:      "DAO count error",
+			petDao:    FakePetDao{getHistoryCountErr: assert.AnError},
+			encoder:   SampleEncoder,
+			first:     2,
+			expectErr: true,
+		},
+		{
+			name:       "not authorized",
+			petDao:     FakePetDao{queryHistoryPets: []model.Pet{SamplePet1}},
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionRead},
+			encoder:    SampleEncoder,
+			first:      2,
+			expectErr:  true,
 		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		// Setup
-		service := service.NewPetService(&test.petDao, nil, nil, nil)
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &test.encoder)
 
 		// Execute
-		err := service.Delete(test.petId)
+		connection, err := service.History(context.Background(), SampleIdentity, SamplePet1.Id, test.first, test.after)
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedConnection, connection, test.name)
+			assert.Equal(t, test.expectedStartVersion, test.petDao.queryHistoryStartVersion, test.name)
 		} else {
 			assert.NotNil(t, err, test.name)
 		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetDelete(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		petDao          FakePetDao
+		authorizer      FakePetAuthorizer
+		petId           string
+		expectedVersion *int
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:   "valid delete",
+			petDao: FakePetDao{getByIdPet: SamplePet1},
+			petId:  SamplePet1.Id,
+		},
+		{
+			name:            "valid delete with expected version",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(SamplePet1.Version),
+		},
+		{
+			name:            "missing id",
+			petId:           "",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "invalid expected version",
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(0),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "version conflict",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(SamplePet1.Version - 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "not authorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionDelete},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "pet changed since it was read",
+			petDao:          FakePetDao{getByIdPet: SamplePet1, deleteErr: apperror.NewConflict("pet has been changed", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, nil)
+
+		// Execute
+		err := service.Delete(context.Background(), SampleIdentity, test.petId, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, SampleIdentity.Username, test.petDao.changedBy, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetPurge(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		petDao          FakePetDao
+		photoDao        FakePhotoDao
+		authorizer      FakePetAuthorizer
+		petId           string
+		expectedVersion *int
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	deletedPet := SamplePet1
+	deletedPet.DeletedAt = "2022-01-01T00:00:00Z"
+	notFoundErr := apperror.NewNotFound("pet not found", nil)
+
+	// Define tests
+	tests := []Test{
+		{
+			name:   "valid purge",
+			petDao: FakePetDao{getByIdPet: SamplePet1},
+			petId:  SamplePet1.Id,
+		},
+		{
+			name:   "valid purge of deleted pet",
+			petDao: FakePetDao{getByIdErr: notFoundErr, getDeletedByIdPet: deletedPet},
+			petId:  SamplePet1.Id,
+		},
+		{
+			name:            "missing id",
+			petId:           "",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: notFoundErr, getDeletedByIdErr: notFoundErr},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "error getting deleted pet",
+			petDao:          FakePetDao{getByIdErr: notFoundErr, getDeletedByIdErr: assert.AnError},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "version conflict",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(SamplePet1.Version - 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "not authorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionPurge},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "purge error",
+			petDao:          FakePetDao{getByIdPet: SamplePet1, purgeErr: assert.AnError},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "photo delete error",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			photoDao:        FakePhotoDao{deleteErr: apperror.NewInternal("error deleting photos", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, &test.photoDao, nil, &test.authorizer, nil)
+
+		// Execute
+		err := service.Purge(context.Background(), SampleIdentity, test.petId, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, pointy.Int(SamplePet1.Version), test.petDao.purgedVersion, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if !test.expectErr || test.photoDao.deleteErr != nil {
+			assert.Equal(t, "pets/"+SamplePet1.Id+"/photos/", test.photoDao.deletedPrefix, test.name)
+		} else {
+			assert.Equal(t, "", test.photoDao.deletedPrefix, test.name+": photos are kept")
+		}
+	}
+}
+
+func TestPetRestore(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		petDao          FakePetDao
+		authorizer      FakePetAuthorizer
+		petId           string
+		expectedVersion *int
+		expectedPet     model.Pet
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	deletedPet := SamplePet1
+	deletedPet.DeletedAt = "2022-01-01T00:00:00Z"
+	restoredPet := SamplePet1
+	restoredPet.Version++
+
+	// Define tests
+	tests := []Test{
+		{
+			name:        "valid restore",
+			petDao:      FakePetDao{getDeletedByIdPet: deletedPet},
+			petId:       SamplePet1.Id,
+			expectedPet: restoredPet,
+		},
+		{
+			name:            "valid restore with expected version",
+			petDao:          FakePetDao{getDeletedByIdPet: deletedPet},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(SamplePet1.Version),
+			expectedPet:     restoredPet,
+		},
+		{
+			name:            "missing id",
+			petId:           "",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "deleted pet not found",
+			petDao:          FakePetDao{getDeletedByIdErr: apperror.NewNotFound("deleted pet not found", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "version conflict",
+			petDao:          FakePetDao{getDeletedByIdPet: deletedPet},
+			petId:           SamplePet1.Id,
+			expectedVersion: pointy.Int(SamplePet1.Version - 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "not authorized",
+			petDao:          FakePetDao{getDeletedByIdPet: deletedPet},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionRestore},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "restore error",
+			petDao:          FakePetDao{getDeletedByIdPet: deletedPet, restoreErr: assert.AnError},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, nil)
+
+		// Execute
+		pet, err := service.Restore(context.Background(), SampleIdentity, test.petId, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPet, pet, test.name)
+			assert.Equal(t, SampleIdentity.Username, test.petDao.changedBy, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetListDeleted(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		authorizer         FakePetAuthorizer
+		first              int
+		expectedConnection model.PetConnection
+		expectErr          bool
+		expectedErrCode    apperror.Code
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name: "list deleted pets",
+			petDao: FakePetDao{
+				getDeletedTotalCountValue: 1,
+				queryDeletedPets:          []model.Pet{SamplePet1},
+			},
+			first: 10,
+			expectedConnection: model.PetConnection{
+				TotalCount: 1,
+				Edges:      []model.PetEdge{SamplePet1Edge},
+				PageInfo: model.PageInfo{
+					EndCursor:   SampleEncoder.Encode(SamplePet1.Id),
+					HasNextPage: false,
+				},
+			},
+		},
+		{
+			name:            "not authorized",
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionListDeleted},
+			first:           10,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "invalid first",
+			first:           -1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "query error",
+			petDao:          FakePetDao{queryDeletedErr: assert.AnError},
+			first:           10,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "count error",
+			petDao:          FakePetDao{getDeletedTotalCountErr: assert.AnError},
+			first:           10,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &SampleEncoder)
+
+		// Execute
+		connection, err := service.ListDeleted(context.Background(), SampleIdentity, test.first, "")
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedConnection, connection, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
 	}
 }
 
@@ -171,6 +898,7 @@ func TestPetList(t *testing.T) {
 	type Test struct {
 		name               string
 		petDao             FakePetDao
+		authorizer         FakePetAuthorizer
 		encoder            FakeEncoder
 		first              int
 		after              string
@@ -247,6 +975,22 @@ func TestPetList(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name:      "first above max page size",
+			petDao:    FakePetDao{},
+			encoder:   SampleEncoder,
+			first:     101,
+			after:     "",
+			expectErr: true,
+		},
+		{
+			name:      "negative first",
+			petDao:    FakePetDao{},
+			encoder:   SampleEncoder,
+			first:     -1,
+			after:     "",
+			expectErr: true,
+		},
 		{
 			name: "decode error",
 			petDao: FakePetDao{
@@ -282,15 +1026,26 @@ func TestPetList(t *testing.T) {
 			after:     "",
 			expectErr: true,
 		},
+		{
+			name: "not authorized",
+			petDao: FakePetDao{
+				getTotalCountValue: 2,
+				queryPets:          []model.Pet{SamplePet1, SamplePet2},
+			},
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionRead},
+			encoder:    SampleEncoder,
+			first:      2,
+			expectErr:  true,
+		},
 	}
 
 	//Run tests
 	for _, test := range tests {
 		// Setup
-		service := service.NewPetService(&test.petDao, nil, nil, &test.encoder)
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &test.encoder)
 
 		// Execute
-		pets, err := service.List(test.first, test.after)
+		pets, err := service.List(context.Background(), SampleIdentity, test.first, test.after)
 
 		// Verify
 		if !test.expectErr {
@@ -302,126 +1057,435 @@ func TestPetList(t *testing.T) {
 	}
 }
 
-func TestPetUpdateOwner(t *testing.T) {
+func TestPetListByOwner(t *testing.T) {
 	// Define test struct
 	type Test struct {
-		name       string
-		petDao     FakePetDao
-		userDao    FakeUserDao
-		authorizer FakePetAuthorizer
-		petId      string
-		petOwner   string
-		expectErr  bool
+		name                 string
+		petDao               FakePetDao
+		authorizer           FakePetAuthorizer
+		owner                string
+		first                int
+		expectedConnection   model.PetConnection
+		expectIncludePrivate bool
+		expectErr            bool
+		expectedErrCode      apperror.Code
 	}
 
 	// Define tests
 	tests := []Test{
 		{
-			name: "valid update owner",
+			name: "list owner's pets",
 			petDao: FakePetDao{
-				getByIdPet: SamplePet1,
-			},
-			userDao: FakeUserDao{
-				getByUsernameUser: SampleUser1,
+				getTotalCountByOwnerValue: 2,
+				queryByOwnerPets:          []model.Pet{SamplePet1},
+				queryByOwnerHasNextPage:   true,
 			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: true,
+			owner: SamplePet1.Owners[0],
+			first: 1,
+			expectedConnection: model.PetConnection{
+				TotalCount: 2,
+				Edges:      []model.PetEdge{SamplePet1Edge},
+				PageInfo: model.PageInfo{
+					EndCursor:   SampleEncoder.Encode(SamplePet1.Id),
+					HasNextPage: true,
+				},
 			},
-			petId:     SamplePet1.Id,
-			petOwner:  SampleUser1.Username,
-			expectErr: false,
+			expectIncludePrivate: true,
+			expectErr:            false,
 		},
 		{
-			name: "remove owner (empty string)",
+			name: "private pets left out for a requestor who can't see their owners",
 			petDao: FakePetDao{
-				getByIdPet: SamplePet1,
+				getTotalCountByOwnerValue: 1,
+				queryByOwnerPets:          []model.Pet{SamplePet1},
 			},
-			userDao: FakeUserDao{
-				getByUsernameUser: SampleUser1,
-			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: true,
+			authorizer: FakePetAuthorizer{deniedAction: service.PetActionReadPrivateOwners},
+			owner:      SamplePet1.Owners[0],
+			first:      1,
+			expectedConnection: model.PetConnection{
+				TotalCount: 1,
+				Edges:      []model.PetEdge{SamplePet1Edge},
+				PageInfo: model.PageInfo{
+					EndCursor: SampleEncoder.Encode(SamplePet1.Id),
+				},
 			},
-			petId:     SamplePet1.Id,
-			petOwner:  "",
-			expectErr: false,
+			expectIncludePrivate: false,
+			expectErr:            false,
 		},
 		{
-			name: "unauthorized",
-			petDao: FakePetDao{
-				updateErr: assert.AnError,
-			},
-			userDao: FakeUserDao{
-				getByUsernameUser: SampleUser1,
-			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: false,
-			},
-			petId:     SamplePet1.Id,
-			petOwner:  SampleUser1.Username,
-			expectErr: true,
+			name:            "authorizer error",
+			petDao:          FakePetDao{},
+			authorizer:      FakePetAuthorizer{authorizeErr: assert.AnError},
+			owner:           SamplePet1.Owners[0],
+			first:           1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "missing owner",
+			petDao:          FakePetDao{},
+			owner:           "",
+			first:           1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
 		},
 		{
-			name: "user DAO get error",
+			name: "DAO total count error",
 			petDao: FakePetDao{
-				getByIdPet: SamplePet1,
+				getTotalCountByOwnerErr: assert.AnError,
 			},
-			userDao: FakeUserDao{
-				getByUsernameErr: assert.AnError,
-			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: true,
-			},
-			petId:     SamplePet1.Id,
-			petOwner:  SampleUser1.Username,
-			expectErr: true,
+			owner:           SamplePet1.Owners[0],
+			first:           1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
 		},
 		{
-			name: "pet DAO get error",
+			name: "DAO query error",
 			petDao: FakePetDao{
-				getByIdErr: assert.AnError,
-			},
-			userDao: FakeUserDao{
-				getByUsernameUser: SampleUser1,
+				queryByOwnerErr: assert.AnError,
 			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: true,
-			},
-			petId:     SamplePet1.Id,
-			petOwner:  SampleUser1.Username,
-			expectErr: true,
+			owner:           SamplePet1.Owners[0],
+			first:           1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
 		},
 		{
-			name: "pet DAO update error",
+			name: "not authorized",
 			petDao: FakePetDao{
-				updateErr: assert.AnError,
-			},
-			userDao: FakeUserDao{
-				getByUsernameUser: SampleUser1,
+				getTotalCountByOwnerValue: 1,
+				queryByOwnerPets:          []model.Pet{SamplePet1},
 			},
-			authorizer: FakePetAuthorizer{
-				IsAuthorizedResult: true,
-			},
-			petId:     SamplePet1.Id,
-			petOwner:  SampleUser1.Username,
-			expectErr: true,
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionRead},
+			owner:           SamplePet1.Owners[0],
+			first:           1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
 		},
 	}
 
-	// Run
+	// Run tests
 	for _, test := range tests {
 		// Setup
-		service := service.NewPetService(&test.petDao, &test.userDao, &test.authorizer, nil)
+		encoder := SampleEncoder
+		service := service.NewPetService(&test.petDao, nil, nil, &test.authorizer, &encoder)
 
 		// Execute
-		pet, err := service.UpdateOwner(SampleIdentity, test.petId, test.petOwner)
+		pets, err := service.ListByOwner(context.Background(), SampleIdentity, test.owner, test.first, "")
 
 		// Verify
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
-			assert.Equal(t, test.petOwner, pet.Owner)
+			assert.Equal(t, test.expectedConnection, pets, test.name)
+			assert.Equal(t, test.owner, test.petDao.queryByOwnerOwner, test.name)
+			assert.Equal(t, test.expectIncludePrivate, test.petDao.queryByOwnerIncludePrivate, test.name)
+			assert.Equal(t, test.expectIncludePrivate, test.petDao.countByOwnerIncludePrivate, test.name)
 		} else {
-			assert.NotNil(t, err, test.name)
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPetListByOwnerPrivatePets(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                 string
+		requestor            model.Identity
+		expectIncludePrivate bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:                 "owner",
+			requestor:            model.Identity{Username: SamplePet1.Owners[0]},
+			expectIncludePrivate: true,
+		},
+		{
+			name:                 "admin",
+			requestor:            model.Identity{Username: "someone else", Groups: map[string]bool{authorization.RoleAdmin.String(): true}},
+			expectIncludePrivate: true,
+		},
+		{
+			name:                 "vet",
+			requestor:            model.Identity{Username: "someone else", Groups: map[string]bool{authorization.RoleVet.String(): true}},
+			expectIncludePrivate: false,
+		},
+		{
+			name:                 "shelter staff",
+			requestor:            model.Identity{Username: "someone else", Groups: map[string]bool{authorization.RoleShelterStaff.String(): true}},
+			expectIncludePrivate: false,
+		},
+		{
+			name:                 "moderator",
+			requestor:            model.Identity{Username: "someone else", Groups: map[string]bool{authorization.RoleModerator.String(): true}},
+			expectIncludePrivate: false,
+		},
+		{
+			name:                 "another user",
+			requestor:            model.Identity{Username: "someone else"},
+			expectIncludePrivate: false,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		engine := authorization.NewPolicyEngine()
+		authorizer := authorization.NewPetAuthorizer(&engine)
+		petDao := FakePetDao{}
+		encoder := SampleEncoder
+		service := service.NewPetService(&petDao, nil, nil, &authorizer, &encoder)
+
+		// Execute
+		_, err := service.ListByOwner(context.Background(), test.requestor, SamplePet1.Owners[0], 1, "")
+
+		// Verify
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expectIncludePrivate, petDao.queryByOwnerIncludePrivate, test.name)
+		assert.Equal(t, test.expectIncludePrivate, petDao.countByOwnerIncludePrivate, test.name)
+	}
+}
+
+func TestPetRemoveOwner(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		authorizer         FakePetAuthorizer
+		petId              string
+		owner              string
+		expectedOwners     []string
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectedViolations []string
+	}
+
+	// Define tests
+	coOwnedPet := model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, Owners: []string{"User 1", "User 3"}, Version: 1}
+	tests := []Test{
+		{
+			name:           "remove a co-owner",
+			petDao:         FakePetDao{getByIdPet: coOwnedPet},
+			authorizer:     FakePetAuthorizer{deniedAction: service.PetActionRemoveLastOwner},
+			petId:          SamplePet1.Id,
+			owner:          "User 3",
+			expectedOwners: []string{"User 1"},
+			expectErr:      false,
+		},
+		{
+			name:           "remove the last owner",
+			petDao:         FakePetDao{getByIdPet: SamplePet1},
+			petId:          SamplePet1.Id,
+			owner:          SamplePet1.Owners[0],
+			expectedOwners: []string{},
+			expectErr:      false,
+		},
+		{
+			name:            "remove the last owner without being allowed to",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionRemoveLastOwner},
+			petId:           SamplePet1.Id,
+			owner:           SamplePet1.Owners[0],
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:               "missing ID and owner",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.id", "input.owner"},
+		},
+		{
+			name:               "user doesn't own the pet",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			petId:              SamplePet1.Id,
+			owner:              "User 3",
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owner"},
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			owner:           SamplePet1.Owners[0],
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "unauthorized",
+			petDao:          FakePetDao{getByIdPet: coOwnedPet},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionRemoveOwner},
+			petId:           SamplePet1.Id,
+			owner:           "User 3",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "pet DAO patch error",
+			petDao:          FakePetDao{getByIdPet: coOwnedPet, patchErr: assert.AnError},
+			petId:           SamplePet1.Id,
+			owner:           "User 3",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, &FakeUserDao{}, &test.authorizer, nil)
+
+		// Execute
+		pet, err := service.RemoveOwner(context.Background(), SampleIdentity, test.petId, test.owner, nil)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedOwners, pet.Owners, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetUpdate(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		userDao            FakeUserDao
+		authorizer         FakePetAuthorizer
+		petId              string
+		patch              model.PetPatch
+		expectedVersion    *int
+		expectedPet        model.Pet
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectedViolations []string
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:        "update name and age",
+			petDao:      FakePetDao{getByIdPet: SamplePet1},
+			petId:       SamplePet1.Id,
+			patch:       model.PetPatch{Name: pointy.String("new name"), Age: pointy.Int(3)},
+			expectedPet: model.Pet{Id: SamplePet1.Id, Name: "new name", Age: 3, Owners: SamplePet1.Owners, Version: SamplePet1.Version + 1},
+			expectErr:   false,
+		},
+		{
+			name:        "make private",
+			petDao:      FakePetDao{getByIdPet: SamplePet1},
+			petId:       SamplePet1.Id,
+			patch:       model.PetPatch{Private: pointy.Bool(true)},
+			expectedPet: model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, Age: SamplePet1.Age, Owners: SamplePet1.Owners, Private: true, Version: SamplePet1.Version + 1},
+			expectErr:   false,
+		},
+		{
+			name:            "make private without being allowed to (e.g. a vet)",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionUpdatePrivacy},
+			petId:           SamplePet1.Id,
+			patch:           model.PetPatch{Name: pointy.String("new name"), Private: pointy.Bool(true)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:               "invalid fields",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			patch:              model.PetPatch{Name: pointy.String(""), Age: pointy.Int(-1)},
+			expectedVersion:    pointy.Int(0),
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.id", "input.name", "input.age", "input.expectedVersion"},
+		},
+		{
+			name:               "invalid species and breed, and birth date given with age",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			petId:              SamplePet1.Id,
+			patch:              model.PetPatch{Species: (*model.Species)(pointy.String("DRAGON")), Breed: pointy.String(strings.Repeat("a", 51)), BirthDate: pointy.String("2020-01-02"), Age: pointy.Int(3)},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.species", "input.breed", "input.age"},
+		},
+		{
+			name:               "age on a pet with a birth date",
+			petDao:             FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, BirthDate: "2020-01-02", Version: 1}},
+			petId:              SamplePet1.Id,
+			patch:              model.PetPatch{Age: pointy.Int(3)},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.age"},
+		},
+		{
+			name:               "owners can't be changed",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			petId:              SamplePet1.Id,
+			patch:              model.PetPatch{Name: pointy.String("new name"), Owners: &[]string{SampleUser2.Username}},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owners"},
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			patch:           model.PetPatch{Age: pointy.Int(3)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "unauthorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			petId:           SamplePet1.Id,
+			patch:           model.PetPatch{Age: pointy.Int(3)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "expected version is stale",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			patch:           model.PetPatch{Age: pointy.Int(3)},
+			expectedVersion: pointy.Int(SamplePet1.Version + 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "pet DAO patch error",
+			petDao:          FakePetDao{getByIdPet: SamplePet1, patchErr: assert.AnError},
+			petId:           SamplePet1.Id,
+			patch:           model.PetPatch{Age: pointy.Int(3)},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetService(&test.petDao, nil, &test.userDao, &test.authorizer, nil)
+
+		// Execute
+		pet, err := service.Update(context.Background(), SampleIdentity, test.petId, test.patch, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPet, pet, test.name)
+			assert.Equal(t, SampleIdentity.Username, test.petDao.changedBy, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
 		}
 	}
 }
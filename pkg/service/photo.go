@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/mcwiet/go-test/pkg/validation"
+)
+
+type PhotoDao interface {
+	DeleteByPrefix(ctx context.Context, prefix string) error
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	PresignDownload(ctx context.Context, key string, expiry time.Duration) (string, error)
+	PresignUpload(ctx context.Context, key string, contentType string, contentLength int64, expiry time.Duration) (string, error)
+}
+
+// Object containing data needed to use the Photo service
+type PhotoService struct {
+	authorizer Authorizer
+	petDao     PetDao
+	photoDao   PhotoDao
+}
+
+const (
+	photoUploadExpiry   = 15 * time.Minute
+	photoDownloadExpiry = time.Hour
+	// Maximum number of pets whose photos are listed at the same time
+	photoListConcurrency = 10
+)
+
+// Creates a Photo service object
+func NewPhotoService(petDao PetDao, photoDao PhotoDao, authorizer Authorizer) PhotoService {
+	return PhotoService{
+		authorizer: authorizer,
+		petDao:     petDao,
+		photoDao:   photoDao,
+	}
+}
+
+// Lists the photos stored for a pet, each with a URL for downloading it
+func (s *PhotoService) ListByPet(ctx context.Context, petId string) (photos []model.PetPhoto, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListByPet")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("petId", petId)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err = trace(ctx, "PhotoDao.ListKeys", func(ctx context.Context) (err error) {
+		keys, err = s.photoDao.ListKeys(ctx, petPhotoPrefix(petId))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	photos = []model.PetPhoto{}
+	err = trace(ctx, "PhotoDao.PresignDownload", func(ctx context.Context) error {
+		for _, key := range keys {
+			url, err := s.photoDao.PresignDownload(ctx, key, photoDownloadExpiry)
+			if err != nil {
+				return err
+			}
+			photos = append(photos, model.PetPhoto{Key: key, Url: url})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// Lists the photos of many pets at once, each pet's concurrently (photos and errors are index aligned with the pet IDs)
+func (s *PhotoService) ListByPets(ctx context.Context, petIds []string) ([][]model.PetPhoto, []error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListByPets")
+	defer span.End(nil)
+
+	photos := make([][]model.PetPhoto, len(petIds))
+	errs := make([]error, len(petIds))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, photoListConcurrency)
+	for i, petId := range petIds {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, petId string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			photos[i], errs[i] = s.ListByPet(ctx, petId)
+		}(i, petId)
+	}
+	wg.Wait()
+
+	return photos, errs
+}
+
+// Creates a URL which a new photo of a pet can be uploaded to; only those allowed to change the pet's photos get one,
+// and the upload is only accepted if it is of the given image content type and length (no larger than the photo limit)
+func (s *PhotoService) RequestUpload(ctx context.Context, requestor model.Identity, petId string, contentType string, contentLength int) (upload model.PetPhotoUpload, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.RequestUpload")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	v.Required("petId", petId)
+	validatePhotoContentType(&v, contentType)
+	v.Range("contentLength", contentLength, 1, photoMaxBytes)
+	if err := v.Err(); err != nil {
+		return model.PetPhotoUpload{}, err
+	}
+
+	var pet model.Pet
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, petId)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.PetPhotoUpload{}, apperror.NewNotFound("could not find pet ID "+petId, err).With("id", petId)
+	} else if err != nil {
+		return model.PetPhotoUpload{}, err
+	}
+
+	err = trace(ctx, "Authorizer.Authorize", func(ctx context.Context) error {
+		return s.authorizer.Authorize(ctx, requestor, pet, PetActionUploadPhoto)
+	})
+	if err != nil {
+		return model.PetPhotoUpload{}, err
+	}
+
+	key := petPhotoPrefix(petId) + uuid.NewString()
+	expiresAt := time.Now().Add(photoUploadExpiry)
+	var url string
+	err = trace(ctx, "PhotoDao.PresignUpload", func(ctx context.Context) (err error) {
+		url, err = s.photoDao.PresignUpload(ctx, key, contentType, int64(contentLength), photoUploadExpiry)
+		return err
+	})
+	if err != nil {
+		return model.PetPhotoUpload{}, err
+	}
+
+	return model.PetPhotoUpload{
+		Key:       key,
+		UploadUrl: url,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Photos of a pet are stored under a prefix of their own
+func petPhotoPrefix(petId string) string {
+	return "pets/" + petId + "/photos/"
+}
@@ -0,0 +1,249 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotoListByPet(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		photoDao        FakePhotoDao
+		petId           string
+		expectedPhotos  []model.PetPhoto
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	// Define tests
+	prefix := "pets/" + SamplePet1.Id + "/photos/"
+	tests := []Test{
+		{
+			name:     "pet with photos",
+			photoDao: FakePhotoDao{listKeys: []string{prefix + "a", prefix + "b"}},
+			petId:    SamplePet1.Id,
+			expectedPhotos: []model.PetPhoto{
+				{Key: prefix + "a", Url: "https://download/" + prefix + "a"},
+				{Key: prefix + "b", Url: "https://download/" + prefix + "b"},
+			},
+			expectErr: false,
+		},
+		{
+			name:           "pet without photos",
+			photoDao:       FakePhotoDao{listKeys: []string{}},
+			petId:          SamplePet1.Id,
+			expectedPhotos: []model.PetPhoto{},
+			expectErr:      false,
+		},
+		{
+			name:            "missing pet ID",
+			photoDao:        FakePhotoDao{},
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "photo DAO list error",
+			photoDao:        FakePhotoDao{listKeysErr: apperror.NewInternal("error listing photos", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+		{
+			name:            "photo DAO presign error",
+			photoDao:        FakePhotoDao{listKeys: []string{prefix + "a"}, presignErr: apperror.NewInternal("error creating photo URL", nil)},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPhotoService(&FakePetDao{}, &test.photoDao, &FakePetAuthorizer{})
+
+		// Execute
+		photos, err := service.ListByPet(context.Background(), test.petId)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPhotos, photos, test.name)
+			assert.Equal(t, prefix, test.photoDao.listedPrefix, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPhotoListByPets(t *testing.T) {
+	// Setup
+	photoDao := FakePhotoDao{listKeysByPrefix: map[string][]string{
+		"pets/1/photos/": {"pets/1/photos/a"},
+		"pets/2/photos/": {},
+	}}
+	service := service.NewPhotoService(&FakePetDao{}, &photoDao, &FakePetAuthorizer{})
+
+	// Execute
+	photos, errs := service.ListByPets(context.Background(), []string{"1", "2", "3", "1"})
+
+	// Verify
+	assert.Equal(t, 4, len(photos), "photos aligned with pet IDs")
+	assert.Equal(t, 4, len(errs), "errors aligned with pet IDs")
+	assert.Equal(t, []model.PetPhoto{{Key: "pets/1/photos/a", Url: "https://download/pets/1/photos/a"}}, photos[0], "pet with photos")
+	assert.Nil(t, errs[0], "pet with photos")
+	assert.Equal(t, []model.PetPhoto{}, photos[1], "pet without photos")
+	assert.Nil(t, errs[1], "pet without photos")
+	assert.Equal(t, apperror.CodeInternal, apperror.CodeOf(errs[2]), "photo DAO list error")
+	assert.Equal(t, photos[0], photos[3], "pet asked for twice")
+}
+
+func TestPhotoRequestUpload(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name            string
+		petDao          FakePetDao
+		photoDao        FakePhotoDao
+		authorizer      FakePetAuthorizer
+		petId           string
+		contentType     string
+		contentLength   int
+		expectErr       bool
+		expectedErrCode apperror.Code
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:          "valid request",
+			petDao:        FakePetDao{getByIdPet: SamplePet1},
+			petId:         SamplePet1.Id,
+			contentType:   "image/png",
+			contentLength: 1024,
+			expectErr:     false,
+		},
+		{
+			name:            "missing pet ID",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			contentType:     "image/png",
+			contentLength:   1024,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "missing content type",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:          "photo at the size limit",
+			petDao:        FakePetDao{getByIdPet: SamplePet1},
+			petId:         SamplePet1.Id,
+			contentType:   "image/png",
+			contentLength: 10 << 20,
+			expectErr:     false,
+		},
+		{
+			name:            "missing content length",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			contentType:     "image/png",
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "photo too large",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			contentType:     "image/png",
+			contentLength:   10<<20 + 1,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "content type which isn't an image",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			contentType:     "text/html",
+			contentLength:   1024,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeValidation,
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			contentType:     "image/png",
+			contentLength:   1024,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "unauthorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			petId:           SamplePet1.Id,
+			contentType:     "image/png",
+			contentLength:   1024,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "photo DAO presign error",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			photoDao:        FakePhotoDao{presignErr: apperror.NewInternal("error creating photo URL", nil)},
+			petId:           SamplePet1.Id,
+			contentType:     "image/png",
+			contentLength:   1024,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeInternal,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPhotoService(&test.petDao, &test.photoDao, &test.authorizer)
+		before := time.Now()
+
+		// Execute
+		upload, err := service.RequestUpload(context.Background(), SampleIdentity, test.petId, test.contentType, test.contentLength)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.True(t, strings.HasPrefix(upload.Key, "pets/"+SamplePet1.Id+"/photos/"), test.name)
+			assert.Equal(t, "https://upload/"+upload.Key, upload.UploadUrl, test.name)
+			assert.Equal(t, 15*time.Minute, test.photoDao.presignExpiry, test.name)
+			assert.Equal(t, test.contentType, test.photoDao.presignContentType, test.name)
+			assert.Equal(t, int64(test.contentLength), test.photoDao.presignLength, test.name)
+			expiresAt, parseErr := time.Parse(time.RFC3339, upload.ExpiresAt)
+			assert.Nil(t, parseErr, test.name)
+			assert.WithinDuration(t, before.Add(15*time.Minute), expiresAt, 2*time.Second, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+	}
+}
+
+func TestPhotoRequestUploadKeysAreUnique(t *testing.T) {
+	// Setup
+	service := service.NewPhotoService(&FakePetDao{getByIdPet: SamplePet1}, &FakePhotoDao{}, &FakePetAuthorizer{})
+
+	// Execute
+	first, _ := service.RequestUpload(context.Background(), SampleIdentity, SamplePet1.Id, "image/jpeg", 1024)
+	second, _ := service.RequestUpload(context.Background(), SampleIdentity, SamplePet1.Id, "image/jpeg", 1024)
+
+	// Verify
+	assert.NotEqual(t, first.Key, second.Key)
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/tracing"
+)
+
+// Runs a step of a service call in a span of its own; the span ends with the step's error
+func trace(ctx context.Context, name string, step func(ctx context.Context) error) error {
+	ctx, span := tracing.Start(ctx, name)
+	err := step(ctx)
+	span.End(err)
+	return err
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/mcwiet/go-test/pkg/validation"
+)
+
+type PetTransferDao interface {
+	Delete(ctx context.Context, petId string) error
+	GetByPetId(ctx context.Context, petId string) (model.PetTransfer, error)
+	Insert(ctx context.Context, transfer model.PetTransfer) error
+	QueryByUser(ctx context.Context, username string) ([]model.PetTransfer, error)
+}
+
+// Authorizes pet actions, and actions on pending transfers with the transfer itself as the resource
+type PetTransferAuthorizer interface {
+	Authorizer
+	AuthorizeTransfer(context.Context, model.Identity, model.PetTransfer, PetAction) error
+}
+
+// Object containing data needed to use the Pet Transfer service
+type PetTransferService struct {
+	authorizer  PetTransferAuthorizer
+	petDao      PetDao
+	transferDao PetTransferDao
+	userDao     UserDao
+}
+
+// Creates a Pet Transfer service object
+func NewPetTransferService(petDao PetDao, transferDao PetTransferDao, userDao UserDao, authorizer PetTransferAuthorizer) PetTransferService {
+	return PetTransferService{
+		authorizer:  authorizer,
+		petDao:      petDao,
+		transferDao: transferDao,
+		userDao:     userDao,
+	}
+}
+
+// Accepts a pending transfer, making the requestor (who must be the recipient) an owner of the pet in the sender's place;
+// any other owners keep the pet, unless the transfer replaces every owner, and the sender keeps it too if the transfer
+// only adds the recipient to the owners
+//
+// A transfer from one of the owners is only accepted if the sender still owns the pet, and one adding an owner only if
+// the pet has room for another; a transfer which can't be carried out is removed
+func (s *PetTransferService) Accept(ctx context.Context, requestor model.Identity, petId string) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.Accept")
+	defer func() { span.End(err) }()
+
+	transfer, err := s.findAsRecipient(ctx, requestor, petId, PetActionAcceptTransfer)
+	if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, petId)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		s.remove(ctx, petId)
+		return model.Pet{}, apperror.NewNotFound("could not find pet ID "+petId, err).With("id", petId)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+	if !transfer.ReplacesOwners && !transfer.AddsOwner && !pet.HasOwner(transfer.Sender) {
+		s.remove(ctx, petId)
+		return model.Pet{}, apperror.NewConflict("sender no longer owns the pet", nil)
+	}
+	if transfer.AddsOwner && len(pet.Owners) >= petOwnersMax {
+		s.remove(ctx, petId)
+		return model.Pet{}, apperror.NewConflict("pet already has the most owners allowed", nil)
+	}
+
+	// The transfer is claimed before the owner changes, so a transfer canceled or declined in the meantime is never
+	// carried out
+	err = s.remove(ctx, petId)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.Pet{}, newTransferNotFound(petId, err)
+	} else if err != nil {
+		return model.Pet{}, err
+	}
+
+	err = trace(ctx, "PetDao.Patch", func(ctx context.Context) (err error) {
+		owners := []string{transfer.Recipient}
+		if !transfer.ReplacesOwners {
+			for _, owner := range pet.Owners {
+				if owner != transfer.Sender || transfer.AddsOwner {
+					owners = append(owners, owner)
+				}
+			}
+		}
+		pet, err = s.petDao.Patch(ctx, petId, pet.Version, model.PetPatch{Owners: &owners}, requestor.Username)
+		return err
+	})
+	if err != nil {
+		// Put the transfer back so it can be accepted again once the pet can be changed; if that fails too, the transfer
+		// is lost (the sender has to request it again), which is logged while the patch error is returned
+		insertErr := trace(ctx, "PetTransferDao.Insert", func(ctx context.Context) error {
+			return s.transferDao.Insert(ctx, transfer)
+		})
+		if insertErr != nil {
+			logging.FromContext(ctx).Error("could not put back pet transfer", insertErr, logging.Fields{"petId": petId, "patchError": err.Error()})
+		}
+		return model.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+// Cancels a pending transfer; only the sender, or someone allowed to transfer the pet, may cancel it
+func (s *PetTransferService) Cancel(ctx context.Context, requestor model.Identity, petId string) (err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.Cancel")
+	defer func() { span.End(err) }()
+
+	transfer, err := s.find(ctx, petId)
+	if err != nil {
+		return err
+	}
+
+	if requestor.Username != transfer.Sender {
+		var pet model.Pet
+		err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+			pet, err = s.petDao.GetById(ctx, petId)
+			return err
+		})
+		if err != nil && !apperror.Is(err, apperror.CodeNotFound) {
+			return err
+		}
+		// A transfer of a pet which no longer exists is checked against a pet without an owner
+		err = trace(ctx, "Authorizer.Authorize", func(ctx context.Context) error {
+			return s.authorizer.Authorize(ctx, requestor, pet, PetActionTransfer)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.remove(ctx, petId)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return newTransferNotFound(petId, err)
+	}
+	return err
+}
+
+// Declines a pending transfer; only the recipient may decline it
+func (s *PetTransferService) Decline(ctx context.Context, requestor model.Identity, petId string) (err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.Decline")
+	defer func() { span.End(err) }()
+
+	_, err = s.findAsRecipient(ctx, requestor, petId, PetActionDeclineTransfer)
+	if err != nil {
+		return err
+	}
+
+	err = s.remove(ctx, petId)
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return newTransferNotFound(petId, err)
+	}
+	return err
+}
+
+// Lists the pending transfers the requestor sent or received, oldest first
+func (s *PetTransferService) ListPending(ctx context.Context, requestor model.Identity) (transfers []model.PetTransfer, err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.ListPending")
+	defer func() { span.End(err) }()
+
+	err = trace(ctx, "PetTransferDao.QueryByUser", func(ctx context.Context) (err error) {
+		transfers, err = s.transferDao.QueryByUser(ctx, requestor.Username)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].RequestedAt != transfers[j].RequestedAt {
+			return transfers[i].RequestedAt < transfers[j].RequestedAt
+		}
+		return transfers[i].PetId < transfers[j].PetId
+	})
+	return transfers, nil
+}
+
+// Requests that the requestor's ownership of a pet be handed over to the recipient; the owners don't change until the
+// recipient accepts
+//
+// A requestor who may transfer a pet they don't own (e.g. shelter staff) hands over the whole pet: the recipient replaces
+// every owner
+func (s *PetTransferService) Request(ctx context.Context, requestor model.Identity, petId string, recipient string) (transfer model.PetTransfer, err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.Request")
+	defer func() { span.End(err) }()
+
+	_, transfer, err = s.request(ctx, requestor, petId, recipient, false, nil, "petId", "recipient")
+	return transfer, err
+}
+
+// Invites a user to join the owners of a pet, requesting a transfer which adds them to the owners (the requestor keeps
+// the pet) once they accept, and gets the pet; backs addPetOwner, which used to add the owner without their consent
+//
+// The transfer is only requested if the pet hasn't changed since the expected version (if one is given)
+func (s *PetTransferService) RequestAddOwner(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.RequestAddOwner")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet, _, err = s.request(ctx, requestor, petId, owner, true, expectedVersion, "id", "owner")
+	return pet, err
+}
+
+// Requests that the requestor's ownership of a pet be handed over to the new owner, like Request, and gets the pet
+// (which doesn't change until the new owner accepts); backs the deprecated updatePetOwner, which used to replace the
+// owners without the new owner's consent
+//
+// The transfer is only requested if the pet hasn't changed since the expected version (if one is given)
+func (s *PetTransferService) RequestOwnerUpdate(ctx context.Context, requestor model.Identity, petId string, owner string, expectedVersion *int) (pet model.Pet, err error) {
+	ctx, span := tracing.Start(ctx, "PetTransferService.RequestOwnerUpdate")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	validateExpectedVersion(&v, expectedVersion)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, err
+	}
+
+	pet, _, err = s.request(ctx, requestor, petId, owner, false, expectedVersion, "id", "owner")
+	return pet, err
+}
+
+// Stores a transfer of the pet from the requestor to the recipient (or, if it adds an owner, one inviting the recipient
+// to join the owners), getting the pet as it was when the transfer was requested; violations are reported against the
+// input's pet ID and recipient fields
+func (s *PetTransferService) request(ctx context.Context, requestor model.Identity, petId string, recipient string, addsOwner bool, expectedVersion *int, petIdField string, recipientField string) (pet model.Pet, transfer model.PetTransfer, err error) {
+	v := validation.NewValidator("input")
+	v.Required(petIdField, petId)
+	v.Required(recipientField, recipient)
+	if err := v.Err(); err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+
+	err = trace(ctx, "PetDao.GetById", func(ctx context.Context) (err error) {
+		pet, err = s.petDao.GetById(ctx, petId)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.Pet{}, model.PetTransfer{}, apperror.NewNotFound("could not find pet ID "+petId, err).With("id", petId)
+	} else if err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+	if err := checkVersion(pet, expectedVersion); err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+
+	action := PetActionTransfer
+	if addsOwner {
+		action = PetActionAddOwner
+	}
+	err = trace(ctx, "Authorizer.Authorize", func(ctx context.Context) error {
+		return s.authorizer.Authorize(ctx, requestor, pet, action)
+	})
+	if err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+
+	// Checks which depend on the stored pet (or other users) happen after authorization so callers can't probe pets
+	// they can't change
+	if pet.HasOwner(recipient) {
+		v.Add(recipientField, "already owns the pet")
+	} else if addsOwner && len(pet.Owners) >= petOwnersMax {
+		v.Add(recipientField, "pet already has the most owners allowed")
+	}
+	if err := validateUser(ctx, &v, s.userDao, recipientField, "ValidateRecipient", recipient); err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+	if err := v.Err(); err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+
+	transfer = model.PetTransfer{
+		PetId:       petId,
+		Sender:      requestor.Username,
+		Recipient:   recipient,
+		RequestedAt: time.Now().UTC().Format(time.RFC3339),
+		// Only a role lets a requestor who doesn't own the pet past authorization
+		ReplacesOwners: !addsOwner && !pet.HasOwner(requestor.Username),
+		AddsOwner:      addsOwner,
+	}
+	err = trace(ctx, "PetTransferDao.Insert", func(ctx context.Context) error {
+		return s.transferDao.Insert(ctx, transfer)
+	})
+	if apperror.Is(err, apperror.CodeConflict) {
+		return model.Pet{}, model.PetTransfer{}, apperror.NewConflict("pet already has a pending transfer; cancel it first", err).With("petId", petId)
+	} else if err != nil {
+		return model.Pet{}, model.PetTransfer{}, err
+	}
+
+	return pet, transfer, nil
+}
+
+// Gets the pending transfer of a pet, reporting a missing transfer with the pet's ID
+func (s *PetTransferService) find(ctx context.Context, petId string) (transfer model.PetTransfer, err error) {
+	v := validation.NewValidator("input")
+	v.Required("petId", petId)
+	if err := v.Err(); err != nil {
+		return model.PetTransfer{}, err
+	}
+
+	err = trace(ctx, "PetTransferDao.GetByPetId", func(ctx context.Context) (err error) {
+		transfer, err = s.transferDao.GetByPetId(ctx, petId)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		return model.PetTransfer{}, newTransferNotFound(petId, err)
+	}
+	return transfer, err
+}
+
+// Gets the pending transfer of a pet, checking the requestor may act on it as its recipient; the action is authorized
+// on the transfer itself, as it is the recipient's to answer
+func (s *PetTransferService) findAsRecipient(ctx context.Context, requestor model.Identity, petId string, action PetAction) (model.PetTransfer, error) {
+	transfer, err := s.find(ctx, petId)
+	if err != nil {
+		return model.PetTransfer{}, err
+	}
+	err = trace(ctx, "Authorizer.Authorize", func(ctx context.Context) error {
+		return s.authorizer.AuthorizeTransfer(ctx, requestor, transfer, action)
+	})
+	if err != nil {
+		return model.PetTransfer{}, err
+	}
+	return transfer, nil
+}
+
+// Deletes the pending transfer of a pet
+func (s *PetTransferService) remove(ctx context.Context, petId string) error {
+	return trace(ctx, "PetTransferDao.Delete", func(ctx context.Context) error {
+		return s.transferDao.Delete(ctx, petId)
+	})
+}
+
+func newTransferNotFound(petId string, err error) error {
+	return apperror.NewNotFound("could not find a pending transfer of pet ID "+petId, err).With("petId", petId)
+}
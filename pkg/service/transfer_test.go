@@ -0,0 +1,768 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/audit"
+	"github.com/mcwiet/go-test/pkg/authorization"
+	"github.com/mcwiet/go-test/pkg/logging"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/service"
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SampleTransfer = model.PetTransfer{
+		PetId:       SamplePet1.Id,
+		Sender:      SamplePet1.Owners[0],
+		Recipient:   SampleUser1.Username,
+		RequestedAt: "2022-01-01T00:00:00Z",
+	}
+	// Transfer from shelter staff (who don't own the pet) which hands the pet over to the recipient alone
+	SampleReplacingTransfer = model.PetTransfer{
+		PetId:          SamplePet1.Id,
+		Sender:         "Shelter Staff",
+		Recipient:      SampleUser1.Username,
+		RequestedAt:    "2022-01-01T00:00:00Z",
+		ReplacesOwners: true,
+	}
+	// Invitation from an owner for the recipient to join the owners
+	SampleAddingTransfer = model.PetTransfer{
+		PetId:       SamplePet1.Id,
+		Sender:      SamplePet1.Owners[0],
+		Recipient:   SampleUser1.Username,
+		RequestedAt: "2022-01-01T00:00:00Z",
+		AddsOwner:   true,
+	}
+	SampleSender    = model.Identity{Username: SampleTransfer.Sender}
+	SampleRecipient = model.Identity{Username: SampleTransfer.Recipient}
+)
+
+// Transfer DAO holding the sample transfer
+func newSampleTransferDao() FakePetTransferDao {
+	return FakePetTransferDao{transfers: map[string]model.PetTransfer{SampleTransfer.PetId: SampleTransfer}}
+}
+
+func TestPetTransferRequest(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name                 string
+		petDao               FakePetDao
+		transferDao          FakePetTransferDao
+		userDao              FakeUserDao
+		authorizer           FakePetAuthorizer
+		petId                string
+		recipient            string
+		expectErr            bool
+		expectedErrCode      apperror.Code
+		expectedViolations   []string
+		expectReplacesOwners bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:        "valid request",
+			petDao:      FakePetDao{getByIdPet: SamplePet1},
+			transferDao: FakePetTransferDao{},
+			userDao:     FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:       SamplePet1.Id,
+			recipient:   SampleUser1.Username,
+			expectErr:   false,
+		},
+		{
+			name:               "missing pet ID and recipient",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.petId", "input.recipient"},
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			recipient:       SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "unauthorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			authorizer:      FakePetAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			petId:           SamplePet1.Id,
+			recipient:       SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:                 "requestor allowed to transfer a pet they don't own (e.g. shelter staff)",
+			petDao:               FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Name: SamplePet1.Name, Owners: []string{"someone else"}}},
+			userDao:              FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:                SamplePet1.Id,
+			recipient:            SampleUser1.Username,
+			expectErr:            false,
+			expectReplacesOwners: true,
+		},
+		{
+			name:               "recipient already owns the pet",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			userDao:            FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:              SamplePet1.Id,
+			recipient:          SamplePet1.Owners[0],
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.recipient"},
+		},
+		{
+			name:               "recipient isn't a user",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			userDao:            FakeUserDao{getByUsernameErr: apperror.NewNotFound("user not found", nil)},
+			petId:              SamplePet1.Id,
+			recipient:          "unknown",
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.recipient"},
+		},
+		{
+			name:            "pet already has a pending transfer",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			transferDao:     newSampleTransferDao(),
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			recipient:       SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&test.petDao, &test.transferDao, &test.userDao, &test.authorizer)
+
+		// Execute
+		transfer, err := service.Request(context.Background(), SampleSender, test.petId, test.recipient)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, SamplePet1.Id, transfer.PetId, test.name)
+			assert.Equal(t, SampleSender.Username, transfer.Sender, test.name)
+			assert.Equal(t, test.recipient, transfer.Recipient, test.name)
+			assert.Equal(t, test.expectReplacesOwners, transfer.ReplacesOwners, test.name)
+			requestedAt, parseErr := time.Parse(time.RFC3339, transfer.RequestedAt)
+			assert.Nil(t, parseErr, test.name)
+			assert.WithinDuration(t, time.Now(), requestedAt, 2*time.Second, test.name)
+			assert.Equal(t, transfer, test.transferDao.transfers[SamplePet1.Id], test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetTransferShelterStaff(t *testing.T) {
+	// Setup
+	engine := authorization.NewPolicyEngine()
+	authorizer := authorization.NewPetAuthorizer(&engine)
+	staff := model.Identity{Username: "Shelter Staff", Groups: map[string]bool{authorization.RoleShelterStaff.String(): true}}
+	petDao := FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Owners: []string{"User 3", "User 4"}, Version: 1}}
+	transferDao := FakePetTransferDao{}
+	service := service.NewPetTransferService(&petDao, &transferDao, &FakeUserDao{getByUsernameUser: SampleUser1}, &authorizer)
+
+	// Execute
+	transfer, requestErr := service.Request(context.Background(), staff, SamplePet1.Id, SampleRecipient.Username)
+	pet, acceptErr := service.Accept(context.Background(), SampleRecipient, SamplePet1.Id)
+
+	// Verify
+	assert.Nil(t, requestErr, "shelter staff may transfer a pet they don't own")
+	assert.True(t, transfer.ReplacesOwners)
+	assert.Nil(t, acceptErr)
+	assert.Equal(t, []string{SampleRecipient.Username}, pet.Owners, "recipient replaces every owner")
+}
+
+func TestPetTransferRecipientDecisionsAudited(t *testing.T) {
+	// Setup
+	engine := authorization.NewPolicyEngine()
+	authorizer := authorization.NewPetAuthorizer(&engine)
+	trail := audit.NewTrail()
+	ctx := audit.NewContext(context.Background(), trail)
+	transferDao := newSampleTransferDao()
+	service := service.NewPetTransferService(&FakePetDao{getByIdPet: SamplePet1}, &transferDao, &FakeUserDao{}, &authorizer)
+
+	// Execute
+	_, acceptErr := service.Accept(ctx, SampleSender, SamplePet1.Id)
+	declineErr := service.Decline(ctx, SampleRecipient, SamplePet1.Id)
+
+	// Verify
+	assert.Equal(t, apperror.CodeForbidden, apperror.CodeOf(acceptErr), "only the recipient may accept")
+	assert.Nil(t, declineErr)
+	decisions := trail.Decisions()
+	if assert.Equal(t, 2, len(decisions)) {
+		assert.Equal(t, "pet:acceptTransfer", decisions[0].Action)
+		assert.False(t, decisions[0].Allowed)
+		assert.Equal(t, "pet:declineTransfer", decisions[1].Action)
+		assert.True(t, decisions[1].Allowed)
+		assert.Contains(t, decisions[1].Reason, "transferRecipients")
+	}
+}
+
+func TestPetTransferRequestOwnerUpdate(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		transferDao        FakePetTransferDao
+		userDao            FakeUserDao
+		petId              string
+		owner              string
+		expectedVersion    *int
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectedViolations []string
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:            "valid request",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectedVersion: pointy.Int(SamplePet1.Version),
+			expectErr:       false,
+		},
+		{
+			name:               "missing ID and owner",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.id", "input.owner"},
+		},
+		{
+			name:               "new owner isn't a user",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			petId:              SamplePet1.Id,
+			userDao:            FakeUserDao{getByUsernameErr: apperror.NewNotFound("user not found", nil)},
+			owner:              "unknown",
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owner"},
+		},
+		{
+			name:            "pet changed since the expected version",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectedVersion: pointy.Int(SamplePet1.Version + 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "pet already has a pending transfer",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			transferDao:     newSampleTransferDao(),
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&test.petDao, &test.transferDao, &test.userDao, &FakePetAuthorizer{})
+
+		// Execute
+		pet, err := service.RequestOwnerUpdate(context.Background(), SampleSender, test.petId, test.owner, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, SamplePet1, pet, "owners don't change until the new owner accepts")
+			transfer := test.transferDao.transfers[SamplePet1.Id]
+			assert.Equal(t, SampleSender.Username, transfer.Sender, test.name)
+			assert.Equal(t, test.owner, transfer.Recipient, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetTransferRequestAddOwner(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		transferDao        FakePetTransferDao
+		userDao            FakeUserDao
+		authorizer         FakePetAuthorizer
+		petId              string
+		owner              string
+		expectedVersion    *int
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectedViolations []string
+	}
+
+	// A pet with as many owners as allowed
+	crowdedPet := SamplePet1
+	crowdedPet.Owners = []string{SampleSender.Username}
+	for i := 1; i < 20; i++ {
+		crowdedPet.Owners = append(crowdedPet.Owners, fmt.Sprintf("owner-%02d", i))
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:            "valid request",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectedVersion: pointy.Int(SamplePet1.Version),
+			expectErr:       false,
+		},
+		{
+			name:               "invalid expected version",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			petId:              SamplePet1.Id,
+			owner:              SampleUser1.Username,
+			expectedVersion:    pointy.Int(0),
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.expectedVersion"},
+		},
+		{
+			name:               "missing ID and owner",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.id", "input.owner"},
+		},
+		{
+			name:               "user already owns the pet",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			userDao:            FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:              SamplePet1.Id,
+			owner:              SamplePet1.Owners[0],
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owner"},
+		},
+		{
+			name:               "pet has the most owners allowed",
+			petDao:             FakePetDao{getByIdPet: crowdedPet},
+			userDao:            FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:              crowdedPet.Id,
+			owner:              SampleUser1.Username,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owner"},
+		},
+		{
+			name:               "owner isn't a user",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			userDao:            FakeUserDao{getByUsernameErr: apperror.NewNotFound("user not found", nil)},
+			petId:              SamplePet1.Id,
+			owner:              "unknown",
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeValidation,
+			expectedViolations: []string{"input.owner"},
+		},
+		{
+			name:            "pet not found",
+			petDao:          FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:            "unauthorized",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			authorizer:      FakePetAuthorizer{deniedAction: service.PetActionAddOwner},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeForbidden,
+		},
+		{
+			name:            "pet changed since the expected version",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectedVersion: pointy.Int(SamplePet1.Version - 1),
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+		{
+			name:            "pet already has a pending transfer",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			transferDao:     newSampleTransferDao(),
+			userDao:         FakeUserDao{getByUsernameUser: SampleUser1},
+			petId:           SamplePet1.Id,
+			owner:           SampleUser1.Username,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&test.petDao, &test.transferDao, &test.userDao, &test.authorizer)
+
+		// Execute
+		pet, err := service.RequestAddOwner(context.Background(), SampleSender, test.petId, test.owner, test.expectedVersion)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, SamplePet1, pet, "owners don't change until the new owner accepts")
+			transfer := test.transferDao.transfers[SamplePet1.Id]
+			assert.Equal(t, SampleSender.Username, transfer.Sender, test.name)
+			assert.Equal(t, test.owner, transfer.Recipient, test.name)
+			assert.True(t, transfer.AddsOwner, test.name)
+			assert.False(t, transfer.ReplacesOwners, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		if test.expectedViolations != nil {
+			assert.Equal(t, test.expectedViolations, violationPaths(err), test.name)
+		}
+	}
+}
+
+func TestPetTransferAccept(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		transferDao        FakePetTransferDao
+		authorizer         FakePetAuthorizer
+		requestor          model.Identity
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectTransferKept bool
+		expectedPetOwners  []string
+		expectedPetVersion int
+	}
+
+	// Owners filling a pet up
+	crowdedOwners := []string{}
+	for i := 0; i < 20; i++ {
+		crowdedOwners = append(crowdedOwners, fmt.Sprintf("owner-%02d", i))
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:               "recipient accepts",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          false,
+			expectTransferKept: false,
+			expectedPetOwners:  []string{SampleTransfer.Recipient},
+			expectedPetVersion: SamplePet1.Version + 1,
+		},
+		{
+			name:               "recipient accepts the share of a co-owner",
+			petDao:             FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Owners: []string{SampleTransfer.Sender, "User 3"}, Version: 1}},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          false,
+			expectTransferKept: false,
+			expectedPetOwners:  model.NewOwners("User 3", SampleTransfer.Recipient),
+			expectedPetVersion: 2,
+		},
+		{
+			name:               "recipient accepts a transfer replacing every owner",
+			petDao:             FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Owners: []string{"User 3", "User 4"}, Version: 1}},
+			transferDao:        FakePetTransferDao{transfers: map[string]model.PetTransfer{SamplePet1.Id: SampleReplacingTransfer}},
+			requestor:          SampleRecipient,
+			expectErr:          false,
+			expectTransferKept: false,
+			expectedPetOwners:  []string{SampleTransfer.Recipient},
+			expectedPetVersion: 2,
+		},
+		{
+			name:               "recipient accepts an invitation to join the owners",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			transferDao:        FakePetTransferDao{transfers: map[string]model.PetTransfer{SamplePet1.Id: SampleAddingTransfer}},
+			requestor:          SampleRecipient,
+			expectErr:          false,
+			expectTransferKept: false,
+			expectedPetOwners:  model.NewOwners(SamplePet1.Owners[0], SampleTransfer.Recipient),
+			expectedPetVersion: SamplePet1.Version + 1,
+		},
+		{
+			name:               "invitation to a pet which has since reached the most owners allowed",
+			petDao:             FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Owners: crowdedOwners, Version: 1}},
+			transferDao:        FakePetTransferDao{transfers: map[string]model.PetTransfer{SamplePet1.Id: SampleAddingTransfer}},
+			requestor:          SampleRecipient,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeConflict,
+			expectTransferKept: false,
+		},
+		{
+			name:               "someone other than the recipient",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			transferDao:        newSampleTransferDao(),
+			authorizer:         FakePetAuthorizer{deniedAction: service.PetActionAcceptTransfer},
+			requestor:          SampleSender,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeForbidden,
+			expectTransferKept: true,
+		},
+		{
+			name:            "no pending transfer",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			transferDao:     FakePetTransferDao{},
+			requestor:       SampleRecipient,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+		{
+			name:               "sender no longer owns the pet",
+			petDao:             FakePetDao{getByIdPet: model.Pet{Id: SamplePet1.Id, Owners: []string{"someone else"}, Version: 4}},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeConflict,
+			expectTransferKept: false,
+		},
+		{
+			name:               "pet no longer exists",
+			petDao:             FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeNotFound,
+			expectTransferKept: false,
+		},
+		{
+			name:               "pet changed while accepting",
+			petDao:             FakePetDao{getByIdPet: SamplePet1, patchErr: apperror.NewConflict("pet has been changed", nil)},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeConflict,
+			expectTransferKept: true,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&test.petDao, &test.transferDao, &FakeUserDao{}, &test.authorizer)
+
+		// Execute
+		pet, err := service.Accept(context.Background(), test.requestor, SamplePet1.Id)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expectedPetOwners, pet.Owners, test.name)
+			assert.Equal(t, test.expectedPetVersion, pet.Version, test.name)
+			assert.Equal(t, SampleRecipient.Username, test.authorizer.authorizedTransfer.Recipient, test.name+": authorized on the transfer")
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		_, kept := test.transferDao.transfers[SamplePet1.Id]
+		assert.Equal(t, test.expectTransferKept, kept, test.name)
+	}
+}
+
+func TestPetTransferAcceptPutBackFailure(t *testing.T) {
+	// Setup
+	var buffer bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.NewLogger(&buffer))
+	petDao := FakePetDao{getByIdPet: SamplePet1, patchErr: apperror.NewConflict("pet has been changed", nil)}
+	transferDao := newSampleTransferDao()
+	transferDao.insertErr = assert.AnError
+	service := service.NewPetTransferService(&petDao, &transferDao, &FakeUserDao{}, &FakePetAuthorizer{})
+
+	// Execute
+	_, err := service.Accept(ctx, SampleRecipient, SamplePet1.Id)
+
+	// Verify
+	assert.Equal(t, apperror.CodeConflict, apperror.CodeOf(err), "patch error is returned")
+	assert.Contains(t, buffer.String(), "could not put back pet transfer")
+	assert.Contains(t, buffer.String(), assert.AnError.Error())
+	assert.Contains(t, buffer.String(), "pet has been changed")
+}
+
+func TestPetTransferDecline(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		transferDao        FakePetTransferDao
+		authorizer         FakePetAuthorizer
+		requestor          model.Identity
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectTransferKept bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:               "recipient declines",
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleRecipient,
+			expectErr:          false,
+			expectTransferKept: false,
+		},
+		{
+			name:               "someone other than the recipient",
+			transferDao:        newSampleTransferDao(),
+			authorizer:         FakePetAuthorizer{deniedAction: service.PetActionDeclineTransfer},
+			requestor:          SampleSender,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeForbidden,
+			expectTransferKept: true,
+		},
+		{
+			name:            "no pending transfer",
+			transferDao:     FakePetTransferDao{},
+			requestor:       SampleRecipient,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&FakePetDao{}, &test.transferDao, &FakeUserDao{}, &test.authorizer)
+
+		// Execute
+		err := service.Decline(context.Background(), test.requestor, SamplePet1.Id)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, SampleRecipient.Username, test.authorizer.authorizedTransfer.Recipient, test.name+": authorized on the transfer")
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		_, kept := test.transferDao.transfers[SamplePet1.Id]
+		assert.Equal(t, test.expectTransferKept, kept, test.name)
+	}
+}
+
+func TestPetTransferCancel(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		petDao             FakePetDao
+		transferDao        FakePetTransferDao
+		authorizer         FakePetAuthorizer
+		requestor          model.Identity
+		expectErr          bool
+		expectedErrCode    apperror.Code
+		expectTransferKept bool
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:               "sender cancels",
+			petDao:             FakePetDao{getByIdErr: assert.AnError}, // the pet isn't needed
+			transferDao:        newSampleTransferDao(),
+			authorizer:         FakePetAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			requestor:          SampleSender,
+			expectErr:          false,
+			expectTransferKept: false,
+		},
+		{
+			name:               "someone allowed to transfer the pet cancels",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleIdentity,
+			expectErr:          false,
+			expectTransferKept: false,
+		},
+		{
+			name:               "transfer of a pet which no longer exists",
+			petDao:             FakePetDao{getByIdErr: apperror.NewNotFound("pet not found", nil)},
+			transferDao:        newSampleTransferDao(),
+			requestor:          SampleIdentity,
+			expectErr:          false,
+			expectTransferKept: false,
+		},
+		{
+			name:               "unauthorized",
+			petDao:             FakePetDao{getByIdPet: SamplePet1},
+			transferDao:        newSampleTransferDao(),
+			authorizer:         FakePetAuthorizer{authorizeErr: apperror.NewForbidden("not authorized", nil)},
+			requestor:          SampleRecipient,
+			expectErr:          true,
+			expectedErrCode:    apperror.CodeForbidden,
+			expectTransferKept: true,
+		},
+		{
+			name:            "no pending transfer",
+			petDao:          FakePetDao{getByIdPet: SamplePet1},
+			transferDao:     FakePetTransferDao{},
+			requestor:       SampleSender,
+			expectErr:       true,
+			expectedErrCode: apperror.CodeNotFound,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		service := service.NewPetTransferService(&test.petDao, &test.transferDao, &FakeUserDao{}, &test.authorizer)
+
+		// Execute
+		err := service.Cancel(context.Background(), test.requestor, SamplePet1.Id)
+
+		// Verify
+		if !test.expectErr {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Equal(t, test.expectedErrCode, apperror.CodeOf(err), test.name)
+		}
+		_, kept := test.transferDao.transfers[SamplePet1.Id]
+		assert.Equal(t, test.expectTransferKept, kept, test.name)
+	}
+}
+
+func TestPetTransferListPending(t *testing.T) {
+	// Setup
+	older := SampleTransfer
+	older.PetId, older.RequestedAt = SamplePet2.Id, "2021-12-31T00:00:00Z"
+	transferDao := FakePetTransferDao{queryByUser: []model.PetTransfer{SampleTransfer, older}}
+	failingDao := FakePetTransferDao{queryErr: assert.AnError}
+	service1 := service.NewPetTransferService(&FakePetDao{}, &transferDao, &FakeUserDao{}, &FakePetAuthorizer{})
+	service2 := service.NewPetTransferService(&FakePetDao{}, &failingDao, &FakeUserDao{}, &FakePetAuthorizer{})
+
+	// Execute
+	transfers, err := service1.ListPending(context.Background(), SampleRecipient)
+	_, queryErr := service2.ListPending(context.Background(), SampleRecipient)
+
+	// Verify
+	assert.Nil(t, err)
+	assert.Equal(t, []model.PetTransfer{older, SampleTransfer}, transfers, "oldest first")
+	assert.NotNil(t, queryErr)
+}
@@ -1,13 +1,18 @@
 package service
 
 import (
+	"context"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/mcwiet/go-test/pkg/validation"
 )
 
 type UserDao interface {
-	GetByUsername(id string) (model.User, error)
-	GetTotalCount() (int, error)
-	List(first int, after string) ([]model.User, string, error)
+	GetByUsername(ctx context.Context, id string) (model.User, error)
+	GetTotalCount(ctx context.Context) (int, error)
+	List(ctx context.Context, first int, after string) ([]model.User, string, error)
 }
 
 type UserService struct {
@@ -23,26 +28,69 @@ func NewUserService(userDao UserDao, encoder CursorEncoder) UserService {
 }
 
 // Get a user from their username
-func (u *UserService) GetByUsername(username string) (model.User, error) {
-	user, err := u.userDao.GetByUsername(username)
+func (u *UserService) GetByUsername(ctx context.Context, username string) (user model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByUsername")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	if v.Required("username", username) {
+		v.MaxLength("username", username, usernameMaxLength)
+	}
+	if err := v.Err(); err != nil {
+		return model.User{}, err
+	}
+
+	err = trace(ctx, "UserDao.GetByUsername", func(ctx context.Context) (err error) {
+		user, err = u.userDao.GetByUsername(ctx, username)
+		return err
+	})
 	return user, err
 }
 
+// Get many users at once; duplicate usernames are only looked up once (users and errors are index aligned with the usernames)
+func (u *UserService) GetByUsernames(ctx context.Context, usernames []string) ([]model.User, []error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByUsernames")
+	defer span.End(nil)
+
+	loader := NewUserLoader(u.userDao)
+	return loader.LoadMany(ctx, usernames)
+}
+
 // Get the first N users after the provided token
-func (u *UserService) List(first int, after string) (model.UserConnection, error) {
+func (u *UserService) List(ctx context.Context, first int, after string) (connection model.UserConnection, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.List")
+	defer func() { span.End(err) }()
+
+	v := validation.NewValidator("input")
+	validateFirst(&v, first)
 	decodedToken, err := u.encoder.Decode(after)
 	if err != nil {
+		v.Add("after", "is not a valid cursor")
+	}
+	if err := v.Err(); err != nil {
 		return model.UserConnection{}, err
 	}
 
-	users, token, err := u.userDao.List(first, decodedToken)
-	if err != nil {
+	var users []model.User
+	var token string
+	err = trace(ctx, "UserDao.List", func(ctx context.Context) (err error) {
+		users, token, err = u.userDao.List(ctx, first, decodedToken)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeValidation) {
+		v.Add("after", "is not a valid cursor")
+		return model.UserConnection{}, v.Err()
+	} else if err != nil {
 		return model.UserConnection{}, err
 	}
 
 	token = u.encoder.Encode(token)
-	totalCount, err := u.userDao.GetTotalCount()
-	connection := model.UserConnection{
+	var totalCount int
+	err = trace(ctx, "UserDao.GetTotalCount", func(ctx context.Context) (err error) {
+		totalCount, err = u.userDao.GetTotalCount(ctx)
+		return err
+	})
+	connection = model.UserConnection{
 		TotalCount: totalCount,
 		Edges:      []model.UserEdge{},
 		PageInfo: model.PageInfo{
@@ -1,8 +1,10 @@
 package service_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/mcwiet/go-test/pkg/apperror"
 	"github.com/mcwiet/go-test/pkg/model"
 	"github.com/mcwiet/go-test/pkg/service"
 	"github.com/stretchr/testify/assert"
@@ -54,12 +56,20 @@ func TestUserGetByUsername(t *testing.T) {
 			username:  SampleUser1.Username,
 			expectErr: true,
 		},
+		{
+			name: "missing username",
+			userDao: FakeUserDao{
+				getByUsernameUser: SampleUser1,
+			},
+			username:  "",
+			expectErr: true,
+		},
 	}
 
 	for _, test := range tests {
 		service := service.NewUserService(&test.userDao, &SampleEncoder)
 
-		user, err := service.GetByUsername(test.username)
+		user, err := service.GetByUsername(context.Background(), test.username)
 
 		if !test.expectErr {
 			assert.Nil(t, err, test.name)
@@ -197,7 +207,7 @@ func TestUserList(t *testing.T) {
 		service := service.NewUserService(&test.userDao, &test.encoder)
 
 		// Execute
-		connection, err := service.List(test.first, test.after)
+		connection, err := service.List(context.Background(), test.first, test.after)
 
 		// Verify
 		if !test.expectErr {
@@ -208,3 +218,58 @@ func TestUserList(t *testing.T) {
 		}
 	}
 }
+
+func TestUserGetByUsernames(t *testing.T) {
+	// Setup
+	userDao := CountingUserDao{
+		users: map[string]model.User{
+			SampleUser1.Username: SampleUser1,
+			SampleUser2.Username: SampleUser2,
+		},
+	}
+	service := service.NewUserService(&userDao, &SampleEncoder)
+	usernames := []string{
+		SampleUser1.Username,
+		SampleUser2.Username,
+		SampleUser1.Username,
+		"unknown",
+		SampleUser1.Username,
+	}
+
+	// Execute
+	users, errs := service.GetByUsernames(context.Background(), usernames)
+
+	// Verify
+	assert.Equal(t, []model.User{SampleUser1, SampleUser2, SampleUser1, {}, SampleUser1}, users)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Nil(t, errs[2])
+	assert.NotNil(t, errs[3], "unknown user")
+	assert.Nil(t, errs[4])
+	assert.Equal(t, map[string]int{SampleUser1.Username: 1, SampleUser2.Username: 1, "unknown": 1}, userDao.calls, "each username is only looked up once")
+}
+
+func TestUserListReportsEveryViolation(t *testing.T) {
+	// Setup
+	encoder := FakeEncoder{decodeErr: assert.AnError}
+	service := service.NewUserService(&FakeUserDao{}, &encoder)
+
+	// Execute
+	_, err := service.List(context.Background(), -1, "not a cursor")
+
+	// Verify
+	assert.Equal(t, apperror.CodeValidation, apperror.CodeOf(err))
+	assert.Equal(t, []string{"input.first", "input.after"}, violationPaths(err))
+}
+
+func TestUserListInvalidToken(t *testing.T) {
+	// Setup
+	userDao := FakeUserDao{listErr: apperror.NewValidation("invalid pagination token", nil)}
+	service := service.NewUserService(&userDao, &SampleEncoder)
+
+	// Execute
+	_, err := service.List(context.Background(), 1, SampleEncoder.Encode("expired"))
+
+	// Verify
+	assert.Equal(t, []string{"input.after"}, violationPaths(err))
+}
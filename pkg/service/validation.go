@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/model"
+	"github.com/mcwiet/go-test/pkg/validation"
+)
+
+// Limits on input values
+const (
+	petNameMaxLength  = 50
+	petBreedMaxLength = 50
+	petAgeMin         = 0
+	petAgeMax         = 100
+	usernameMaxLength = 128 // longest username Cognito allows
+	petOwnersMax      = 20  // keeps the owner index items of a pet within a single DynamoDB transaction
+	maxPageSize       = 100
+	photoMaxBytes     = 10 << 20 // largest photo which can be uploaded
+)
+
+// Content types photos can be uploaded as
+var photoContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Checks the number of items requested for a page
+func validateFirst(v *validation.Validator, first int) {
+	v.Range("first", first, 0, maxPageSize)
+}
+
+// Checks a photo is uploaded as one of the image content types
+func validatePhotoContentType(v *validation.Validator, contentType string) {
+	if v.Required("contentType", contentType) && !photoContentTypes[contentType] {
+		v.Add("contentType", "must be image/jpeg, image/png, image/gif or image/webp")
+	}
+}
+
+// Checks a pet's name
+func validatePetName(v *validation.Validator, name string) {
+	if v.Required("name", name) {
+		v.MaxLength("name", name, petNameMaxLength)
+	}
+}
+
+// Checks a pet's age
+func validatePetAge(v *validation.Validator, age int) {
+	v.Range("age", age, petAgeMin, petAgeMax)
+}
+
+// Checks a pet's (optional) species is one of the species in the schema
+func validatePetSpecies(v *validation.Validator, species model.Species) {
+	if species != "" && !species.IsValid() {
+		v.Add("species", "is not a valid species")
+	}
+}
+
+// Checks a pet's (optional) breed
+func validatePetBreed(v *validation.Validator, breed string) {
+	v.MaxLength("breed", breed, petBreedMaxLength)
+}
+
+// Checks a pet's birth date is a YYYY-MM-DD date which isn't in the future and gives an age within the age limits
+func validatePetBirthDate(v *validation.Validator, birthDate string, now time.Time) {
+	parsed, err := time.Parse(model.DateLayout, birthDate)
+	if err != nil {
+		v.Add("birthDate", "must be a date (YYYY-MM-DD)")
+		return
+	}
+	if parsed.After(now) {
+		v.Add("birthDate", "cannot be in the future")
+		return
+	}
+	if age := (model.Pet{BirthDate: birthDate}).WithAgeOn(now).Age; age > petAgeMax {
+		v.Add("birthDate", "cannot be more than 100 years ago")
+	}
+}
+
+// Checks a new pet has either a birth date or (if its birth date isn't known) an age, but not both
+func validatePetBirthDateOrAge(v *validation.Validator, birthDate string, age *int, now time.Time) {
+	switch {
+	case birthDate != "" && age != nil:
+		v.Add("age", "cannot be given together with birthDate")
+	case birthDate != "":
+		validatePetBirthDate(v, birthDate, now)
+	case age != nil:
+		validatePetAge(v, *age)
+	default:
+		v.Add("birthDate", "is required when age isn't given")
+	}
+}
+
+// Checks an (optional) version a write expects a pet to be at
+func validateExpectedVersion(v *validation.Validator, expectedVersion *int) {
+	if expectedVersion != nil && *expectedVersion < 1 {
+		v.Add("expectedVersion", "must be at least 1")
+	}
+}
+
+// Checks every owner in a list is an existing user; only returns an error if a user can't be looked up
+func validateOwners(ctx context.Context, v *validation.Validator, userDao UserDao, owners []string) error {
+	if len(owners) > petOwnersMax {
+		v.Add("owners", fmt.Sprintf("must have at most %d owners", petOwnersMax))
+		return nil
+	}
+	for i, owner := range owners {
+		path := fmt.Sprintf("owners[%d]", i)
+		if !v.Required(path, owner) {
+			continue
+		}
+		if err := validateUser(ctx, v, userDao, path, "ValidateOwner", owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the (optional) username at the path belongs to an existing user, looking them up in a span with the given
+// name; only returns an error if the user can't be looked up
+func validateUser(ctx context.Context, v *validation.Validator, userDao UserDao, path string, spanName string, username string) error {
+	if username == "" || !v.MaxLength(path, username, usernameMaxLength) {
+		return nil
+	}
+
+	err := trace(ctx, spanName, func(ctx context.Context) error {
+		_, err := userDao.GetByUsername(ctx, username)
+		return err
+	})
+	if apperror.Is(err, apperror.CodeNotFound) {
+		v.Add(path, "is not a valid user")
+		return nil
+	}
+
+	return err
+}
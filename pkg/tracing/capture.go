@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// Span kept by a capture tracer
+type CapturedSpan struct {
+	Name     string
+	Err      error
+	Ended    bool
+	Children []*CapturedSpan
+}
+
+// Tracer which keeps every span in memory so tests can assert the span tree; safe for concurrent use
+type Capture struct {
+	mutex sync.Mutex
+	roots []*CapturedSpan
+}
+
+type captureKey struct{}
+
+type captureSpan struct {
+	capture *Capture
+	span    *CapturedSpan
+}
+
+func (c *Capture) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &CapturedSpan{Name: name}
+	c.mutex.Lock()
+	if parent, ok := ctx.Value(captureKey{}).(*CapturedSpan); ok {
+		parent.Children = append(parent.Children, span)
+	} else {
+		c.roots = append(c.roots, span)
+	}
+	c.mutex.Unlock()
+	return context.WithValue(ctx, captureKey{}, span), captureSpan{capture: c, span: span}
+}
+
+func (s captureSpan) End(err error) {
+	s.capture.mutex.Lock()
+	defer s.capture.mutex.Unlock()
+	s.span.Err = err
+	s.span.Ended = true
+}
+
+// Gets the spans which were started without a parent, in the order they were started
+func (c *Capture) Roots() []*CapturedSpan {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]*CapturedSpan{}, c.roots...)
+}
+
+// Gets the path of every span (parent names joined with " > "), parents before their children
+func (c *Capture) Paths() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	paths := []string{}
+	var walk func(prefix string, spans []*CapturedSpan)
+	walk = func(prefix string, spans []*CapturedSpan) {
+		for _, span := range spans {
+			path := prefix + span.Name
+			paths = append(paths, path)
+			walk(path+" > ", span.Children)
+		}
+	}
+	walk("", c.roots)
+	return paths
+}
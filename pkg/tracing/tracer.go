@@ -0,0 +1,48 @@
+// Package tracing splits a request into named spans of work (e.g. X-Ray subsegments); the tracer travels in the
+// request's context.Context so any layer can add spans without knowing where they are sent
+package tracing
+
+import (
+	"context"
+)
+
+// Object which starts spans; the returned context makes the new span the parent of spans started from it
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span of work which is ended once (with the error it failed with, if any)
+type Span interface {
+	End(err error)
+}
+
+type contextKey struct{}
+
+// Tracer used when the context doesn't carry one; spans are dropped
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) End(error) {}
+
+// Creates a context which carries the tracer
+func NewContext(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, contextKey{}, tracer)
+}
+
+// Gets the tracer carried by the context (or a tracer which drops spans if there isn't one)
+func FromContext(ctx context.Context) Tracer {
+	if tracer, ok := ctx.Value(contextKey{}).(Tracer); ok {
+		return tracer
+	}
+	return noopTracer{}
+}
+
+// Starts a span with the tracer carried by the context
+func Start(ctx context.Context, name string) (context.Context, Span) {
+	return FromContext(ctx).Start(ctx, name)
+}
@@ -0,0 +1,58 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-xray-sdk-go/strategy/ctxmissing"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/mcwiet/go-test/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureBuildsSpanTree(t *testing.T) {
+	// Setup
+	var capture tracing.Capture
+	ctx := tracing.NewContext(context.Background(), &capture)
+	failure := errors.New("failed")
+
+	// Execute
+	parentCtx, parent := tracing.Start(ctx, "Parent")
+	_, first := tracing.Start(parentCtx, "First")
+	first.End(nil)
+	_, second := tracing.Start(parentCtx, "Second")
+	second.End(failure)
+	parent.End(failure)
+	_, sibling := tracing.Start(ctx, "Sibling")
+	sibling.End(nil)
+
+	// Verify
+	assert.Equal(t, []string{"Parent", "Parent > First", "Parent > Second", "Sibling"}, capture.Paths())
+	roots := capture.Roots()
+	assert.True(t, roots[0].Ended)
+	assert.Equal(t, failure, roots[0].Err)
+	assert.Nil(t, roots[0].Children[0].Err)
+	assert.Equal(t, failure, roots[0].Children[1].Err)
+}
+
+func TestContextWithoutTracer(t *testing.T) {
+	// Execute
+	ctx, span := tracing.Start(context.Background(), "Dropped")
+	span.End(nil)
+
+	// Verify
+	assert.Equal(t, context.Background(), ctx, "spans are dropped when the context doesn't carry a tracer")
+}
+
+func TestXRayTracerWithoutSegment(t *testing.T) {
+	// Setup
+	xray.Configure(xray.Config{ContextMissingStrategy: ctxmissing.NewDefaultLogErrorStrategy()})
+	tracer := tracing.NewXRayTracer()
+
+	// Execute
+	_, span := tracer.Start(context.Background(), "Orphan")
+
+	// Verify
+	assert.NotPanics(t, func() { span.End(errors.New("failed")) }, "a subsegment without a parent segment is skipped")
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/mcwiet/go-test/pkg/apperror"
+)
+
+// Tracer which sends spans to X-Ray as subsegments of the segment in the context (the Lambda's segment)
+type XRayTracer struct{}
+
+type xraySpan struct {
+	segment *xray.Segment
+}
+
+// Creates an X-Ray tracer
+func NewXRayTracer() XRayTracer {
+	return XRayTracer{}
+}
+
+func (t XRayTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, segment := xray.BeginSubsegment(ctx, name)
+	return ctx, xraySpan{segment: segment}
+}
+
+// Ends the subsegment; errors the caller caused (e.g. not found) are marked as errors rather than faults
+func (s xraySpan) End(err error) {
+	if s.segment == nil {
+		// No segment was found in the context, so the subsegment was never started
+		return
+	}
+	if err != nil && apperror.CodeOf(err) != apperror.CodeInternal {
+		s.segment.Lock()
+		s.segment.Error = true
+		s.segment.Unlock()
+		err = nil
+	}
+	s.segment.Close(err)
+}
@@ -0,0 +1,85 @@
+// Package validation collects field-level violations so every problem with an input can be reported at once
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+)
+
+// Problem with a single field; the path is the argument path of the field (e.g. 'input.name')
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Object which checks fields of an argument and collects every violation
+type Validator struct {
+	argument   string
+	violations []Violation
+}
+
+// Creates a validator for the fields of an argument (e.g. 'input')
+func NewValidator(argument string) Validator {
+	return Validator{
+		argument:   argument,
+		violations: []Violation{},
+	}
+}
+
+// Adds a violation for a field
+func (v *Validator) Add(field string, message string) {
+	v.violations = append(v.violations, Violation{
+		Path:    v.argument + "." + field,
+		Message: message,
+	})
+}
+
+// Checks a field is not blank; returns whether the check passed
+func (v *Validator) Required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// Checks a field is at most max characters long; returns whether the check passed
+func (v *Validator) MaxLength(field string, value string, max int) bool {
+	if utf8.RuneCountInString(value) > max {
+		v.Add(field, "must be at most "+strconv.Itoa(max)+" characters")
+		return false
+	}
+	return true
+}
+
+// Checks a field is between min and max (inclusive); returns whether the check passed
+func (v *Validator) Range(field string, value int, min int, max int) bool {
+	if value < min || value > max {
+		v.Add(field, "must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+		return false
+	}
+	return true
+}
+
+// Gets every violation found so far
+func (v *Validator) Violations() []Violation {
+	return append([]Violation{}, v.violations...)
+}
+
+// Gets a validation error listing every violation (nil if there are none)
+func (v *Validator) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	problems := []string{}
+	for _, violation := range v.violations {
+		problems = append(problems, violation.Path+" "+violation.Message)
+	}
+
+	return apperror.NewValidation("invalid "+v.argument+": "+strings.Join(problems, "; "), nil).
+		With("violations", v.Violations())
+}
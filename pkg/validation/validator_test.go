@@ -0,0 +1,91 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/mcwiet/go-test/pkg/apperror"
+	"github.com/mcwiet/go-test/pkg/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorRules(t *testing.T) {
+	// Define test struct
+	type Test struct {
+		name               string
+		validate           func(*validation.Validator) bool
+		expectedPass       bool
+		expectedViolations []validation.Violation
+	}
+
+	// Define tests
+	tests := []Test{
+		{
+			name:         "required - has value",
+			validate:     func(v *validation.Validator) bool { return v.Required("name", "Levi") },
+			expectedPass: true,
+		},
+		{
+			name:               "required - blank",
+			validate:           func(v *validation.Validator) bool { return v.Required("name", "  ") },
+			expectedPass:       false,
+			expectedViolations: []validation.Violation{{Path: "input.name", Message: "is required"}},
+		},
+		{
+			name:         "max length - multi-byte characters count once",
+			validate:     func(v *validation.Validator) bool { return v.MaxLength("name", "ééé", 3) },
+			expectedPass: true,
+		},
+		{
+			name:               "max length - too long",
+			validate:           func(v *validation.Validator) bool { return v.MaxLength("name", "abcd", 3) },
+			expectedPass:       false,
+			expectedViolations: []validation.Violation{{Path: "input.name", Message: "must be at most 3 characters"}},
+		},
+		{
+			name:         "range - at bounds",
+			validate:     func(v *validation.Validator) bool { return v.Range("age", 0, 0, 10) && v.Range("age", 10, 0, 10) },
+			expectedPass: true,
+		},
+		{
+			name:               "range - below min",
+			validate:           func(v *validation.Validator) bool { return v.Range("age", -1, 0, 10) },
+			expectedPass:       false,
+			expectedViolations: []validation.Violation{{Path: "input.age", Message: "must be between 0 and 10"}},
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		// Setup
+		validator := validation.NewValidator("input")
+
+		// Execute
+		pass := test.validate(&validator)
+
+		// Verify
+		assert.Equal(t, test.expectedPass, pass, test.name)
+		if test.expectedPass {
+			assert.Nil(t, validator.Err(), test.name)
+		} else {
+			assert.Equal(t, test.expectedViolations, validator.Violations(), test.name)
+		}
+	}
+}
+
+func TestValidatorErrListsEveryViolation(t *testing.T) {
+	// Setup
+	validator := validation.NewValidator("input")
+	validator.Required("name", "")
+	validator.Range("age", 200, 0, 100)
+
+	// Execute
+	err := validator.Err()
+
+	// Verify
+	assert.Equal(t, apperror.CodeValidation, apperror.CodeOf(err))
+	assert.Equal(t, "invalid input: input.name is required; input.age must be between 0 and 100", err.Error())
+	assert.Equal(t, []validation.Violation{
+		{Path: "input.name", Message: "is required"},
+		{Path: "input.age", Message: "must be between 0 and 100"},
+	}, apperror.InfoOf(err)["violations"])
+}
@@ -1,7 +1,9 @@
 package integration_test
 
 import (
+	"bytes"
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/machinebox/graphql"
@@ -16,18 +18,34 @@ func TestPetApi(t *testing.T) {
 	pet1 := createPet(t)
 	pet2 := createPet(t)
 
-	// List the pets
+	// List the pets, then only the test user's
 	listPets(t)
+	listMyPets(t, pet1)
 
 	// Get a pet
 	getPet(t, pet1.Id, &pet1)
 
-	// Update the pet owner
-	updatePetOwner(t, pet1, "")
+	// Upload a photo of the pet (while the test user still owns it)
+	uploadPetPhoto(t, pet1)
 
-	// Delete the pets
-	deletePet(t, &pet1)
-	deletePet(t, &pet2)
+	// Update the pet, then try again with the version it had before the update
+	updatePet(t, pet1)
+	updatePetWithStaleVersion(t, pet1)
+
+	// List the versions of the pet
+	listPetHistory(t, pet1)
+
+	// Try to leave the pet without owners (only admins may)
+	removeLastPetOwner(t, pet1)
+
+	// Delete a pet (it is hidden until restored)
+	deletePet(t, &pet1, false)
+	getPet(t, pet1.Id, nil)
+	restorePet(t, pet1)
+
+	// Delete the pets for good
+	deletePet(t, &pet1, true)
+	deletePet(t, &pet2, true)
 
 	// Attempt to get a pet again
 	getPet(t, pet1.Id, nil)
@@ -39,20 +57,21 @@ func createPet(t *testing.T) model.Pet {
 	petAge := 10
 	petOwner := UserToken.Username
 	request := graphql.NewRequest(`
-		mutation ($name: String!, $age: Int!, $owner: String) {
-			createPet (input: { name: $name, age: $age, owner: $owner }) {
+		mutation ($name: String!, $age: Int!, $owners: [String!]) {
+			createPet (input: { name: $name, age: $age, owners: $owners }) {
 				pet {
 					id
 					name
 					age
-					owner
+					owners
+					version
 				}
 			}
 		}
 	`)
 	request.Var("name", petName)
 	request.Var("age", petAge)
-	request.Var("owner", petOwner)
+	request.Var("owners", []string{petOwner})
 	request.Header.Set("Authorization", UserToken.IdTokenString)
 
 	// Execute
@@ -71,21 +90,23 @@ func createPet(t *testing.T) model.Pet {
 	assert.NotNil(t, pet.Id, stepName+"id should exist")
 	assert.Equal(t, petName, pet.Name, stepName+"name should match")
 	assert.Equal(t, petAge, pet.Age, stepName+"age should match")
-	assert.Equal(t, petOwner, pet.Owner, stepName+"owner should match")
+	assert.Equal(t, []string{petOwner}, pet.Owners, stepName+"owners should match")
+	assert.Equal(t, 1, pet.Version, stepName+"version should start at 1")
 
 	return pet
 }
 
-func deletePet(t *testing.T, pet *model.Pet) {
+func deletePet(t *testing.T, pet *model.Pet, purge bool) {
 	// Setup
 	request := graphql.NewRequest(`
-		mutation ($id: ID!) {
-			deletePet (input: { id: $id }) {
+		mutation ($id: ID!, $purge: Boolean) {
+			deletePet (input: { id: $id, purge: $purge }) {
 				id
 			}
 		}
 	`)
 	request.Var("id", pet.Id)
+	request.Var("purge", purge)
 	request.Header.Set("Authorization", UserToken.IdTokenString)
 
 	// Execute
@@ -97,6 +118,93 @@ func deletePet(t *testing.T, pet *model.Pet) {
 	assert.Nil(t, err, stepName+": should not error")
 }
 
+func restorePet(t *testing.T, pet model.Pet) {
+	// Setup
+	request := graphql.NewRequest(`
+		mutation ($id: ID!) {
+			restorePet (input: { id: $id }) {
+				pet {
+					id
+					deletedAt
+				}
+			}
+		}
+	`)
+	request.Var("id", pet.Id)
+	request.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var response map[string]interface{}
+	err := GraphQlClient.Run(context.Background(), request, &response)
+	var payload model.RestorePetPayload
+	mapstructure.Decode(response["restorePet"], &payload)
+
+	// Verify
+	stepName := "restorePet"
+	assert.Nil(t, err, stepName+": should not error")
+	assert.Equal(t, pet.Id, payload.Pet.Id, stepName+": should restore the pet")
+	assert.Equal(t, "", payload.Pet.DeletedAt, stepName+": should no longer be deleted")
+}
+
+func uploadPetPhoto(t *testing.T, pet model.Pet) {
+	// Setup
+	uploadRequest := graphql.NewRequest(`
+		mutation ($petId: ID!, $contentLength: Int!) {
+			requestPetPhotoUpload (input: { petId: $petId, contentType: "image/png", contentLength: $contentLength }) {
+				photoUpload {
+					key
+					uploadUrl
+					expiresAt
+				}
+			}
+		}
+	`)
+	photo := []byte("photo")
+	uploadRequest.Var("petId", pet.Id)
+	uploadRequest.Var("contentLength", len(photo))
+	uploadRequest.Header.Set("Authorization", UserToken.IdTokenString)
+	photosRequest := graphql.NewRequest(`
+		query ($id: ID!) {
+			pet (input: { id: $id }) {
+				photos {
+					key
+					url
+				}
+			}
+		}
+	`)
+	photosRequest.Var("id", pet.Id)
+	photosRequest.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var uploadResponse map[string]interface{}
+	uploadErr := GraphQlClient.Run(context.Background(), uploadRequest, &uploadResponse)
+	var payload model.RequestPetPhotoUploadPayload
+	mapstructure.Decode(uploadResponse["requestPetPhotoUpload"], &payload)
+	putRequest, _ := http.NewRequest(http.MethodPut, payload.PhotoUpload.UploadUrl, bytes.NewReader(photo))
+	putRequest.Header.Set("Content-Type", "image/png")
+	putResponse, putErr := http.DefaultClient.Do(putRequest)
+	var photosResponse map[string]interface{}
+	photosErr := GraphQlClient.Run(context.Background(), photosRequest, &photosResponse)
+	var photosPet struct{ Photos []model.PetPhoto }
+	mapstructure.Decode(photosResponse["pet"], &photosPet)
+
+	// Verify
+	stepName := "uploadPetPhoto"
+	assert.Nil(t, uploadErr, stepName+": should not error requesting an upload")
+	assert.Nil(t, putErr, stepName+": should not error uploading")
+	if putErr == nil {
+		assert.Equal(t, http.StatusOK, putResponse.StatusCode, stepName+": should accept the upload")
+		putResponse.Body.Close()
+	}
+	assert.Nil(t, photosErr, stepName+": should not error listing photos")
+	assert.Equal(t, 1, len(photosPet.Photos), stepName+": should list the uploaded photo")
+	if len(photosPet.Photos) == 1 {
+		assert.Equal(t, payload.PhotoUpload.Key, photosPet.Photos[0].Key, stepName+": should list the uploaded photo")
+		assert.NotEmpty(t, photosPet.Photos[0].Url, stepName+": should have a download URL")
+	}
+}
+
 func getPet(t *testing.T, id string, expectedPet *model.Pet) {
 	// Setup
 	request := graphql.NewRequest(`
@@ -105,7 +213,8 @@ func getPet(t *testing.T, id string, expectedPet *model.Pet) {
 				id
 				name
 				age
-				owner
+				owners
+				version
 			}
 		}
 	`)
@@ -129,6 +238,79 @@ func getPet(t *testing.T, id string, expectedPet *model.Pet) {
 	}
 }
 
+func listPetHistory(t *testing.T, pet model.Pet) {
+	// Setup
+	request := graphql.NewRequest(`
+		query ($id: ID!) {
+			petHistory (input: { id: $id, first: 10 }) {
+				totalCount
+				edges {
+					node {
+						version
+						changedBy
+						changedAt
+					}
+				}
+			}
+		}
+	`)
+	request.Var("id", pet.Id)
+	request.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var response map[string]interface{}
+	err := GraphQlClient.Run(context.Background(), request, &response)
+	var connection model.PetConnection
+	mapstructure.Decode(response["petHistory"], &connection)
+
+	// Verify
+	stepName := "listPetHistory"
+	assert.Nil(t, err, stepName+": should not error")
+	assert.Equal(t, 2, connection.TotalCount, stepName+": should have the created and updated versions")
+	if len(connection.Edges) != 2 {
+		assert.Fail(t, stepName+": should return 2 versions")
+		return
+	}
+	assert.Equal(t, pet.Version+1, connection.Edges[0].Node.Version, stepName+": should return the newest version first")
+	assert.Equal(t, UserToken.Username, connection.Edges[0].Node.ChangedBy, stepName+": should record who changed the pet")
+	assert.NotEmpty(t, connection.Edges[0].Node.ChangedAt, stepName+": should record when the pet changed")
+}
+
+func listMyPets(t *testing.T, pet model.Pet) {
+	// Setup
+	request := graphql.NewRequest(`
+		query {
+			myPets (input: { first: 100 }) {
+				totalCount
+				edges {
+					node {
+						id
+						owners
+					}
+				}
+			}
+		}
+	`)
+	request.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var response map[string]interface{}
+	err := GraphQlClient.Run(context.Background(), request, &response)
+	var connection model.PetConnection
+	mapstructure.Decode(response["myPets"], &connection)
+
+	// Verify
+	stepName := "listMyPets"
+	assert.Nil(t, err, stepName+": should not error")
+	assert.GreaterOrEqual(t, connection.TotalCount, len(connection.Edges), stepName+": should count every pet listed")
+	ids := []string{}
+	for _, edge := range connection.Edges {
+		assert.Contains(t, edge.Node.Owners, UserToken.Username, stepName+": should only list the user's pets")
+		ids = append(ids, edge.Node.Id)
+	}
+	assert.Contains(t, ids, pet.Id, stepName+": should list the created pet")
+}
+
 func listPets(t *testing.T) {
 	// Setup
 	request := graphql.NewRequest(`
@@ -169,31 +351,85 @@ func listPets(t *testing.T) {
 	assert.Equal(t, true, connection.PageInfo.HasNextPage, stepName+": should have next page")
 }
 
-func updatePetOwner(t *testing.T, pet model.Pet, newOwner string) {
+func removeLastPetOwner(t *testing.T, pet model.Pet) {
 	// Setup
 	request := graphql.NewRequest(`
 		mutation ($id: ID!, $owner: String!) {
-			updatePetOwner (input: { id: $id, owner: $owner }) {
+			removePetOwner (input: { id: $id, owner: $owner }) {
+				pet {
+					id
+					owners
+				}
+			}
+		}
+	`)
+	request.Var("id", pet.Id)
+	request.Var("owner", UserToken.Username)
+	request.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var response map[string]interface{}
+	err := GraphQlClient.Run(context.Background(), request, &response)
+
+	// Verify
+	stepName := "removeLastPetOwner"
+	assert.NotNil(t, err, stepName+": should not allow a non-admin to leave the pet without owners")
+}
+
+func updatePet(t *testing.T, pet model.Pet) {
+	// Setup
+	request := graphql.NewRequest(`
+		mutation ($id: ID!, $age: Int, $expectedVersion: Int) {
+			updatePet (input: { id: $id, age: $age, expectedVersion: $expectedVersion }) {
 				pet {
 					id
-					owner
+					name
+					age
+					version
 				}
 			}
 		}
 	`)
 	request.Var("id", pet.Id)
-	request.Var("owner", newOwner)
+	request.Var("age", pet.Age+1)
+	request.Var("expectedVersion", pet.Version)
 	request.Header.Set("Authorization", UserToken.IdTokenString)
 
 	// Execute
 	var response map[string]interface{}
 	err := GraphQlClient.Run(context.Background(), request, &response)
-	var updatedPet model.UpdatePetOwnerPayload
-	mapstructure.Decode(response["updatePetOwner"], &updatedPet)
+	var payload model.UpdatePetPayload
+	mapstructure.Decode(response["updatePet"], &payload)
 
 	// Verify
-	stepName := "updatePetOwner"
+	stepName := "updatePet"
 	assert.Nil(t, err, stepName+": should not error")
-	assert.NotEqual(t, pet.Owner, newOwner, stepName+": new owner should not match current owner")
-	assert.Equal(t, newOwner, updatedPet.Pet.Owner, stepName+": should should update the owner")
+	assert.Equal(t, pet.Age+1, payload.Pet.Age, stepName+": should update the age")
+	assert.Equal(t, pet.Name, payload.Pet.Name, stepName+": should leave the name unchanged")
+	assert.Equal(t, pet.Version+1, payload.Pet.Version, stepName+": should increment the version")
+}
+
+func updatePetWithStaleVersion(t *testing.T, pet model.Pet) {
+	// Setup
+	request := graphql.NewRequest(`
+		mutation ($id: ID!, $age: Int, $expectedVersion: Int) {
+			updatePet (input: { id: $id, age: $age, expectedVersion: $expectedVersion }) {
+				pet {
+					id
+				}
+			}
+		}
+	`)
+	request.Var("id", pet.Id)
+	request.Var("age", pet.Age)
+	request.Var("expectedVersion", pet.Version)
+	request.Header.Set("Authorization", UserToken.IdTokenString)
+
+	// Execute
+	var response map[string]interface{}
+	err := GraphQlClient.Run(context.Background(), request, &response)
+
+	// Verify
+	stepName := "updatePetWithStaleVersion"
+	assert.NotNil(t, err, stepName+": should error with a version conflict")
 }